@@ -0,0 +1,75 @@
+package haraqafs
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// chunkTarget is how long adaptive chunks aim to take to write, long enough to amortise each call
+// and short enough that a slow volume doesn't stall repairs or cancellation for long
+const chunkTarget = 100 * time.Millisecond
+
+// chunkSizer sizes copy chunks from the write throughput seen on each volume
+type chunkSizer struct {
+	min, max int
+	mu       sync.Mutex
+	rates    map[int]int64 // bytes per second per replica, -1 for writes to every replica at once
+}
+
+// WithAdaptiveChunks sizes the chunks repairs, heals and ReadFrom copy between min and max bytes from the throughput
+// seen on each volume, so slow network volumes get small chunks which bound stalls and fast local disks get large ones
+func WithAdaptiveChunks(min, max int) FileOption {
+	return func(f *File) error {
+		if min <= 0 || max < min {
+			return fmt.Errorf("adaptive chunks need 0 < min <= max, got %d and %d: %w", min, max, os.ErrInvalid)
+		}
+		f.chunks = &chunkSizer{min: min, max: max, rates: make(map[int]int64)}
+		return nil
+	}
+}
+
+// chunkFor returns buf resized for the next chunk copied to replica i, or to every replica when i is -1.
+// without adaptive chunks every chunk is fixed bytes
+func (f *File) chunkFor(buf []byte, i, fixed int) []byte {
+	size := fixed
+	if c := f.chunks; c != nil {
+		size = c.min
+		if rate := c.rate(i); rate > 0 {
+			size = int(rate * int64(chunkTarget) / int64(time.Second))
+		}
+		if size < c.min {
+			size = c.min
+		}
+		if size > c.max {
+			size = c.max
+		}
+	}
+	if cap(buf) < size {
+		return make([]byte, size)
+	}
+	return buf[:size]
+}
+
+// copied records that n bytes took d to write to replica i, or to every replica when i is -1
+func (f *File) copied(i, n int, d time.Duration) {
+	c := f.chunks
+	if c == nil || d <= 0 {
+		return
+	}
+	rate := int64(float64(n) / d.Seconds())
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if old := c.rates[i]; old > 0 {
+		// a moving average, so one hiccup doesn't swing the chunk size
+		rate = old + (rate-old)/4
+	}
+	c.rates[i] = rate
+}
+
+func (c *chunkSizer) rate(i int) int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.rates[i]
+}
@@ -0,0 +1,56 @@
+package haraqafs
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWithAdaptiveChunks(t *testing.T) {
+	volumes := newTmpVolumes(t, 3)
+	defer removeVolumes(volumes)
+	for _, opt := range []FileOption{WithAdaptiveChunks(0, 1), WithAdaptiveChunks(2, 1)} {
+		if _, err := New("my_file", WithVolumes(volumes...), WithCreate(), opt); !errors.Is(err, os.ErrInvalid) {
+			t.Fatal(err)
+		}
+	}
+
+	f, err := New("my_file", WithVolumes(volumes...), WithCreate())
+	checkErr(t, err)
+	if buf := f.chunkFor(nil, 0, 1e6); len(buf) != 1e6 {
+		t.Fatal(len(buf))
+	}
+	checkClose(t, f)
+
+	f, err = New("my_file", WithVolumes(volumes...), WithCreate(), WithAdaptiveChunks(4096, 1<<20))
+	checkErr(t, err)
+	if buf := f.chunkFor(nil, 0, 1e6); len(buf) != 4096 {
+		t.Fatal(len(buf))
+	}
+	// fast volumes get the largest chunks, slow ones the smallest
+	f.copied(0, 1<<20, 10*time.Millisecond)
+	f.copied(1, 1000, time.Second)
+	f.copied(2, 1<<20, time.Second)
+	for i, want := range []int{1 << 20, 4096, 1 << 20 / 10} {
+		if buf := f.chunkFor(nil, i, 1e6); len(buf) != want {
+			t.Fatal(i, len(buf))
+		}
+	}
+	data := bytes.Repeat([]byte("a"), 100000)
+	checkWrite(t, f, data)
+	checkClose(t, f)
+
+	// repairs still copy everything
+	checkErr(t, os.Remove(filepath.Join(volumes[0], "my_file")))
+	f, err = New("my_file", WithVolumes(volumes...), WithAdaptiveChunks(4096, 1<<20))
+	checkErr(t, err)
+	checkClose(t, f)
+	b, err := os.ReadFile(filepath.Join(volumes[0], "my_file"))
+	checkErr(t, err)
+	if !bytes.Equal(b, data) {
+		t.Fatal(len(b))
+	}
+}
@@ -0,0 +1,64 @@
+package haraqafs
+
+import (
+	"context"
+	"fmt"
+)
+
+// WithAsyncRepair lets New return before divergent replicas are repaired. reads and writes go to the replicas which
+// agree with the source of truth while the rest are copied over in the background, see RepairDone and WaitRepair
+func WithAsyncRepair() FileOption {
+	return func(f *File) error {
+		f.asyncRepair = true
+		return nil
+	}
+}
+
+// deferRepair takes the replicas which disagree with the source at index off the synchronous path until startRepair heals them
+func (f *File) deferRepair(lagging []int, index int) error {
+	for _, i := range lagging {
+		if i == index {
+			continue
+		}
+		if err := f.holdBack(i, fmt.Errorf("replica %s is repaired in the background", f.paths[i])); err != nil {
+			return err
+		}
+		f.deferred = append(f.deferred, i)
+	}
+	return nil
+}
+
+// startRepair heals the replicas left behind by deferRepair in a background goroutine
+func (f *File) startRepair() {
+	if len(f.deferred) == 0 {
+		return
+	}
+	f.repairDone = make(chan struct{})
+	go func() {
+		defer close(f.repairDone)
+		f.repairErr = f.Heal()
+	}()
+}
+
+// RepairDone returns a channel which is closed once the background repair started by WithAsyncRepair has finished
+func (f *File) RepairDone() <-chan struct{} {
+	if f == nil || f.repairDone == nil {
+		done := make(chan struct{})
+		close(done)
+		return done
+	}
+	return f.repairDone
+}
+
+// WaitRepair blocks until the background repair started by WithAsyncRepair has finished and returns its error
+func (f *File) WaitRepair(ctx context.Context) error {
+	select {
+	case <-f.RepairDone():
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	if f == nil {
+		return nil
+	}
+	return f.repairErr
+}
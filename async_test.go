@@ -0,0 +1,57 @@
+package haraqafs
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWithAsyncRepair(t *testing.T) {
+	volumes := newTmpVolumes(t, 3)
+	defer removeVolumes(volumes)
+	for i, v := range volumes[:2] {
+		msg := "hello"
+		if i == 1 {
+			msg = "hello world"
+		}
+		checkErr(t, os.WriteFile(filepath.Join(v, "my_file"), []byte(msg), 0666))
+	}
+	checkErr(t, os.WriteFile(filepath.Join(volumes[2], "my_file"), []byte("hello"), 0666))
+
+	f, err := New("my_file", WithVolumes(volumes...), WithAsyncRepair())
+	checkErr(t, err)
+	checkRead(t, f, []byte("hello"))
+	checkErr(t, f.WaitRepair(context.Background()))
+	if !f.usable(1) {
+		t.Fatal("replica wasn't repaired")
+	}
+	select {
+	case <-f.RepairDone():
+	default:
+		t.Fatal("repair isn't done")
+	}
+	checkClose(t, f)
+	b, err := os.ReadFile(filepath.Join(volumes[1], "my_file"))
+	checkErr(t, err)
+	if string(b) != "hello" {
+		t.Fatal(string(b))
+	}
+
+	// missing replicas are created and filled in the background, close waits for them
+	checkErr(t, os.Remove(filepath.Join(volumes[0], "my_file")))
+	f, err = New("my_file", WithVolumes(volumes...), WithAsyncRepair())
+	checkErr(t, err)
+	checkClose(t, f)
+	b, err = os.ReadFile(filepath.Join(volumes[0], "my_file"))
+	checkErr(t, err)
+	if string(b) != "hello" {
+		t.Fatal(string(b))
+	}
+
+	// nothing to repair
+	f, err = New("my_file", WithVolumes(volumes...), WithAsyncRepair())
+	checkErr(t, err)
+	checkErr(t, f.WaitRepair(context.Background()))
+	checkClose(t, f)
+}
@@ -0,0 +1,233 @@
+package haraqafs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+)
+
+// stageSuffix and commitSuffix name the redo record kept next to a replica while an atomic write is in flight. it's staged
+// under stageSuffix and renamed to commitSuffix once every replica holds it, laid out as the write's offset and a crc of
+// the record followed by the bytes written
+const (
+	stageSuffix  = ".haraqafs-stage"
+	commitSuffix = ".haraqafs-commit"
+)
+
+const redoHeader = 12
+
+// WithAtomicWrites commits writes in two phases. each write is first staged next to every replica and only applied once
+// all of them staged it, so a write either reaches every replica or none of them. a crash before the commit discards the
+// write the next time the file is opened WithExclusive, and a crash after it finishes the write on the replicas it hadn't reached
+func WithAtomicWrites() FileOption {
+	return func(f *File) error {
+		f.atomic = true
+		return nil
+	}
+}
+
+// writeAtomic is writeAt staged on every usable replica before any of them is written
+func (f *File) writeAtomic(b []byte, offset int64) (int, error) {
+	rec := redoRecord(b, offset)
+	recs := make([][]byte, len(f.multi))
+	for i := range recs {
+		recs[i] = rec
+	}
+	targets, err := f.stageRecords(recs)
+	if err != nil {
+		return 0, err
+	}
+
+	var applied int
+	for _, i := range targets {
+		if !f.usable(i) {
+			continue
+		}
+		// the commit record can only go once the write is on disk, so it's synced whatever the sync policy
+		if err := f.writeReplicaSync(i, b, offset, true); err != nil {
+			// the commit record stays behind so the next open finishes the write
+			f.markDirty(i, fmt.Errorf("committed write to %s failed: %v", f.paths[i], err))
+			continue
+		}
+		_ = os.Remove(f.paths[i] + commitSuffix)
+		applied++
+	}
+	from := offset
+	if f.size < from {
+		from = f.size
+	}
+	if end := offset + int64(len(b)); end > f.size {
+		f.size = end
+	}
+	f.digestsChanged(from, offset+int64(len(b)))
+	// the write is committed either way, the replicas which missed it finish it the next time the file's opened
+	if applied < f.writeQuorum() {
+		return 0, fmt.Errorf("%d of %d replicas written, %d needed: %w", applied, len(f.multi), f.writeQuorum(), ErrNoQuorum)
+	}
+	return len(b), nil
+}
+
+// syncRecordDir syncs the directory holding the records of the replica at path whatever the sync policy, a record
+// which is renamed but not yet on disk could commit a write after a crash or lose one which was committed
+func syncRecordDir(path string) error {
+	dir := filepath.Dir(path)
+	if err := syncDir(dir); err != nil {
+		return pathErr("sync", dir, err)
+	}
+	return nil
+}
+
+// stageRecords stages recs[i] next to each usable replica i and commits them, returning the replicas which hold a record.
+// a replica which can't stage its record fails the write before anything's committed
+func (f *File) stageRecords(recs [][]byte) ([]int, error) {
+	var targets []int
+	for i := range f.multi {
+		if !f.usable(i) {
+			continue
+		}
+		err := writeRecord(f.paths[i]+stageSuffix, recs[i])
+		if err != nil {
+			err = pathErr("stage", f.paths[i], err)
+		} else {
+			err = syncRecordDir(f.paths[i])
+		}
+		if err != nil {
+			_ = os.Remove(f.paths[i] + stageSuffix)
+			f.dropRecords(targets)
+			return nil, err
+		}
+		targets = append(targets, i)
+	}
+
+	// the first record renamed commits the write, the rest follow it even when their own rename fails
+	var committed bool
+	for _, i := range targets {
+		err := os.Rename(f.paths[i]+stageSuffix, f.paths[i]+commitSuffix)
+		if err != nil {
+			err = pathErr("commit", f.paths[i], err)
+		} else {
+			err = syncRecordDir(f.paths[i])
+		}
+		switch {
+		case err == nil:
+			committed = true
+		case !committed:
+			f.dropRecords(targets)
+			return nil, err
+		default:
+			f.markDirty(i, fmt.Errorf("write to %s couldn't be committed: %v", f.paths[i], err))
+		}
+	}
+	return targets, nil
+}
+
+func redoRecord(b []byte, offset int64) []byte {
+	rec := make([]byte, redoHeader+len(b))
+	binary.LittleEndian.PutUint64(rec, uint64(offset))
+	copy(rec[redoHeader:], b)
+	binary.LittleEndian.PutUint32(rec[8:], crc32.Checksum(rec[redoHeader:], crcTable)^crc32.Checksum(rec[:8], crcTable))
+	return rec
+}
+
+func validRedo(rec []byte) bool {
+	if len(rec) < redoHeader {
+		return false
+	}
+	sum := crc32.Checksum(rec[redoHeader:], crcTable) ^ crc32.Checksum(rec[:8], crcTable)
+	return binary.LittleEndian.Uint32(rec[8:]) == sum
+}
+
+// writeRecord writes rec to path and syncs it, so it's on disk before it's acted on
+func writeRecord(path string, rec []byte) error {
+	out, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0666)
+	if err != nil {
+		return err
+	}
+	if _, err = out.Write(rec); err == nil {
+		err = out.Sync()
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func (f *File) dropRecords(replicas []int) {
+	for _, i := range replicas {
+		_ = os.Remove(f.paths[i] + stageSuffix)
+		_ = os.Remove(f.paths[i] + commitSuffix)
+	}
+}
+
+// replayCommits finishes the atomic writes a crash interrupted after they were committed and discards the ones it
+// interrupted before, so the replicas are compared as if each write happened entirely or not at all. records can
+// belong to a write another process still has in flight, so they're only replayed while the file is held WithExclusive
+func (f *File) replayCommits() error {
+	if f.exclusiveLock == nil {
+		return nil
+	}
+	if f.erasure != nil {
+		return f.replayShards()
+	}
+	staged := make([][]byte, len(f.multi))
+	committed := make([][]byte, len(f.multi))
+	var found bool
+	for i := range f.multi {
+		if f.multi[i] == nil {
+			continue
+		}
+		for _, r := range []struct {
+			suffix string
+			into   [][]byte
+		}{{stageSuffix, staged}, {commitSuffix, committed}} {
+			rec, err := os.ReadFile(f.paths[i] + r.suffix)
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			if err != nil {
+				return pathErr("commit", f.paths[i], err)
+			}
+			found = true
+			// a torn record was never renamed into place, so it was never committed
+			if validRedo(rec) {
+				r.into[i] = rec
+			}
+		}
+	}
+	// read only files can't be written, consensus outvotes the replicas which missed the write instead
+	if !found || f.readOnly {
+		return nil
+	}
+
+	for i := range f.multi {
+		if f.multi[i] == nil {
+			continue
+		}
+		rec := committed[i]
+		if rec == nil && staged[i] != nil {
+			// a staged record was committed when another replica's was renamed
+			for _, c := range committed {
+				if c != nil && bytes.Equal(c, staged[i]) {
+					rec = c
+					break
+				}
+			}
+		}
+		// a truncated file has nothing left to finish
+		if rec != nil && f.flags&os.O_TRUNC == 0 {
+			offset := int64(binary.LittleEndian.Uint64(rec))
+			if _, err := f.multi[i].WriteAt(rec[redoHeader:], offset); err != nil {
+				return pathErr("commit", f.paths[i], err)
+			}
+			if err := f.syncReplica(i); err != nil {
+				return pathErr("commit", f.paths[i], err)
+			}
+		}
+		f.dropRecords([]int{i})
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package haraqafs
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWithAtomicWrites(t *testing.T) {
+	volumes := newTmpVolumes(t, 3)
+	defer removeVolumes(volumes)
+	read := func(i int) string {
+		b, err := os.ReadFile(filepath.Join(volumes[i], "my_file"))
+		checkErr(t, err)
+		return string(b)
+	}
+	noRecords := func() {
+		t.Helper()
+		for _, v := range volumes {
+			for _, suffix := range []string{stageSuffix, commitSuffix} {
+				if _, err := os.Stat(filepath.Join(v, "my_file"+suffix)); !os.IsNotExist(err) {
+					t.Fatal("record left behind", err)
+				}
+			}
+		}
+	}
+	f, err := New("my_file", WithVolumes(volumes...), WithCreate(), WithAtomicWrites())
+	checkErr(t, err)
+	checkWrite(t, f, []byte("hello world"))
+	noRecords()
+
+	// replica 2 can't stage the write, so no replica gets it
+	blocked := filepath.Join(volumes[2], "my_file"+stageSuffix)
+	checkErr(t, os.Mkdir(blocked, 0755))
+	if _, err = f.WriteAt([]byte("jello"), 0); err == nil {
+		t.Fatal("expected an error")
+	}
+	for i := range volumes {
+		if s := read(i); s != "hello world" {
+			t.Fatal(i, s)
+		}
+	}
+	checkErr(t, os.RemoveAll(blocked))
+	noRecords()
+	checkClose(t, f)
+
+	// a crash before the commit discards the write
+	rec := redoRecord([]byte("jello"), 0)
+	checkErr(t, writeRecord(filepath.Join(volumes[0], "my_file"+stageSuffix), rec))
+	checkErr(t, writeRecord(filepath.Join(volumes[1], "my_file"+stageSuffix), rec))
+	// records are left alone unless the file's held exclusively, they could belong to a write in flight
+	f, err = New("my_file", WithVolumes(volumes...))
+	checkErr(t, err)
+	checkClose(t, f)
+	if _, err := os.Stat(filepath.Join(volumes[0], "my_file"+stageSuffix)); err != nil {
+		t.Fatal(err)
+	}
+	f, err = New("my_file", WithVolumes(volumes...), WithExclusive())
+	checkErr(t, err)
+	checkRead(t, f, []byte("hello world"))
+	checkClose(t, f)
+	noRecords()
+
+	// a crash after it finishes the write everywhere it was staged
+	checkErr(t, writeRecord(filepath.Join(volumes[0], "my_file"+commitSuffix), rec))
+	checkErr(t, writeRecord(filepath.Join(volumes[1], "my_file"+stageSuffix), rec))
+	checkErr(t, writeRecord(filepath.Join(volumes[2], "my_file"+commitSuffix), rec))
+	f, err = New("my_file", WithVolumes(volumes...), WithExclusive())
+	checkErr(t, err)
+	checkRead(t, f, []byte("jello world"))
+	checkClose(t, f)
+	noRecords()
+	for i := range volumes {
+		if s := read(i); s != "jello world" {
+			t.Fatal(i, s)
+		}
+	}
+
+	// a write which reaches too few replicas fails, the commit record finishes it on the next open
+	f, err = New("my_file", WithVolumes(volumes...), WithAtomicWrites(), WithWriteQuorum(3))
+	checkErr(t, err)
+	checkErr(t, f.multi[1].Close())
+	if _, err = f.WriteAt([]byte("hello"), 0); !errors.Is(err, ErrNoQuorum) {
+		t.Fatal(err)
+	}
+	_ = f.Close()
+	if s := read(1); s != "jello world" {
+		t.Fatal(s)
+	}
+	f, err = New("my_file", WithVolumes(volumes...), WithExclusive())
+	checkErr(t, err)
+	checkClose(t, f)
+	noRecords()
+	for i := range volumes {
+		if s := read(i); s != "hello world" {
+			t.Fatal(i, s)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package haraqafs
+
+import (
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// changesDue reports whether the replicas should be checked for changes made behind the file's back
+func (f *File) changesDue() bool {
+	if !f.detectChanges || f.readOnly {
+		return false
+	}
+	last := atomic.LoadInt64(&f.lastCheck)
+	return f.checkEvery <= 0 || time.Since(time.Unix(0, last)) >= f.checkEvery
+}
+
+// recordStamps remembers what the replicas look like after this handle changed them
+func (f *File) recordStamps() {
+	if !f.detectChanges {
+		return
+	}
+	f.wroteAt = time.Time{}
+	if f.stamps == nil {
+		f.stamps = make([]os.FileInfo, len(f.paths))
+	}
+	for i := range f.paths {
+		f.stamps[i] = nil
+		if info, err := os.Stat(f.paths[i]); err == nil {
+			f.stamps[i] = info
+		}
+	}
+	atomic.StoreInt64(&f.lastCheck, time.Now().UnixNano())
+}
+
+// wroteStamps notes that this handle wrote to the replicas, rather than stat'ing every one of them after each write
+// their stamps are brought up to date by the next revalidate, which takes changes up to now as this handle's own
+func (f *File) wroteStamps() {
+	if f.detectChanges {
+		f.wroteAt = time.Now()
+	}
+}
+
+// revalidate looks for replicas modified, replaced or removed by someone else and re-runs consensus if any were,
+// it must be called with the file lock held exclusively
+func (f *File) revalidate() error {
+	var changed bool
+	for i := range f.paths {
+		info, err := os.Stat(f.paths[i])
+		prev := f.stamps[i]
+		switch {
+		case err != nil && prev == nil:
+			continue
+		case err == nil && prev != nil && os.SameFile(info, prev) && info.Size() == prev.Size() && info.ModTime().Equal(prev.ModTime()):
+			continue
+		case err == nil && prev != nil && os.SameFile(info, prev) && !f.wroteAt.IsZero() && !info.ModTime().After(f.wroteAt):
+			// modified no later than this handle's last write, which is what modified it
+			continue
+		}
+		changed = true
+		f.emit(EventModified, i, fmt.Errorf("replica %s changed outside of this file", f.paths[i]))
+
+		// a replaced or removed replica can't be read through the old descriptor
+		if err != nil || prev == nil || !os.SameFile(info, prev) {
+			if f.multi[i] != nil {
+				_ = f.multi[i].Close()
+				f.multi[i] = nil
+			}
+			if err == nil {
+				f.multi[i], _ = os.OpenFile(f.paths[i], f.flags&^(os.O_CREATE|os.O_EXCL|os.O_TRUNC)|f.spec(i).Flags, f.perms)
+			}
+		}
+	}
+	if changed {
+		if err := f.reconcile(); err != nil {
+			f.recordStamps()
+			return err
+		}
+	}
+	f.recordStamps()
+	return nil
+}
+
+// reconcile re-runs consensus once the replicas changed underneath the file, it must be called with the file lock held exclusively
+func (f *File) reconcile() error {
+	if err := f.consensus(); err != nil {
+		return fmt.Errorf("re-consensus failed: %w", err)
+	}
+	f.size = f.statSize()
+	if err := f.loadDigests(); err != nil {
+		return err
+	}
+	f.unmapReplicas()
+	if err := f.mapReplicas(); err != nil {
+		return err
+	}
+	f.advance()
+	return nil
+}
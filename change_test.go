@@ -0,0 +1,66 @@
+package haraqafs
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWithChangeDetection(t *testing.T) {
+	volumes := newTmpVolumes(t, 3)
+	defer removeVolumes(volumes)
+	var events []Event
+	f, err := New("my_file", WithVolumes(volumes...), WithCreate(), WithChangeDetection(0), WithEvents(func(e Event) {
+		events = append(events, e)
+	}))
+	checkErr(t, err)
+	checkWrite(t, f, []byte("hello"))
+
+	// our own writes aren't changes
+	b := make([]byte, 5)
+	_, err = f.ReadAt(b, 0)
+	checkErr(t, err)
+	if len(events) != 0 {
+		t.Fatal(events)
+	}
+
+	// a replica modified in place is repaired from the others
+	checkErr(t, os.WriteFile(filepath.Join(volumes[0], "my_file"), []byte("jello!"), 0666))
+	_, err = f.ReadAt(b, 0)
+	checkErr(t, err)
+	if string(b) != "hello" || len(events) != 1 || events[0].Kind != EventModified {
+		t.Fatal(string(b), events)
+	}
+	got, err := os.ReadFile(filepath.Join(volumes[0], "my_file"))
+	checkErr(t, err)
+	if string(got) != "hello" {
+		t.Fatal(string(got))
+	}
+
+	// replacing every replica is picked up through new descriptors
+	for _, v := range volumes {
+		tmp := filepath.Join(v, "tmp")
+		checkErr(t, os.WriteFile(tmp, []byte("world"), 0666))
+		checkErr(t, os.Rename(tmp, filepath.Join(v, "my_file")))
+	}
+	_, err = f.ReadAt(b, 0)
+	checkErr(t, err)
+	if string(b) != "world" || len(events) != 4 {
+		t.Fatal(string(b), events)
+	}
+
+	// changes made after this handle's last write are told apart from it
+	_, err = f.WriteAt([]byte("HELLO"), 0)
+	checkErr(t, err)
+	path := filepath.Join(volumes[1], "my_file")
+	checkErr(t, os.WriteFile(path, []byte("jello"), 0666))
+	later := time.Now().Add(time.Minute)
+	checkErr(t, os.Chtimes(path, later, later))
+	_, err = f.ReadAt(b, 0)
+	checkErr(t, err)
+	if string(b) != "HELLO" || len(events) != 5 || events[4].Path != path {
+		t.Fatal(string(b), events)
+	}
+	checkClose(t, f)
+}
@@ -0,0 +1,180 @@
+package haraqafs
+
+import (
+	"bytes"
+	"errors"
+	"io"
+)
+
+// consensusChunk is how much of each replica is hashed at a time while looking for divergence
+const consensusChunk = 1 << 20
+
+// chunkHashes hashes the non-empty replicas chunk by chunk in lockstep, splitting them into groups with identical content.
+// a group too small to ever reach quorum stops being read, so replicas which diverge early aren't hashed in full.
+// it returns the offset of the first chunk where each pair of replicas differ, -1 when they never did
+func (f *File) chunkHashes(sizes []int64, hashes [][]byte) ([][]int64, error) {
+	diverged := make([][]int64, len(f.multi))
+	for i := range diverged {
+		diverged[i] = make([]int64, len(f.multi))
+		for j := range diverged[i] {
+			diverged[i][j] = -1
+		}
+	}
+
+	chains := make([][]byte, len(f.multi))
+	var group []int
+	for i := range f.multi {
+		if f.multi[i] != nil && sizes[i] > 0 {
+			group = append(group, i)
+		}
+	}
+	active := [][]int{group}
+	var dropped []int
+	chunk := f.chunkSize()
+	buf := make([]byte, chunk)
+	for off := int64(0); len(active) > 0; off += int64(chunk) {
+		if f.pastConsensusDeadline() {
+			return nil, errConsensusDeadline
+		}
+		if err := f.aborted(); err != nil {
+			return nil, err
+		}
+		var next [][]int
+		for _, group := range active {
+			split := make(map[string][]int)
+			var order []string
+			for _, i := range group {
+				n, err := f.multi[i].ReadAt(buf, off)
+				if err != nil && !errors.Is(err, io.EOF) {
+					// unreadable replicas are left without a hash, like before
+					chains[i] = nil
+					continue
+				}
+				f.hashing.Reset()
+				_, _ = f.hashing.Write(buf[:n])
+				key := string(f.hashing.Sum(nil))
+				if n == 0 {
+					key = ""
+				}
+				if _, ok := split[key]; !ok {
+					order = append(order, key)
+				}
+				split[key] = append(split[key], i)
+				chains[i] = append(chains[i], key...)
+			}
+			if len(order) > 1 {
+				for _, a := range group {
+					for _, b := range group {
+						if diverged[a][b] == -1 && !sameGroup(split, a, b) {
+							diverged[a][b] = off
+						}
+					}
+				}
+			}
+			for _, key := range order {
+				switch members := split[key]; {
+				case key == "":
+					// every member reached the end together
+					f.finishGroup(members, chains, hashes)
+				case len(members) < f.quorum && len(order) > 1:
+					dropped = append(dropped, members...)
+				default:
+					next = append(next, members)
+				}
+			}
+		}
+		active = next
+	}
+
+	// dropped replicas get hashes of their own so nothing is skipped when they're repaired
+	for _, i := range dropped {
+		f.finishGroup([]int{i}, chains, hashes)
+		hashes[i] = append(hashes[i], byte(i))
+	}
+	return diverged, nil
+}
+
+// chunkSize is the block size set with WithBlockRepair, or consensusChunk
+func (f *File) chunkSize() int {
+	if f.blockSize > 0 {
+		return f.blockSize
+	}
+	return consensusChunk
+}
+
+// repairBlocks rewrites only the blocks of replica i from from onwards which differ from the source replica at index,
+// so a few changed blocks in a large file don't cost a full copy
+func (f *File) repairBlocks(i, index int, sizes []int64, from int64) error {
+	var file writeSyncer = f.multi[i]
+	if f.wrapReplica != nil {
+		file = f.wrapReplica(i, file)
+	}
+	src := make([]byte, f.blockSize)
+	dst := make([]byte, f.blockSize)
+	for off := from; off < sizes[index]; off += int64(f.blockSize) {
+		if f.pastConsensusDeadline() {
+			return errConsensusDeadline
+		}
+		if err := f.aborted(); err != nil {
+			return err
+		}
+		n, err := f.multi[index].ReadAt(src, off)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return pathErr("read", f.paths[index], err)
+		}
+		if n == 0 {
+			return pathErr("read", f.paths[index], io.ErrUnexpectedEOF)
+		}
+		m, err := f.multi[i].ReadAt(dst[:n], off)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return pathErr("read", f.paths[i], err)
+		}
+		if m == n && bytes.Equal(src[:n], dst[:n]) {
+			continue
+		}
+		f.scheduler.wait(n)
+		if m, err = file.WriteAt(src[:n], off); err != nil {
+			return pathErr("write", f.paths[i], err)
+		}
+		if m != n {
+			return pathErr("write", f.paths[i], io.ErrShortWrite)
+		}
+	}
+	if sizes[i] != sizes[index] {
+		if err := f.multi[i].Truncate(sizes[index]); err != nil {
+			return pathErr("truncate", f.paths[i], err)
+		}
+		sizes[i] = sizes[index]
+	}
+	return nil
+}
+
+func (f *File) finishGroup(members []int, chains [][]byte, hashes [][]byte) {
+	for _, i := range members {
+		if chains[i] == nil {
+			continue
+		}
+		// a replica which fits in one chunk is identified by the hash of its content, as it was before chunking
+		if len(chains[i]) == f.hashing.Size() {
+			hashes[i] = chains[i]
+			continue
+		}
+		f.hashing.Reset()
+		_, _ = f.hashing.Write(chains[i])
+		hashes[i] = f.hashing.Sum(nil)
+	}
+}
+
+func sameGroup(split map[string][]int, a, b int) bool {
+	for _, members := range split {
+		var hasA, hasB bool
+		for _, i := range members {
+			hasA = hasA || i == a
+			hasB = hasB || i == b
+		}
+		if hasA || hasB {
+			return hasA && hasB
+		}
+	}
+	return false
+}
@@ -0,0 +1,96 @@
+package haraqafs
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestChunkHashes(t *testing.T) {
+	volumes := newTmpVolumes(t, 3)
+	defer removeVolumes(volumes)
+	want := make([]byte, 3*consensusChunk)
+	rand.New(rand.NewSource(1)).Read(want)
+	for i, v := range volumes {
+		b := append([]byte(nil), want...)
+		if i == 2 {
+			b[2*consensusChunk+consensusChunk/2]++
+		}
+		checkErr(t, os.WriteFile(filepath.Join(v, "my_file"), b, 0666))
+	}
+
+	f := &File{quorum: 2, hashing: sha256.New()}
+	sizes := make([]int64, len(volumes))
+	for i, v := range volumes {
+		fd, err := os.Open(filepath.Join(v, "my_file"))
+		checkErr(t, err)
+		defer fd.Close()
+		f.multi = append(f.multi, fd)
+		sizes[i] = int64(len(want))
+	}
+	hashes := make([][]byte, len(volumes))
+	diverged, err := f.chunkHashes(sizes, hashes)
+	checkErr(t, err)
+	if diverged[0][1] != -1 || diverged[2][0] != 2*consensusChunk || diverged[1][2] != 2*consensusChunk {
+		t.Fatal(diverged)
+	}
+	if !bytes.Equal(hashes[0], hashes[1]) || bytes.Equal(hashes[0], hashes[2]) {
+		t.Fatal(hashes)
+	}
+
+	// the lagging replica is repaired from the differing chunk onwards
+	r, err := New("my_file", WithVolumes(volumes...), WithHashing(sha256.New()))
+	checkErr(t, err)
+	checkClose(t, r)
+	got, err := os.ReadFile(filepath.Join(volumes[2], "my_file"))
+	checkErr(t, err)
+	if !bytes.Equal(got, want) {
+		t.Fatal("replica wasn't repaired")
+	}
+}
+
+type countingWriter struct {
+	writeSyncer
+	n *int
+}
+
+func (w countingWriter) WriteAt(b []byte, off int64) (int, error) {
+	*w.n += len(b)
+	return w.writeSyncer.WriteAt(b, off)
+}
+
+func TestWithBlockRepair(t *testing.T) {
+	const block = 4096
+	volumes := newTmpVolumes(t, 3)
+	defer removeVolumes(volumes)
+
+	want := make([]byte, 8*block)
+	rand.New(rand.NewSource(1)).Read(want)
+	for i, v := range volumes {
+		b := append([]byte(nil), want...)
+		if i == 2 {
+			b[block+1]++
+			b[6*block+1]++
+			b = append(b, "extra"...)
+		}
+		checkErr(t, os.WriteFile(filepath.Join(v, "my_file"), b, 0666))
+	}
+
+	var written int
+	f, err := New("my_file", WithVolumes(volumes...), WithHashing(sha256.New()), WithBlockRepair(block), withWrapReplica(func(i int, w writeSyncer) writeSyncer {
+		return countingWriter{writeSyncer: w, n: &written}
+	}))
+	checkErr(t, err)
+	checkClose(t, f)
+	if written != 2*block {
+		t.Fatal(written)
+	}
+	b, err := os.ReadFile(filepath.Join(volumes[2], "my_file"))
+	checkErr(t, err)
+	if !bytes.Equal(b, want) {
+		t.Fatal(len(b))
+	}
+}
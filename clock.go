@@ -0,0 +1,34 @@
+package haraqafs
+
+import (
+	"os"
+	"time"
+)
+
+type Clock interface {
+	Now() time.Time
+}
+
+func (f *File) now() time.Time {
+	if f.clock == nil {
+		return time.Now()
+	}
+	return f.clock.Now()
+}
+
+// modTime clamps replica mod times to the clock, a replica written by a host with a skewed clock can't appear newer than now
+func (f *File) modTime(t time.Time) time.Time {
+	if now := f.now(); t.After(now) {
+		return now
+	}
+	return t
+}
+
+// stamp sets the replica mod time from the configured clock so time based quorum policies follow it
+func (f *File) stamp(i int) error {
+	if f.clock == nil {
+		return nil
+	}
+	now := f.clock.Now()
+	return os.Chtimes(f.paths[i], now, now)
+}
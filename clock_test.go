@@ -0,0 +1,41 @@
+package haraqafs
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+type testClock struct{ t time.Time }
+
+func (c *testClock) Now() time.Time { return c.t }
+
+func TestWithClock(t *testing.T) {
+	const fileName = "my_file"
+	v1 := newTmpVolume(t, "clock_1*")
+	defer os.RemoveAll(v1)
+	v2 := newTmpVolume(t, "clock_2*")
+	defer os.RemoveAll(v2)
+
+	clock := &testClock{t: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+	for _, tc := range []struct {
+		vol string
+		msg string
+	}{{v2, "newer!"}, {v1, "older"}} {
+		f, err := New(fileName, WithVolumes(tc.vol), WithCreate(), WithClock(clock))
+		checkErr(t, err)
+		checkWrite(t, f, []byte(tc.msg))
+		checkClose(t, f)
+		clock.t = clock.t.Add(-time.Hour)
+	}
+
+	clock.t = clock.t.Add(24 * time.Hour)
+	f, err := New(fileName, WithVolumes(v1, v2), WithQuorum(2), WithQuorumFail(QFWriteLast), WithClock(clock))
+	checkErr(t, err)
+	checkRead(t, f, []byte("newer!"))
+	checkClose(t, f)
+
+	if _, err = New(fileName, WithQuorumFail(QFShortestNonZero+1)); err == nil {
+		t.Fatal("expected error")
+	}
+}
@@ -0,0 +1,99 @@
+package haraqafs
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// WithCloneRepair rebuilds replicas which are repaired in full as a new file beside them, renamed over the replica once
+// it's complete, so a repair interrupted part way never leaves a replica half written. when both replicas share a
+// filesystem which supports reflinks the new file is a clone sharing the source's blocks instead of a byte copy.
+// another handle on the replica would go on using the file it replaced, so replicas are only cloned while the file is
+// held WithExclusive and isn't mapped, they're repaired in place otherwise
+func WithCloneRepair() FileOption {
+	return func(f *File) error {
+		f.cloneRepair = true
+		return nil
+	}
+}
+
+// canClone reports whether replicas can be replaced by a clone, nothing else may have the replaced file open
+func (f *File) canClone() bool {
+	return f.cloneRepair && f.exclusiveLock != nil && !f.mmap
+}
+
+// cloneReplica replaces replica i with a copy of replica src made beside it and renamed into place.
+// it reports whether the copy was a reflink clone
+func (f *File) cloneReplica(i, src int) (bool, error) {
+	info, err := f.multi[src].Stat()
+	if err != nil {
+		return false, pathErr("stat", f.paths[src], err)
+	}
+	var b [8]byte
+	_, _ = rand.Read(b[:])
+	// named like the other temporary files, so GC collects it after a crash
+	tmp := filepath.Join(filepath.Dir(f.paths[i]), "."+filepath.Base(f.paths[i])+tmpMarker+hex.EncodeToString(b[:]))
+	f.mkdirParent(i)
+	out, err := os.OpenFile(tmp, os.O_RDWR|os.O_CREATE|os.O_EXCL, f.perms)
+	if err != nil {
+		return false, pathErr("open", tmp, err)
+	}
+	cloned, err := f.fillClone(out, i, src, info)
+	if err == nil {
+		err = out.Sync()
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, f.paths[i])
+	}
+	if err == nil {
+		err = f.syncParents(f.paths[i])
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return false, pathErr("clone", f.paths[i], err)
+	}
+
+	// the old handle still points at the replaced file
+	replica, err := os.OpenFile(f.paths[i], (f.flags&^(os.O_CREATE|os.O_TRUNC|os.O_EXCL))|f.spec(i).Flags, f.perms)
+	if err != nil {
+		return cloned, pathErr("open", f.paths[i], err)
+	}
+	if f.multi[i] != nil {
+		_ = f.multi[i].Close()
+	}
+	f.multi[i] = replica
+	return cloned, nil
+}
+
+// fillClone copies replica src into out, as a reflink when replica i's volume shares src's filesystem
+func (f *File) fillClone(out *os.File, i, src int, info os.FileInfo) (bool, error) {
+	if dir, err := os.Stat(filepath.Dir(f.paths[i])); err == nil && sameDevice(dir, info) && reflink(out, f.multi[src]) == nil {
+		return true, nil
+	}
+	var buf []byte
+	for off := int64(0); off < info.Size(); {
+		if err := f.aborted(); err != nil {
+			return false, err
+		}
+		buf = f.chunkFor(buf, i, 1e6)
+		n, err := f.multi[src].ReadAt(buf, off)
+		if n == 0 && err != nil {
+			return false, pathErr("read", f.paths[src], err)
+		}
+		f.scheduler.wait(n)
+		start := time.Now()
+		_, err = out.WriteAt(buf[:n], off)
+		f.copied(i, n, time.Since(start))
+		if err != nil {
+			return false, err
+		}
+		off += int64(n)
+	}
+	return false, nil
+}
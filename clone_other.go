@@ -0,0 +1,13 @@
+//go:build !linux
+// +build !linux
+
+package haraqafs
+
+import (
+	"errors"
+	"os"
+)
+
+func reflink(dst, src *os.File) error {
+	return errors.New("reflinks aren't supported on this platform")
+}
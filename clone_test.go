@@ -0,0 +1,64 @@
+package haraqafs
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWithCloneRepair(t *testing.T) {
+	volumes := newTmpVolumes(t, 3)
+	defer removeVolumes(volumes)
+	f, err := New("my_file", WithVolumes(volumes...), WithCreate())
+	checkErr(t, err)
+	checkWrite(t, f, []byte("hello world"))
+	checkClose(t, f)
+
+	// one replica lost and one diverged are both rebuilt beside themselves
+	checkErr(t, os.Remove(filepath.Join(volumes[1], "my_file")))
+	checkErr(t, os.WriteFile(filepath.Join(volumes[2], "my_file"), []byte("jello"), 0666))
+	diverged, err := os.Stat(filepath.Join(volumes[2], "my_file"))
+	checkErr(t, err)
+	f, err = New("my_file", WithVolumes(volumes...), WithQuorum(2), WithQuorumFail(QFLongest), WithCloneRepair(), WithExclusive())
+	checkErr(t, err)
+	checkRead(t, f, []byte("hello world"))
+	checkClose(t, f)
+	if info, err := os.Stat(filepath.Join(volumes[2], "my_file")); err != nil || os.SameFile(diverged, info) {
+		t.Fatal("replica wasn't cloned", err)
+	}
+
+	// without WithExclusive another process could hold the replica open, so it's repaired in place
+	checkErr(t, os.WriteFile(filepath.Join(volumes[2], "my_file"), []byte("jello"), 0666))
+	diverged, err = os.Stat(filepath.Join(volumes[2], "my_file"))
+	checkErr(t, err)
+	f, err = New("my_file", WithVolumes(volumes...), WithQuorum(2), WithQuorumFail(QFLongest), WithCloneRepair())
+	checkErr(t, err)
+	checkRead(t, f, []byte("hello world"))
+	checkClose(t, f)
+	if info, err := os.Stat(filepath.Join(volumes[2], "my_file")); err != nil || !os.SameFile(diverged, info) {
+		t.Fatal("replica was cloned", err)
+	}
+
+	src, err := os.Stat(filepath.Join(volumes[0], "my_file"))
+	checkErr(t, err)
+	for _, v := range volumes[1:] {
+		b, err := os.ReadFile(filepath.Join(v, "my_file"))
+		checkErr(t, err)
+		if string(b) != "hello world" {
+			t.Fatal(string(b))
+		}
+		info, err := os.Stat(filepath.Join(v, "my_file"))
+		checkErr(t, err)
+		if os.SameFile(src, info) {
+			t.Fatal("replica is a link to its source")
+		}
+		entries, err := os.ReadDir(v)
+		checkErr(t, err)
+		for _, e := range entries {
+			if strings.Contains(e.Name(), tmpMarker) {
+				t.Fatal("temporary file left behind:", e.Name())
+			}
+		}
+	}
+}
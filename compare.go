@@ -0,0 +1,131 @@
+package haraqafs
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync/atomic"
+)
+
+// WithReadRepair repairs the replicas reads find diverged or unreadable in the background. reads with WithReadQuorum,
+// ReadAtRecover and ReadCompared rewrite the range on replicas which disagree with the quorum, other reads rewrite it on
+// replicas which failed to read it. every repair is counted by ReadRepairs and reported as an EventReadRepaired,
+// a replica whose range can't be repaired is healed in full
+func WithReadRepair() FileOption {
+	return func(f *File) error {
+		f.readRepair = true
+		return nil
+	}
+}
+
+// ReadCompared reads the range from every usable replica and compares them, at least the read quorum, or a majority
+// when none was set, must agree. any replica which disagrees or can't be read fails the read with a *ReadMismatchError,
+// unless WithReadRepair is set in which case it's repaired and the agreed content returned
+func (f *File) ReadCompared(b []byte, off int64) (int, error) {
+	if f == nil || len(f.multi) == 0 || f.lock == nil {
+		return 0, os.ErrInvalid
+	}
+	if f.erasure != nil {
+		return 0, errShards
+	}
+	if err := f.acquireRead(); err != nil {
+		return 0, err
+	}
+	defer f.releaseRead()
+
+	q := f.readQ
+	if q <= 1 {
+		q = f.quorum
+	}
+	votes, failed, errs := f.ballots(b, off, true)
+	if len(votes) == 0 || len(votes[0].replicas) < q {
+		errs = append(errs, fmt.Errorf("%d replicas must agree at offset %d: %w", q, off, ErrNoMajority))
+		return 0, aggErrors(errs)
+	}
+	agreed := votes[0]
+	if (len(votes) > 1 || len(failed) > 0) && !f.readRepair {
+		e := &ReadMismatchError{Offset: off, Length: len(b)}
+		for _, v := range votes[1:] {
+			for _, i := range v.replicas {
+				e.Diverged = append(e.Diverged, f.paths[i])
+			}
+		}
+		for _, i := range failed {
+			e.Diverged = append(e.Diverged, f.paths[i])
+		}
+		return 0, e
+	}
+	f.outvoted(agreed, votes, failed, off)
+	return copy(b, agreed.buf), agreed.err
+}
+
+// outvoted repairs the range at off on the replicas which disagreed with the agreed ballot or failed to read
+func (f *File) outvoted(agreed *ballot, votes []*ballot, failed []int, off int64) {
+	for _, v := range votes {
+		if v == agreed {
+			continue
+		}
+		for _, i := range v.replicas {
+			f.readRepairLater(i, off, agreed.buf, agreed.err == nil, fmt.Errorf("replica %s disagreed with a read quorum at %d", f.paths[i], off))
+		}
+	}
+	for _, i := range failed {
+		f.readRepairLater(i, off, agreed.buf, agreed.err == nil, fmt.Errorf("replica %s failed a read at %d", f.paths[i], off))
+	}
+}
+
+// readRepairLater rewrites the agreed data at off on replica i once reads let go of the lock.
+// when only the range can't be trusted to fix the replica, like when it disagrees about where the file ends,
+// the whole replica is healed instead
+func (f *File) readRepairLater(i int, off int64, data []byte, rangeOnly bool, cause error) {
+	if !f.readRepair || f.readOnly || f.pinned {
+		return
+	}
+	data = append([]byte(nil), data...)
+	go func() {
+		if err := f.acquire(); err != nil {
+			return
+		}
+		if !f.usable(i) {
+			f.lock.unlock()
+			return
+		}
+		err := errors.New("the range isn't enough to repair it")
+		if rangeOnly {
+			err = f.repairRange(i, off, data)
+		}
+		if err != nil {
+			f.markDirty(i, fmt.Errorf("%v, %v", cause, err))
+		} else {
+			atomic.AddUint64(&f.readRepairs, 1)
+			f.emit(EventReadRepaired, i, cause)
+		}
+		f.lock.unlock()
+		if err != nil {
+			f.healLater()
+		}
+	}()
+}
+
+// repairRange writes the content the read agreed on at off onto replica i, it must be called with the file lock held exclusively.
+// the agreed bytes are written rather than another replica's, which could be outvoted just the same
+func (f *File) repairRange(i int, off int64, data []byte) error {
+	if _, err := f.multi[i].WriteAt(data, off); err != nil {
+		return pathErr("write", f.paths[i], err)
+	}
+	if f.digests != nil {
+		if err := f.updateDigests(i, off, off+int64(len(data))); err != nil {
+			return err
+		}
+	}
+	f.recordStamps()
+	return nil
+}
+
+// ReadRepairs returns how many ranges reads found diverged or unreadable and repaired, see WithReadRepair
+func (f *File) ReadRepairs() uint64 {
+	if f == nil {
+		return 0
+	}
+	return atomic.LoadUint64(&f.readRepairs)
+}
@@ -0,0 +1,124 @@
+package haraqafs
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReadCompared(t *testing.T) {
+	volumes := newTmpVolumes(t, 3)
+	defer removeVolumes(volumes)
+	f, err := New("my_file", WithVolumes(volumes...), WithCreate())
+	checkErr(t, err)
+	checkWrite(t, f, []byte("hello"))
+	got := make([]byte, 5)
+	n, err := f.ReadCompared(got, 0)
+	checkErr(t, err)
+	if string(got[:n]) != "hello" {
+		t.Fatal(string(got[:n]))
+	}
+
+	// bit rot on one replica fails the read
+	rotten := filepath.Join(volumes[1], "my_file")
+	checkErr(t, os.WriteFile(rotten, []byte("jello"), 0666))
+	var mErr *ReadMismatchError
+	if _, err = f.ReadCompared(got, 0); !errors.As(err, &mErr) || !errors.Is(err, ErrCorrupt) || len(mErr.Diverged) != 1 || mErr.Diverged[0] != rotten {
+		t.Fatal(err)
+	}
+	checkClose(t, f)
+
+	// or gets it repaired
+	f, err = New("my_file", WithVolumes(volumes...), WithReadRepair())
+	checkErr(t, err)
+	defer checkClose(t, f)
+	n, err = f.ReadCompared(got, 0)
+	checkErr(t, err)
+	if string(got[:n]) != "hello" {
+		t.Fatal(string(got[:n]))
+	}
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		b, err := os.ReadFile(rotten)
+		checkErr(t, err)
+		if string(b) == "hello" && f.Status().PendingRepairs == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal(string(b))
+		}
+	}
+}
+
+func TestReadRepairRange(t *testing.T) {
+	volumes := newTmpVolumes(t, 3)
+	defer removeVolumes(volumes)
+	events := make(chan Event, 10)
+	f, err := New("my_file", WithVolumes(volumes...), WithCreate(), WithReadRepair(), WithEvents(func(e Event) { events <- e }))
+	checkErr(t, err)
+	defer checkClose(t, f)
+	checkWrite(t, f, []byte("hello world"))
+
+	// the first replica in read order can be written but not read
+	first := f.readPlan(nil)[0]
+	checkErr(t, os.WriteFile(f.paths[first], []byte("jello world"), 0666))
+	writeOnly, err := os.OpenFile(f.paths[first], os.O_WRONLY, 0)
+	checkErr(t, err)
+	checkErr(t, f.multi[first].Close())
+	f.multi[first] = writeOnly
+
+	got := make([]byte, 5)
+	n, err := f.ReadAt(got, 0)
+	checkErr(t, err)
+	if string(got[:n]) != "hello" {
+		t.Fatal(string(got[:n]))
+	}
+	select {
+	case e := <-events:
+		if e.Kind != EventReadRepaired || e.Path != f.paths[first] {
+			t.Fatal(e)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no read repair")
+	}
+	if f.ReadRepairs() != 1 {
+		t.Fatal(f.ReadRepairs())
+	}
+	b, err := os.ReadFile(f.paths[first])
+	checkErr(t, err)
+	if string(b) != "hello world" {
+		t.Fatal(string(b))
+	}
+}
+
+func TestReadRepairOutvoted(t *testing.T) {
+	volumes := newTmpVolumes(t, 5)
+	defer removeVolumes(volumes)
+	f, err := New("my_file", WithVolumes(volumes...), WithCreate(), WithReadRepair())
+	checkErr(t, err)
+	defer checkClose(t, f)
+	checkWrite(t, f, []byte("hello"))
+
+	// two replicas are outvoted, each is repaired with what the quorum agreed on rather than the other's content
+	checkErr(t, os.WriteFile(f.paths[0], []byte("jello"), 0666))
+	checkErr(t, os.WriteFile(f.paths[1], []byte("cello"), 0666))
+	got := make([]byte, 5)
+	n, err := f.ReadCompared(got, 0)
+	checkErr(t, err)
+	if string(got[:n]) != "hello" {
+		t.Fatal(string(got[:n]))
+	}
+	for deadline := time.Now().Add(5 * time.Second); f.ReadRepairs() < 2; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal(f.ReadRepairs())
+		}
+	}
+	for _, p := range f.paths[:2] {
+		b, err := os.ReadFile(p)
+		checkErr(t, err)
+		if string(b) != "hello" {
+			t.Fatal(p, string(b))
+		}
+	}
+}
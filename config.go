@@ -0,0 +1,252 @@
+package haraqafs
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"hash/fnv"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+type Config struct {
+	Volumes     []Volume    `json:"volumes"`
+	Quorum      int         `json:"quorum,omitempty"`
+	Hashing     string      `json:"hashing,omitempty"`
+	ForceSync   bool        `json:"force_sync,omitempty"`
+	DirSync     bool        `json:"dir_sync,omitempty"`
+	SyncPolicy  SyncPolicy  `json:"sync_policy,omitempty"`
+	AppendOnly  bool        `json:"append_only,omitempty"`
+	ShardLevels int         `json:"shard_levels,omitempty"`
+	Ring        *RingConfig `json:"ring,omitempty"`
+	Rebinds     []Rebind    `json:"rebinds,omitempty"`
+
+	RepairConcurrency int   `json:"repair_concurrency,omitempty"`
+	RepairBandwidth   int64 `json:"repair_bandwidth,omitempty"`
+}
+
+type RingConfig struct {
+	VirtualNodes int `json:"virtual_nodes"`
+	Replicas     int `json:"replicas"`
+}
+
+// LoadConfig reads the config at path, its extension picks the format: .json or none, .yaml or .yml, and .toml
+func LoadConfig(path string) (*FS, error) {
+	var format string
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".json", "":
+		format = "json"
+	case ".yaml", ".yml":
+		format = "yaml"
+	case ".toml":
+		format = "toml"
+	default:
+		return nil, fmt.Errorf("unsupported config format %q: %w", ext, os.ErrInvalid)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseConfigFormat(f, format)
+}
+
+// ParseConfig parses a json config
+func ParseConfig(r io.Reader) (*FS, error) {
+	return ParseConfigFormat(r, "json")
+}
+
+// ParseConfigFormat parses a config in format, one of json, yaml and toml. every format uses the json field names
+func ParseConfigFormat(r io.Reader, format string) (*FS, error) {
+	// yaml and toml are re-encoded as json, so they're checked against the same fields
+	var m map[string]interface{}
+	var err error
+	switch strings.ToLower(format) {
+	case "json":
+	case "yaml", "yml":
+		err = yaml.NewDecoder(r).Decode(&m)
+	case "toml":
+		_, err = toml.NewDecoder(r).Decode(&m)
+	default:
+		return nil, fmt.Errorf("unsupported config format %q: %w", format, os.ErrInvalid)
+	}
+	if err == nil && m != nil {
+		var b []byte
+		b, err = json.Marshal(m)
+		r = bytes.NewReader(b)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	var c Config
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&c); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	return c.FS()
+}
+
+func (c *Config) New(name string, opts ...FileOption) (*File, error) {
+	fsys, err := c.FS()
+	if err != nil {
+		return nil, err
+	}
+	return fsys.New(name, opts...)
+}
+
+func (c *Config) Validate() error {
+	_, err := c.FS()
+	return err
+}
+
+func (c *Config) FS() (*FS, error) {
+	opts, err := c.options()
+	if err != nil {
+		return nil, err
+	}
+	fsys := NewFS(opts...)
+	if c.Hashing != "" {
+		fsys.newHash, err = hashByName(c.Hashing)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return fsys, nil
+}
+
+func (c *Config) options() ([]FileOption, error) {
+	var opts []FileOption
+	switch {
+	case c.Ring != nil:
+		volumes := make([]string, len(c.Volumes))
+		for i := range c.Volumes {
+			volumes[i] = c.Volumes[i].Path
+		}
+		r, err := NewRing(c.Ring.VirtualNodes, volumes...)
+		if err != nil {
+			return nil, err
+		}
+		// the specs are matched up with the volumes each file is placed on
+		opts = append(opts, WithVolumeSpecs(append([]Volume(nil), c.Volumes...)...), WithRing(r, c.Ring.Replicas))
+	case len(c.Volumes) > 0:
+		opts = append(opts, WithVolumeSpecs(append([]Volume(nil), c.Volumes...)...))
+	default:
+		return nil, fmt.Errorf("missing volumes: %w", os.ErrInvalid)
+	}
+	if len(c.Rebinds) > 0 {
+		p, err := NewPlacement(c.Rebinds...)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, WithPlacement(p))
+	}
+	if c.Quorum != 0 {
+		opts = append(opts, WithQuorum(c.Quorum))
+	}
+	if c.ForceSync && c.SyncPolicy != SyncBarrier && c.SyncPolicy != SyncWrite {
+		return nil, fmt.Errorf("force_sync conflicts with sync_policy %s: %w", c.SyncPolicy, os.ErrInvalid)
+	}
+	if c.ForceSync {
+		opts = append(opts, WithForceSync(true))
+	}
+	if c.DirSync {
+		opts = append(opts, WithDirSync())
+	}
+	if c.SyncPolicy != SyncBarrier {
+		opts = append(opts, WithSyncPolicy(c.SyncPolicy))
+	}
+	if c.AppendOnly {
+		opts = append(opts, WithAppendOnly(true))
+	}
+	if c.ShardLevels != 0 {
+		opts = append(opts, WithSharding(c.ShardLevels))
+	}
+	if c.RepairConcurrency != 0 || c.RepairBandwidth != 0 {
+		// one scheduler shared by every file opened through the config
+		opts = append(opts, WithRepairScheduler(NewRepairScheduler(c.RepairConcurrency, c.RepairBandwidth)))
+	}
+
+	// apply to a scratch file to surface invalid values early
+	if err := applyScratch(&File{}, opts); err != nil {
+		return nil, err
+	}
+	return opts, nil
+}
+
+func hashByName(name string) (func() hash.Hash, error) {
+	switch strings.ToLower(name) {
+	case "md5":
+		return md5.New, nil
+	case "sha1":
+		return sha1.New, nil
+	case "sha256":
+		return sha256.New, nil
+	case "sha512":
+		return sha512.New, nil
+	case "crc32":
+		return func() hash.Hash { return crc32.NewIEEE() }, nil
+	case "fnv64a":
+		return func() hash.Hash { return fnv.New64a() }, nil
+	}
+	return nil, fmt.Errorf("unknown hashing %q: %w", name, os.ErrInvalid)
+}
+
+func (m SyncMode) MarshalText() ([]byte, error) {
+	switch m {
+	case SyncDefault:
+		return []byte("default"), nil
+	case SyncAlways:
+		return []byte("always"), nil
+	case SyncNever:
+		return []byte("never"), nil
+	}
+	return nil, fmt.Errorf("unknown sync mode %d: %w", m, os.ErrInvalid)
+}
+
+func (p SyncPolicy) MarshalText() ([]byte, error) {
+	if p < SyncBarrier || p > SyncWrite {
+		return nil, fmt.Errorf("unknown sync policy %d: %w", p, os.ErrInvalid)
+	}
+	return []byte(p.String()), nil
+}
+
+func (p *SyncPolicy) UnmarshalText(b []byte) error {
+	name := strings.ToLower(string(b))
+	if name == "" {
+		*p = SyncBarrier
+		return nil
+	}
+	for i, n := range syncPolicyNames {
+		if n == name {
+			*p = SyncPolicy(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown sync policy %q: %w", b, os.ErrInvalid)
+}
+
+func (m *SyncMode) UnmarshalText(b []byte) error {
+	switch strings.ToLower(string(b)) {
+	case "default", "":
+		*m = SyncDefault
+	case "always":
+		*m = SyncAlways
+	case "never":
+		*m = SyncNever
+	default:
+		return fmt.Errorf("unknown sync mode %q: %w", b, os.ErrInvalid)
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package haraqafs
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseConfig(t *testing.T) {
+	v1 := newTmpVolume(t, "config_1*")
+	defer os.RemoveAll(v1)
+	v2 := newTmpVolume(t, "config_2*")
+	defer os.RemoveAll(v2)
+
+	cfg := `{
+		"volumes": [{"path": "` + v1 + `", "sync": "always"}, {"path": "` + v2 + `", "read_weight": 2}],
+		"quorum": 2,
+		"hashing": "sha256"
+	}`
+	fsys, err := ParseConfig(strings.NewReader(cfg))
+	checkErr(t, err)
+	f, err := fsys.New("my_file", WithCreate())
+	checkErr(t, err)
+	if f.hashing == nil || f.quorum != 2 || !f.shouldSync(0) {
+		t.Fatal(f)
+	}
+	checkWrite(t, f, []byte("hello"))
+	checkClose(t, f)
+
+	path := filepath.Join(v1, "config.json")
+	checkErr(t, os.WriteFile(path, []byte(cfg), 0666))
+	_, err = LoadConfig(path)
+	checkErr(t, err)
+
+	for _, bad := range []string{
+		`{}`,
+		`{"volumes": [{"path": "/tmp"}], "hashing": "nope"}`,
+		`{"volumes": [{"path": "/tmp", "sync": "sometimes"}]}`,
+		`{"volumes": [{"path": "/tmp"}], "unknown": true}`,
+	} {
+		if _, err = ParseConfig(strings.NewReader(bad)); err == nil {
+			t.Fatal("expected error for", bad)
+		}
+	}
+	if _, err = LoadConfig("config.yaml"); err == nil {
+		t.Fatal("expected error")
+	}
+	if _, err = LoadConfig("config.ini"); !errors.Is(err, os.ErrInvalid) {
+		t.Fatal(err)
+	}
+}
+
+func TestConfigFormats(t *testing.T) {
+	volumes := newTmpVolumes(t, 2)
+	defer removeVolumes(volumes)
+
+	for name, cfg := range map[string]string{
+		"config.yaml": `
+volumes:
+  - path: ` + volumes[0] + `
+    sync: always
+  - path: ` + volumes[1] + `
+quorum: 2
+sync_policy: data
+`,
+		"config.toml": `
+quorum = 2
+sync_policy = "data"
+
+[[volumes]]
+path = "` + volumes[0] + `"
+sync = "always"
+
+[[volumes]]
+path = "` + volumes[1] + `"
+`,
+	} {
+		path := filepath.Join(volumes[0], name)
+		checkErr(t, os.WriteFile(path, []byte(cfg), 0666))
+		fsys, err := LoadConfig(path)
+		checkErr(t, err)
+		f, err := fsys.New("my_file", WithCreate())
+		checkErr(t, err)
+		if f.quorum != 2 || f.syncPolicy != SyncData || f.spec(0).Sync != SyncAlways || f.spec(1).Sync != SyncDefault {
+			t.Fatal(name, f.quorum, f.syncPolicy, f.specs)
+		}
+		checkClose(t, f)
+	}
+
+	// the fields are checked just as they are in json
+	for format, bad := range map[string]string{
+		"yaml": "volumes:\n  - path: /tmp\nunknown: true\n",
+		"toml": "unknown = true\n[[volumes]]\npath = \"/tmp\"\n",
+		"ini":  "",
+	} {
+		if _, err := ParseConfigFormat(strings.NewReader(bad), format); err == nil {
+			t.Fatal("expected error for", format)
+		}
+	}
+}
+
+func TestConfigNew(t *testing.T) {
+	v1 := newTmpVolume(t, "config_new_1*")
+	defer os.RemoveAll(v1)
+	v2 := newTmpVolume(t, "config_new_2*")
+	defer os.RemoveAll(v2)
+
+	c := Config{Volumes: []Volume{{Path: v1}, {Path: v2}}, Quorum: 2, Hashing: "crc32"}
+	checkErr(t, c.Validate())
+	f, err := c.New("my_file", WithCreate())
+	checkErr(t, err)
+	checkWrite(t, f, []byte("hello"))
+	checkClose(t, f)
+
+	c.Quorum = -1
+	if err = c.Validate(); err == nil {
+		t.Fatal("expected error")
+	}
+	if _, err = c.New("my_file"); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestConfigRingSpecs(t *testing.T) {
+	volumes := newTmpVolumes(t, 3)
+	defer removeVolumes(volumes)
+
+	c := Config{Ring: &RingConfig{VirtualNodes: 8, Replicas: 2}}
+	for i, v := range volumes {
+		c.Volumes = append(c.Volumes, Volume{Path: v, Sync: SyncNever, ReadWeight: i + 1})
+	}
+	f, err := c.New("my_file", WithCreate())
+	checkErr(t, err)
+	if len(f.volumes) != 2 {
+		t.Fatal(f.volumes)
+	}
+	for i := range f.volumes {
+		if spec := f.spec(i); spec.Path != f.volumes[i] || spec.Sync != SyncNever || volumes[spec.ReadWeight-1] != spec.Path {
+			t.Fatal(spec)
+		}
+	}
+	checkClose(t, f)
+}
@@ -0,0 +1,33 @@
+package haraqafs
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestConsensusSizes(t *testing.T) {
+	const fileName = "my_file"
+	var volumes []string
+	for _, msg := range []string{"hello", "hello", "hello world"} {
+		v := newTmpVolume(t, "consensus_*")
+		defer os.RemoveAll(v)
+		checkErr(t, os.WriteFile(filepath.Join(v, fileName), []byte(msg), 0666))
+		volumes = append(volumes, v)
+	}
+
+	// sizes line up with the replicas, so appends go to the end of the source the quorum agreed on
+	f, err := New(fileName, WithVolumes(append([]string(nil), volumes...)...), WithAppendOnly(true))
+	checkErr(t, err)
+	if f.offset != 5 {
+		t.Fatal(f.offset)
+	}
+	checkClose(t, f)
+
+	// a replica which didn't open doesn't vote with a hash left over from an earlier consensus
+	checkErr(t, os.Remove(filepath.Join(volumes[0], fileName)))
+	checkErr(t, os.WriteFile(filepath.Join(volumes[1], fileName), []byte("hi"), 0666))
+	if _, err = New(fileName, WithVolumes(append([]string(nil), volumes...)...)); err == nil {
+		t.Fatal("consensus reached without a quorum")
+	}
+}
@@ -0,0 +1,105 @@
+package haraqafs
+
+import (
+	"context"
+	"fmt"
+	"os"
+)
+
+// NewContext is New giving up once ctx is done, while waiting for locks or part way through repairing a divergent replica.
+// ctx only covers opening, use WithContext to cover the file's later calls too
+func NewContext(ctx context.Context, name string, opts ...FileOption) (*File, error) {
+	if ctx == nil {
+		return nil, fmt.Errorf("nil context: %w", os.ErrInvalid)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	f, err := New(name, append(opts[:len(opts):len(opts)], func(f *File) error {
+		f.openCtx = ctx
+		return nil
+	})...)
+	if err != nil {
+		return nil, err
+	}
+	f.openCtx = nil
+	return f, nil
+}
+
+// aborted returns why long running work on the file, like consensus repair, should stop early
+func (f *File) aborted() error {
+	for _, ctx := range []context.Context{f.openCtx, f.ctx} {
+		if ctx != nil && ctx.Err() != nil {
+			return fmt.Errorf("aborted: %w", ctx.Err())
+		}
+	}
+	return nil
+}
+
+// ReadAtContext is ReadAt giving up once ctx is done, while waiting for the file lock or between chunks of a large read
+func (f *File) ReadAtContext(ctx context.Context, b []byte, off int64) (int, error) {
+	if f == nil || len(f.multi) == 0 || f.lock == nil {
+		return 0, os.ErrInvalid
+	}
+	if err := f.acquireReadContext(ctx); err != nil {
+		return 0, err
+	}
+	defer f.releaseRead()
+
+	var n int
+	for n < len(b) {
+		if err := ctx.Err(); err != nil {
+			return n, err
+		}
+		end := n + f.chunkSize()
+		if end > len(b) {
+			end = len(b)
+		}
+		m, err := f.read(b[n:end], off+int64(n))
+		n += m
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// WriteAtContext is WriteAt giving up once ctx is done, while waiting for the file lock or between chunks of a large write.
+// the chunks already written stay written, n reports how many bytes they hold
+func (f *File) WriteAtContext(ctx context.Context, b []byte, off int64) (int, error) {
+	if f == nil || len(f.multi) == 0 || f.lock == nil {
+		return 0, os.ErrInvalid
+	}
+	if f.readOnly {
+		return 0, errReadOnly
+	}
+	if f.appendWrites {
+		return 0, errWriteAtInAppendMode
+	}
+	if err := f.takeContext(ctx, true); err != nil {
+		return 0, err
+	}
+	defer f.lock.unlock()
+
+	// framed and validated writes must land whole
+	chunk := f.chunkSize()
+	if f.framing || f.validate != nil {
+		chunk = len(b)
+	}
+	var n int
+	for n < len(b) || len(b) == 0 {
+		if err := ctx.Err(); err != nil {
+			return n, err
+		}
+		end := n + chunk
+		if end > len(b) {
+			end = len(b)
+		}
+		m, err := f.write(b[n:end], off+int64(n), &f.offset)
+		n += m
+		if err != nil || len(b) == 0 {
+			return n, err
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,98 @@
+package haraqafs
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// cancellingWriter cancels a context on its first write
+type cancellingWriter struct {
+	writeSyncer
+	cancel context.CancelFunc
+}
+
+func (w cancellingWriter) WriteAt(b []byte, off int64) (int, error) {
+	w.cancel()
+	return w.writeSyncer.WriteAt(b, off)
+}
+
+func TestNewContext(t *testing.T) {
+	volumes := newTmpVolumes(t, 3)
+	defer removeVolumes(volumes)
+	const block = 16
+	for i, v := range volumes {
+		b := bytes.Repeat([]byte("a"), 8*block)
+		if i == 2 {
+			b = bytes.Repeat([]byte("b"), 8*block)
+		}
+		checkErr(t, os.WriteFile(filepath.Join(v, "my_file"), b, 0666))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := NewContext(ctx, "my_file", WithVolumes(volumes...)); !errors.Is(err, context.Canceled) {
+		t.Fatal(err)
+	}
+
+	// cancelling part way through a repair abandons it
+	ctx, cancel = context.WithCancel(context.Background())
+	_, err := NewContext(ctx, "my_file", WithVolumes(volumes...), WithHashing(sha256.New()), WithBlockRepair(block), withWrapReplica(func(i int, w writeSyncer) writeSyncer {
+		return cancellingWriter{writeSyncer: w, cancel: cancel}
+	}))
+	if !errors.Is(err, context.Canceled) {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(filepath.Join(volumes[2], "my_file"))
+	checkErr(t, err)
+	if !bytes.Equal(b, append(bytes.Repeat([]byte("a"), block), bytes.Repeat([]byte("b"), 7*block)...)) {
+		t.Fatal(string(b))
+	}
+
+	// the context only covers opening
+	ctx, cancel = context.WithCancel(context.Background())
+	f, err := NewContext(ctx, "my_file", WithVolumes(volumes...), WithHashing(sha256.New()), WithBlockRepair(block))
+	checkErr(t, err)
+	defer checkClose(t, f)
+	cancel()
+	checkRead(t, f, bytes.Repeat([]byte("a"), 8*block))
+}
+
+func TestWriteAtContext(t *testing.T) {
+	volumes := newTmpVolumes(t, 3)
+	defer removeVolumes(volumes)
+	const block = 16
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var calls int
+	f, err := New("my_file", WithVolumes(volumes...), WithCreate(), WithBlockRepair(block),
+		WithMiddleware(func(c Call, next func(Call) (int, error)) (int, error) {
+			if c.Op == OpWrite {
+				calls++
+				cancel()
+			}
+			return next(c)
+		}))
+	checkErr(t, err)
+	defer checkClose(t, f)
+
+	n, err := f.WriteAtContext(ctx, bytes.Repeat([]byte("a"), 4*block), 0)
+	if n != block || calls != 1 || !errors.Is(err, context.Canceled) {
+		t.Fatal(n, calls, err)
+	}
+	b := make([]byte, 4*block)
+	if n, err = f.ReadAtContext(ctx, b, 0); !errors.Is(err, context.Canceled) {
+		t.Fatal(n, err)
+	}
+	if n, err = f.ReadAtContext(context.Background(), b[:block], 0); n != block || err != nil {
+		t.Fatal(n, err)
+	}
+	if !bytes.Equal(b[:block], bytes.Repeat([]byte("a"), block)) {
+		t.Fatal(string(b))
+	}
+}
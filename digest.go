@@ -0,0 +1,211 @@
+package haraqafs
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"os"
+	"time"
+)
+
+// digestSuffix names the sidecar holding a replica's block checksums,
+// laid out as the replica's size and mod time followed by one crc per block
+const digestSuffix = ".haraqafs-sum"
+
+const (
+	digestBlock  = 64 << 10
+	digestHeader = 16
+)
+
+func digestPath(path string) string {
+	return path + digestSuffix
+}
+
+// loadDigests reads every replica's block checksums, rebuilding the sidecars which are missing or out of date
+func (f *File) loadDigests() error {
+	if !f.verifiedReads {
+		return nil
+	}
+	f.digests = make([][]uint32, len(f.multi))
+	for i := range f.multi {
+		if f.multi[i] == nil {
+			continue
+		}
+		info, err := f.multi[i].Stat()
+		if err != nil {
+			return fmt.Errorf("stat failed for %s: %w", f.paths[i], err)
+		}
+		if sums, ok := readDigests(f.paths[i], info); ok {
+			f.digests[i] = sums
+			continue
+		}
+		// read only files can't fix the sidecar, their replica just goes unverified
+		if f.readOnly {
+			continue
+		}
+		if err = f.rebuildDigests(i); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readDigests(path string, info os.FileInfo) ([]uint32, bool) {
+	b, err := os.ReadFile(digestPath(path))
+	if err != nil || len(b) < digestHeader || (len(b)-digestHeader)%4 != 0 {
+		return nil, false
+	}
+	if int64(binary.LittleEndian.Uint64(b)) != info.Size() || int64(binary.LittleEndian.Uint64(b[8:])) != info.ModTime().UnixNano() {
+		return nil, false
+	}
+	sums := make([]uint32, (len(b)-digestHeader)/4)
+	if int64(len(sums)) != blocks(info.Size()) {
+		return nil, false
+	}
+	for k := range sums {
+		sums[k] = binary.LittleEndian.Uint32(b[digestHeader+4*k:])
+	}
+	return sums, true
+}
+
+func blocks(size int64) int64 {
+	return (size + digestBlock - 1) / digestBlock
+}
+
+func (f *File) rebuildDigests(i int) error {
+	f.digests[i] = nil
+	return f.updateDigests(i, 0, math.MaxInt64)
+}
+
+// updateDigests rehashes the blocks of replica i overlapping from to end and any it grew by, then replaces its sidecar
+func (f *File) updateDigests(i int, from, end int64) error {
+	info, err := f.multi[i].Stat()
+	if err != nil {
+		return fmt.Errorf("stat failed for %s: %w", f.paths[i], err)
+	}
+	old := f.digests[i]
+	n := blocks(info.Size())
+	first, last := from/digestBlock, n
+	if end < n*digestBlock {
+		last = blocks(end)
+	}
+	sums := make([]uint32, n)
+	copy(sums, old)
+	buf := make([]byte, digestBlock)
+	for k := int64(0); k < n; k++ {
+		if k < int64(len(old)) && (k < first || k >= last) {
+			continue
+		}
+		m, err := f.multi[i].ReadAt(buf, k*digestBlock)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("read failed for %s: %w", f.paths[i], err)
+		}
+		sums[k] = crc32.Checksum(buf[:m], crcTable)
+	}
+
+	out := make([]byte, digestHeader+4*len(sums))
+	binary.LittleEndian.PutUint64(out, uint64(info.Size()))
+	binary.LittleEndian.PutUint64(out[8:], uint64(info.ModTime().UnixNano()))
+	for k := range sums {
+		binary.LittleEndian.PutUint32(out[digestHeader+4*k:], sums[k])
+	}
+	// a sidecar torn by a crash would fail every block it covers, so it's replaced whole
+	if err = replaceFile(digestPath(f.paths[i]), out); err != nil {
+		return fmt.Errorf("write failed for %s: %w", digestPath(f.paths[i]), err)
+	}
+	f.digests[i] = sums
+	return nil
+}
+
+// digestsChanged updates the checksums of every replica written to between from and end. the write already reached
+// the replicas, so one whose sidecar can't be updated goes unverified rather than failing it
+func (f *File) digestsChanged(from, end int64) {
+	if f.digests == nil {
+		return
+	}
+	for i := range f.multi {
+		if !f.usable(i) {
+			continue
+		}
+		if err := f.updateDigests(i, from, end); err != nil {
+			f.dropDigests(i)
+		}
+	}
+}
+
+// dropDigests leaves replica i without checksums, its stale sidecar is removed so it isn't trusted on the next open either
+func (f *File) dropDigests(i int) {
+	f.digests[i] = nil
+	_ = os.Remove(digestPath(f.paths[i]))
+	f.markVerified(i, 0)
+}
+
+// readVerified reads from the first usable replica whose blocks covering the range match their checksums
+func (f *File) readVerified(b []byte, off int64) (int, error) {
+	if off >= f.size {
+		return 0, io.EOF
+	}
+	end := off + int64(len(b))
+	if end > f.size {
+		end = f.size
+	}
+	first := off / digestBlock
+	buf := make([]byte, (blocks(end)-first)*digestBlock)
+	errs := []error{fmt.Errorf("no replica could be verified at offset %d: %w", off, ErrCorrupt)}
+	var plan [8]int
+	replicas := f.readPlan(plan[:0])
+	if len(replicas) == 0 {
+		return 0, f.unservable(off, len(b))
+	}
+	for _, i := range replicas {
+		// a replica without a sidecar can't be verified, it's neither trusted nor blamed
+		if f.digests[i] == nil {
+			errs = append(errs, pathErr("read", f.paths[i], ErrStaleRead))
+			continue
+		}
+		start := time.Now()
+		n, err := f.multi[i].ReadAt(buf, first*digestBlock)
+		f.observe(i, opRead, start)
+		if err != nil && !errors.Is(err, io.EOF) {
+			f.readFailed(i)
+			errs = append(errs, pathErr("read", f.paths[i], err))
+			continue
+		}
+		if int64(n) < end-first*digestBlock {
+			errs = append(errs, pathErr("read", f.paths[i], io.ErrUnexpectedEOF))
+			continue
+		}
+		if !f.verifyBlocks(i, first, buf[:n]) {
+			f.markVerified(i, 0)
+			f.readFailed(i)
+			errs = append(errs, pathErr("read", f.paths[i], ErrCorrupt))
+			continue
+		}
+		n = copy(b, buf[off-first*digestBlock:end-first*digestBlock])
+		if n < len(b) {
+			return n, io.EOF
+		}
+		return n, nil
+	}
+	return 0, aggErrors(errs)
+}
+
+func (f *File) verifyBlocks(i int, first int64, data []byte) bool {
+	sums := f.digests[i]
+	for k := int64(0); k*digestBlock < int64(len(data)); k++ {
+		if first+k >= int64(len(sums)) {
+			return false
+		}
+		block := data[k*digestBlock:]
+		if len(block) > digestBlock {
+			block = block[:digestBlock]
+		}
+		if crc32.Checksum(block, crcTable) != sums[first+k] {
+			return false
+		}
+	}
+	return true
+}
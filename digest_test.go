@@ -0,0 +1,111 @@
+package haraqafs
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWithVerifiedReads(t *testing.T) {
+	volumes := newTmpVolumes(t, 3)
+	defer removeVolumes(volumes)
+	want := make([]byte, 3*digestBlock+100)
+	rand.New(rand.NewSource(1)).Read(want)
+
+	f, err := New("my_file", WithVolumes(volumes...), WithCreate(), WithVerifiedReads())
+	checkErr(t, err)
+	checkWrite(t, f, want)
+	checkClose(t, f)
+
+	// flip a byte in place without changing the size or mod time, consensus can't notice
+	corrupt := func(v string) {
+		path := filepath.Join(v, "my_file")
+		info, err := os.Stat(path)
+		checkErr(t, err)
+		b, err := os.ReadFile(path)
+		checkErr(t, err)
+		b[digestBlock+5]++
+		checkErr(t, os.WriteFile(path, b, 0666))
+		checkErr(t, os.Chtimes(path, info.ModTime(), info.ModTime()))
+	}
+	corrupt(volumes[0])
+
+	f, err = New("my_file", WithVolumes(append([]string(nil), volumes...)...), WithVerifiedReads())
+	checkErr(t, err)
+	got := make([]byte, 10)
+	_, err = f.ReadAt(got, digestBlock)
+	checkErr(t, err)
+	if !bytes.Equal(got, want[digestBlock:digestBlock+10]) {
+		t.Fatal(got)
+	}
+
+	// blocks which weren't touched still read from the first replica
+	_, err = f.ReadAt(got, 0)
+	checkErr(t, err)
+	if !bytes.Equal(got, want[:10]) {
+		t.Fatal(got)
+	}
+	checkClose(t, f)
+
+	corrupt(volumes[1])
+	corrupt(volumes[2])
+	f, err = New("my_file", WithVolumes(append([]string(nil), volumes...)...), WithVerifiedReads())
+	checkErr(t, err)
+	if _, err = f.ReadAt(got, digestBlock); !errors.Is(err, ErrCorrupt) {
+		t.Fatal(err)
+	}
+	checkClose(t, f)
+}
+
+func TestDigestUpdates(t *testing.T) {
+	volumes := newTmpVolumes(t, 3)
+	defer removeVolumes(volumes)
+	want := make([]byte, 3*digestBlock+100)
+	rand.New(rand.NewSource(2)).Read(want)
+
+	f, err := New("my_file", WithVolumes(volumes...), WithCreate(), WithVerifiedReads())
+	checkErr(t, err)
+	checkWrite(t, f, want[:digestBlock+10])
+	checkWrite(t, f, want[digestBlock+10:])
+	_, err = f.WriteAt(want[2*digestBlock-5:2*digestBlock+5], 2*digestBlock-5)
+	checkErr(t, err)
+	checkErr(t, f.Truncate(int64(len(want)-50)))
+	want = want[:len(want)-50]
+
+	// the blocks rehashed piecemeal match a full rebuild
+	sums := append([]uint32(nil), f.digests[0]...)
+	checkErr(t, f.rebuildDigests(0))
+	if len(sums) != len(f.digests[0]) {
+		t.Fatal(sums, f.digests[0])
+	}
+	for k := range sums {
+		if sums[k] != f.digests[0][k] {
+			t.Fatal(k, sums, f.digests[0])
+		}
+	}
+	checkClose(t, f)
+
+	// replicas whose sidecar is missing aren't served as verified
+	for _, v := range volumes {
+		checkErr(t, os.Remove(digestPath(filepath.Join(v, "my_file"))))
+	}
+	f, err = New("my_file", WithVolumes(append([]string(nil), volumes...)...), WithReadOnly(), WithVerifiedReads())
+	checkErr(t, err)
+	got := make([]byte, 10)
+	if _, err = f.ReadAt(got, 0); !errors.Is(err, ErrStaleRead) {
+		t.Fatal(err)
+	}
+	checkClose(t, f)
+
+	f, err = New("my_file", WithVolumes(append([]string(nil), volumes...)...), WithVerifiedReads())
+	checkErr(t, err)
+	_, err = f.ReadAt(got, int64(len(want)-10))
+	checkErr(t, err)
+	if !bytes.Equal(got, want[len(want)-10:]) {
+		t.Fatal(got)
+	}
+	checkClose(t, f)
+}
@@ -0,0 +1,382 @@
+package haraqafs
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Dir is a directory replicated across volumes
+type Dir struct {
+	name    string
+	opts    []FileOption
+	volumes []string
+	paths   []string
+	quorum  int
+	create  bool
+	entries []DirEntry
+	read    bool
+}
+
+// settings applies opts to a scratch file to read back the configuration
+func settings(opts []FileOption) (*File, error) {
+	f := &File{flags: os.O_RDWR}
+	if err := applyScratch(f, opts); err != nil {
+		return nil, err
+	}
+	if f.ring != nil {
+		f.volumes = f.ring.Volumes()
+	}
+	if len(f.volumes) == 0 {
+		return nil, fmt.Errorf("missing volumes: %w", os.ErrInvalid)
+	}
+	if f.quorum == 0 {
+		f.quorum = 1 + len(f.volumes)/2
+	}
+	if f.quorum > len(f.volumes) {
+		return nil, &QuorumError{Quorum: f.quorum, Volumes: len(f.volumes)}
+	}
+	return f, nil
+}
+
+// OpenDir opens a directory across volumes, with WithCreate or WithCreateIfNotExist missing replicas are created
+func OpenDir(name string, opts ...FileOption) (*Dir, error) {
+	f, err := settings(opts)
+	if err != nil {
+		return nil, err
+	}
+	if name, err = logicalName("open", name); err != nil {
+		return nil, err
+	}
+	d := &Dir{
+		name:    name,
+		opts:    opts,
+		volumes: f.volumes,
+		quorum:  f.quorum,
+		create:  f.flags&os.O_CREATE != 0,
+	}
+	d.paths = make([]string, len(d.volumes))
+	for i := range d.volumes {
+		d.paths[i] = filepath.Join(d.volumes[i], f.jailName(d.name))
+	}
+	if err = f.checkJail(d.volumes, d.paths); err != nil {
+		return nil, err
+	}
+	if err = d.Repair(); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+func (d *Dir) Name() string {
+	return d.name
+}
+
+// Repair creates the directory on volumes missing it, and recreates entries held by a quorum of replicas but missing from others
+func (d *Dir) Repair() error {
+	var present int
+	var errs []error
+	for _, p := range d.paths {
+		info, err := os.Stat(p)
+		switch {
+		case err == nil && !info.IsDir():
+			return fmt.Errorf("%s is not a directory: %w", p, os.ErrInvalid)
+		case err == nil:
+			present++
+		case !errors.Is(err, os.ErrNotExist):
+			errs = append(errs, err)
+		}
+	}
+	if present < d.quorum && !d.create {
+		return aggErrors(append(errs, fmt.Errorf("directory %s found on %d of %d volumes: %w", d.name, present, len(d.paths), os.ErrNotExist)))
+	}
+	for _, p := range d.paths {
+		if err := os.MkdirAll(p, os.ModePerm); err != nil {
+			errs = append(errs, fmt.Errorf("mkdir failed for %s: %w", p, err))
+		}
+	}
+	if len(d.paths)-len(errs) < d.quorum {
+		return aggErrors(errs)
+	}
+
+	// bring entries held by a quorum back onto every replica
+	entries, missing, err := d.list()
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if len(missing[e.Name()]) == 0 {
+			continue
+		}
+		if e.IsDir() {
+			for _, i := range missing[e.Name()] {
+				if err := os.MkdirAll(filepath.Join(d.paths[i], e.Name()), os.ModePerm); err != nil {
+					errs = append(errs, err)
+				}
+			}
+			continue
+		}
+		f, err := d.open(e.Name())
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if err = f.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return aggErrors(errs)
+	}
+	return nil
+}
+
+// list returns the entries found on at least a quorum of replicas, and which replicas are missing each of them
+func (d *Dir) list() ([]DirEntry, map[string][]int, error) {
+	type seen struct {
+		entry DirEntry
+		on    []bool
+		count int
+	}
+	all := make(map[string]*seen)
+	var errs []error
+	var listed int
+	for i, p := range d.paths {
+		entries, err := os.ReadDir(p)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		listed++
+		for _, e := range entries {
+			if internalName(e.Name()) {
+				continue
+			}
+			// entries of different types on different replicas are counted separately
+			key := e.Name() + "/" + e.Type().String()
+			s, ok := all[key]
+			if !ok {
+				s = &seen{entry: e, on: make([]bool, len(d.paths))}
+				all[key] = s
+			}
+			s.on[i] = true
+			s.count++
+		}
+	}
+	if listed < d.quorum {
+		return nil, nil, aggErrors(append(errs, &QuorumError{Quorum: d.quorum, Volumes: listed}))
+	}
+
+	var entries []DirEntry
+	missing := make(map[string][]int)
+	for _, s := range all {
+		if s.count < d.quorum {
+			continue
+		}
+		entries = append(entries, s.entry)
+		for i := range s.on {
+			if !s.on[i] {
+				missing[s.entry.Name()] = append(missing[s.entry.Name()], i)
+			}
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, missing, nil
+}
+
+// ReadDir returns the entries found on a quorum of replicas, with the same paging semantics as os.File.ReadDir
+func (d *Dir) ReadDir(n int) ([]DirEntry, error) {
+	if !d.read {
+		entries, _, err := d.list()
+		if err != nil {
+			return nil, err
+		}
+		d.entries = entries
+		d.read = true
+	}
+	if n <= 0 {
+		entries := d.entries
+		d.entries = nil
+		return entries, nil
+	}
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(d.entries) {
+		n = len(d.entries)
+	}
+	entries := d.entries[:n:n]
+	d.entries = d.entries[n:]
+	return entries, nil
+}
+
+// Mkdir creates a child directory on every volume
+func (d *Dir) Mkdir(name string, perm os.FileMode) error {
+	return d.each(name, "mkdir", func(path string) error {
+		err := os.Mkdir(path, perm)
+		if errors.Is(err, os.ErrExist) {
+			return nil
+		}
+		return err
+	})
+}
+
+// Remove removes a child file or empty directory from every volume along with its sidecars,
+// replicas which are already missing count as removed
+func (d *Dir) Remove(name string) error {
+	if err := d.checkPinned("remove", name); err != nil {
+		return err
+	}
+	return d.each(name, "remove", func(path string) error {
+		err := os.Remove(path)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return removeSidecars(path)
+	})
+}
+
+// RemoveAll removes a child and everything under it from every volume, along with the sidecars of a child file
+func (d *Dir) RemoveAll(name string) error {
+	if err := d.checkPinned("remove", name); err != nil {
+		return err
+	}
+	return d.each(name, "remove", func(path string) error {
+		if err := os.RemoveAll(path); err != nil {
+			return err
+		}
+		return removeSidecars(path)
+	})
+}
+
+// Rename moves a child file or directory to newname on every volume, taking the sidecars of a file with it,
+// replicas which are already missing count as renamed
+func (d *Dir) Rename(oldname, newname string) error {
+	oldname, err := childName("rename", oldname)
+	if err != nil {
+		return err
+	}
+	if newname, err = childName("rename", newname); err != nil {
+		return err
+	}
+	if err = d.checkPinned("rename", oldname); err != nil {
+		return err
+	}
+	if err = d.checkPinned("rename", newname); err != nil {
+		return err
+	}
+	var errs []error
+	for _, p := range d.paths {
+		from, to := filepath.Join(p, oldname), filepath.Join(p, newname)
+		if err := renameReplica(from, to); err != nil && !errors.Is(err, os.ErrNotExist) {
+			errs = append(errs, fmt.Errorf("rename failed for %s: %w", from, err))
+		}
+	}
+	if len(d.paths)-len(errs) < d.quorum {
+		return aggErrors(errs)
+	}
+	d.entries, d.read = nil, false
+	return nil
+}
+
+func (d *Dir) each(name, op string, fn func(path string) error) error {
+	name, err := childName(op, name)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, p := range d.paths {
+		if err := fn(filepath.Join(p, name)); err != nil {
+			errs = append(errs, fmt.Errorf("%s failed for %s: %w", op, filepath.Join(p, name), err))
+		}
+	}
+	if len(d.paths)-len(errs) < d.quorum {
+		return aggErrors(errs)
+	}
+	return nil
+}
+
+// RemoveContents removes every entry of the directory from every replica, including entries not held by a quorum,
+// leaving the directory itself in place. An entry only fails if it remains on more replicas than quorum allows.
+// pinned entries and their sidecars are kept and reported with ErrPinned
+func (d *Dir) RemoveContents() error {
+	names := make(map[string]bool)
+	for _, p := range d.paths {
+		entries, err := os.ReadDir(p)
+		if err != nil {
+			continue
+		}
+		for _, e := range entries {
+			names[e.Name()] = true
+		}
+	}
+
+	var errs []error
+	for name := range names {
+		if keptByPin(names, name) {
+			continue
+		}
+		if err := d.checkPinned("remove", name); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		var entryErrs []error
+		for _, p := range d.paths {
+			if err := os.RemoveAll(filepath.Join(p, name)); err != nil {
+				entryErrs = append(entryErrs, err)
+			}
+		}
+		if len(d.paths)-len(entryErrs) < d.quorum {
+			errs = append(errs, entryErrs...)
+		}
+	}
+	d.entries, d.read = nil, false
+	return aggErrors(errs)
+}
+
+// childName cleans name, which must stay within the directory
+func childName(op, name string) (string, error) {
+	clean := filepath.Clean(name)
+	if clean == "." || filepath.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s %s: %w", op, name, os.ErrInvalid)
+	}
+	return clean, nil
+}
+
+// Create creates or truncates a child file, inheriting the directory's volumes, quorum and options
+func (d *Dir) Create(name string) (*File, error) {
+	return d.Open(name, WithCreate())
+}
+
+// Open opens a child file, inheriting the directory's volumes, quorum and options, opts are applied after the inherited ones
+func (d *Dir) Open(name string, opts ...FileOption) (*File, error) {
+	name, err := childName("open", name)
+	if err != nil {
+		return nil, err
+	}
+	return d.open(name, opts...)
+}
+
+// OpenDir opens a child directory, inheriting the directory's volumes, quorum and options
+func (d *Dir) OpenDir(name string, opts ...FileOption) (*Dir, error) {
+	name, err := childName("open", name)
+	if err != nil {
+		return nil, err
+	}
+	all := make([]FileOption, 0, len(d.opts)+len(opts)+1)
+	all = append(all, d.opts...)
+	all = append(all, WithVolumes(d.volumes...))
+	return OpenDir(filepath.Join(d.name, name), append(all, opts...)...)
+}
+
+// open opens a child file using the directory's volumes and options
+func (d *Dir) open(name string, opts ...FileOption) (*File, error) {
+	all := make([]FileOption, 0, len(d.opts)+len(opts)+1)
+	all = append(all, d.opts...)
+	all = append(all, WithVolumes(d.volumes...), WithFlags(os.O_RDWR))
+	return New(filepath.Join(d.name, name), append(all, opts...)...)
+}
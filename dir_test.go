@@ -0,0 +1,219 @@
+package haraqafs
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestOpenDir(t *testing.T) {
+	volumes := newTmpVolumes(t, 3)
+	defer removeVolumes(volumes)
+
+	if _, err := OpenDir("dir", WithVolumes(volumes...)); !errors.Is(err, os.ErrNotExist) {
+		t.Fatal(err)
+	}
+	d, err := OpenDir("dir", WithVolumes(volumes...), WithCreateIfNotExist())
+	checkErr(t, err)
+	checkErr(t, d.Mkdir("sub", os.ModePerm))
+
+	// a file on a quorum of replicas is listed, one on a single replica is not
+	for _, v := range volumes[:2] {
+		checkErr(t, os.WriteFile(filepath.Join(v, "dir", "quorum"), []byte("hello"), 0666))
+	}
+	checkErr(t, os.WriteFile(filepath.Join(volumes[2], "dir", "stray"), []byte("hello"), 0666))
+
+	entries, err := d.ReadDir(-1)
+	checkErr(t, err)
+	if len(entries) != 2 || entries[0].Name() != "quorum" || entries[1].Name() != "sub" || !entries[1].IsDir() {
+		t.Fatal(entries)
+	}
+
+	// repair copies the quorum file onto the missing replica
+	checkErr(t, os.RemoveAll(filepath.Join(volumes[1], "dir", "sub")))
+	checkErr(t, d.Repair())
+	b, err := os.ReadFile(filepath.Join(volumes[2], "dir", "quorum"))
+	checkErr(t, err)
+	if string(b) != "hello" {
+		t.Fatal(string(b))
+	}
+	if _, err = os.Stat(filepath.Join(volumes[1], "dir", "sub")); err != nil {
+		t.Fatal(err)
+	}
+
+	// paging
+	d, err = OpenDir("dir", WithVolumes(volumes...))
+	checkErr(t, err)
+	entries, err = d.ReadDir(1)
+	checkErr(t, err)
+	if len(entries) != 1 || entries[0].Name() != "quorum" {
+		t.Fatal(entries)
+	}
+	entries, err = d.ReadDir(5)
+	checkErr(t, err)
+	if len(entries) != 1 {
+		t.Fatal(entries)
+	}
+	if _, err = d.ReadDir(1); err != io.EOF {
+		t.Fatal(err)
+	}
+
+	checkErr(t, d.Remove("quorum"))
+	checkErr(t, d.Remove("sub"))
+	for _, v := range volumes {
+		if _, err = os.Stat(filepath.Join(v, "dir", "quorum")); !errors.Is(err, os.ErrNotExist) {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestDirCreate(t *testing.T) {
+	volumes := newTmpVolumes(t, 3)
+	defer removeVolumes(volumes)
+
+	d, err := OpenDir("tree", WithVolumes(volumes...), WithCreateIfNotExist(), WithQuorum(3))
+	checkErr(t, err)
+	sub, err := d.OpenDir("child", WithCreateIfNotExist())
+	checkErr(t, err)
+
+	f, err := sub.Create("leaf")
+	checkErr(t, err)
+	if f.quorum != 3 || len(f.paths) != 3 || f.paths[0] != filepath.Join(volumes[0], "tree", "child", "leaf") {
+		t.Fatal(f.quorum, f.paths)
+	}
+	checkWrite(t, f, []byte("hello"))
+	checkClose(t, f)
+
+	f, err = sub.Open("leaf")
+	checkErr(t, err)
+	checkRead(t, f, []byte("hello"))
+	checkClose(t, f)
+
+	for _, bad := range []string{"..", "../escape", "/abs", "."} {
+		if _, err = d.Open(bad); !errors.Is(err, os.ErrInvalid) {
+			t.Fatal(bad, err)
+		}
+	}
+}
+
+func TestDirRemoveContents(t *testing.T) {
+	volumes := newTmpVolumes(t, 3)
+	defer removeVolumes(volumes)
+
+	d, err := OpenDir("cache", WithVolumes(volumes...), WithCreateIfNotExist())
+	checkErr(t, err)
+	f, err := d.Create("entry")
+	checkErr(t, err)
+	checkClose(t, f)
+	checkErr(t, d.Mkdir("sub", os.ModePerm))
+	checkErr(t, os.WriteFile(filepath.Join(volumes[0], "cache", "stray"), nil, 0666))
+
+	checkErr(t, d.RemoveContents())
+	for _, v := range volumes {
+		entries, err := os.ReadDir(filepath.Join(v, "cache"))
+		checkErr(t, err)
+		if len(entries) != 0 {
+			t.Fatal(entries)
+		}
+	}
+}
+
+func TestDirSidecars(t *testing.T) {
+	volumes := newTmpVolumes(t, 3)
+	defer removeVolumes(volumes)
+
+	d, err := OpenDir("dir", WithVolumes(volumes...), WithCreateIfNotExist())
+	checkErr(t, err)
+	f, err := d.Open("a", WithCreate(), WithVerifiedReads())
+	checkErr(t, err)
+	checkWrite(t, f, []byte("hello"))
+	checkClose(t, f)
+	for _, v := range volumes {
+		checkErr(t, os.WriteFile(filepath.Join(v, "dir", "a.torn.5"), []byte("junk"), 0666))
+		// an older file's digests must not end up describing the renamed one
+		checkErr(t, os.WriteFile(filepath.Join(v, "dir", "b"+digestSuffix), []byte("stale"), 0666))
+	}
+
+	checkErr(t, d.Rename("a", "b"))
+	for _, v := range volumes {
+		for name, want := range map[string]bool{"a": false, "a" + digestSuffix: false, "a.torn.5": false, "b": true, "b.torn.5": true} {
+			if _, err := os.Stat(filepath.Join(v, "dir", name)); (err == nil) != want {
+				t.Fatal(name, err)
+			}
+		}
+		b, err := os.ReadFile(filepath.Join(v, "dir", "b"+digestSuffix))
+		checkErr(t, err)
+		if string(b) == "stale" {
+			t.Fatal("stale digests survived the rename")
+		}
+	}
+	f, err = d.Open("b", WithVerifiedReads())
+	checkErr(t, err)
+	checkRead(t, f, []byte("hello"))
+	checkClose(t, f)
+
+	checkErr(t, d.Remove("b"))
+	for _, v := range volumes {
+		entries, err := os.ReadDir(filepath.Join(v, "dir"))
+		checkErr(t, err)
+		if len(entries) != 0 {
+			t.Fatal(entries)
+		}
+	}
+}
+
+func TestDirPin(t *testing.T) {
+	volumes := newTmpVolumes(t, 3)
+	defer removeVolumes(volumes)
+
+	d, err := OpenDir("dir", WithVolumes(volumes...), WithCreateIfNotExist())
+	checkErr(t, err)
+	f, err := d.Create("a")
+	checkErr(t, err)
+	checkWrite(t, f, []byte("hello"))
+	checkClose(t, f)
+	checkErr(t, d.Pin("a"))
+	if ok, err := d.Pinned("a"); err != nil || !ok {
+		t.Fatal(ok, err)
+	}
+
+	for _, err := range []error{d.Remove("a"), d.RemoveAll("a"), d.Rename("a", "b"), d.RemoveContents()} {
+		if !errors.Is(err, ErrPinned) || !errors.Is(err, os.ErrPermission) {
+			t.Fatal(err)
+		}
+	}
+
+	// gc keeps the pinned file's garbage, diverged replicas aren't repaired
+	old := time.Now().Add(-time.Hour)
+	torn := filepath.Join(volumes[0], "dir", "a.torn.5")
+	checkErr(t, os.WriteFile(torn, []byte("junk"), 0666))
+	checkErr(t, os.Chtimes(torn, old, old))
+	checkErr(t, os.WriteFile(filepath.Join(volumes[2], "dir", "a"), []byte("other content"), 0666))
+	_, err = GC(volumes, time.Minute)
+	checkErr(t, err)
+	if _, err := os.Stat(torn); err != nil {
+		t.Fatal(err)
+	}
+	f, err = d.Open("a")
+	checkErr(t, err)
+	checkRead(t, f, []byte("hello"))
+	if err := f.Heal(); !errors.Is(err, ErrPinned) {
+		t.Fatal(err)
+	}
+	checkClose(t, f)
+	if b, err := os.ReadFile(filepath.Join(volumes[2], "dir", "a")); err != nil || string(b) != "other content" {
+		t.Fatal(string(b), err)
+	}
+	if _, err = d.Open("a", WithCreate()); !errors.Is(err, ErrPinned) {
+		t.Fatal(err)
+	}
+
+	checkErr(t, d.Unpin("a"))
+	checkErr(t, d.Remove("a"))
+	if ok, err := d.Pinned("a"); err != nil || ok {
+		t.Fatal(ok, err)
+	}
+}
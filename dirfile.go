@@ -0,0 +1,87 @@
+package haraqafs
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// openAsDir reports whether the replicas should be opened as a directory, which is the case when any of them already is one.
+// truncating a directory makes no sense, those opens fail like they would on a single volume
+func (f *File) openAsDir() bool {
+	if f.flags&os.O_TRUNC != 0 {
+		return false
+	}
+	for _, p := range f.paths {
+		if info, err := os.Stat(p); err == nil && info.IsDir() {
+			return true
+		}
+	}
+	return false
+}
+
+// viewDir sets up the Dir used to reconcile and list the replicas of a directory opened with New.
+// children it opens inherit the file's options
+func (f *File) viewDir(name string, opts []FileOption) {
+	f.dir = &Dir{
+		name:    filepath.Clean(name),
+		opts:    opts,
+		volumes: f.volumes,
+		paths:   f.paths,
+		quorum:  f.quorum,
+		create:  f.flags&os.O_CREATE != 0,
+	}
+}
+
+// openDirReplicas opens the directory replicas read only, the only way a directory can be opened.
+// missing replicas are left nil for dirConsensus to create
+func (f *File) openDirReplicas() []error {
+	var errs []error
+	for i := range f.paths {
+		start := time.Now()
+		tmp, err := os.Open(f.paths[i])
+		f.observe(i, opOpen, start)
+		if err != nil && !(f.dir.create && os.IsNotExist(err)) {
+			errs = append(errs, err)
+		}
+		f.multi = append(f.multi, tmp)
+	}
+	return errs
+}
+
+// dirConsensus reconciles the entries of a directory, creating the replicas and the entries held by a quorum which are missing
+func (f *File) dirConsensus() error {
+	var present int
+	for i := range f.multi {
+		if f.multi[i] != nil {
+			present++
+		}
+	}
+	// read only and pinned directories are listed as they are
+	if f.readOnly || f.pinned {
+		if present < f.quorum {
+			return fmt.Errorf("directory found on %d of %d volumes, %d needed: %w", present, len(f.multi), f.quorum, ErrNoQuorum)
+		}
+		return nil
+	}
+	if err := f.dir.Repair(); err != nil {
+		return err
+	}
+	var errs []error
+	for i := range f.multi {
+		if f.multi[i] != nil {
+			continue
+		}
+		var err error
+		if f.multi[i], err = os.Open(f.paths[i]); err != nil {
+			f.multi[i] = nil
+			errs = append(errs, err)
+			f.markDirty(i, err)
+		}
+	}
+	if len(f.multi)-len(errs) < f.quorum {
+		return aggErrors(errs)
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package haraqafs
+
+import (
+	"path/filepath"
+)
+
+// WithDirSync syncs the parent directory of a replica on each volume after it's created, renamed or removed,
+// so the change to the namespace survives a power loss along with the data
+func WithDirSync() FileOption {
+	return func(f *File) error {
+		f.dirSync = true
+		return nil
+	}
+}
+
+// syncParents syncs the directories holding paths with WithDirSync, each directory once
+func (f *File) syncParents(paths ...string) error {
+	if !f.dirSync && f.syncPolicy != SyncDataDir {
+		return nil
+	}
+	synced := make(map[string]bool, len(paths))
+	for _, p := range paths {
+		dir := filepath.Dir(p)
+		if synced[dir] {
+			continue
+		}
+		synced[dir] = true
+		if err := syncDir(dir); err != nil {
+			return pathErr("sync", dir, err)
+		}
+	}
+	return nil
+}
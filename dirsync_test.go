@@ -0,0 +1,38 @@
+package haraqafs
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWithDirSync(t *testing.T) {
+	volumes := newTmpVolumes(t, 3)
+	defer removeVolumes(volumes)
+	opts := []FileOption{WithVolumes(volumes...), WithDirSync(), WithMkdirAll()}
+
+	f, err := New("dir/my_file", append(opts, WithCreate())...)
+	checkErr(t, err)
+	checkWrite(t, f, []byte("hello world"))
+	checkClose(t, f)
+	checkErr(t, Rename("dir/my_file", "dir/renamed", opts...))
+	checkErr(t, MkdirAll("a/b", 0755, opts...))
+	checkErr(t, Remove("dir/renamed", opts...))
+	for _, v := range volumes {
+		if _, err := os.Stat(filepath.Join(v, "dir/renamed")); !errors.Is(err, os.ErrNotExist) {
+			t.Fatal(err)
+		}
+		if !isDir(filepath.Join(v, "a/b")) {
+			t.Fatal("directory not created on", v)
+		}
+	}
+
+	// a directory which can't be synced fails the change rather than pass it off as durable
+	f = &File{dirSync: true}
+	if err = f.syncParents(filepath.Join(volumes[0], "missing", "my_file")); !errors.Is(err, os.ErrNotExist) {
+		t.Fatal(err)
+	}
+	f.dirSync = false
+	checkErr(t, f.syncParents(filepath.Join(volumes[0], "missing", "my_file")))
+}
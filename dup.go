@@ -0,0 +1,96 @@
+package haraqafs
+
+import (
+	"io"
+	"os"
+)
+
+// Handle is an independent position in a File, sharing its replicas, health and lock.
+// like the File it came from, a single Handle isn't meant to be used from more than one goroutine at once
+type Handle struct {
+	f      *File
+	offset int64
+	closed bool
+}
+
+// Dup returns a new handle on the file starting at the same offset, so several goroutines can stream the file
+// at different positions without opening it again. closing a handle leaves the file open, closing the file closes every handle
+func (f *File) Dup() (*Handle, error) {
+	if f == nil || len(f.multi) == 0 || f.lock == nil {
+		return nil, os.ErrInvalid
+	}
+	if f.lock.isClosed() {
+		return nil, os.ErrClosed
+	}
+	return &Handle{f: f, offset: f.offset}, nil
+}
+
+func (h *Handle) Read(b []byte) (int, error) {
+	if h.closed {
+		return 0, os.ErrClosed
+	}
+	n, err := h.f.ReadAt(b, h.offset)
+	h.offset += int64(n)
+	return n, err
+}
+
+func (h *Handle) ReadAt(b []byte, off int64) (int, error) {
+	if h.closed {
+		return 0, os.ErrClosed
+	}
+	return h.f.ReadAt(b, off)
+}
+
+func (h *Handle) Write(b []byte) (int, error) {
+	if h.closed {
+		return 0, os.ErrClosed
+	}
+	if !h.f.appendWrites {
+		return h.f.writeAtPos(b, h.offset, &h.offset)
+	}
+	n, end, err := h.f.writeAppend(b)
+	if end >= 0 {
+		h.offset = end
+	}
+	return n, err
+}
+
+func (h *Handle) WriteAt(b []byte, off int64) (int, error) {
+	if h.closed {
+		return 0, os.ErrClosed
+	}
+	return h.f.writeAtPos(b, off, nil)
+}
+
+func (h *Handle) Seek(offset int64, whence int) (int64, error) {
+	if h.closed {
+		return 0, os.ErrClosed
+	}
+	switch whence {
+	case io.SeekStart:
+		h.offset = offset
+	case io.SeekCurrent:
+		h.offset += offset
+	case io.SeekEnd:
+		if err := h.f.acquireRead(); err != nil {
+			return h.offset, err
+		}
+		h.offset = h.f.size + offset
+		h.f.releaseRead()
+	}
+	return h.offset, nil
+}
+
+// File returns the file the handle was duplicated from
+func (h *Handle) File() *File {
+	return h.f
+}
+
+// Close releases the handle, the file and its other handles stay open
+func (h *Handle) Close() error {
+	if h.closed {
+		return os.ErrClosed
+	}
+	h.closed = true
+	return nil
+}
@@ -0,0 +1,55 @@
+package haraqafs
+
+import (
+	"errors"
+	"io"
+	"os"
+	"testing"
+)
+
+func TestDup(t *testing.T) {
+	volumes := newTmpVolumes(t, 3)
+	defer removeVolumes(volumes)
+
+	f, err := New("my_file", WithVolumes(volumes...), WithCreate())
+	checkErr(t, err)
+	checkWrite(t, f, []byte("hello world"))
+	checkSeek(t, f, 0, io.SeekStart)
+
+	h, err := f.Dup()
+	checkErr(t, err)
+	if _, err = h.Seek(6, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	b := make([]byte, 5)
+	if n, err := h.Read(b); n != 5 || err != nil || string(b) != "world" {
+		t.Fatal(n, err, string(b))
+	}
+	checkRead(t, f, []byte("hello"))
+
+	// writes through the handle move only its own offset
+	if off, err := h.Seek(0, io.SeekEnd); off != 11 || err != nil {
+		t.Fatal(off, err)
+	}
+	if n, err := h.Write([]byte("!")); n != 1 || err != nil {
+		t.Fatal(n, err)
+	}
+	checkRead(t, f, []byte(" world!"))
+
+	checkClose(t, h)
+	if _, err = h.Read(b); !errors.Is(err, os.ErrClosed) {
+		t.Fatal(err)
+	}
+	checkSeek(t, f, 0, io.SeekStart)
+	checkRead(t, f, []byte("hello world!"))
+
+	h, err = f.Dup()
+	checkErr(t, err)
+	checkClose(t, f)
+	if _, err = h.ReadAt(b, 0); err == nil {
+		t.Fatal("expected error")
+	}
+	if _, err = f.Dup(); !errors.Is(err, os.ErrClosed) {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,36 @@
+package haraqafs
+
+import "os"
+
+// EmptyPolicy decides whether replicas without content take part in consensus.
+// missing replicas, including ones O_CREATE made empty while opening, and replicas which can't be read never vote
+type EmptyPolicy int
+
+const (
+	// EmptyAbstains leaves empty replicas out of the vote, they're repaired from whichever content wins
+	EmptyAbstains EmptyPolicy = iota
+	// EmptyVotes counts replicas which already existed but were empty as votes for an empty file,
+	// so a quorum of them truncates a minority which still has content
+	EmptyVotes
+)
+
+// statMissing notes which replicas don't exist yet, before opening them with O_CREATE hides the difference
+func (f *File) statMissing() {
+	if f.emptyPolicy != EmptyVotes || f.flags&os.O_CREATE == 0 {
+		return
+	}
+	f.missing = make([]bool, len(f.paths))
+	for i := range f.paths {
+		_, err := os.Stat(f.paths[i])
+		f.missing[i] = os.IsNotExist(err)
+	}
+}
+
+// emptyVote returns the hash an empty replica i votes with, nil when it doesn't vote.
+// it's non nil but never equal to the hash of any content
+func (f *File) emptyVote(i int) []byte {
+	if f.emptyPolicy != EmptyVotes || (f.missing != nil && f.missing[i]) {
+		return nil
+	}
+	return []byte{}
+}
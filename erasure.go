@@ -0,0 +1,477 @@
+package haraqafs
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// shardHeader starts every shard of an erasure coded file, holding shardMagic, the file's size and the generation of the
+// last write the shard took part in. the blocks of each stripe follow it
+const shardHeader = 24
+
+// shardMagic marks a file as a shard, so it isn't mistaken for a replica holding the whole file
+const shardMagic = "haraqaEC"
+
+// erasureBlock is how much of each stripe a shard holds
+const erasureBlock = 64 << 10
+
+type erasure struct {
+	code  *rsCode
+	block int
+	size  int64
+	gen   uint64
+}
+
+// WithErasureCoding stripes the file across its volumes instead of mirroring it, each stripe split over data shards and
+// protected by parity shards. it takes data+parity volumes and stores data+parity/data times the file's size instead of
+// one copy per volume. reads rebuild what's missing from any data of the shards, and shards which missed writes are
+// rebuilt when the file's opened or healed. every write is staged on the shards before any block is overwritten.
+// it can't be combined with mmap, framing, block repair, verified reads, journaled or atomic writes, and Scrub,
+// Verify and ReadCompared refuse it since shards differ by design
+func WithErasureCoding(data, parity int) FileOption {
+	return func(f *File) error {
+		code, err := newRSCode(data, parity)
+		if err != nil {
+			return err
+		}
+		f.erasure = &erasure{code: code, block: erasureBlock}
+		return nil
+	}
+}
+
+// checkErasure checks the options of an erasure coded file fit together, opening it needs its data shards
+func (f *File) checkErasure() error {
+	if f.erasure == nil {
+		return nil
+	}
+	shards := f.erasure.code.data + f.erasure.code.parity
+	if len(f.volumes) != shards {
+		return fmt.Errorf("erasure coding into %d shards needs as many volumes, got %d: %w", shards, len(f.volumes), os.ErrInvalid)
+	}
+	if f.mmap || f.framing || f.blockSize > 0 || f.verifiedReads || f.journal || f.atomic {
+		return fmt.Errorf("erasure coding can't be combined with mmap, framing, block repair, verified reads or journaled writes: %w", os.ErrInvalid)
+	}
+	if f.quorum == 0 {
+		f.quorum = f.erasure.code.data
+	}
+	return nil
+}
+
+func (e *erasure) stripe() int64 {
+	return int64(e.code.data * e.block)
+}
+
+// stripes returns how many stripes a file of size spans
+func (e *erasure) stripes(size int64) int64 {
+	return (size + e.stripe() - 1) / e.stripe()
+}
+
+func (e *erasure) blockOffset(k int64) int64 {
+	return shardHeader + k*int64(e.block)
+}
+
+// settleShards stands in for consensus on erasure coded files. shards behind the newest generation are stale,
+// they're rebuilt from the others or, when the file's read only, left out of reads
+func (f *File) settleShards() error {
+	e := f.erasure
+	gens := make([]uint64, len(f.multi))
+	sizes := make([]int64, len(f.multi))
+	var newest uint64
+	var current int
+	for i := range f.multi {
+		if f.multi[i] == nil {
+			continue
+		}
+		var h [shardHeader]byte
+		n, err := f.multi[i].ReadAt(h[:], 0)
+		if err != nil && !(errors.Is(err, io.EOF) && n == 0) {
+			f.markDirty(i, fmt.Errorf("shard header of %s couldn't be read: %v", f.paths[i], err))
+			continue
+		}
+		// an empty shard has never been written
+		if n > 0 {
+			var ok bool
+			if sizes[i], gens[i], ok = parseShardHeader(h[:]); !ok {
+				f.markDirty(i, fmt.Errorf("%s isn't a shard: %w", f.paths[i], ErrCorrupt))
+				continue
+			}
+		}
+		// shards O_TRUNC couldn't truncate are dirty already, their generation is from before
+		if gens[i] > newest && f.usable(i) {
+			newest = gens[i]
+		}
+	}
+	e.gen = newest
+	for i := range f.multi {
+		if f.multi[i] == nil || !f.usable(i) {
+			continue
+		}
+		if gens[i] == newest {
+			e.size = sizes[i]
+			current++
+			continue
+		}
+		f.markDirty(i, fmt.Errorf("shard %s is %d writes behind", f.paths[i], newest-gens[i]))
+	}
+	if current < e.code.data {
+		return fmt.Errorf("%d of %d shards are current, %d needed: %w", current, len(f.multi), e.code.data, ErrNoMajority)
+	}
+	f.size = e.size
+	if f.readOnly {
+		return nil
+	}
+	for i := range f.multi {
+		if f.multi[i] == nil || f.usable(i) {
+			continue
+		}
+		// shards which can't be rebuilt now stay dirty until Heal gets to them
+		if f.rebuildShard(i) == nil {
+			f.health[i].setState(replicaHealthy)
+		}
+	}
+	return nil
+}
+
+// readStripe reads stripe k into buf, rebuilding the blocks of shards which are missing or fail to read
+func (f *File) readStripe(k int64, buf []byte) error {
+	e := f.erasure
+	shards := make([][]byte, len(f.multi))
+	var have, missing int
+	read := func(i int, into []byte) {
+		start := time.Now()
+		n, err := f.multi[i].ReadAt(into, e.blockOffset(k))
+		f.observe(i, opRead, start)
+		if err != nil && !errors.Is(err, io.EOF) {
+			f.readFailed(i)
+			return
+		}
+		// blocks past the end of a shard were never written, they're zeros on every shard
+		for j := n; j < len(into); j++ {
+			into[j] = 0
+		}
+		shards[i] = into
+		have++
+	}
+	for d := 0; d < e.code.data; d++ {
+		if f.usable(d) {
+			read(d, buf[d*e.block:(d+1)*e.block])
+		}
+		if shards[d] == nil {
+			missing++
+		}
+	}
+	if missing == 0 {
+		return nil
+	}
+	for p := e.code.data; p < len(f.multi) && have < e.code.data; p++ {
+		if f.usable(p) {
+			read(p, make([]byte, e.block))
+		}
+	}
+	if err := e.code.reconstruct(shards, e.block); err != nil {
+		return pathErr("read", f.paths[0], err)
+	}
+	for d := 0; d < e.code.data; d++ {
+		copy(buf[d*e.block:], shards[d])
+	}
+	return nil
+}
+
+// readErasure is readAt for erasure coded files
+func (f *File) readErasure(b []byte, off int64) (int, error) {
+	if off >= f.size {
+		return 0, io.EOF
+	}
+	want := len(b)
+	if rest := f.size - off; int64(want) > rest {
+		want = int(rest)
+	}
+	e := f.erasure
+	stripe := make([]byte, e.stripe())
+	var n int
+	for n < want {
+		k := (off + int64(n)) / e.stripe()
+		if err := f.readStripe(k, stripe); err != nil {
+			return n, err
+		}
+		n += copy(b[n:want], stripe[(off+int64(n))%e.stripe():])
+	}
+	if n < len(b) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// writeErasure is writeAt for erasure coded files, stripes which are only partly written are read back first
+func (f *File) writeErasure(b []byte, off int64) (int, error) {
+	if len(b) == 0 {
+		return 0, nil
+	}
+	e := f.erasure
+	first := off / e.stripe()
+	last := (off + int64(len(b)) - 1) / e.stripe()
+	data := make([]byte, (last-first+1)*e.stripe())
+	ends := []int64{first}
+	if last != first {
+		ends = append(ends, last)
+	}
+	for _, k := range ends {
+		partial := (k == first && off%e.stripe() != 0) || (k == last && (off+int64(len(b)))%e.stripe() != 0)
+		if partial && k*e.stripe() < f.size {
+			if err := f.readStripe(k, data[(k-first)*e.stripe():(k-first+1)*e.stripe()]); err != nil {
+				return 0, err
+			}
+		}
+	}
+	copy(data[off-first*e.stripe():], b)
+	size := f.size
+	if end := off + int64(len(b)); end > size {
+		size = end
+	}
+	if err := f.commitStripes(first, data, size); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// truncateErasure is Truncate for erasure coded files, the part of the last stripe past the new size is zeroed
+// so growing the file again reads zeros
+func (f *File) truncateErasure(size int64) error {
+	e := f.erasure
+	k := size / e.stripe()
+	var data []byte
+	if at := size % e.stripe(); size < f.size && at != 0 {
+		data = make([]byte, e.stripe())
+		if err := f.readStripe(k, data); err != nil {
+			return err
+		}
+		for j := at; j < int64(len(data)); j++ {
+			data[j] = 0
+		}
+	}
+	// blocks a crash left past the old size mustn't show through when the file grows
+	if size > f.size {
+		for i := range f.multi {
+			if f.usable(i) && f.multi[i].Truncate(e.blockOffset(e.stripes(f.size))) != nil {
+				f.markDirty(i, fmt.Errorf("shard %s couldn't be truncated", f.paths[i]))
+			}
+		}
+	}
+	if err := f.commitStripes(k, data, size); err != nil {
+		return err
+	}
+	for i := range f.multi {
+		if !f.usable(i) {
+			continue
+		}
+		if err := f.multi[i].Truncate(e.blockOffset(e.stripes(size))); err != nil {
+			f.markDirty(i, pathErr("truncate", f.paths[i], err))
+		}
+	}
+	if healthy := f.healthy(); healthy < e.code.data {
+		return fmt.Errorf("%d of %d shards truncated, %d needed: %w", healthy, len(f.multi), e.code.data, ErrNoQuorum)
+	}
+	return nil
+}
+
+// commitStripes encodes data, whole stripes starting at stripe first, and writes it to every usable shard along with
+// the new size and the next generation. the blocks are staged and committed on every shard before any is overwritten,
+// so a crash never leaves a stripe mixing blocks from two writes
+func (f *File) commitStripes(first int64, data []byte, size int64) error {
+	e := f.erasure
+	n := len(data) / int(e.stripe())
+	shards := make([][]byte, len(f.multi))
+	for i := range shards {
+		shards[i] = make([]byte, n*e.block)
+	}
+	views := make([][]byte, len(f.multi))
+	for s := 0; s < n; s++ {
+		for i := range views {
+			views[i] = shards[i][s*e.block : (s+1)*e.block]
+			if i < e.code.data {
+				copy(views[i], data[int64(s)*e.stripe()+int64(i*e.block):])
+			}
+		}
+		e.code.encode(views)
+	}
+
+	// each record holds the shard's new header followed by its blocks
+	gen := e.gen + 1
+	recs := make([][]byte, len(f.multi))
+	for i := range f.multi {
+		if f.usable(i) {
+			recs[i] = redoRecord(append(shardHeaderBytes(size, gen), shards[i]...), e.blockOffset(first))
+		}
+	}
+	if usable := f.healthy(); usable < e.code.data {
+		return fmt.Errorf("%d of %d shards usable, %d needed: %w", usable, len(f.multi), e.code.data, ErrNoQuorum)
+	}
+	targets, err := f.stageRecords(recs)
+	if err != nil {
+		return err
+	}
+	for _, i := range targets {
+		if !f.usable(i) {
+			continue
+		}
+		start := time.Now()
+		err := f.applyShardRecord(i, recs[i])
+		f.observe(i, opWrite, start)
+		if err != nil {
+			// the commit record stays behind so the next open finishes the write
+			f.markDirty(i, fmt.Errorf("committed write to %s failed: %v", f.paths[i], err))
+			continue
+		}
+		_ = os.Remove(f.paths[i] + commitSuffix)
+	}
+	e.gen = gen
+	e.size = size
+	f.size = size
+	if healthy := f.healthy(); healthy < e.code.data {
+		return fmt.Errorf("%d of %d shards written, %d needed: %w", healthy, len(f.multi), e.code.data, ErrNoQuorum)
+	}
+	return nil
+}
+
+// applyShardRecord writes the blocks of a committed record to shard i, then its header, and syncs it
+func (f *File) applyShardRecord(i int, rec []byte) error {
+	offset := int64(binary.LittleEndian.Uint64(rec))
+	body := rec[redoHeader:]
+	if _, err := f.multi[i].WriteAt(body[shardHeader:], offset); err != nil {
+		return pathErr("write", f.paths[i], err)
+	}
+	if _, err := f.multi[i].WriteAt(body[:shardHeader], 0); err != nil {
+		return pathErr("write", f.paths[i], err)
+	}
+	if err := f.syncReplica(i); err != nil {
+		return pathErr("sync", f.paths[i], err)
+	}
+	return nil
+}
+
+// replayShards finishes the stripe writes a crash interrupted after they were committed and discards the ones it
+// interrupted before. a shard which had already missed earlier writes is left for settleShards to rebuild
+func (f *File) replayShards() error {
+	recs := make([][]byte, len(f.multi))
+	var newest uint64
+	var found bool
+	for i := range f.multi {
+		if f.multi[i] == nil {
+			continue
+		}
+		for _, suffix := range []string{commitSuffix, stageSuffix} {
+			rec, err := os.ReadFile(f.paths[i] + suffix)
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			if err != nil {
+				return pathErr("commit", f.paths[i], err)
+			}
+			found = true
+			if !validRedo(rec) || len(rec) < redoHeader+shardHeader {
+				continue
+			}
+			_, gen, ok := parseShardHeader(rec[redoHeader:])
+			if !ok {
+				continue
+			}
+			// only a renamed record commits its generation, a staged one follows it when it's the same write
+			if suffix == commitSuffix && gen > newest {
+				newest = gen
+			}
+			if recs[i] == nil {
+				recs[i] = rec
+			}
+		}
+	}
+	if !found || f.readOnly {
+		return nil
+	}
+	for i := range f.multi {
+		if f.multi[i] == nil {
+			continue
+		}
+		if rec := recs[i]; rec != nil && newest > 0 && f.flags&os.O_TRUNC == 0 {
+			_, gen, _ := parseShardHeader(rec[redoHeader:])
+			var h [shardHeader]byte
+			n, _ := f.multi[i].ReadAt(h[:], 0)
+			_, cur, _ := parseShardHeader(h[:n])
+			if gen == newest && (cur+1 == gen || cur == gen) {
+				if err := f.applyShardRecord(i, rec); err != nil {
+					return err
+				}
+			}
+		}
+		f.dropRecords([]int{i})
+	}
+	return nil
+}
+
+// shardHeaderBytes returns the header of a shard of a file of size as of write gen
+func shardHeaderBytes(size int64, gen uint64) []byte {
+	h := make([]byte, shardHeader)
+	copy(h, shardMagic)
+	binary.LittleEndian.PutUint64(h[8:], uint64(size))
+	binary.LittleEndian.PutUint64(h[16:], gen)
+	return h
+}
+
+func parseShardHeader(h []byte) (size int64, gen uint64, ok bool) {
+	if len(h) < shardHeader || string(h[:8]) != shardMagic {
+		return 0, 0, false
+	}
+	return int64(binary.LittleEndian.Uint64(h[8:])), binary.LittleEndian.Uint64(h[16:]), true
+}
+
+// readShardHeader reads the header of the shard at path, ok is false when it isn't a shard
+func readShardHeader(path string) (size int64, gen uint64, ok bool) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, 0, false
+	}
+	defer file.Close()
+	var h [shardHeader]byte
+	n, _ := io.ReadFull(file, h[:])
+	return parseShardHeader(h[:n])
+}
+
+// rebuildShard rewrites shard i from the others, it's left out of reads until it's healthy again
+func (f *File) rebuildShard(i int) error {
+	e := f.erasure
+	stripe := make([]byte, e.stripe())
+	shards := make([][]byte, len(f.multi))
+	for k := int64(0); k < e.stripes(e.size); k++ {
+		if err := f.aborted(); err != nil {
+			return err
+		}
+		if err := f.readStripe(k, stripe); err != nil {
+			return err
+		}
+		for j := range shards {
+			if j < e.code.data {
+				shards[j] = stripe[j*e.block : (j+1)*e.block]
+			} else {
+				shards[j] = make([]byte, e.block)
+			}
+		}
+		e.code.encode(shards)
+		f.scheduler.wait(e.block)
+		if _, err := f.multi[i].WriteAt(shards[i], e.blockOffset(k)); err != nil {
+			return pathErr("rebuild", f.paths[i], err)
+		}
+	}
+	if err := f.multi[i].Truncate(e.blockOffset(e.stripes(e.size))); err != nil {
+		return pathErr("rebuild", f.paths[i], err)
+	}
+	if _, err := f.multi[i].WriteAt(shardHeaderBytes(e.size, e.gen), 0); err != nil {
+		return pathErr("rebuild", f.paths[i], err)
+	}
+	if err := f.syncReplica(i); err != nil {
+		return pathErr("rebuild", f.paths[i], err)
+	}
+	return nil
+}
@@ -0,0 +1,184 @@
+package haraqafs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRSCode(t *testing.T) {
+	code, err := newRSCode(4, 2)
+	checkErr(t, err)
+	shards := make([][]byte, 6)
+	for i := range shards {
+		shards[i] = make([]byte, 100)
+		if i < 4 {
+			rand.Read(shards[i])
+		}
+	}
+	code.encode(shards)
+
+	// any two shards can go missing
+	for a := range shards {
+		for b := a + 1; b < len(shards); b++ {
+			lost := append([][]byte(nil), shards...)
+			lost[a], lost[b] = nil, nil
+			checkErr(t, code.reconstruct(lost, 100))
+			for i := range shards {
+				if !bytes.Equal(lost[i], shards[i]) {
+					t.Fatal("shard", i, "rebuilt wrong without", a, b)
+				}
+			}
+		}
+	}
+	lost := append([][]byte(nil), shards...)
+	lost[0], lost[1], lost[2] = nil, nil, nil
+	if err = code.reconstruct(lost, 100); !errors.Is(err, ErrNoMajority) {
+		t.Fatal(err)
+	}
+	if _, err = newRSCode(4, 0); !errors.Is(err, os.ErrInvalid) {
+		t.Fatal(err)
+	}
+}
+
+func TestWithErasureCoding(t *testing.T) {
+	volumes := newTmpVolumes(t, 5)
+	defer removeVolumes(volumes)
+	opts := []FileOption{WithVolumes(volumes...), WithErasureCoding(3, 2)}
+	if _, err := New("my_file", WithVolumes(volumes[:4]...), WithErasureCoding(3, 2)); !errors.Is(err, os.ErrInvalid) {
+		t.Fatal(err)
+	}
+
+	data := make([]byte, 3*erasureBlock*2+1234)
+	rand.Read(data)
+	f, err := New("my_file", append(opts, WithCreate())...)
+	checkErr(t, err)
+	checkWrite(t, f, data)
+	// a write inside a stripe keeps the rest of it
+	copy(data[1000:], "hello world")
+	_, err = f.WriteAt([]byte("hello world"), 1000)
+	checkErr(t, err)
+	checkClose(t, f)
+	for _, v := range volumes {
+		info, err := os.Stat(filepath.Join(v, "my_file"))
+		checkErr(t, err)
+		if info.Size() != shardHeader+3*erasureBlock {
+			t.Fatal("shard holds", info.Size())
+		}
+	}
+
+	// two shards lost, the rest rebuild them
+	checkErr(t, os.Remove(filepath.Join(volumes[0], "my_file")))
+	checkErr(t, os.Remove(filepath.Join(volumes[3], "my_file")))
+	f, err = New("my_file", opts...)
+	checkErr(t, err)
+	checkRead(t, f, data)
+	checkErr(t, f.Repair())
+	checkClose(t, f)
+	checkErr(t, os.Remove(filepath.Join(volumes[1], "my_file")))
+	checkErr(t, os.Remove(filepath.Join(volumes[2], "my_file")))
+	f, err = New("my_file", append(opts, WithReadOnly())...)
+	checkErr(t, err)
+	checkRead(t, f, data)
+	checkClose(t, f)
+
+	// a shard which missed writes is rebuilt on open
+	f, err = New("my_file", append(opts, WithCreateIfNotExist())...)
+	checkErr(t, err)
+	checkClose(t, f)
+	stale := filepath.Join(volumes[4], "my_file")
+	old, err := os.ReadFile(stale)
+	checkErr(t, err)
+	f, err = New("my_file", opts...)
+	checkErr(t, err)
+	_, err = f.WriteAt([]byte("jello"), 0)
+	checkErr(t, err)
+	copy(data, "jello")
+	checkClose(t, f)
+	checkErr(t, os.WriteFile(stale, old, 0666))
+	f, err = New("my_file", opts...)
+	checkErr(t, err)
+	checkClose(t, f)
+	checkErr(t, os.Remove(filepath.Join(volumes[0], "my_file")))
+	checkErr(t, os.Remove(filepath.Join(volumes[1], "my_file")))
+	f, err = New("my_file", append(opts, WithReadOnly())...)
+	checkErr(t, err)
+	checkRead(t, f, data)
+	checkClose(t, f)
+
+	// truncating zeros what it cuts off
+	f, err = New("my_file", append(opts, WithCreateIfNotExist())...)
+	checkErr(t, err)
+	checkErr(t, f.Truncate(10))
+	checkErr(t, f.Truncate(20))
+	info, err := f.Stat()
+	checkErr(t, err)
+	if info.Size() != 20 {
+		t.Fatal(info.Size())
+	}
+	checkRead(t, f, append(append([]byte(nil), data[:10]...), make([]byte, 10)...))
+	checkClose(t, f)
+}
+
+func TestErasureCommit(t *testing.T) {
+	volumes := newTmpVolumes(t, 5)
+	defer removeVolumes(volumes)
+	opts := []FileOption{WithVolumes(volumes...), WithErasureCoding(3, 2)}
+	data := make([]byte, 3*erasureBlock)
+	rand.Read(data)
+	f, err := New("my_file", append(opts, WithCreate())...)
+	checkErr(t, err)
+	checkWrite(t, f, data)
+
+	// shards which lose their handle after the write's committed finish it from their records on the next open
+	for i := 0; i < 3; i++ {
+		checkErr(t, f.multi[i].Close())
+	}
+	copy(data, "hello world")
+	if _, err = f.WriteAt(data, 0); !errors.Is(err, ErrNoQuorum) {
+		t.Fatal(err)
+	}
+	_ = f.Close()
+	for i := 0; i < 3; i++ {
+		if _, err := os.Stat(filepath.Join(volumes[i], "my_file"+commitSuffix)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	f, err = New("my_file", append(opts, WithExclusive())...)
+	checkErr(t, err)
+	checkRead(t, f, data)
+	for i := range volumes {
+		if !f.usable(i) {
+			t.Fatal("shard", i, "left behind")
+		}
+		if _, err := os.Stat(filepath.Join(volumes[i], "my_file"+commitSuffix)); !os.IsNotExist(err) {
+			t.Fatal(err)
+		}
+	}
+
+	// shards aren't mirrors, comparing them is refused and stat reads the size from their headers
+	if _, err = f.ReadCompared(make([]byte, 10), 0); !errors.Is(err, os.ErrInvalid) {
+		t.Fatal(err)
+	}
+	if _, err = f.Verify(); !errors.Is(err, os.ErrInvalid) {
+		t.Fatal(err)
+	}
+	if _, err = f.Scrub(context.Background()); !errors.Is(err, os.ErrInvalid) {
+		t.Fatal(err)
+	}
+	checkClose(t, f)
+	stats, err := NewFS(opts...).StatMany([]string{"my_file"})
+	checkErr(t, err)
+	if !stats[0].Exists || stats[0].Size != int64(len(data)) {
+		t.Fatal(stats[0])
+	}
+	r, err := VerifyVolume(context.Background(), volumes[0], volumes[1:], 0)
+	checkErr(t, err)
+	if len(r.Files) != 1 || r.Files[0].State != VerifySkipped {
+		t.Fatal(r.Files)
+	}
+}
@@ -1,6 +1,197 @@
 package haraqafs
 
-import "fmt"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"time"
+)
+
+var (
+	ErrNoMajority    = errors.New("replicas did not agree")
+	ErrHardlinked    = errors.New("replica is hardlinked")
+	ErrLocked        = errors.New("file is locked by another owner")
+	ErrBadRecord     = errors.New("record failed validation")
+	ErrCorrupt       = errors.New("replica data failed verification")
+	ErrQuorumLost    = errors.New("too few healthy replicas left for quorum")
+	ErrNoSpace       = errors.New("not enough free space on volume")
+	ErrQuotaExceeded = errors.New("namespace quota exceeded")
+	ErrStaleRead     = errors.New("only dirty or unverified replicas could serve the read")
+
+	// consensus outcomes returned by New
+	ErrNoQuorum        = errors.New("too few replicas available to reach quorum")
+	ErrDiverged        = errors.New("replicas diverged and no quorum agrees")
+	ErrMismatchedTypes = fmt.Errorf("replicas are a mix of files and directories: %w", os.ErrInvalid)
+	// ErrDegraded is carried by events about a replica being taken off the synchronous path
+	ErrDegraded = errors.New("replica taken off the synchronous path")
+
+	ErrLockTimeout = fmt.Errorf("timed out waiting for file lock: %w", context.DeadlineExceeded)
+	ErrLeaseHeld   = fmt.Errorf("append lease held by another process: %w", ErrLocked)
+)
+
+var (
+	errReadOnly       = fmt.Errorf("file opened read only: %w", os.ErrPermission)
+	errMissingReplica = errors.New("replica is missing")
+	errReplicaTimeout = errors.New("replica timed out")
+	errCrossPlacement = fmt.Errorf("names are placed on different volumes: %w", os.ErrInvalid)
+	errShards         = fmt.Errorf("erasure coded shards can't be compared like replicas: %w", os.ErrInvalid)
+
+	errConsensusDeadline = errors.New("consensus deadline passed")
+
+	errFenced = fmt.Errorf("writes are fenced until quorum is restored: %w", ErrQuorumLost)
+
+	errWriteAtInAppendMode = fmt.Errorf("invalid use of WriteAt on file opened with O_APPEND: %w", os.ErrInvalid)
+)
+
+type ConflictError struct {
+	Paths []string
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("replicas %v are already open in this process", e.Paths)
+}
+
+func (e *ConflictError) Unwrap() error {
+	return os.ErrExist
+}
+
+// AppendOnlyError is returned when an append only file would be rewritten or shortened
+type AppendOnlyError struct {
+	Op     string
+	Offset int64
+	End    int64
+}
+
+func (e *AppendOnlyError) Error() string {
+	return fmt.Sprintf("append only file: %s at %d is before the end at %d", e.Op, e.Offset, e.End)
+}
+
+func (e *AppendOnlyError) Unwrap() error {
+	return os.ErrPermission
+}
+
+// TruncateError is returned when a truncate failed on some replicas,
+// replicas which were truncated but couldn't be restored are listed as dirty and no longer used
+type TruncateError struct {
+	Size   int64
+	Failed []string
+	Dirty  []string
+	Err    error
+}
+
+func (e *TruncateError) Error() string {
+	return fmt.Sprintf("truncate to %d failed on %v, dirty %v: %v", e.Size, e.Failed, e.Dirty, e.Err)
+}
+
+func (e *TruncateError) Unwrap() error {
+	return e.Err
+}
+
+// RemoveError is returned when a removal took some replicas but fewer than a quorum,
+// the removed replicas can't be put back and the kept ones are still in place
+type RemoveError struct {
+	Op      string
+	Name    string
+	Removed []string
+	Kept    []string
+	Err     error
+}
+
+func (e *RemoveError) Error() string {
+	return fmt.Sprintf("%s of %s removed %v but kept %v: %v", e.Op, e.Name, e.Removed, e.Kept, e.Err)
+}
+
+func (e *RemoveError) Unwrap() error {
+	return e.Err
+}
+
+// ConsensusTimeoutError is returned by New when consensus couldn't finish before the deadline set with WithConsensusDeadline.
+// Source is empty when the deadline passed before the replicas were even compared
+type ConsensusTimeoutError struct {
+	Deadline time.Duration
+	Source   string
+	Diverged []string
+}
+
+func (e *ConsensusTimeoutError) Error() string {
+	if e.Source == "" {
+		return fmt.Sprintf("consensus didn't finish comparing replicas within %s", e.Deadline)
+	}
+	return fmt.Sprintf("consensus didn't finish repairing %v from %s within %s", e.Diverged, e.Source, e.Deadline)
+}
+
+func (e *ConsensusTimeoutError) Unwrap() error {
+	return context.DeadlineExceeded
+}
+
+// StaleReadError is returned by reads of files opened with WithStrictReads when every replica left to read from is
+// dirty, failed verification or missed the latest write, the read is refused rather than risk stale data
+type StaleReadError struct {
+	Offset   int64
+	Length   int
+	Replicas []string
+}
+
+func (e *StaleReadError) Error() string {
+	return fmt.Sprintf("read of %d bytes at %d could only be served by %v", e.Length, e.Offset, e.Replicas)
+}
+
+func (e *StaleReadError) Unwrap() error {
+	return ErrStaleRead
+}
+
+// ReadMismatchError is returned by ReadCompared when replicas disagree about the range or can't read it
+type ReadMismatchError struct {
+	Offset   int64
+	Length   int
+	Diverged []string
+}
+
+func (e *ReadMismatchError) Error() string {
+	return fmt.Sprintf("replicas %v disagree about %d bytes at %d", e.Diverged, e.Length, e.Offset)
+}
+
+func (e *ReadMismatchError) Unwrap() error {
+	return ErrCorrupt
+}
+
+type QuorumError struct {
+	Quorum  int
+	Volumes int
+}
+
+func (e *QuorumError) Error() string {
+	return fmt.Sprintf("quorum of %d can never be reached with %d volumes", e.Quorum, e.Volumes)
+}
+
+func (e *QuorumError) Unwrap() error {
+	return os.ErrInvalid
+}
+
+// SyncQuorumError is returned when fewer replicas than the write quorum could be synced, unlike QuorumError the
+// quorum is reachable with the volumes given and the sync may succeed once the failed replicas recover
+type SyncQuorumError struct {
+	Quorum int
+	Synced int
+}
+
+func (e *SyncQuorumError) Error() string {
+	return fmt.Sprintf("%d replicas synced, %d needed", e.Synced, e.Quorum)
+}
+
+func (e *SyncQuorumError) Unwrap() error {
+	return ErrNoQuorum
+}
+
+// pathErr attributes err to a single replica, an error which already names the replica is unwrapped so the path isn't repeated
+func pathErr(op, path string, err error) error {
+	if pe, ok := err.(*fs.PathError); ok && pe.Path == path {
+		err = pe.Err
+	}
+	return &fs.PathError{Op: op, Path: path, Err: err}
+}
 
 func aggErrors(errs []error) error {
 	switch len(errs) {
@@ -9,6 +200,30 @@ func aggErrors(errs []error) error {
 	case 1:
 		return errs[0]
 	default:
-		return fmt.Errorf("multiple errors received %+v", errs)
+		return multiError(errs)
+	}
+}
+
+type multiError []error
+
+func (m multiError) Error() string {
+	return fmt.Sprintf("multiple errors received %+v", []error(m))
+}
+
+func (m multiError) Is(target error) bool {
+	for _, err := range m {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m multiError) As(target interface{}) bool {
+	for _, err := range m {
+		if errors.As(err, target) {
+			return true
+		}
 	}
+	return false
 }
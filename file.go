@@ -1,57 +1,306 @@
 package haraqafs
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"hash"
 	"io"
 	"io/fs"
 	"os"
+	"sort"
+	"sync"
+	"time"
 )
 
 type File struct {
-	quorum     int
-	volumes    []string
-	flags      int
-	perms      os.FileMode
-	hashing    hash.Hash
-	appendOnly bool
-	quorumFail quorumFailEnum
-	forceSync  bool
+	quorum            int
+	writeQ            int
+	blockSize         int
+	readQ             int
+	volumes           []string
+	flags             int
+	perms             os.FileMode
+	hashing           hash.Hash
+	appendOnly        bool
+	appendWrites      bool
+	consensusDeadline time.Duration
+	consensusLate     LateConsensus
+	consensusBy       time.Time
+	asyncRepair       bool
+	hashCache         bool
+	account           *account
+	opened            Usage
+	framing           bool
+	emptyPolicy       EmptyPolicy
+	missing           []bool
+	tornPolicy        TornPolicy
+	detectChanges     bool
+	verifiedReads     bool
+	mmap              bool
+	checkEvery        time.Duration
+	quorumFail        QuorumFail
+	syncPolicy        SyncPolicy
+	specs             []Volume
+	shardLevels       int
+	ring              *Ring
+	ringReplicas      int
+	placement         *Placement
+	jail              string
+	mkdirAll          bool
+	dirPerms          os.FileMode
+	clock             Clock
+	hashTieBreak      bool
+	stats             *Stats
+	slowFactor        float64
+	replicaTimeout    time.Duration
+	// wrapReplica lets tests intercept the writes to replica i
+	wrapReplica func(i int, w writeSyncer) writeSyncer
+	// freeSpace lets tests fake the free space of the volumes
+	freeSpace         func(path string) (int64, bool)
+	parallelReadSize  int
+	concurrency       int
+	openWorkers       int
+	writeConcurrency  int
+	hardlinks         HardlinkPolicy
+	repairConcurrency int
+	spaceAware        bool
+	repairReserve     int64
+	scheduler         *RepairScheduler
+	readOnly          bool
+	pinned            bool
+	dir               *Dir
+	registry          *Registry
+	registryMode      RegistryMode
+	registered        []string
+	exclusive         bool
+	exclusiveLock     *exclusiveLock
+	lease             *appendLease
+	failStop          bool
+	lockTimeout       time.Duration
+	ctx               context.Context
+	openCtx           context.Context
+	zeroFill          bool
+	events            func(Event)
+	middleware        []Middleware
+	validate          func(b []byte, off int64) error
 
-	paths  []string
-	multi  []*os.File
-	offset int64
-	lock   chan struct{}
+	paths       []string
+	readOrder   []int
+	trust       replicaTrust
+	strategy    ReadStrategy
+	strictReads bool
+	hedge       int
+	hedgeDelay  time.Duration
+	readRepair  bool
+	chunks      *chunkSizer
+	readRepairs uint64
+	journal     bool
+	cloneRepair bool
+	dirSync     bool
+	atomic      bool
+	erasure     *erasure
+	multi       []*os.File
+	health      []replicaHealth
+	stamps      []os.FileInfo
+	wroteAt     time.Time
+	digests     [][]uint32
+	maps        []*mapping
+	mapSize     int64
+	lastCheck   int64
+	healthMu    sync.Mutex
+	markMu      sync.Mutex
+	marks       []watermark
+	marked      chan struct{}
+	watchMu     sync.Mutex
+	watchers    []*SizeWatcher
+	watchedSize int64
+	gen         uint64
+	lost        int32
+	healing     int32
+	deferred    []int
+	repairDone  chan struct{}
+	repairErr   error
+	ops         int
+	offset      int64
+	size        int64
+	lock        *rwLock
 }
 
+func (f *File) spec(i int) Volume {
+	if i < len(f.specs) {
+		return f.specs[i]
+	}
+	return Volume{Path: f.volumes[i]}
+}
+
+func (f *File) shouldSync(i int) bool {
+	switch f.spec(i).Sync {
+	case SyncAlways:
+		return true
+	case SyncNever:
+		return false
+	}
+	return f.syncPolicy == SyncData || f.syncPolicy == SyncDataDir || f.syncPolicy == SyncWrite
+}
+
+// sortReadOrder prefers replicas with a higher read weight, falling back to the last replica first
+func (f *File) sortReadOrder() {
+	f.readOrder = f.readOrder[:0]
+	for i := len(f.multi) - 1; i >= 0; i-- {
+		f.readOrder = append(f.readOrder, i)
+	}
+	sort.SliceStable(f.readOrder, func(a, b int) bool {
+		return f.spec(f.readOrder[a]).ReadWeight > f.spec(f.readOrder[b]).ReadWeight
+	})
+}
+
+// acquire takes the file lock exclusively, giving up once the lock timeout passes or the file's context is done
+func (f *File) acquire() error {
+	return f.take(true)
+}
+
+// acquireRead shares the file lock with other readers, reads never change the replica set.
+// read only files can't change at all, so their reads skip the lock entirely
+func (f *File) acquireRead() error {
+	return f.acquireReadContext(nil)
+}
+
+// acquireReadContext is acquireRead also giving up once ctx, which may be nil, is done
+func (f *File) acquireReadContext(ctx context.Context) error {
+	if f.readOnly {
+		if f.lock.isClosed() {
+			return os.ErrClosed
+		}
+		return nil
+	}
+	if !f.changesDue() {
+		return f.takeContext(ctx, false)
+	}
+	// the replicas are checked and read under one lock, so nothing changes them in between
+	if err := f.takeContext(ctx, true); err != nil {
+		return err
+	}
+	if f.changesDue() {
+		if err := f.revalidate(); err != nil {
+			f.lock.unlock()
+			return err
+		}
+	}
+	f.lock.downgrade()
+	return nil
+}
+
+func (f *File) releaseRead() {
+	if !f.readOnly {
+		f.lock.runlock()
+	}
+}
+
+func (f *File) take(exclusive bool) error {
+	return f.takeContext(nil, exclusive)
+}
+
+// takeContext is take also giving up once ctx, which may be nil, is done
+func (f *File) takeContext(ctx context.Context, exclusive bool) error {
+	var timer *time.Timer
+	defer func() {
+		if timer != nil {
+			timer.Stop()
+		}
+	}()
+	return f.lock.lock(exclusive, func(wait <-chan struct{}) error {
+		var timeout <-chan time.Time
+		if f.lockTimeout > 0 {
+			if timer == nil {
+				timer = time.NewTimer(f.lockTimeout)
+			}
+			timeout = timer.C
+		}
+		var done <-chan struct{}
+		if f.ctx != nil {
+			done = f.ctx.Done()
+		}
+		var cancelled <-chan struct{}
+		if ctx != nil {
+			cancelled = ctx.Done()
+		}
+		select {
+		case <-wait:
+			return nil
+		case <-timeout:
+			return fmt.Errorf("waited %s: %w", f.lockTimeout, ErrLockTimeout)
+		case <-done:
+			return fmt.Errorf("waiting for file lock: %w", f.ctx.Err())
+		case <-cancelled:
+			return fmt.Errorf("waiting for file lock: %w", ctx.Err())
+		}
+	})
+}
+
+// Chdir changes the working directory to the first usable replica of a directory opened with New
 func (f *File) Chdir() error {
-	return fmt.Errorf("haraqafs files are not directories...yet: %w", os.ErrInvalid)
+	if f == nil || len(f.multi) == 0 || f.lock == nil {
+		return os.ErrInvalid
+	}
+	if f.dir == nil {
+		return fmt.Errorf("%s is not a directory: %w", f.paths[0], os.ErrInvalid)
+	}
+	if err := f.acquireRead(); err != nil {
+		return err
+	}
+	defer f.releaseRead()
+	for _, i := range f.readOrder {
+		if f.usable(i) {
+			return f.multi[i].Chdir()
+		}
+	}
+	return errMissingReplica
 }
 
 func (f *File) Chmod(mode os.FileMode) error {
 	if f == nil || len(f.multi) == 0 || f.lock == nil {
 		return os.ErrInvalid
 	}
-	if _, ok := <-f.lock; !ok {
-		return os.ErrClosed
+	if f.readOnly {
+		return errReadOnly
+	}
+	if err := f.acquire(); err != nil {
+		return err
 	}
-	defer func() { f.lock <- struct{}{} }()
+	defer f.lock.unlock()
 
+	// remember the current mode so a partial failure can be undone
+	var prev os.FileMode
+	var havePrev bool
 	for i := range f.multi {
-		err := f.multi[i].Chmod(mode)
-		if err != nil {
-			if i > 0 {
-				// best effort, try to undo what we've set so far
-				if info, e := f.multi[len(f.multi)-1].Stat(); e == nil {
-					m := info.Mode()
-					for j := range f.multi[:i] {
-						_ = f.multi[j].Chmod(m)
-					}
+		if f.multi[i] == nil {
+			continue
+		}
+		if info, err := f.multi[i].Stat(); err == nil {
+			prev, havePrev = info.Mode(), true
+			break
+		}
+	}
+
+	errs := f.fanout(func(i int) error {
+		return f.multi[i].Chmod(mode)
+	})
+	for i, err := range errs {
+		if err == nil {
+			continue
+		}
+		if havePrev {
+			// best effort, try to undo what we've set so far
+			_ = f.fanout(func(j int) error {
+				if errs[j] != nil {
+					return nil
 				}
-			}
-			return fmt.Errorf("unable to chmod file at path %s: %w", f.paths[i], err)
+				return f.multi[j].Chmod(prev)
+			})
 		}
+		return pathErr("chmod", f.paths[i], err)
 	}
 	return nil
 }
@@ -60,10 +309,13 @@ func (f *File) Chown(uid int, gid int) error {
 	if f == nil || len(f.multi) == 0 || f.lock == nil {
 		return os.ErrInvalid
 	}
-	if _, ok := <-f.lock; !ok {
-		return os.ErrClosed
+	if f.readOnly {
+		return errReadOnly
+	}
+	if err := f.acquire(); err != nil {
+		return err
 	}
-	defer func() { f.lock <- struct{}{} }()
+	defer f.lock.unlock()
 
 	for i := range f.multi {
 		err := f.multi[i].Chown(uid, gid)
@@ -77,53 +329,121 @@ func (f *File) Chown(uid int, gid int) error {
 			//		}
 			//	}
 			//}
-			return fmt.Errorf("unable to chown file at path %s: %w", f.paths[i], err)
+			return pathErr("chown", f.paths[i], err)
 		}
 	}
 	return nil
 }
 
 func (f *File) Close() error {
+	_, err := f.close(false)
+	return err
+}
+
+// CloseWithReport syncs and closes every replica, reporting the outcome per replica
+func (f *File) CloseWithReport() (*CloseReport, error) {
+	return f.close(true)
+}
+
+func (f *File) close(sync bool) (*CloseReport, error) {
 	if f == nil || len(f.multi) == 0 || f.lock == nil {
-		return os.ErrInvalid
+		return nil, os.ErrInvalid
+	}
+	if f.repairDone != nil {
+		<-f.repairDone
+	}
+	if err := f.acquire(); err != nil {
+		return nil, err
 	}
-	if _, ok := <-f.lock; !ok {
-		return os.ErrClosed
+	f.unmapReplicas()
+
+	report := &CloseReport{Replicas: make([]ReplicaClose, len(f.multi))}
+	for i := range report.Replicas {
+		report.Replicas[i] = ReplicaClose{
+			Volume:  f.volumes[i],
+			Path:    f.paths[i],
+			Missing: f.multi[i] == nil,
+			Dirty:   f.multi[i] != nil && !f.usable(i),
+		}
 	}
 
 	var errs []error
 	var closedErrs int
-	for i := range f.multi {
+	for i, err := range f.fanout(func(i int) error {
+		if sync {
+			if err := f.syncReplica(i); err != nil {
+				report.Replicas[i].Err = pathErr("sync", f.paths[i], err)
+			} else {
+				report.Replicas[i].Synced = true
+			}
+		}
+		return f.multi[i].Close()
+	}) {
 		if f.multi[i] == nil {
 			continue
 		}
-
-		err := f.multi[i].Close()
 		if err != nil {
 			if errors.Is(err, os.ErrClosed) {
 				closedErrs++
 			}
-			err = fmt.Errorf("close %s: %w", f.paths[i], err)
+			err = pathErr("close", f.paths[i], err)
 			errs = append(errs, err)
+			if report.Replicas[i].Err == nil {
+				report.Replicas[i].Err = err
+			}
+			continue
 		}
+		report.Replicas[i].Closed = true
 	}
 
 	// if the only errors we got are closed, then we started in a partial close state but succeeded this time
 	if len(errs) == 0 || len(errs) == closedErrs {
-		close(f.lock)
-		pathPool.Put(f.paths[:0])
-		filePool.Put(f.multi[:0])
+		f.lock.close()
+		f.markMu.Lock()
+		f.wakeMarks()
+		f.markMu.Unlock()
+		f.stopWatchers()
+		f.unregister()
+		// lock free readers may still be looking at the replicas of a read only file
+		if !f.readOnly {
+			pathPool.Put(f.paths[:0])
+			filePool.Put(f.multi[:0])
+		}
 		if len(f.multi) == closedErrs {
-			return os.ErrClosed
+			return report, os.ErrClosed
 		}
-		return nil
+		return report, nil
 	}
 
 	// we failed to close, unlock and maybe try again
-	defer func() { f.lock <- struct{}{} }()
+	defer f.lock.unlock()
 
 	// aggregate errors
-	return aggErrors(errs)
+	return report, aggErrors(errs)
+}
+
+type CloseReport struct {
+	Replicas []ReplicaClose
+}
+
+type ReplicaClose struct {
+	Volume  string
+	Path    string
+	Missing bool
+	Dirty   bool
+	Synced  bool
+	Closed  bool
+	Err     error
+}
+
+// AtRisk reports whether any replica may not hold the latest data, because it was missing, dirty or failed to sync or close
+func (r *CloseReport) AtRisk() bool {
+	for _, rc := range r.Replicas {
+		if rc.Missing || rc.Dirty || rc.Err != nil {
+			return true
+		}
+	}
+	return false
 }
 
 func (f *File) Name() string {
@@ -134,29 +454,90 @@ func (f *File) Name() string {
 	return f.multi[0].Name()
 }
 
+// Read moves the file offset, so unlike ReadAt it takes the file lock exclusively
 func (f *File) Read(b []byte) (int, error) {
-	return f.ReadAt(b, f.offset)
+	if f == nil || len(f.multi) == 0 || f.lock == nil {
+		return 0, os.ErrInvalid
+	}
+	if err := f.acquire(); err != nil {
+		return 0, err
+	}
+	defer f.lock.unlock()
+	if f.changesDue() {
+		if err := f.revalidate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := f.read(b, f.offset)
+	f.offset += int64(n)
+	return n, err
 }
 
 func (f *File) ReadAt(b []byte, off int64) (int, error) {
 	if f == nil || len(f.multi) == 0 || f.lock == nil {
 		return 0, os.ErrInvalid
 	}
-	if _, ok := <-f.lock; !ok {
-		return 0, os.ErrClosed
+	if err := f.acquireRead(); err != nil {
+		return 0, err
 	}
-	defer func() { f.lock <- struct{}{} }()
+	defer f.releaseRead()
 
-	var n int
-	var err error
-	for i := len(f.multi) - 1; i >= 0; i-- {
+	return f.read(b, off)
+}
+
+func (f *File) read(b []byte, off int64) (int, error) {
+	if f.middleware == nil {
+		return f.readReplicas(b, off)
+	}
+	return f.through(Call{Op: OpRead, Offset: off, Buf: b}, func(c Call) (int, error) {
+		return f.readReplicas(c.Buf, c.Offset)
+	})
+}
+
+func (f *File) readReplicas(b []byte, off int64) (n int, err error) {
+	if f.erasure != nil {
+		n, err = f.readErasure(b, off)
+	} else if f.readQ > 1 {
+		n, err = f.vote(b, off, f.readQ)
+	} else if f.digests != nil {
+		n, err = f.readVerified(b, off)
+	} else if f.parallelReadSize > 0 && len(b) >= 2*f.parallelReadSize {
+		n, err = f.readAtParallel(b, off)
+	} else if f.hedge > 1 {
+		n, err = f.readHedged(b, off)
+	} else {
+		n, err = f.readAt(b, off)
+	}
+	f.checkSlow(opRead)
+	return n, err
+}
+
+// readAt reads from the first usable replica in the read plan which returns data
+func (f *File) readAt(b []byte, off int64) (n int, err error) {
+	var plan [8]int
+	replicas := f.readPlan(plan[:0])
+	if len(replicas) == 0 {
+		return 0, f.unservable(off, len(b))
+	}
+	var failed []int
+	for _, i := range replicas {
+		start := time.Now()
 		n, err = f.multi[i].ReadAt(b, off)
+		f.observe(i, opRead, start)
 		if err == nil || n > 0 {
 			break
 		}
+		if !errors.Is(err, io.EOF) {
+			f.readFailed(i)
+			failed = append(failed, i)
+		}
+	}
+	if n > 0 {
+		for _, i := range failed {
+			f.readRepairLater(i, off, b[:n], true, fmt.Errorf("replica %s failed a read at %d", f.paths[i], off))
+		}
 	}
-	f.offset += int64(n)
-
 	return n, err
 }
 
@@ -166,12 +547,14 @@ func (f *File) ReadDir(n int) ([]DirEntry, error) {
 	if f == nil || len(f.multi) == 0 || f.lock == nil {
 		return nil, os.ErrInvalid
 	}
-	if _, ok := <-f.lock; !ok {
-		return nil, os.ErrClosed
+	if err := f.acquire(); err != nil {
+		return nil, err
 	}
-	defer func() { f.lock <- struct{}{} }()
+	defer f.lock.unlock()
 
-	// TODO: full parsing & support
+	if f.dir != nil {
+		return f.dir.ReadDir(n)
+	}
 	dirs, err := f.multi[0].ReadDir(n)
 	if err != nil {
 		return []DirEntry{}, err
@@ -186,59 +569,509 @@ func (f *File) Seek(offset int64, whence int) (ret int64, err error) {
 	case io.SeekCurrent:
 		f.offset += offset
 	case io.SeekEnd:
-		//TODO: seek from end
+		if err := f.acquireRead(); err != nil {
+			return f.offset, err
+		}
+		f.offset = f.size + offset
+		f.releaseRead()
 	}
 	return f.offset, nil
 }
 
+// Barrier returns once every previously acknowledged write is durable on at least a quorum of replicas
+func (f *File) Barrier() error {
+	return f.syncReplicas(false)
+}
+
+// Sync fsyncs every open replica, failing with the errors of each replica which couldn't be synced even if a quorum was
+func (f *File) Sync() error {
+	return f.syncReplicas(true)
+}
+
+func (f *File) syncReplicas(all bool) error {
+	if f == nil || len(f.multi) == 0 || f.lock == nil {
+		return os.ErrInvalid
+	}
+	if err := f.acquire(); err != nil {
+		return err
+	}
+	defer f.lock.unlock()
+	if f.middleware == nil {
+		return f.barrier(all)
+	}
+	_, err := f.through(Call{Op: OpSync}, func(Call) (int, error) {
+		return 0, f.barrier(all)
+	})
+	return err
+}
+
+func (f *File) barrier(all bool) error {
+	if f.syncPolicy == SyncNone {
+		return nil
+	}
+	var errs []error
+	synced := 0
+	took := make([]time.Duration, len(f.multi))
+	for i, err := range f.fanout(func(i int) error {
+		start := time.Now()
+		err := f.syncReplica(i)
+		took[i] = time.Since(start)
+		return err
+	}) {
+		if f.multi[i] == nil {
+			continue
+		}
+		f.observeDuration(i, opSync, took[i])
+		if err != nil {
+			errs = append(errs, pathErr("sync", f.paths[i], err))
+			continue
+		}
+		synced++
+	}
+	if synced < f.writeQuorum() {
+		return aggErrors(append(errs, &SyncQuorumError{Quorum: f.writeQuorum(), Synced: synced}))
+	}
+	if all {
+		return aggErrors(errs)
+	}
+	return nil
+}
+
+func (f *File) writeQuorum() int {
+	if f.writeQ > 0 {
+		return f.writeQ
+	}
+	if f.quorum <= 0 {
+		return 1
+	}
+	return f.quorum
+}
+
 func (f *File) Truncate(size int64) error {
 	if f == nil || len(f.multi) == 0 || f.lock == nil {
 		return os.ErrInvalid
 	}
-	if _, ok := <-f.lock; !ok {
-		return os.ErrClosed
+	if f.readOnly {
+		return errReadOnly
+	}
+	if err := f.acquire(); err != nil {
+		return err
+	}
+	defer f.lock.unlock()
+	if f.appendOnly && size < f.size {
+		return &AppendOnlyError{Op: "truncate", Offset: size, End: f.size}
+	}
+	if f.failStop && f.QuorumLost() {
+		return errFenced
+	}
+	prev := f.size
+	charged, err := f.chargeGrowth(size)
+	if err != nil {
+		return err
+	}
+	defer f.settleGrowth(prev, charged)
+	if f.erasure != nil {
+		return f.truncateErasure(size)
 	}
-	defer func() { f.lock <- struct{}{} }()
 
+	// remember the current sizes so a partial failure can be undone
+	prior := make([]int64, len(f.multi))
 	for i := range f.multi {
+		prior[i] = -1
+		if f.multi[i] == nil {
+			continue
+		}
+		if info, err := f.multi[i].Stat(); err == nil {
+			prior[i] = info.Size()
+		}
+	}
+
+	errs := f.fanout(func(i int) error {
 		if err := f.multi[i].Truncate(size); err != nil {
 			return err
 		}
+		return f.stamp(i)
+	})
+	var failed []error
+	for _, err := range errs {
+		if err != nil {
+			failed = append(failed, err)
+		}
 	}
-	return nil
+	if len(failed) == 0 {
+		f.size = size
+		f.recordStamps()
+		f.advance()
+		if err := f.remap(); err != nil {
+			return err
+		}
+		from := size
+		if prev < from {
+			from = prev
+		}
+		f.digestsChanged(from, size)
+		if f.QuorumLost() {
+			return ErrQuorumLost
+		}
+		return nil
+	}
+
+	tErr := &TruncateError{Size: size, Err: aggErrors(failed)}
+	for i, err := range errs {
+		switch {
+		case f.multi[i] == nil:
+		case err != nil:
+			tErr.Failed = append(tErr.Failed, f.paths[i])
+		case prior[i] >= 0 && prior[i] <= size && f.multi[i].Truncate(prior[i]) == nil:
+			// grown replicas go back to their old size with their content intact
+		default:
+			// shrunk replicas lost data we can't put back
+			tErr.Dirty = append(tErr.Dirty, f.paths[i])
+			f.markDirty(i, fmt.Errorf("truncate of %s couldn't be rolled back", f.paths[i]))
+		}
+	}
+	// replicas may have shrunk underneath their mappings
+	if err := f.remap(); err != nil {
+		return aggErrors([]error{tErr, err})
+	}
+	return tErr
 }
 
 func (f *File) Write(b []byte) (int, error) {
-	return f.WriteAt(b, f.offset)
+	if f == nil || !f.appendWrites {
+		return f.WriteAt(b, f.offset)
+	}
+	n, end, err := f.writeAppend(b)
+	if end >= 0 {
+		f.offset = end
+	}
+	return n, err
+}
+
+// writeAppend writes b at the consensus end, returning where the file now ends or -1 if nothing was attempted
+func (f *File) writeAppend(b []byte) (int, int64, error) {
+	if len(f.multi) == 0 || f.lock == nil {
+		return 0, -1, os.ErrInvalid
+	}
+	if f.readOnly {
+		return 0, -1, errReadOnly
+	}
+	if err := f.acquire(); err != nil {
+		return 0, -1, err
+	}
+	defer f.lock.unlock()
+
+	if f.lease != nil {
+		if err := f.holdLease(); err != nil {
+			return 0, -1, err
+		}
+	}
+
+	// O_APPEND writes land at the consensus end, the lock keeps concurrent appends from overlapping
+	n, err := f.write(b, f.size, nil)
+	return n, f.size, err
 }
 
 func (f *File) WriteString(s string) (int, error) {
-	return f.WriteAt([]byte(s), f.offset)
+	return f.Write([]byte(s))
 }
 
 func (f *File) WriteAt(b []byte, offset int64) (int, error) {
+	if f == nil {
+		return 0, os.ErrInvalid
+	}
+	return f.writeAtPos(b, offset, &f.offset)
+}
+
+// writeAtPos is WriteAt moving pos past the bytes written, WriteAt on the file itself has always moved its offset
+func (f *File) writeAtPos(b []byte, offset int64, pos *int64) (int, error) {
+	if len(f.multi) == 0 || f.lock == nil {
+		return 0, os.ErrInvalid
+	}
+	if f.readOnly {
+		return 0, errReadOnly
+	}
+	if f.appendWrites {
+		return 0, errWriteAtInAppendMode
+	}
+	if err := f.acquire(); err != nil {
+		return 0, err
+	}
+	defer f.lock.unlock()
+	return f.write(b, offset, pos)
+}
+
+// write is the body of WriteAt, called with the file lock held exclusively
+func (f *File) write(b []byte, offset int64, pos *int64) (int, error) {
+	if f.middleware == nil {
+		return f.writeReplicas(b, offset, pos)
+	}
+	return f.through(Call{Op: OpWrite, Offset: offset, Buf: b}, func(c Call) (int, error) {
+		return f.writeReplicas(c.Buf, c.Offset, pos)
+	})
+}
+
+func (f *File) writeReplicas(b []byte, offset int64, pos *int64) (int, error) {
+	if f.validate != nil {
+		if err := f.validate(b, offset); err != nil {
+			return 0, fmt.Errorf("write of %d bytes at %d rejected: %w", len(b), offset, err)
+		}
+	}
+	if f.appendOnly && offset < f.size {
+		return 0, &AppendOnlyError{Op: "write", Offset: offset, End: f.size}
+	}
+	if f.failStop && f.QuorumLost() {
+		return 0, errFenced
+	}
+
+	defer f.checkSlow(opWrite)
+	size := len(b)
+	if f.framing {
+		b = frame(b)
+	}
+	prev := f.size
+	charged, err := f.chargeGrowth(offset + int64(len(b)))
+	if err != nil {
+		return 0, err
+	}
+	defer f.settleGrowth(prev, charged)
+	if f.zeroFill && offset > f.size {
+		// fill the gap explicitly so every replica holds real zeros rather than a hole
+		zeros := make([]byte, 1e6)
+		for f.size < offset {
+			n := offset - f.size
+			if n > int64(len(zeros)) {
+				n = int64(len(zeros))
+			}
+			if _, err := f.writeAt(zeros[:n], f.size); err != nil {
+				return 0, err
+			}
+		}
+	}
+	n, err := f.writeAt(b, offset)
+	if err != nil {
+		return 0, err
+	}
+	if pos != nil {
+		*pos += int64(n)
+	}
+	f.wroteStamps()
+	f.advance()
+	if f.framing {
+		// callers only see their payload, the framing is ours
+		n = size
+	}
+	if f.QuorumLost() {
+		return n, ErrQuorumLost
+	}
+	return n, nil
+}
+
+func (f *File) writeAt(b []byte, offset int64) (int, error) {
+	if f.erasure != nil {
+		return f.writeErasure(b, offset)
+	}
+	if f.atomic && !f.mapped(offset, len(b)) {
+		return f.writeAtomic(b, offset)
+	}
+	if f.journal && !f.mapped(offset, len(b)) {
+		return f.writeJournaled(b, offset)
+	}
+	return f.fanWrite(b, offset)
+}
+
+// fanWrite writes b at offset to every replica on the synchronous path
+func (f *File) fanWrite(b []byte, offset int64) (int, error) {
+	// copies into the mappings don't block, so they skip the replica timeout
+	if f.replicaTimeout > 0 && !f.mapped(offset, len(b)) {
+		if err := f.writeAtTimeout(b, offset); err != nil {
+			return 0, err
+		}
+	} else if f.writeConcurrency > 0 || f.writeQ > 0 {
+		if err := f.writeAtParallel(b, offset); err != nil {
+			return 0, err
+		}
+	} else {
+		for i := range f.multi {
+			if f.multi[i] != nil && !f.usable(i) {
+				continue
+			}
+			if err := f.writeReplica(i, b, offset); err != nil {
+				return 0, err
+			}
+		}
+	}
+	from := offset
+	if f.size < from {
+		from = f.size
+	}
+	if end := offset + int64(len(b)); end > f.size {
+		f.size = end
+		if err := f.remap(); err != nil {
+			return 0, err
+		}
+	}
+	f.digestsChanged(from, offset+int64(len(b)))
+	return len(b), nil
+}
+
+func (f *File) writeReplica(i int, b []byte, offset int64) error {
+	return f.writeReplicaSync(i, b, offset, f.shouldSync(i))
+}
+
+// writeReplicaSync is writeReplica syncing the write when sync is set, whatever the sync policy
+func (f *File) writeReplicaSync(i int, b []byte, offset int64, sync bool) error {
+	start := time.Now()
+	n, err := len(b), error(nil)
+	mapped := f.writeMapping(i, b, offset)
+	if !mapped {
+		n, err = f.multi[i].WriteAt(b, offset)
+	}
+	f.observe(i, opWrite, start)
+	if err != nil {
+		return pathErr("write", f.paths[i], err)
+	}
+	if n != len(b) {
+		return pathErr("write", f.paths[i], io.ErrShortWrite)
+	}
+	if err = f.stamp(i); err != nil {
+		return pathErr("chtimes", f.paths[i], err)
+	}
+	if sync {
+		start = time.Now()
+		if mapped {
+			err = f.msyncRange(i, offset, offset+int64(len(b)))
+		}
+		if err == nil {
+			err = f.syncReplica(i)
+		}
+		f.observe(i, opSync, start)
+		if err != nil {
+			return pathErr("sync", f.paths[i], err)
+		}
+	}
+	return nil
+}
+
+// ReadAtMajority reads the range from every replica and returns the content agreed on by a majority of them
+func (f *File) ReadAtMajority(b []byte, off int64) (int, error) {
+	if f == nil {
+		return 0, os.ErrInvalid
+	}
+	return f.readAtQuorum(b, off, len(f.multi)/2+1)
+}
+
+// ReadAtWithQuorum reads the range from every replica and requires at least q of them to agree, regardless of the file's quorum
+func (f *File) ReadAtWithQuorum(b []byte, off int64, q int) (int, error) {
+	if f == nil {
+		return 0, os.ErrInvalid
+	}
+	if q <= 0 || q > len(f.multi) {
+		return 0, &QuorumError{Quorum: q, Volumes: len(f.multi)}
+	}
+	return f.readAtQuorum(b, off, q)
+}
+
+func (f *File) readAtQuorum(b []byte, off int64, q int) (int, error) {
 	if f == nil || len(f.multi) == 0 || f.lock == nil {
 		return 0, os.ErrInvalid
 	}
-	if _, ok := <-f.lock; !ok {
-		return 0, os.ErrClosed
+	if err := f.acquireRead(); err != nil {
+		return 0, err
+	}
+	defer f.releaseRead()
+
+	return f.vote(b, off, q)
+}
+
+// vote reads the range from every replica and copies the content agreed on by at least q replicas into b
+func (f *File) vote(b []byte, off int64, q int) (int, error) {
+	votes, failed, errs := f.ballots(b, off, false)
+	for _, v := range votes {
+		if len(v.replicas) >= q {
+			f.outvoted(v, votes, failed, off)
+			return copy(b, v.buf), v.err
+		}
 	}
-	defer func() { f.lock <- struct{}{} }()
+	errs = append(errs, fmt.Errorf("%d replicas must agree at offset %d: %w", q, off, ErrNoMajority))
+	return 0, aggErrors(errs)
+}
 
+type ballot struct {
+	buf      []byte
+	err      error
+	replicas []int
+}
+
+// ballots reads the range from every open replica, or every usable one, grouping the replicas by what they returned.
+// the groups come back largest first, the replicas which failed to read are listed separately
+func (f *File) ballots(b []byte, off int64, usableOnly bool) ([]*ballot, []int, []error) {
+	votes := make([]*ballot, 0, len(f.multi))
+	var failed []int
+	var errs []error
 	for i := range f.multi {
-		n, err := f.multi[i].WriteAt(b, offset)
-		if err != nil {
-			return 0, fmt.Errorf("write failed on file %s: %w", f.paths[i], err)
+		if f.multi[i] == nil || (usableOnly && !f.usable(i)) {
+			continue
 		}
-		if n != len(b) {
-			return 0, fmt.Errorf("write failed on file %s: %w", f.paths[i], io.ErrShortWrite)
+		buf := make([]byte, len(b))
+		start := time.Now()
+		n, err := f.multi[i].ReadAt(buf, off)
+		f.observe(i, opRead, start)
+		if err != nil && !errors.Is(err, io.EOF) {
+			failed = append(failed, i)
+			errs = append(errs, pathErr("read", f.paths[i], err))
+			continue
 		}
-		if f.forceSync {
-			if err = f.multi[i].Sync(); err != nil {
-				return 0, fmt.Errorf("sync failed on file %s: %w", f.paths[i], err)
+		buf = buf[:n]
+
+		var found bool
+		for _, v := range votes {
+			if bytes.Equal(v.buf, buf) && v.err == err {
+				v.replicas = append(v.replicas, i)
+				found = true
+				break
 			}
 		}
+		if !found {
+			votes = append(votes, &ballot{buf: buf, err: err, replicas: []int{i}})
+		}
 	}
-	f.offset += int64(len(b))
-	return len(b), nil
+	sort.SliceStable(votes, func(a, b int) bool {
+		return len(votes[a].replicas) > len(votes[b].replicas)
+	})
+	return votes, failed, errs
+}
+
+const recoverBlockSize = 64 << 10
+
+// ReadAtRecover stitches the range together block by block from whichever replicas agree on each block,
+// so a read can succeed even when no single replica is fully readable
+func (f *File) ReadAtRecover(b []byte, off int64) (int, error) {
+	if f == nil || len(f.multi) == 0 || f.lock == nil {
+		return 0, os.ErrInvalid
+	}
+	if err := f.acquireRead(); err != nil {
+		return 0, err
+	}
+	defer f.releaseRead()
+
+	var total int
+	for total < len(b) {
+		// align blocks to the file rather than the request
+		pos := off + int64(total)
+		end := (pos/recoverBlockSize + 1) * recoverBlockSize
+		size := int64(len(b) - total)
+		if end-pos < size {
+			size = end - pos
+		}
+		n, err := f.vote(b[total:total+int(size)], pos, f.writeQuorum())
+		total += n
+		if err != nil {
+			return total, err
+		}
+		if int64(n) < size {
+			return total, io.EOF
+		}
+	}
+	return total, nil
 }
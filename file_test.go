@@ -0,0 +1,418 @@
+package haraqafs
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTmpVolumes(t testing.TB, n int) []string {
+	volumes := make([]string, n)
+	for i := range volumes {
+		volumes[i] = newTmpVolume(t, "vol*")
+	}
+	return volumes
+}
+
+func removeVolumes(volumes []string) {
+	for _, v := range volumes {
+		_ = os.RemoveAll(v)
+	}
+}
+
+func TestReadAtMajority(t *testing.T) {
+	const fileName = "my_file"
+	volumes := newTmpVolumes(t, 3)
+	defer removeVolumes(volumes)
+
+	f, err := New(fileName, WithVolumes(volumes...), WithCreate())
+	checkErr(t, err)
+	checkWrite(t, f, []byte("hello"))
+
+	// corrupt a single replica underneath the open file
+	checkErr(t, os.WriteFile(filepath.Join(volumes[2], fileName), []byte("jello"), 0666))
+	b := make([]byte, 5)
+	n, err := f.ReadAtMajority(b, 0)
+	checkErr(t, err)
+	if string(b[:n]) != "hello" {
+		t.Fatal(string(b[:n]))
+	}
+
+	// with no majority the read fails
+	checkErr(t, os.WriteFile(filepath.Join(volumes[1], fileName), []byte("world"), 0666))
+	if _, err = f.ReadAtMajority(b, 0); !errors.Is(err, ErrNoMajority) {
+		t.Fatal(err)
+	}
+	checkClose(t, f)
+}
+
+func TestReadAtWithQuorum(t *testing.T) {
+	const fileName = "my_file"
+	volumes := newTmpVolumes(t, 3)
+	defer removeVolumes(volumes)
+
+	f, err := New(fileName, WithVolumes(volumes...), WithCreate())
+	checkErr(t, err)
+	checkWrite(t, f, []byte("hello"))
+	checkErr(t, os.WriteFile(filepath.Join(volumes[0], fileName), []byte("jello"), 0666))
+
+	b := make([]byte, 5)
+	_, err = f.ReadAtWithQuorum(b, 0, 2)
+	checkErr(t, err)
+	if _, err = f.ReadAtWithQuorum(b, 0, 3); !errors.Is(err, ErrNoMajority) {
+		t.Fatal(err)
+	}
+	var qErr *QuorumError
+	if _, err = f.ReadAtWithQuorum(b, 0, 4); !errors.As(err, &qErr) {
+		t.Fatal(err)
+	}
+	checkClose(t, f)
+}
+
+func TestBarrier(t *testing.T) {
+	volumes := newTmpVolumes(t, 3)
+	defer removeVolumes(volumes)
+
+	f, err := New("my_file", WithVolumes(volumes...), WithCreate())
+	checkErr(t, err)
+	checkWrite(t, f, []byte("hello"))
+	checkErr(t, f.Barrier())
+
+	// losing a single replica still leaves a quorum
+	checkErr(t, f.multi[0].Close())
+	checkErr(t, f.Barrier())
+	checkErr(t, f.multi[1].Close())
+	var qErr *SyncQuorumError
+	if err = f.Barrier(); !errors.As(err, &qErr) || qErr.Synced != 1 || !errors.Is(err, ErrNoQuorum) {
+		t.Fatal(err)
+	}
+	_ = f.Close()
+}
+
+func TestSync(t *testing.T) {
+	volumes := newTmpVolumes(t, 3)
+	defer removeVolumes(volumes)
+
+	f, err := New("my_file", WithVolumes(volumes...), WithCreate())
+	checkErr(t, err)
+	checkWrite(t, f, []byte("hello"))
+	checkErr(t, f.Sync())
+
+	// unlike Barrier a single failed replica fails the sync, naming the replica
+	checkErr(t, f.multi[0].Close())
+	checkErr(t, f.Barrier())
+	err = f.Sync()
+	var pErr *fs.PathError
+	if !errors.As(err, &pErr) || pErr.Path != f.paths[0] || !errors.Is(err, os.ErrClosed) {
+		t.Fatal(err)
+	}
+	_ = f.Close()
+}
+
+func TestReadAtRecover(t *testing.T) {
+	const fileName = "my_file"
+	volumes := newTmpVolumes(t, 3)
+	defer removeVolumes(volumes)
+
+	want := bytes.Repeat([]byte("0123456789abcdef"), 3*recoverBlockSize/16)
+	f, err := New(fileName, WithVolumes(volumes...), WithCreate())
+	checkErr(t, err)
+	checkWrite(t, f, want)
+
+	// corrupt a different block on every replica
+	for i, v := range volumes {
+		r, err := os.OpenFile(filepath.Join(v, fileName), os.O_RDWR, 0)
+		checkErr(t, err)
+		_, err = r.WriteAt([]byte("corrupt"), int64(i*recoverBlockSize+100))
+		checkErr(t, err)
+		checkClose(t, r)
+	}
+
+	got := make([]byte, len(want))
+	if _, err = f.ReadAtMajority(got, 0); !errors.Is(err, ErrNoMajority) {
+		t.Fatal(err)
+	}
+	n, err := f.ReadAtRecover(got, 0)
+	checkErr(t, err)
+	if n != len(want) || !bytes.Equal(got, want) {
+		t.Fatal(n)
+	}
+
+	// unaligned reads past the end report EOF
+	n, err = f.ReadAtRecover(got[:100], int64(len(want)-50))
+	if n != 50 || !errors.Is(err, io.EOF) {
+		t.Fatal(n, err)
+	}
+	checkClose(t, f)
+}
+
+func TestCloseWithReport(t *testing.T) {
+	volumes := newTmpVolumes(t, 2)
+	defer removeVolumes(volumes)
+
+	f, err := New("my_file", WithVolumes(volumes...), WithCreate())
+	checkErr(t, err)
+	checkWrite(t, f, []byte("hello"))
+	checkErr(t, f.multi[1].Close())
+
+	report, err := f.CloseWithReport()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.AtRisk() || len(report.Replicas) != 2 {
+		t.Fatal(report)
+	}
+	if r := report.Replicas[0]; !r.Synced || !r.Closed || r.Err != nil {
+		t.Fatal(r)
+	}
+	if r := report.Replicas[1]; r.Synced || r.Closed || !errors.Is(r.Err, os.ErrClosed) {
+		t.Fatal(r)
+	}
+}
+
+func TestWriteBeyondEOF(t *testing.T) {
+	const fileName = "my_file"
+	for _, opts := range [][]FileOption{nil, {WithZeroFill()}} {
+		volumes := newTmpVolumes(t, 3)
+		f, err := New(fileName, append(opts, WithVolumes(volumes...), WithCreate())...)
+		checkErr(t, err)
+		checkWrite(t, f, []byte("hello"))
+		_, err = f.WriteAt([]byte("world"), 3<<20)
+		checkErr(t, err)
+		checkClose(t, f)
+
+		var first []byte
+		for _, v := range volumes {
+			b, err := os.ReadFile(filepath.Join(v, fileName))
+			checkErr(t, err)
+			if len(b) != 3<<20+5 || !bytes.Equal(b[5:3<<20], make([]byte, 3<<20-5)) {
+				t.Fatal(len(b))
+			}
+			if first != nil && !bytes.Equal(first, b) {
+				t.Fatal("replicas differ")
+			}
+			first = b
+			// zero fill writes real zeros, a hole would read back the same
+			if size, ok := allocated(filepath.Join(v, fileName)); ok && opts != nil && size < 3<<20 {
+				t.Fatal("gap left as a hole", size)
+			}
+		}
+
+		// content hashing sees the replicas as equal, so nothing is repaired
+		var events []Event
+		f, err = New(fileName, WithVolumes(volumes...), WithHashing(sha256.New()), WithReadOnly(), WithEvents(func(e Event) {
+			events = append(events, e)
+		}))
+		checkErr(t, err)
+		checkClose(t, f)
+		if len(events) != 0 {
+			t.Fatal(events)
+		}
+		removeVolumes(volumes)
+	}
+}
+
+func TestWithLockTimeout(t *testing.T) {
+	volumes := newTmpVolumes(t, 3)
+	defer removeVolumes(volumes)
+	ctx, cancel := context.WithCancel(context.Background())
+	f, err := New("my_file", WithVolumes(volumes...), WithCreate(), WithLockTimeout(20*time.Millisecond), WithContext(ctx))
+	checkErr(t, err)
+
+	// simulate a stuck operation holding the lock
+	checkErr(t, f.acquire())
+	if _, err := f.Write([]byte("hello")); !errors.Is(err, ErrLockTimeout) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatal(err)
+	}
+	cancel()
+	if err := f.Truncate(0); !errors.Is(err, context.Canceled) {
+		t.Fatal(err)
+	}
+	f.lock.unlock()
+
+	// the lock is free again, but the context stays cancelled
+	if _, err := f.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	checkClose(t, f)
+}
+
+func TestSharedReads(t *testing.T) {
+	volumes := newTmpVolumes(t, 3)
+	defer removeVolumes(volumes)
+	f, err := New("my_file", WithVolumes(volumes...), WithCreate(), WithLockTimeout(20*time.Millisecond))
+	checkErr(t, err)
+	checkWrite(t, f, []byte("hello"))
+
+	// readers don't block each other, but do block writers
+	checkErr(t, f.acquireRead())
+	done := make(chan error)
+	for i := 0; i < 4; i++ {
+		go func() {
+			b := make([]byte, 5)
+			_, err := f.ReadAt(b, 0)
+			if err == nil && string(b) != "hello" {
+				err = errors.New(string(b))
+			}
+			done <- err
+		}()
+	}
+	for i := 0; i < 4; i++ {
+		checkErr(t, <-done)
+	}
+	if _, err := f.Write([]byte("world")); !errors.Is(err, ErrLockTimeout) {
+		t.Fatal(err)
+	}
+	f.lock.runlock()
+
+	checkWrite(t, f, []byte("world"))
+	checkClose(t, f)
+}
+
+func TestReadOnlyLockFree(t *testing.T) {
+	volumes := newTmpVolumes(t, 3)
+	defer removeVolumes(volumes)
+	f, err := New("my_file", WithVolumes(volumes...), WithCreate())
+	checkErr(t, err)
+	checkWrite(t, f, []byte("hello"))
+	checkClose(t, f)
+
+	f, err = New("my_file", WithVolumes(append([]string(nil), volumes...)...), WithReadOnly())
+	checkErr(t, err)
+
+	// reads go ahead even while the lock is held
+	checkErr(t, f.acquire())
+	b := make([]byte, 5)
+	if _, err = f.ReadAt(b, 0); err != nil || string(b) != "hello" {
+		t.Fatal(err, string(b))
+	}
+	f.lock.unlock()
+
+	checkClose(t, f)
+	if _, err = f.ReadAt(b, 0); !errors.Is(err, os.ErrClosed) {
+		t.Fatal(err)
+	}
+}
+
+func TestAppendOnlyWrites(t *testing.T) {
+	volumes := newTmpVolumes(t, 3)
+	defer removeVolumes(volumes)
+	f, err := New("my_file", WithVolumes(volumes...), WithCreate(), WithAppendOnly(true))
+	checkErr(t, err)
+	checkWrite(t, f, []byte("hello"))
+	checkWrite(t, f, []byte("world"))
+
+	var appendErr *AppendOnlyError
+	if _, err = f.WriteAt([]byte("jello"), 0); !errors.As(err, &appendErr) || !errors.Is(err, os.ErrPermission) {
+		t.Fatal(err)
+	}
+	if appendErr.Offset != 0 || appendErr.End != 10 {
+		t.Fatal(appendErr)
+	}
+	if err = f.Truncate(5); !errors.As(err, &appendErr) {
+		t.Fatal(err)
+	}
+	checkErr(t, f.Truncate(12))
+	checkClose(t, f)
+
+	// reopening appends after the existing content
+	f, err = New("my_file", WithVolumes(append([]string(nil), volumes...)...), WithAppendOnly(true))
+	checkErr(t, err)
+	checkWrite(t, f, []byte("!"))
+	checkClose(t, f)
+	b, err := os.ReadFile(filepath.Join(volumes[0], "my_file"))
+	checkErr(t, err)
+	if string(b) != "helloworld\x00\x00!" {
+		t.Fatalf("%q", b)
+	}
+}
+
+func TestTruncateRollback(t *testing.T) {
+	volumes := newTmpVolumes(t, 3)
+	defer removeVolumes(volumes)
+	f, err := New("my_file", WithVolumes(volumes...), WithCreate())
+	checkErr(t, err)
+	checkWrite(t, f, []byte("hello"))
+
+	// break the last replica underneath the file
+	checkErr(t, f.multi[2].Close())
+
+	// growing is undone on the replicas which succeeded
+	var tErr *TruncateError
+	if err = f.Truncate(10); !errors.As(err, &tErr) || !errors.Is(err, os.ErrClosed) {
+		t.Fatal(err)
+	}
+	if len(tErr.Failed) != 1 || len(tErr.Dirty) != 0 {
+		t.Fatal(tErr)
+	}
+	for _, v := range volumes[:2] {
+		info, err := os.Stat(filepath.Join(v, "my_file"))
+		checkErr(t, err)
+		if info.Size() != 5 {
+			t.Fatal(info.Size())
+		}
+	}
+
+	// shrinking can't be undone, so those replicas are marked dirty
+	if err = f.Truncate(2); !errors.As(err, &tErr) {
+		t.Fatal(err)
+	}
+	if len(tErr.Failed) != 1 || len(tErr.Dirty) != 2 || f.usable(0) || f.usable(1) {
+		t.Fatal(tErr)
+	}
+}
+
+func TestPathErrors(t *testing.T) {
+	volumes := newTmpVolumes(t, 3)
+	defer removeVolumes(volumes)
+	f, err := New("my_file", WithVolumes(volumes...), WithCreate())
+	checkErr(t, err)
+	checkErr(t, f.multi[1].Close())
+
+	var pe *fs.PathError
+	if _, err = f.Write([]byte("hello")); !errors.As(err, &pe) || pe.Op != "write" || pe.Path != f.paths[1] || !errors.Is(err, os.ErrClosed) {
+		t.Fatal(err)
+	}
+	if err = f.Chmod(0600); !errors.As(err, &pe) || pe.Op != "chmod" || pe.Path != f.paths[1] {
+		t.Fatal(err)
+	}
+	if err = f.Truncate(1); !errors.As(err, &pe) || pe.Op != "truncate" || pe.Path != f.paths[1] {
+		t.Fatal(err)
+	}
+}
+
+func TestAppendFlag(t *testing.T) {
+	volumes := newTmpVolumes(t, 3)
+	defer removeVolumes(volumes)
+	f, err := New("my_file", WithVolumes(volumes...), WithCreate())
+	checkErr(t, err)
+	checkWrite(t, f, []byte("hello"))
+	checkClose(t, f)
+
+	f, err = New("my_file", WithVolumes(append([]string(nil), volumes...)...), WithFlags(os.O_RDWR|os.O_APPEND))
+	checkErr(t, err)
+	checkSeek(t, f, 0, io.SeekStart)
+	checkWrite(t, f, []byte(" world"))
+	if _, err = f.WriteAt([]byte("j"), 0); !errors.Is(err, os.ErrInvalid) {
+		t.Fatal(err)
+	}
+	checkSeek(t, f, 0, io.SeekStart)
+	if n, err := f.WriteString("!"); n != 1 || err != nil {
+		t.Fatal(n, err)
+	}
+	checkSeek(t, f, 0, io.SeekStart)
+	checkRead(t, f, []byte("hello world!"))
+	checkClose(t, f)
+
+	specs := []Volume{{Path: volumes[0], Flags: os.O_APPEND}, {Path: volumes[1]}, {Path: volumes[2]}}
+	if _, err = New("my_file", WithVolumeSpecs(specs...)); !errors.Is(err, os.ErrInvalid) {
+		t.Fatal(err)
+	}
+}
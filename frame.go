@@ -0,0 +1,197 @@
+package haraqafs
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+)
+
+// a framed record is laid out as [length][payload][crc][length], the trailing length lets the tail be validated from the end
+const frameOverhead = 12
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// tornWindow bounds how far back from the end of a replica validTail searches for the last record boundary
+var tornWindow int64 = 1 << 20
+
+func frame(b []byte) []byte {
+	out := make([]byte, len(b)+frameOverhead)
+	binary.LittleEndian.PutUint32(out, uint32(len(b)))
+	copy(out[4:], b)
+	binary.LittleEndian.PutUint32(out[4+len(b):], crc32.Checksum(out[:4+len(b)], crcTable))
+	binary.LittleEndian.PutUint32(out[8+len(b):], uint32(len(b)))
+	return out
+}
+
+// unframe validates a whole record and returns its payload
+func unframe(rec []byte) ([]byte, error) {
+	if len(rec) < frameOverhead {
+		return nil, ErrBadRecord
+	}
+	n := len(rec) - frameOverhead
+	if binary.LittleEndian.Uint32(rec) != uint32(n) || binary.LittleEndian.Uint32(rec[8+n:]) != uint32(n) {
+		return nil, ErrBadRecord
+	}
+	if binary.LittleEndian.Uint32(rec[4+n:]) != crc32.Checksum(rec[:4+n], crcTable) {
+		return nil, ErrBadRecord
+	}
+	return rec[4 : 4+n], nil
+}
+
+// recordEndsAt reports whether a valid record ends exactly at end
+func recordEndsAt(r io.ReaderAt, end int64) bool {
+	if end < frameOverhead {
+		return false
+	}
+	var trailer [4]byte
+	if _, err := r.ReadAt(trailer[:], end-4); err != nil {
+		return false
+	}
+	start := end - frameOverhead - int64(binary.LittleEndian.Uint32(trailer[:]))
+	if start < 0 {
+		return false
+	}
+	rec := make([]byte, end-start)
+	if _, err := r.ReadAt(rec, start); err != nil {
+		return false
+	}
+	_, err := unframe(rec)
+	return err == nil
+}
+
+// validTail returns the end of the last valid record, scanning backwards from size past any torn write
+func validTail(r io.ReaderAt, size int64) (int64, error) {
+	if size == 0 || recordEndsAt(r, size) {
+		return size, nil
+	}
+	start := size - tornWindow
+	if start < 0 {
+		start = 0
+	}
+	buf := make([]byte, size-start)
+	if _, err := r.ReadAt(buf, start); err != nil && !errors.Is(err, io.EOF) {
+		return 0, err
+	}
+	for end := size - 1; end > start; end-- {
+		if end-start < 4 {
+			break
+		}
+		// cheap plausibility check before reading the whole record
+		n := int64(binary.LittleEndian.Uint32(buf[end-start-4 : end-start]))
+		if n+frameOverhead > end {
+			continue
+		}
+		if recordEndsAt(r, end) {
+			return end, nil
+		}
+	}
+	if start > 0 {
+		return 0, fmt.Errorf("no record boundary in the last %d bytes: %w", tornWindow, ErrBadRecord)
+	}
+	return 0, nil
+}
+
+type TornPolicy int
+
+const (
+	// TruncateTorn cuts a torn tail off the replica
+	TruncateTorn TornPolicy = iota
+	// ErrorOnTorn fails the open instead of touching a torn replica
+	ErrorOnTorn
+	// QuarantineTorn copies a torn tail to a .torn file next to the replica before cutting it off
+	QuarantineTorn
+)
+
+// recoverTails truncates every replica back to its last valid record so torn appends don't count towards consensus
+func (f *File) recoverTails() error {
+	if !f.framing {
+		return nil
+	}
+	for i := range f.multi {
+		if f.multi[i] == nil {
+			continue
+		}
+		info, err := f.multi[i].Stat()
+		if err != nil {
+			return fmt.Errorf("stat failed for %s: %w", f.paths[i], err)
+		}
+		end, err := validTail(f.multi[i], info.Size())
+		if err != nil {
+			return fmt.Errorf("recover tail of %s: %w", f.paths[i], err)
+		}
+		if end == info.Size() {
+			continue
+		}
+		if f.tornPolicy == ErrorOnTorn {
+			return fmt.Errorf("replica %s is torn at %d of %d bytes: %w", f.paths[i], end, info.Size(), ErrBadRecord)
+		}
+		if f.readOnly {
+			f.markDirty(i, fmt.Errorf("replica %s has a torn tail at %d", f.paths[i], end))
+			continue
+		}
+		if f.tornPolicy == QuarantineTorn {
+			if err = f.quarantine(i, end, info.Size()); err != nil {
+				return err
+			}
+		}
+		if err = f.multi[i].Truncate(end); err != nil {
+			return fmt.Errorf("trunc failed for %s: %w", f.paths[i], err)
+		}
+	}
+	return nil
+}
+
+// quarantine saves the torn bytes of replica i so they can be inspected after the replica is truncated
+func (f *File) quarantine(i int, end, size int64) error {
+	path := fmt.Sprintf("%s.torn.%d", f.paths[i], end)
+	out, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return fmt.Errorf("quarantine failed for %s: %w", f.paths[i], err)
+	}
+	_, err = io.Copy(out, io.NewSectionReader(f.multi[i], end, size-end))
+	if e := out.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		_ = os.Remove(path)
+		return fmt.Errorf("quarantine failed for %s: %w", f.paths[i], err)
+	}
+	return nil
+}
+
+// ReadRecordAt reads the framed record starting at off, returning its payload and the offset of the next record
+func (f *File) ReadRecordAt(off int64) ([]byte, int64, error) {
+	if f == nil || len(f.multi) == 0 || f.lock == nil {
+		return nil, 0, os.ErrInvalid
+	}
+	if !f.framing {
+		return nil, 0, fmt.Errorf("file isn't framed: %w", os.ErrInvalid)
+	}
+	if err := f.acquireRead(); err != nil {
+		return nil, 0, err
+	}
+	defer f.releaseRead()
+
+	var header [4]byte
+	if n, err := f.readAt(header[:], off); n < len(header) {
+		if err == nil || (n > 0 && errors.Is(err, io.EOF)) {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, 0, err
+	}
+	rec := make([]byte, int64(binary.LittleEndian.Uint32(header[:]))+frameOverhead)
+	if n, err := f.readAt(rec, off); n < len(rec) {
+		if err == nil || errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, 0, err
+	}
+	b, err := unframe(rec)
+	if err != nil {
+		return nil, 0, fmt.Errorf("record at %d: %w", off, err)
+	}
+	return b, off + int64(len(rec)), nil
+}
@@ -0,0 +1,86 @@
+package haraqafs
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWithFraming(t *testing.T) {
+	volumes := newTmpVolumes(t, 3)
+	defer removeVolumes(volumes)
+	opts := func(extra ...FileOption) []FileOption {
+		return append([]FileOption{WithVolumes(append([]string(nil), volumes...)...), WithAppendOnly(true), WithFraming()}, extra...)
+	}
+
+	f, err := New("my_file", opts(WithCreate())...)
+	checkErr(t, err)
+	checkWrite(t, f, []byte("hello"))
+	checkWrite(t, f, []byte("world"))
+	checkClose(t, f)
+
+	// tear the last write on two replicas, and leave garbage on the third
+	for i, v := range volumes {
+		path := filepath.Join(v, "my_file")
+		b, err := os.ReadFile(path)
+		checkErr(t, err)
+		switch i {
+		case 0, 1:
+			b = b[:len(b)-3]
+		case 2:
+			b = append(b, "garbage"...)
+		}
+		checkErr(t, os.WriteFile(path, b, 0666))
+	}
+
+	f, err = New("my_file", opts()...)
+	checkErr(t, err)
+	b, next, err := f.ReadRecordAt(0)
+	if err != nil || string(b) != "hello" {
+		t.Fatal(err, string(b))
+	}
+	if _, _, err = f.ReadRecordAt(next); !errors.Is(err, io.EOF) {
+		t.Fatal(err)
+	}
+	checkWrite(t, f, []byte("again"))
+	b, _, err = f.ReadRecordAt(next)
+	if err != nil || string(b) != "again" {
+		t.Fatal(err, string(b))
+	}
+	checkClose(t, f)
+
+	if _, err = New("my_file", WithVolumes(volumes...), WithFraming()); !errors.Is(err, os.ErrInvalid) {
+		t.Fatal(err)
+	}
+}
+
+func TestWithTornPolicy(t *testing.T) {
+	volumes := newTmpVolumes(t, 1)
+	defer removeVolumes(volumes)
+	path := filepath.Join(volumes[0], "my_file")
+	checkErr(t, os.WriteFile(path, append(frame([]byte("hello")), "garbage"...), 0666))
+	opts := func(p TornPolicy) []FileOption {
+		return []FileOption{WithVolumes(append([]string(nil), volumes...)...), WithAppendOnly(true), WithFraming(), WithTornPolicy(p)}
+	}
+
+	if _, err := New("my_file", opts(ErrorOnTorn)...); !errors.Is(err, ErrBadRecord) {
+		t.Fatal(err)
+	}
+
+	f, err := New("my_file", opts(QuarantineTorn)...)
+	checkErr(t, err)
+	checkClose(t, f)
+	b, err := os.ReadFile(fmt.Sprintf("%s.torn.%d", path, len(frame([]byte("hello")))))
+	checkErr(t, err)
+	if string(b) != "garbage" {
+		t.Fatal(string(b))
+	}
+	info, err := os.Stat(path)
+	checkErr(t, err)
+	if info.Size() != int64(len(frame([]byte("hello")))) {
+		t.Fatal(info.Size())
+	}
+}
@@ -0,0 +1,106 @@
+package haraqafs
+
+import (
+	"hash"
+	"io/fs"
+	"os"
+)
+
+// FS holds a replication configuration shared by every file opened through it
+type FS struct {
+	opts    []FileOption
+	newHash func() hash.Hash
+	stats   *Stats
+	jail    string
+	account *account
+}
+
+func NewFS(opts ...FileOption) *FS {
+	return &FS{opts: opts, stats: NewStats()}
+}
+
+func (fsys *FS) Stats() []VolumeStats {
+	return fsys.stats.Volumes()
+}
+
+func (fsys *FS) New(name string, opts ...FileOption) (*File, error) {
+	all := make([]FileOption, 0, len(fsys.opts)+len(opts)+2)
+	all = append(all, WithStats(fsys.stats))
+	all = append(all, fsys.opts...)
+	if fsys.newHash != nil {
+		// hashes aren't safe for concurrent use, so each file gets its own
+		all = append(all, WithHashing(fsys.newHash()))
+	}
+	return New(name, append(all, opts...)...)
+}
+
+// Open opens name read only, so FS can be used as an fs.FS. the fs.File it returns can be asserted to *File
+func (fsys *FS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	f, err := fsys.New(name, WithReadOnly())
+	if err != nil {
+		// a nil *File would make a non nil fs.File
+		return nil, err
+	}
+	return f, nil
+}
+
+// Create creates or truncates name, like os.Create
+func (fsys *FS) Create(name string) (*File, error) {
+	return fsys.New(name, WithCreate())
+}
+
+// OpenFile opens name with flag, creating missing replicas with perm, like os.OpenFile.
+// replicas are always opened for reading as well, so O_WRONLY behaves like O_RDWR
+func (fsys *FS) OpenFile(name string, flag int, perm os.FileMode) (*File, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR) == 0 {
+		return fsys.New(name, WithReadOnly())
+	}
+	return fsys.New(name, WithFlags(flag), func(f *File) error {
+		f.perms = perm
+		return nil
+	})
+}
+
+// Stat returns the consensus info of name, opening it read only so nothing is repaired
+func (fsys *FS) Stat(name string) (os.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrInvalid}
+	}
+	f, err := fsys.New(name, WithReadOnly())
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return info, err
+}
+
+// Remove removes name from every volume, see Remove
+func (fsys *FS) Remove(name string) error {
+	return Remove(name, fsys.opts...)
+}
+
+// RemoveAll removes name and everything under it from every volume, see RemoveAll
+func (fsys *FS) RemoveAll(name string) error {
+	return RemoveAll(name, fsys.opts...)
+}
+
+// Rename moves oldname to newname on every volume, see Rename
+func (fsys *FS) Rename(oldname, newname string) error {
+	return Rename(oldname, newname, fsys.opts...)
+}
+
+// Mkdir creates a directory on every volume, see Mkdir
+func (fsys *FS) Mkdir(name string, perm os.FileMode) error {
+	return Mkdir(name, perm, fsys.opts...)
+}
+
+// MkdirAll creates a directory and any missing parents on every volume, see MkdirAll
+func (fsys *FS) MkdirAll(name string, perm os.FileMode) error {
+	return MkdirAll(name, perm, fsys.opts...)
+}
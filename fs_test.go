@@ -0,0 +1,103 @@
+package haraqafs
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+)
+
+func TestFS(t *testing.T) {
+	volumes := newTmpVolumes(t, 3)
+	defer removeVolumes(volumes)
+	fsys := NewFS(WithVolumes(volumes...))
+
+	checkErr(t, fsys.MkdirAll("a/b", 0777))
+	checkErr(t, fsys.Mkdir("a/c", 0777))
+	f, err := fsys.Create("a/b/file")
+	checkErr(t, err)
+	checkWrite(t, f, []byte("hello"))
+	checkClose(t, f)
+
+	f, err = fsys.OpenFile("a/b/file", os.O_WRONLY|os.O_APPEND, 0)
+	checkErr(t, err)
+	checkWrite(t, f, []byte(" world"))
+	checkClose(t, f)
+	f, err = fsys.OpenFile("a/b/new", os.O_WRONLY|os.O_CREATE, 0600)
+	checkErr(t, err)
+	checkClose(t, f)
+	for _, v := range volumes {
+		info, err := os.Stat(filepath.Join(v, "a", "b", "new"))
+		checkErr(t, err)
+		if info.Mode().Perm() != 0600 {
+			t.Fatal(info.Mode())
+		}
+	}
+
+	file, err := fsys.Open("a/b/file")
+	checkErr(t, err)
+	f = file.(*File)
+	checkRead(t, f, []byte("hello world"))
+	if _, err = f.Write([]byte("x")); err == nil {
+		t.Fatal("wrote to a file opened read only")
+	}
+	checkClose(t, f)
+
+	info, err := fsys.Stat("a/b/file")
+	checkErr(t, err)
+	if info.Name() != "file" || info.Size() != 11 {
+		t.Fatal(info.Name(), info.Size())
+	}
+	if info, err = fsys.Stat("a/c"); err != nil || !info.IsDir() {
+		t.Fatal(info, err)
+	}
+
+	checkErr(t, fsys.Rename("a/b/file", "a/c/file"))
+	checkErr(t, fsys.Remove("a/c/file"))
+	if _, err = fsys.Stat("a/c/file"); !errors.Is(err, os.ErrNotExist) {
+		t.Fatal(err)
+	}
+	checkErr(t, fsys.RemoveAll("a"))
+	if _, err = fsys.Stat("a"); !errors.Is(err, os.ErrNotExist) {
+		t.Fatal(err)
+	}
+}
+
+func TestIOFS(t *testing.T) {
+	volumes := newTmpVolumes(t, 3)
+	defer removeVolumes(volumes)
+	fsys := NewFS(WithVolumes(volumes...))
+	checkErr(t, fsys.MkdirAll("a/b", 0777))
+	for _, name := range []string{"a/one.txt", "a/b/two.txt", "three.md"} {
+		f, err := fsys.Create(name)
+		checkErr(t, err)
+		checkWrite(t, f, []byte(name))
+		checkClose(t, f)
+	}
+	// sidecars and entries missing from a quorum stay hidden
+	f, err := fsys.New("a/one.txt", WithVerifiedReads())
+	checkErr(t, err)
+	checkClose(t, f)
+	checkErr(t, os.WriteFile(filepath.Join(volumes[0], "stray"), nil, 0666))
+
+	checkErr(t, fstest.TestFS(fsys, "a/one.txt", "a/b/two.txt", "three.md"))
+
+	matches, err := fs.Glob(fsys, "a/*.txt")
+	checkErr(t, err)
+	if len(matches) != 1 || matches[0] != "a/one.txt" {
+		t.Fatal(matches)
+	}
+	b, err := fs.ReadFile(fsys, "a/b/two.txt")
+	checkErr(t, err)
+	if string(b) != "a/b/two.txt" {
+		t.Fatal(string(b))
+	}
+	if _, err = fsys.Open("/three.md"); !errors.Is(err, fs.ErrInvalid) {
+		t.Fatal(err)
+	}
+	if file, err := fsys.Open("missing"); file != nil || !errors.Is(err, os.ErrNotExist) {
+		t.Fatal(file, err)
+	}
+}
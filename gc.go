@@ -0,0 +1,171 @@
+package haraqafs
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// GCReport lists what GC removed from one volume
+type GCReport struct {
+	Volume  string
+	Removed []string
+	Bytes   int64
+	Err     error
+}
+
+// GC removes what crashed or abandoned handles left behind on the volumes, once it's older than olderThan:
+// temporary copies, torn tails quarantined by WithTornPolicy, digest sidecars whose replica is gone,
+// and lock and lease directories nobody refreshed. temporary copies and lock directories are never collected before
+// they'd be broken as stale anyway, lease directories not before their lease expired, and nothing belonging to a file
+// pinned with Dir.Pin is collected at all
+func GC(volumes []string, olderThan time.Duration) ([]GCReport, error) {
+	if olderThan < 0 {
+		return nil, fmt.Errorf("negative gc age: %w", os.ErrInvalid)
+	}
+	cutoff := time.Now().Add(-olderThan)
+	reports := make([]GCReport, len(volumes))
+	var errs []error
+	for i, v := range volumes {
+		reports[i] = gcVolume(filepath.Clean(v), cutoff)
+		if reports[i].Err != nil {
+			errs = append(errs, reports[i].Err)
+		}
+	}
+	return reports, aggErrors(errs)
+}
+
+func gcVolume(volume string, cutoff time.Time) GCReport {
+	r := GCReport{Volume: volume}
+	var errs []error
+	r.Err = filepath.WalkDir(volume, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == volume {
+				return err
+			}
+			errs = append(errs, err)
+			return nil
+		}
+		if path == volume || !garbage(path, d.Name(), d.IsDir()) {
+			return nil
+		}
+		if pinned(owner(path, d.Name())) {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			errs = append(errs, err)
+			return nil
+		}
+		// live handles keep their temporary copies and lock directories fresh, and their leases unexpired
+		now := time.Now()
+		due := cutoff
+		if stale := now.Add(-lockStale); (strings.Contains(d.Name(), tmpMarker) || strings.HasSuffix(d.Name(), lockSuffix)) && stale.Before(due) {
+			due = stale
+		}
+		live := d.IsDir() && strings.HasSuffix(d.Name(), leaseSuffix) && !leaseExpired(path, now)
+		if live || !info.ModTime().Before(due) {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		size := diskUsage(path)
+		if err := os.RemoveAll(path); err != nil {
+			errs = append(errs, err)
+			return nil
+		}
+		r.Removed = append(r.Removed, path)
+		r.Bytes += size
+		if d.IsDir() {
+			return fs.SkipDir
+		}
+		return nil
+	})
+	if r.Err == nil {
+		r.Err = aggErrors(errs)
+	}
+	return r
+}
+
+// garbage reports whether name is something haraqafs leaves next to replicas which can be collected once it's old enough
+func garbage(path, name string, dir bool) bool {
+	switch {
+	case strings.Contains(name, tmpMarker):
+		return true
+	case dir:
+		return strings.HasSuffix(name, lockSuffix) || strings.HasSuffix(name, leaseSuffix)
+	case strings.HasSuffix(name, digestSuffix):
+		_, err := os.Lstat(strings.TrimSuffix(path, digestSuffix))
+		return errors.Is(err, os.ErrNotExist)
+	case strings.HasSuffix(name, hashSuffix):
+		_, err := os.Lstat(strings.TrimSuffix(path, hashSuffix))
+		return errors.Is(err, os.ErrNotExist)
+	case strings.HasSuffix(name, journalSuffix):
+		_, err := os.Lstat(strings.TrimSuffix(path, journalSuffix))
+		return errors.Is(err, os.ErrNotExist)
+	case strings.HasSuffix(name, stageSuffix):
+		_, err := os.Lstat(strings.TrimSuffix(path, stageSuffix))
+		return errors.Is(err, os.ErrNotExist)
+	case strings.HasSuffix(name, commitSuffix):
+		_, err := os.Lstat(strings.TrimSuffix(path, commitSuffix))
+		return errors.Is(err, os.ErrNotExist)
+	}
+	if i := strings.LastIndex(name, ".torn."); i > 0 {
+		_, err := strconv.ParseInt(name[i+len(".torn."):], 10, 64)
+		return err == nil
+	}
+	return false
+}
+
+// owner returns the path of the replica the garbage at path was left next to
+func owner(path, name string) string {
+	dir := filepath.Dir(path)
+	switch {
+	case strings.Contains(name, tmpMarker):
+		// temporary copies are named after their replica, broken locks and leases keep their directory's name
+		base := name[:strings.Index(name, tmpMarker)]
+		base = strings.TrimSuffix(strings.TrimSuffix(base, lockSuffix), leaseSuffix)
+		return filepath.Join(dir, strings.TrimPrefix(base, "."))
+	case strings.HasSuffix(name, lockSuffix):
+		return strings.TrimSuffix(path, lockSuffix)
+	case strings.HasSuffix(name, leaseSuffix):
+		return strings.TrimSuffix(path, leaseSuffix)
+	case strings.HasSuffix(name, digestSuffix):
+		return strings.TrimSuffix(path, digestSuffix)
+	case strings.HasSuffix(name, hashSuffix):
+		return strings.TrimSuffix(path, hashSuffix)
+	case strings.HasSuffix(name, journalSuffix):
+		return strings.TrimSuffix(path, journalSuffix)
+	case strings.HasSuffix(name, stageSuffix):
+		return strings.TrimSuffix(path, stageSuffix)
+	case strings.HasSuffix(name, commitSuffix):
+		return strings.TrimSuffix(path, commitSuffix)
+	}
+	if i := strings.LastIndex(name, ".torn."); i > 0 {
+		return filepath.Join(dir, name[:i])
+	}
+	return path
+}
+
+func diskUsage(path string) int64 {
+	var size int64
+	_ = filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if info, err := d.Info(); err == nil && !d.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
@@ -0,0 +1,74 @@
+package haraqafs
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestGC(t *testing.T) {
+	volumes := newTmpVolumes(t, 2)
+	defer removeVolumes(volumes)
+
+	old := time.Now().Add(-time.Hour)
+	write := func(name string, age time.Time) {
+		path := filepath.Join(volumes[0], name)
+		checkErr(t, os.MkdirAll(filepath.Dir(path), 0777))
+		checkErr(t, os.WriteFile(path, []byte("hello"), 0666))
+		checkErr(t, os.Chtimes(path, age, age))
+	}
+	write("dir/a", old)
+	write("dir/a"+digestSuffix, old)
+	write("dir/gone"+digestSuffix, old)
+	write("dir/a.torn.10", old)
+	write("dir/.a"+tmpMarker+"123", old)
+	write("dir/.b"+tmpMarker+"456", time.Now())
+	checkErr(t, os.Mkdir(filepath.Join(volumes[0], "dir", "a"+leaseSuffix), 0777))
+	checkErr(t, os.Chtimes(filepath.Join(volumes[0], "dir", "a"+leaseSuffix), old, old))
+	checkErr(t, os.Mkdir(filepath.Join(volumes[0], "dir", "a"+lockSuffix), 0777))
+
+	reports, err := GC(volumes, time.Minute)
+	checkErr(t, err)
+	if len(reports) != 2 || len(reports[1].Removed) != 0 {
+		t.Fatal(reports)
+	}
+	if r := reports[0]; len(r.Removed) != 4 || r.Bytes != 15 {
+		t.Fatal(r)
+	}
+	for name, want := range map[string]bool{
+		"a": true, "a" + digestSuffix: true, "gone" + digestSuffix: false, "a.torn.10": false,
+		".a" + tmpMarker + "123": false, ".b" + tmpMarker + "456": true, "a" + leaseSuffix: false, "a" + lockSuffix: true,
+	} {
+		if _, err := os.Stat(filepath.Join(volumes[0], "dir", name)); (err == nil) != want {
+			t.Fatal(name, err)
+		}
+	}
+}
+
+func TestGCLive(t *testing.T) {
+	volumes := newTmpVolumes(t, 1)
+	defer removeVolumes(volumes)
+	old := time.Now().Add(-time.Hour)
+
+	// a lease taken an hour ago which is still held
+	lease := newAppendLease(2*time.Hour, LeaseFailFast)
+	checkErr(t, lease.acquire([]string{filepath.Join(volumes[0], "a")}, 1))
+	checkErr(t, os.Chtimes(filepath.Join(volumes[0], "a"+leaseSuffix), old, old))
+	checkErr(t, os.WriteFile(filepath.Join(volumes[0], ".a"+tmpMarker+"123"), []byte("hello"), 0666))
+	checkErr(t, os.Mkdir(filepath.Join(volumes[0], "a"+lockSuffix), 0777))
+
+	reports, err := GC(volumes, 0)
+	checkErr(t, err)
+	if len(reports[0].Removed) != 0 {
+		t.Fatal(reports[0].Removed)
+	}
+
+	// once the lease lapses it's collected
+	checkErr(t, lease.expires(filepath.Join(volumes[0], "a"+leaseSuffix), old.Add(-3*time.Hour)))
+	reports, err = GC(volumes, 0)
+	checkErr(t, err)
+	if len(reports[0].Removed) != 1 || reports[0].Removed[0] != filepath.Join(volumes[0], "a"+leaseSuffix) {
+		t.Fatal(reports[0].Removed)
+	}
+}
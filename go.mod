@@ -3,7 +3,9 @@ module github.com/haraqa/haraqafs
 go 1.13
 
 require (
+	github.com/BurntSushi/toml v1.2.1
 	github.com/google/pprof v0.0.0-20210506205249-923b5ab0fc1a // indirect
 	github.com/ianlancetaylor/demangle v0.0.0-20210406231658-61c622dd7d50 // indirect
 	golang.org/x/sys v0.0.0-20210514084401-e8d321eab015 // indirect
+	gopkg.in/yaml.v3 v3.0.1
 )
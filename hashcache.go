@@ -0,0 +1,161 @@
+package haraqafs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+)
+
+// hashSuffix names the sidecar caching a replica's consensus hash,
+// laid out as the replica's size, mod time and the chunk size it was hashed with, the hash's type and then the hash
+const hashSuffix = ".haraqafs-hash"
+
+const hashHeader = 24
+
+// WithHashCache keeps the consensus hash of each replica in a sidecar next to it along with the replica's size and mod time,
+// so opening a large file with WithHashing only rereads the replicas which changed since they were last hashed
+func WithHashCache() FileOption {
+	return func(f *File) error {
+		f.hashCache = true
+		return nil
+	}
+}
+
+func hashCachePath(path string) string {
+	return path + hashSuffix
+}
+
+// hashTag identifies the hash a cached value was made with
+func (f *File) hashTag() []byte {
+	return []byte(fmt.Sprintf("%T/%d\n", f.hashing, f.hashing.Size()))
+}
+
+// cachedHashes fills in the hashes of the non-empty replicas from their sidecars, hashing the replicas whose sidecar is
+// missing or out of date in full. it reports false, leaving hashes untouched, when no replica had a usable sidecar
+func (f *File) cachedHashes(sizes []int64, hashes [][]byte) (bool, error) {
+	if !f.hashCache {
+		return false, nil
+	}
+	var hits int
+	var stale []int
+	cached := make([][]byte, len(f.multi))
+	for i := range f.multi {
+		if f.multi[i] == nil || sizes[i] == 0 {
+			continue
+		}
+		info, err := f.multi[i].Stat()
+		if err != nil {
+			continue
+		}
+		if cached[i] = f.readHashCache(f.paths[i], info); cached[i] == nil {
+			stale = append(stale, i)
+		} else {
+			hits++
+		}
+	}
+	if hits == 0 {
+		return false, nil
+	}
+	for _, i := range stale {
+		sum, err := f.hashReplica(i)
+		var pathErr *fs.PathError
+		if errors.As(err, &pathErr) {
+			// unreadable replicas are left without a hash, like chunkHashes does
+			continue
+		}
+		if err != nil {
+			return false, err
+		}
+		cached[i] = sum
+		f.writeHashCache(i, sum)
+	}
+	for i := range cached {
+		if cached[i] != nil {
+			hashes[i] = cached[i]
+		}
+	}
+	return true, nil
+}
+
+// storeHashes caches the hashes chunkHashes settled on, leaving out the replicas it stopped reading part way through
+func (f *File) storeHashes(sizes []int64, hashes [][]byte) {
+	if !f.hashCache {
+		return
+	}
+	for i := range f.multi {
+		if f.multi[i] != nil && sizes[i] > 0 && len(hashes[i]) == f.hashing.Size() {
+			f.writeHashCache(i, hashes[i])
+		}
+	}
+}
+
+// hashReplica hashes replica i in full, giving the same hash chunkHashes does for a replica it reads to the end
+func (f *File) hashReplica(i int) ([]byte, error) {
+	var chain []byte
+	buf := make([]byte, f.chunkSize())
+	for off := int64(0); ; off += int64(len(buf)) {
+		if f.pastConsensusDeadline() {
+			return nil, errConsensusDeadline
+		}
+		if err := f.aborted(); err != nil {
+			return nil, err
+		}
+		n, err := f.multi[i].ReadAt(buf, off)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return nil, pathErr("read", f.paths[i], err)
+		}
+		if n == 0 {
+			break
+		}
+		f.hashing.Reset()
+		_, _ = f.hashing.Write(buf[:n])
+		chain = f.hashing.Sum(chain)
+	}
+	// same as finishGroup, a replica which fits in one chunk is identified by the hash of its content
+	if len(chain) == f.hashing.Size() {
+		return chain, nil
+	}
+	f.hashing.Reset()
+	_, _ = f.hashing.Write(chain)
+	return f.hashing.Sum(nil), nil
+}
+
+// readHashCache returns the cached hash of the replica at path, or nil when it's missing or doesn't match info
+func (f *File) readHashCache(path string, info os.FileInfo) []byte {
+	b, err := os.ReadFile(hashCachePath(path))
+	if err != nil || len(b) < hashHeader {
+		return nil
+	}
+	if int64(binary.LittleEndian.Uint64(b)) != info.Size() || int64(binary.LittleEndian.Uint64(b[8:])) != info.ModTime().UnixNano() ||
+		int(binary.LittleEndian.Uint64(b[16:])) != f.chunkSize() {
+		return nil
+	}
+	tag := f.hashTag()
+	if !bytes.HasPrefix(b[hashHeader:], tag) || len(b) != hashHeader+len(tag)+f.hashing.Size() {
+		return nil
+	}
+	return b[hashHeader+len(tag):]
+}
+
+// writeHashCache records sum as the hash of replica i, read only files leave their sidecars alone
+func (f *File) writeHashCache(i int, sum []byte) {
+	if f.readOnly {
+		return
+	}
+	info, err := f.multi[i].Stat()
+	if err != nil {
+		return
+	}
+	tag := f.hashTag()
+	out := make([]byte, hashHeader, hashHeader+len(tag)+len(sum))
+	binary.LittleEndian.PutUint64(out, uint64(info.Size()))
+	binary.LittleEndian.PutUint64(out[8:], uint64(info.ModTime().UnixNano()))
+	binary.LittleEndian.PutUint64(out[16:], uint64(f.chunkSize()))
+	out = append(append(out, tag...), sum...)
+	// the cache is only an optimisation, a replica without one is just hashed again next time
+	_ = os.WriteFile(hashCachePath(f.paths[i]), out, 0666)
+}
@@ -0,0 +1,55 @@
+package haraqafs
+
+import (
+	"crypto/sha256"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWithHashCache(t *testing.T) {
+	volumes := newTmpVolumes(t, 3)
+	defer removeVolumes(volumes)
+	stamp := time.Now().Add(-time.Hour).Truncate(time.Second)
+	for _, v := range volumes {
+		checkErr(t, os.WriteFile(filepath.Join(v, "my_file"), []byte("hello"), 0666))
+		checkErr(t, os.Chtimes(filepath.Join(v, "my_file"), stamp, stamp))
+	}
+	open := func() {
+		f, err := New("my_file", WithVolumes(volumes...), WithHashing(sha256.New()), WithHashCache())
+		checkErr(t, err)
+		checkClose(t, f)
+	}
+	open()
+	for _, v := range volumes {
+		if _, err := os.Stat(filepath.Join(v, "my_file"+hashSuffix)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// a replica whose size and mod time haven't changed isn't read again
+	path := filepath.Join(volumes[2], "my_file")
+	checkErr(t, os.WriteFile(path, []byte("jello"), 0666))
+	checkErr(t, os.Chtimes(path, stamp, stamp))
+	open()
+	if b, _ := os.ReadFile(path); string(b) != "jello" {
+		t.Fatal(string(b))
+	}
+
+	// once it changes it's hashed again and repaired
+	checkErr(t, os.Chtimes(path, stamp.Add(time.Second), stamp.Add(time.Second)))
+	open()
+	if b, _ := os.ReadFile(path); string(b) != "hello" {
+		t.Fatal(string(b))
+	}
+
+	// the sidecars move and go with their replica
+	checkErr(t, Rename("my_file", "other", WithVolumes(volumes...)))
+	checkErr(t, Remove("other", WithVolumes(volumes...)))
+	for _, v := range volumes {
+		if entries, _ := os.ReadDir(v); len(entries) != 0 {
+			t.Fatal(entries[0].Name())
+		}
+	}
+}
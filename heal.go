@@ -0,0 +1,229 @@
+package haraqafs
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+type LateConsensus int
+
+const (
+	// LateError fails New with a *ConsensusTimeoutError listing the replicas which weren't repaired
+	LateError LateConsensus = iota
+	// LateHeal opens the file anyway, the replicas which weren't repaired are left dirty until Heal is called
+	LateHeal
+)
+
+func (f *File) pastConsensusDeadline() bool {
+	return !f.consensusBy.IsZero() && time.Now().After(f.consensusBy)
+}
+
+// lateConsensus handles the replicas which weren't repaired from the source at index before the deadline
+func (f *File) lateConsensus(late []int, index int) error {
+	if index < 0 || f.consensusLate == LateError {
+		e := &ConsensusTimeoutError{Deadline: f.consensusDeadline}
+		if index >= 0 {
+			e.Source = f.paths[index]
+		}
+		for _, i := range late {
+			e.Diverged = append(e.Diverged, f.paths[i])
+		}
+		return e
+	}
+	for _, i := range late {
+		if err := f.holdBack(i, fmt.Errorf("replica %s wasn't repaired before the consensus deadline", f.paths[i])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// holdBack takes replica i off the synchronous path until it's healed, creating it if it's missing
+func (f *File) holdBack(i int, cause error) error {
+	if f.multi[i] == nil {
+		// create the replica now so writes skip it rather than fail on it
+		f.mkdirParent(i)
+		tmp, err := os.OpenFile(f.paths[i], os.O_RDWR|os.O_CREATE|f.spec(i).Flags, f.perms)
+		if err != nil {
+			return pathErr("open", f.paths[i], err)
+		}
+		f.multi[i] = tmp
+		if err = f.syncParents(f.paths[i]); err != nil {
+			return err
+		}
+	}
+	f.markDirty(i, cause)
+	return nil
+}
+
+// healLater heals the dirty replicas in the background once the file lock is free, with at most one heal running at a time
+func (f *File) healLater() {
+	if !atomic.CompareAndSwapInt32(&f.healing, 0, 1) {
+		return
+	}
+	go func() {
+		defer atomic.StoreInt32(&f.healing, 0)
+		// the file may have been closed and its replica slices handed to another file, so nothing is looked at before the lock
+		if f.readOnly || f.pinned || f.acquire() != nil {
+			return
+		}
+		defer f.lock.unlock()
+		_ = f.heal()
+	}()
+}
+
+// Heal copies a healthy replica over every dirty one and puts them back on the synchronous path
+func (f *File) Heal() error {
+	if f == nil || len(f.multi) == 0 || f.lock == nil {
+		return os.ErrInvalid
+	}
+	if f.readOnly {
+		return errReadOnly
+	}
+	if f.pinned {
+		return pathErr("heal", f.paths[0], ErrPinned)
+	}
+	if err := f.acquire(); err != nil {
+		return err
+	}
+	defer f.lock.unlock()
+	return f.heal()
+}
+
+// heal is the body of Heal, called with the file lock held exclusively
+func (f *File) heal() error {
+	var errs []error
+	for i := range f.health {
+		if f.multi[i] == nil || f.health[i].getState() != replicaDirty {
+			continue
+		}
+		src := f.healthySource(i)
+		if src < 0 {
+			return fmt.Errorf("no healthy replica to heal %s from: %w", f.paths[i], ErrNoMajority)
+		}
+		if err := f.copyReplica(i, src); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		f.health[i].setState(replicaHealthy)
+		f.caughtUp(i)
+		f.emit(EventRecovered, i, nil)
+		f.checkQuorum()
+	}
+	return aggErrors(errs)
+}
+
+// Repair re-runs consensus on demand, so a long lived file can take back a volume which returned.
+// replicas which are missing, off the synchronous path or were replaced on disk are reopened, creating them if needed,
+// every replica is then brought in line with the consensus and put back on the synchronous path
+func (f *File) Repair() error {
+	if f == nil || len(f.multi) == 0 || f.lock == nil {
+		return os.ErrInvalid
+	}
+	if f.readOnly {
+		return errReadOnly
+	}
+	if f.pinned {
+		return pathErr("repair", f.paths[0], ErrPinned)
+	}
+	if err := f.acquire(); err != nil {
+		return err
+	}
+	defer f.lock.unlock()
+
+	f.unmapReplicas()
+	var errs []error
+	var returning []int
+	for i := range f.multi {
+		if f.usable(i) && !f.replaced(i) {
+			continue
+		}
+		returning = append(returning, i)
+		if f.multi[i] != nil {
+			_ = f.multi[i].Close()
+			f.multi[i] = nil
+		}
+		f.mkdirParent(i)
+		tmp, err := os.OpenFile(f.paths[i], os.O_RDWR|os.O_CREATE|f.spec(i).Flags, f.perms)
+		if err != nil {
+			errs = append(errs, pathErr("open", f.paths[i], err))
+			continue
+		}
+		f.multi[i] = tmp
+		if err = f.syncParents(f.paths[i]); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if f.health != nil {
+			f.health[i].setState(replicaHealthy)
+		}
+	}
+
+	if err := f.reconcile(); err != nil {
+		for _, i := range returning {
+			if f.multi[i] != nil {
+				f.markDirty(i, err)
+			}
+		}
+		f.recordStamps()
+		return aggErrors(append(errs, err))
+	}
+	f.recordStamps()
+	for _, i := range returning {
+		if f.usable(i) {
+			f.emit(EventRecovered, i, nil)
+		}
+	}
+	f.checkQuorum()
+	return aggErrors(errs)
+}
+
+// replaced reports whether the path of replica i no longer leads to the file it has open
+func (f *File) replaced(i int) bool {
+	info, err := os.Stat(f.paths[i])
+	if err != nil {
+		return true
+	}
+	open, err := f.multi[i].Stat()
+	return err != nil || !os.SameFile(info, open)
+}
+
+// Verify re-hashes every replica and reports which are missing, diverged or no longer match their block checksums,
+// without changing anything. writers wait until it's done, Scrub compares replicas while they keep writing
+func (f *File) Verify() (FileVerification, error) {
+	if f == nil || len(f.multi) == 0 || f.lock == nil {
+		return FileVerification{}, os.ErrInvalid
+	}
+	if f.erasure != nil {
+		return FileVerification{}, errShards
+	}
+	if err := f.acquireRead(); err != nil {
+		return FileVerification{}, err
+	}
+	defer f.releaseRead()
+
+	name, err := filepath.Rel(f.volumes[0], f.paths[0])
+	if err != nil {
+		name = f.paths[0]
+	}
+	gen := f.Generation()
+	v, _, err := verifyPaths(context.Background(), name, f.volumes, f.paths, nil)
+	if err == nil {
+		bad := make(map[string]bool)
+		for _, p := range append(append(append([]string(nil), v.Missing...), v.Diverged...), v.Corrupt...) {
+			bad[p] = true
+		}
+		for i := range f.paths {
+			if bad[f.paths[i]] {
+				f.markVerified(i, 0)
+			} else if f.usable(i) {
+				f.markVerified(i, gen)
+			}
+		}
+	}
+	return v, err
+}
@@ -0,0 +1,170 @@
+package haraqafs
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWithConsensusDeadline(t *testing.T) {
+	volumes := newTmpVolumes(t, 3)
+	defer removeVolumes(volumes)
+	for i, v := range volumes {
+		msg := "hello"
+		if i == 2 {
+			msg = "hello world"
+		}
+		checkErr(t, os.WriteFile(filepath.Join(v, "my_file"), []byte(msg), 0666))
+	}
+
+	_, err := New("my_file", WithVolumes(append([]string(nil), volumes...)...), WithConsensusDeadline(time.Nanosecond, LateError))
+	var tErr *ConsensusTimeoutError
+	if !errors.As(err, &tErr) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatal(err)
+	}
+	if len(tErr.Diverged) != 1 || tErr.Diverged[0] != filepath.Join(volumes[2], "my_file") {
+		t.Fatal(tErr)
+	}
+
+	f, err := New("my_file", WithVolumes(append([]string(nil), volumes...)...), WithConsensusDeadline(time.Nanosecond, LateHeal))
+	checkErr(t, err)
+	if f.usable(2) {
+		t.Fatal("late replica is usable")
+	}
+	checkWrite(t, f, []byte("jello"))
+	checkErr(t, f.Heal())
+	if !f.usable(2) {
+		t.Fatal("replica wasn't healed")
+	}
+	checkClose(t, f)
+	for _, v := range volumes {
+		b, err := os.ReadFile(filepath.Join(v, "my_file"))
+		checkErr(t, err)
+		if string(b) != "jello" {
+			t.Fatal(string(b))
+		}
+	}
+}
+
+func TestQuorumLost(t *testing.T) {
+	volumes := newTmpVolumes(t, 3)
+	defer removeVolumes(volumes)
+
+	var events []Event
+	f, err := New("my_file", WithVolumes(volumes...), WithCreate(), WithQuorum(2), WithEvents(func(e Event) {
+		events = append(events, e)
+	}))
+	checkErr(t, err)
+	checkWrite(t, f, []byte("hello"))
+
+	checkErr(t, f.acquire())
+	f.markDirty(1, errors.New("gone"))
+	f.markDirty(2, errors.New("gone"))
+	f.lock.unlock()
+	if !f.QuorumLost() || len(events) != 3 || events[2].Kind != EventQuorumLost || !errors.Is(events[2].Err, ErrQuorumLost) {
+		t.Fatal(events)
+	}
+	if n, err := f.Write([]byte(" world")); n != 6 || !errors.Is(err, ErrQuorumLost) {
+		t.Fatal(n, err)
+	}
+	if err := f.Truncate(5); !errors.Is(err, ErrQuorumLost) {
+		t.Fatal(err)
+	}
+	if !f.Status().QuorumLost {
+		t.Fatal("status doesn't report quorum loss")
+	}
+
+	checkErr(t, f.Heal())
+	if f.QuorumLost() || len(events) != 6 || events[4].Kind != EventQuorumRestored {
+		t.Fatal(events)
+	}
+	checkWrite(t, f, []byte(" world"))
+	checkClose(t, f)
+}
+
+func TestWithFailStop(t *testing.T) {
+	volumes := newTmpVolumes(t, 3)
+	defer removeVolumes(volumes)
+
+	f, err := New("my_file", WithVolumes(volumes...), WithCreate(), WithQuorum(2), WithFailStop())
+	checkErr(t, err)
+	checkWrite(t, f, []byte("hello"))
+
+	checkErr(t, f.acquire())
+	f.markDirty(1, errors.New("gone"))
+	f.markDirty(2, errors.New("gone"))
+	f.lock.unlock()
+	if n, err := f.Write([]byte(" world")); n != 0 || !errors.Is(err, ErrQuorumLost) {
+		t.Fatal(n, err)
+	}
+	if err := f.Truncate(0); !errors.Is(err, ErrQuorumLost) {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(filepath.Join(volumes[0], "my_file"))
+	checkErr(t, err)
+	if string(b) != "hello" {
+		t.Fatal(string(b))
+	}
+
+	checkErr(t, f.Heal())
+	checkWrite(t, f, []byte(" world"))
+	checkClose(t, f)
+	for _, v := range volumes {
+		b, err := os.ReadFile(filepath.Join(v, "my_file"))
+		checkErr(t, err)
+		if string(b) != "hello world" {
+			t.Fatal(v, string(b))
+		}
+	}
+}
+
+func TestRepairAndVerify(t *testing.T) {
+	volumes := newTmpVolumes(t, 3)
+	defer removeVolumes(volumes)
+	var events []Event
+	f, err := New("my_file", WithVolumes(volumes...), WithCreate(), WithEvents(func(e Event) { events = append(events, e) }))
+	checkErr(t, err)
+	defer checkClose(t, f)
+	checkWrite(t, f, []byte("hello"))
+
+	// a volume is wiped while the file is open
+	checkErr(t, os.Remove(filepath.Join(volumes[2], "my_file")))
+	v, err := f.Verify()
+	checkErr(t, err)
+	if v.Name != "my_file" || v.State != VerifyMissing || len(v.Missing) != 1 || v.Missing[0] != volumes[2] {
+		t.Fatal(v)
+	}
+	_, err = f.WriteAt([]byte(" world"), 5)
+	checkErr(t, err)
+	checkErr(t, f.Repair())
+	if len(events) != 1 || events[0].Kind != EventRecovered || events[0].Volume != volumes[2] {
+		t.Fatal(events)
+	}
+
+	// someone scribbles on a replica
+	checkErr(t, os.WriteFile(filepath.Join(volumes[1], "my_file"), []byte("junk"), 0666))
+	v, err = f.Verify()
+	checkErr(t, err)
+	if v.State != VerifyDiverged || len(v.Diverged) != 1 || v.Diverged[0] != volumes[1] {
+		t.Fatal(v)
+	}
+	checkErr(t, f.Repair())
+	v, err = f.Verify()
+	checkErr(t, err)
+	if v.State != VerifyClean {
+		t.Fatal(v)
+	}
+	for _, vol := range volumes {
+		b, err := os.ReadFile(filepath.Join(vol, "my_file"))
+		checkErr(t, err)
+		if string(b) != "hello world" {
+			t.Fatal(vol, string(b))
+		}
+	}
+	if s := f.Status(); len(s.PendingRepairs) != 0 {
+		t.Fatal(s)
+	}
+}
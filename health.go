@@ -0,0 +1,331 @@
+package haraqafs
+
+import (
+	"fmt"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+type replicaState int32
+
+const (
+	replicaHealthy replicaState = iota
+	// degraded replicas are too slow, they're removed from the synchronous path and miss writes until re-admitted
+	replicaDegraded
+	// dirty replicas missed or abandoned a write and can't be trusted until repaired
+	replicaDirty
+)
+
+const (
+	latencyWindow = 128
+	evalEvery     = 16
+	minSamples    = 32
+)
+
+// replicaHealth state is read without the health mutex by readers sharing the file lock, so it's only accessed atomically
+type replicaHealth struct {
+	state   replicaState
+	samples [opCount]latencySamples
+}
+
+func (h *replicaHealth) getState() replicaState {
+	return replicaState(atomic.LoadInt32((*int32)(&h.state)))
+}
+
+func (h *replicaHealth) setState(s replicaState) replicaState {
+	return replicaState(atomic.SwapInt32((*int32)(&h.state), int32(s)))
+}
+
+type latencySamples struct {
+	window [latencyWindow]time.Duration
+	n      int
+}
+
+func (s *latencySamples) add(d time.Duration) {
+	s.window[s.n%latencyWindow] = d
+	s.n++
+}
+
+func (s *latencySamples) p99() time.Duration {
+	n := s.n
+	if n > latencyWindow {
+		n = latencyWindow
+	}
+	if n == 0 {
+		return 0
+	}
+	tmp := make([]time.Duration, n)
+	copy(tmp, s.window[:n])
+	sort.Slice(tmp, func(i, j int) bool { return tmp[i] < tmp[j] })
+	return tmp[(n*99)/100]
+}
+
+func (s *latencySamples) reset() {
+	s.n = 0
+}
+
+type EventKind int
+
+const (
+	EventDegraded EventKind = iota
+	EventRecovered
+	EventDirty
+	EventModified
+	EventQuorumLost
+	EventQuorumRestored
+	EventReadRepaired
+)
+
+func (k EventKind) String() string {
+	switch k {
+	case EventDegraded:
+		return "degraded"
+	case EventRecovered:
+		return "recovered"
+	case EventDirty:
+		return "dirty"
+	case EventModified:
+		return "modified"
+	case EventQuorumLost:
+		return "quorum lost"
+	case EventQuorumRestored:
+		return "quorum restored"
+	case EventReadRepaired:
+		return "read repaired"
+	}
+	return fmt.Sprintf("EventKind(%d)", int(k))
+}
+
+type Event struct {
+	Kind   EventKind
+	Volume string
+	Path   string
+	Err    error
+}
+
+func (f *File) emit(kind EventKind, i int, err error) {
+	if f.events == nil {
+		return
+	}
+	if i < 0 {
+		// events about the whole file don't name a replica
+		f.events(Event{Kind: kind, Err: err})
+		return
+	}
+	f.events(Event{Kind: kind, Volume: f.volumes[i], Path: f.paths[i], Err: err})
+}
+
+// QuorumLost reports whether so many replicas went dirty or degraded since the file was opened that writes can't reach quorum.
+// writes still go to the healthy replicas, but return ErrQuorumLost until enough are healed, or are rejected outright with WithFailStop
+func (f *File) QuorumLost() bool {
+	return f != nil && atomic.LoadInt32(&f.lost) == 1
+}
+
+// checkQuorum is called whenever a replica changes state, to notice the file dropping below quorum or recovering
+func (f *File) checkQuorum() {
+	lost := f.healthy() < f.writeQuorum()
+	if lost == f.QuorumLost() {
+		return
+	}
+	if lost {
+		atomic.StoreInt32(&f.lost, 1)
+		f.emit(EventQuorumLost, -1, fmt.Errorf("%d of %d replicas healthy, %d needed: %w", f.healthy(), len(f.multi), f.writeQuorum(), ErrQuorumLost))
+		return
+	}
+	atomic.StoreInt32(&f.lost, 0)
+	f.emit(EventQuorumRestored, -1, nil)
+}
+
+// usable reports whether replica i is on the synchronous path
+func (f *File) usable(i int) bool {
+	if f.multi[i] == nil {
+		return false
+	}
+	return f.health == nil || f.health[i].getState() == replicaHealthy
+}
+
+func (f *File) healthy() int {
+	var n int
+	for i := range f.multi {
+		if f.usable(i) {
+			n++
+		}
+	}
+	return n
+}
+
+// markDirty takes replica i off the synchronous path, New allocates the health it records to so any goroutine may call it
+func (f *File) markDirty(i int, err error) {
+	if f.health[i].setState(replicaDirty) == replicaDirty {
+		return
+	}
+	f.emit(EventDirty, i, fmt.Errorf("%v: %w", err, ErrDegraded))
+	f.checkQuorum()
+}
+
+func (f *File) trackHealth() bool {
+	return f.slowFactor > 0 || f.replicaTimeout > 0 || f.readOnly || f.pinned
+}
+
+func (f *File) sample(i int, op opKind, d time.Duration) {
+	if f.health == nil || !f.trackHealth() {
+		return
+	}
+	f.healthMu.Lock()
+	f.health[i].samples[op].add(d)
+	f.healthMu.Unlock()
+}
+
+// checkSlow degrades replicas whose p99 latency is well above their peers, and re-admits them once they recover
+func (f *File) checkSlow(op opKind) {
+	if f.health == nil || f.slowFactor <= 0 {
+		return
+	}
+	if f.evalSlow(op) {
+		f.healLater()
+	}
+}
+
+// evalSlow is the body of checkSlow, reporting whether a recovered replica was left dirty for healLater to catch up.
+// the copy is never made here, checkSlow runs on the read path and every other read would wait on the health mutex
+func (f *File) evalSlow(op opKind) bool {
+	f.healthMu.Lock()
+	defer f.healthMu.Unlock()
+	heal := false
+	f.ops++
+	if f.ops%evalEvery != 0 {
+		return false
+	}
+
+	// probe degraded replicas, they no longer see regular traffic
+	for i := range f.health {
+		if f.multi[i] != nil && f.health[i].getState() == replicaDegraded {
+			start := time.Now()
+			err := f.syncReplica(i)
+			// the health mutex is already held, record the sample directly
+			d := time.Since(start)
+			f.health[i].samples[opSync].add(d)
+			if f.stats != nil {
+				f.stats.record(f.volumes[i], opSync, d)
+			}
+			if err != nil {
+				f.health[i].samples[opSync].reset()
+			}
+		}
+	}
+
+	for _, op := range []opKind{op, opSync} {
+		for i := range f.health {
+			if f.multi[i] == nil || f.health[i].samples[op].n < minSamples {
+				continue
+			}
+			peer := f.peerP99(i, op)
+			if peer <= 0 {
+				continue
+			}
+			slow := float64(f.health[i].samples[op].p99()) > f.slowFactor*float64(peer)
+			switch {
+			case slow && f.health[i].getState() == replicaHealthy && f.healthy()-1 >= f.writeQuorum():
+				f.health[i].setState(replicaDegraded)
+				f.health[i].samples[opSync].reset()
+				f.emit(EventDegraded, i, fmt.Errorf("replica %s p99 is over %v times its peers' %s: %w", f.paths[i], f.slowFactor, peer, ErrDegraded))
+			case !slow && f.health[i].getState() == replicaDegraded && op == opSync:
+				// read only replicas never miss writes, the rest missed the writes made while they were degraded
+				// and are left dirty for healLater, a pinned one stays off the synchronous path rather than being rewritten
+				if !f.readOnly {
+					if f.pinned {
+						continue
+					}
+					for op := range f.health[i].samples {
+						f.health[i].samples[op].reset()
+					}
+					f.health[i].setState(replicaDirty)
+					heal = true
+					continue
+				}
+				for op := range f.health[i].samples {
+					f.health[i].samples[op].reset()
+				}
+				f.health[i].setState(replicaHealthy)
+				f.caughtUp(i)
+				f.emit(EventRecovered, i, nil)
+				f.checkQuorum()
+			}
+		}
+	}
+	return heal
+}
+
+// peerP99 returns the median p99 of the healthy replicas other than i
+func (f *File) peerP99(i int, op opKind) time.Duration {
+	var peers []time.Duration
+	for j := range f.health {
+		if j == i || !f.usable(j) || f.health[j].samples[op].n < minSamples {
+			continue
+		}
+		peers = append(peers, f.health[j].samples[op].p99())
+	}
+	if len(peers) == 0 {
+		return 0
+	}
+	sort.Slice(peers, func(a, b int) bool { return peers[a] < peers[b] })
+	return peers[len(peers)/2]
+}
+
+// healthySource returns a healthy replica to copy from, other than i
+func (f *File) healthySource(i int) int {
+	for _, j := range f.readOrder {
+		if j != i && f.usable(j) {
+			return j
+		}
+	}
+	return -1
+}
+
+func (f *File) copyReplica(dst, src int) error {
+	if f.erasure != nil {
+		return f.rebuildShard(dst)
+	}
+	info, err := f.multi[src].Stat()
+	if err != nil {
+		return fmt.Errorf("stat failed for %s: %w", f.paths[src], err)
+	}
+	if f.canClone() {
+		if _, err = f.cloneReplica(dst, src); err != nil {
+			return err
+		}
+		if f.digests != nil {
+			return f.rebuildDigests(dst)
+		}
+		return nil
+	}
+	if err = f.checkLinks(dst); err != nil {
+		return err
+	}
+	var buf []byte
+	for off := int64(0); off < info.Size(); {
+		if err := f.aborted(); err != nil {
+			return err
+		}
+		buf = f.chunkFor(buf, dst, 1e6)
+		n, err := f.multi[src].ReadAt(buf, off)
+		if n == 0 && err != nil {
+			return fmt.Errorf("read failed for %s: %w", f.paths[src], err)
+		}
+		start := time.Now()
+		_, err = f.multi[dst].WriteAt(buf[:n], off)
+		f.copied(dst, n, time.Since(start))
+		if err != nil {
+			return fmt.Errorf("write failed for %s: %w", f.paths[dst], err)
+		}
+		off += int64(n)
+	}
+	if err = f.multi[dst].Truncate(info.Size()); err != nil {
+		return fmt.Errorf("trunc failed for %s: %w", f.paths[dst], err)
+	}
+	if f.digests != nil {
+		return f.rebuildDigests(dst)
+	}
+	return nil
+}
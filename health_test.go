@@ -0,0 +1,64 @@
+package haraqafs
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSlowReplicaDetection(t *testing.T) {
+	const fileName = "my_file"
+	volumes := newTmpVolumes(t, 3)
+	defer removeVolumes(volumes)
+
+	var events []Event
+	f, err := New(fileName, WithVolumes(volumes...), WithCreate(), WithSlowReplicaDetection(4), WithEvents(func(e Event) {
+		events = append(events, e)
+	}))
+	checkErr(t, err)
+
+	for i := range f.health {
+		for j := 0; j < minSamples; j++ {
+			d := time.Millisecond
+			if i == 0 {
+				d = time.Second
+			}
+			f.health[i].samples[opWrite].add(d)
+		}
+	}
+	checkWrite(t, f, []byte("hello"))
+	for f.ops%evalEvery != 0 {
+		checkWrite(t, f, []byte("hello"))
+	}
+	if f.health[0].state != replicaDegraded || len(events) != 1 || events[0].Kind != EventDegraded || !errors.Is(events[0].Err, ErrDegraded) {
+		t.Fatal(f.health[0].state, events)
+	}
+	checkWrite(t, f, []byte("hello"))
+	if info, err := os.Stat(filepath.Join(volumes[0], fileName)); err != nil || info.Size() >= f.offset {
+		t.Fatal(info.Size(), err)
+	}
+
+	// once the probes look healthy again the replica catches up in the background and is re-admitted
+	for i := range f.health {
+		for j := 0; j < latencyWindow; j++ {
+			f.health[i].samples[opSync].add(time.Second)
+		}
+	}
+	checkWrite(t, f, []byte("hello"))
+	for f.ops%evalEvery != 0 {
+		checkWrite(t, f, []byte("hello"))
+	}
+	for atomic.LoadInt32(&f.healing) != 0 {
+		time.Sleep(time.Millisecond)
+	}
+	if f.health[0].state != replicaHealthy || len(events) != 2 || events[1].Kind != EventRecovered {
+		t.Fatal(f.health[0].state, events)
+	}
+	if info, err := os.Stat(filepath.Join(volumes[0], fileName)); err != nil || info.Size() != f.offset {
+		t.Fatal(info.Size(), err)
+	}
+	checkClose(t, f)
+}
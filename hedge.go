@@ -0,0 +1,88 @@
+package haraqafs
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// WithHedgedReads sends each read to up to n replicas, starting the next one whenever delay passes without an answer,
+// and returns the first to succeed. a replica which fails hands over to the next straight away.
+// os reads can't be interrupted, so the reads which lose are left to finish in the background
+func WithHedgedReads(n int, delay time.Duration) FileOption {
+	return func(f *File) error {
+		if n < 2 {
+			return fmt.Errorf("hedged reads need at least 2 replicas, got %d: %w", n, os.ErrInvalid)
+		}
+		if delay < 0 {
+			return fmt.Errorf("hedge delay must not be negative: %w", os.ErrInvalid)
+		}
+		f.hedge = n
+		f.hedgeDelay = delay
+		return nil
+	}
+}
+
+type hedgedRead struct {
+	replica int
+	took    time.Duration
+	buf     []byte
+	n       int
+	err     error
+}
+
+// readHedged races reads of the range across the replicas in the read plan
+func (f *File) readHedged(b []byte, off int64) (int, error) {
+	var plan [8]int
+	replicas := f.readPlan(plan[:0])
+	if len(replicas) < 2 {
+		return f.readAt(b, off)
+	}
+
+	// buffered so the losers never block once we've returned
+	results := make(chan hedgedRead, len(replicas))
+	var next, hedged, inflight int
+	launch := func() {
+		i, file := replicas[next], f.multi[replicas[next]]
+		next++
+		inflight++
+		// only reads which finish while we're waiting are recorded, the losers may finish after the file's closed
+		go func() {
+			buf := make([]byte, len(b))
+			start := time.Now()
+			n, err := file.ReadAt(buf, off)
+			results <- hedgedRead{replica: i, took: time.Since(start), buf: buf, n: n, err: err}
+		}()
+	}
+	launch()
+	hedged++
+	timer := time.NewTimer(f.hedgeDelay)
+	defer timer.Stop()
+
+	last := hedgedRead{err: errMissingReplica}
+	for inflight > 0 {
+		select {
+		case r := <-results:
+			inflight--
+			f.observeDuration(r.replica, opRead, r.took)
+			// a read at the end of the file is an answer like any other
+			if r.err == nil || r.n > 0 || errors.Is(r.err, io.EOF) {
+				return copy(b, r.buf[:r.n]), r.err
+			}
+			f.readFailed(r.replica)
+			last = r
+			if next < len(replicas) {
+				launch()
+			}
+		case <-timer.C:
+			if next < len(replicas) && hedged < f.hedge {
+				launch()
+				hedged++
+				timer.Reset(f.hedgeDelay)
+			}
+		}
+	}
+	return 0, last.err
+}
@@ -0,0 +1,57 @@
+package haraqafs
+
+import (
+	"errors"
+	"io"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestWithHedgedReads(t *testing.T) {
+	volumes := newTmpVolumes(t, 3)
+	defer removeVolumes(volumes)
+	for _, opt := range []FileOption{WithHedgedReads(1, 0), WithHedgedReads(2, -time.Second)} {
+		if _, err := New("my_file", WithVolumes(volumes...), WithCreate(), opt); !errors.Is(err, os.ErrInvalid) {
+			t.Fatal(err)
+		}
+	}
+
+	f, err := New("my_file", WithVolumes(volumes...), WithCreate(), WithHedgedReads(3, 0))
+	checkErr(t, err)
+	checkWrite(t, f, []byte("hello"))
+	checkSeek(t, f, 0, 0)
+	checkRead(t, f, []byte("hello"))
+	checkClose(t, f)
+
+	// a failed replica hands over without waiting for the delay
+	f, err = New("my_file", WithVolumes(volumes...), WithHedgedReads(2, time.Hour))
+	checkErr(t, err)
+	defer checkClose(t, f)
+	first := f.readPlan(nil)[0]
+	checkErr(t, f.multi[first].Close())
+	start := time.Now()
+	checkRead(t, f, []byte("hello"))
+	if time.Since(start) > 10*time.Second {
+		t.Fatal("read waited for the hedge delay")
+	}
+	if !f.failedRecently(first) {
+		t.Fatal("failure wasn't recorded")
+	}
+	reopened, err := os.OpenFile(f.paths[first], os.O_RDWR, 0)
+	checkErr(t, err)
+	f.multi[first] = reopened
+
+	// reads at the end of the file don't go on to the other replicas
+	plan := f.readPlan(nil)
+	checkErr(t, f.multi[plan[1]].Close())
+	if _, err = f.ReadAt(make([]byte, 5), 5); !errors.Is(err, io.EOF) {
+		t.Fatal(err)
+	}
+	if f.failedRecently(plan[1]) {
+		t.Fatal("read at the end of the file was hedged")
+	}
+	reopened, err = os.OpenFile(f.paths[plan[1]], os.O_RDWR, 0)
+	checkErr(t, err)
+	f.multi[plan[1]] = reopened
+}
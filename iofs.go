@@ -0,0 +1,47 @@
+package haraqafs
+
+import (
+	"io/fs"
+)
+
+var (
+	_ fs.FS          = (*FS)(nil)
+	_ fs.StatFS      = (*FS)(nil)
+	_ fs.ReadDirFS   = (*FS)(nil)
+	_ fs.GlobFS      = (*FS)(nil)
+	_ fs.ReadDirFile = (*File)(nil)
+)
+
+// ReadDir returns the entries of the directory name held by a quorum of replicas, sorted by name
+func (fsys *FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+	f, err := fsys.New(name, WithReadOnly())
+	if err != nil {
+		return nil, err
+	}
+	entries, err := f.ReadDir(-1)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return entries, err
+}
+
+// Glob returns the names matching pattern, with the syntax of path.Match
+func (fsys *FS) Glob(pattern string) ([]string, error) {
+	return fs.Glob(globFS{fsys}, pattern)
+}
+
+// globFS hides FS.Glob so fs.Glob walks the directories instead of calling back into it
+type globFS struct {
+	fsys *FS
+}
+
+func (g globFS) Open(name string) (fs.File, error) {
+	return g.fsys.Open(name)
+}
+
+func (g globFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	return g.fsys.ReadDir(name)
+}
@@ -0,0 +1,108 @@
+package haraqafs
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Jail returns an FS which can only reach files under subdir on each volume. names are resolved inside subdir,
+// and a replica whose path leads out of it through a symlink is refused, so tenants sharing volumes can't reach each other
+func (fsys *FS) Jail(subdir string) (*FS, error) {
+	sub, err := logicalName("jail", subdir)
+	if err != nil {
+		return nil, err
+	}
+	jail := filepath.Join(fsys.jail, sub)
+	opts := append(fsys.opts[:len(fsys.opts):len(fsys.opts)], withJail(jail))
+	return &FS{opts: opts, newHash: fsys.newHash, stats: fsys.stats, jail: jail, account: fsys.account}, nil
+}
+
+// withJail confines every name to root on each volume
+func withJail(root string) FileOption {
+	return func(f *File) error {
+		f.jail = root
+		return nil
+	}
+}
+
+// jailName resolves a logical name inside the jail
+func (f *File) jailName(name string) string {
+	if f.jail == "" || f.jail == "." {
+		return name
+	}
+	return filepath.Join(f.jail, name)
+}
+
+// checkJail refuses replica paths which symlinks lead out of the jail on their volume
+func (f *File) checkJail(volumes, paths []string) error {
+	if f.jail == "" {
+		return nil
+	}
+	for i := range paths {
+		root := resolveExisting(filepath.Join(volumes[i], f.jail))
+		path := resolveExisting(paths[i])
+		if path != root && !strings.HasPrefix(path, root+string(filepath.Separator)) {
+			return &fs.PathError{Op: "open", Path: paths[i], Err: fmt.Errorf("leads out of the jail: %w", fs.ErrPermission)}
+		}
+	}
+	return nil
+}
+
+// checkOpened closes the replicas whose path was swapped for a symlink out of the jail between checkJail and their open,
+// the replica opened has to be the file its path resolves to inside the jail now
+func (f *File) checkOpened() []error {
+	if f.jail == "" {
+		return nil
+	}
+	var errs []error
+	for i := range f.multi {
+		if f.multi[i] == nil {
+			continue
+		}
+		if err := f.checkJail(f.volumes[i:i+1], f.paths[i:i+1]); err != nil {
+			errs = append(errs, err)
+		} else if !sameOpened(f.multi[i], f.paths[i]) {
+			errs = append(errs, &fs.PathError{Op: "open", Path: f.paths[i], Err: fmt.Errorf("changed while it was opened: %w", fs.ErrPermission)})
+		} else {
+			continue
+		}
+		_ = f.multi[i].Close()
+		f.multi[i] = nil
+	}
+	return errs
+}
+
+func sameOpened(file *os.File, path string) bool {
+	opened, err := file.Stat()
+	if err != nil {
+		return false
+	}
+	real, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return false
+	}
+	info, err := os.Stat(real)
+	return err == nil && os.SameFile(opened, info)
+}
+
+// resolveExisting follows the symlinks of the longest part of path which exists, keeping the rest as it is
+func resolveExisting(path string) string {
+	var rest []string
+	for p := filepath.Clean(path); ; p = filepath.Dir(p) {
+		real, err := filepath.EvalSymlinks(p)
+		if err == nil {
+			for i := len(rest) - 1; i >= 0; i-- {
+				real = filepath.Join(real, rest[i])
+			}
+			return real
+		}
+		if !errors.Is(err, os.ErrNotExist) || filepath.Dir(p) == p {
+			return path
+		}
+		rest = append(rest, filepath.Base(p))
+	}
+}
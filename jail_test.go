@@ -0,0 +1,90 @@
+package haraqafs
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestJail(t *testing.T) {
+	volumes := newTmpVolumes(t, 3)
+	defer removeVolumes(volumes)
+	fsys := NewFS(WithVolumes(volumes...))
+
+	if _, err := fsys.Jail("../outside"); !errors.Is(err, fs.ErrInvalid) {
+		t.Fatal(err)
+	}
+	tenant, err := fsys.Jail("tenant")
+	checkErr(t, err)
+	checkErr(t, tenant.MkdirAll("data", 0755))
+	for _, v := range volumes {
+		if _, err := os.Stat(filepath.Join(v, "tenant", "data")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	f, err := tenant.Create("data/a")
+	checkErr(t, err)
+	checkWrite(t, f, []byte("hello"))
+	checkClose(t, f)
+	if _, err := os.Stat(filepath.Join(volumes[1], "tenant", "data", "a")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tenant.Stat("data/a"); err != nil {
+		t.Fatal(err)
+	}
+
+	// names can't climb out of the jail
+	checkErr(t, os.WriteFile(filepath.Join(volumes[0], "secret"), []byte("x"), 0644))
+	if _, err := tenant.Create("../secret"); !errors.Is(err, fs.ErrInvalid) {
+		t.Fatal(err)
+	}
+	if err := tenant.Remove("../secret"); !errors.Is(err, fs.ErrInvalid) {
+		t.Fatal(err)
+	}
+
+	// nor can symlinks planted inside it
+	checkErr(t, os.Symlink(volumes[0], filepath.Join(volumes[0], "tenant", "escape")))
+	if _, err := tenant.Create("escape/secret"); !errors.Is(err, fs.ErrPermission) {
+		t.Fatal(err)
+	}
+	if err := tenant.Remove("escape/secret"); !errors.Is(err, fs.ErrPermission) {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(volumes[0], "secret")); err != nil {
+		t.Fatal(err)
+	}
+
+	// replicas swapped while they were opened are refused
+	f, err = tenant.New("data/a", WithReadOnly())
+	checkErr(t, err)
+	if errs := f.checkOpened(); len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	a := filepath.Join(volumes[1], "tenant", "data", "a")
+	checkErr(t, os.Rename(a, a+".old"))
+	checkErr(t, os.WriteFile(a, []byte("hello"), 0644))
+	checkErr(t, os.Remove(filepath.Join(volumes[2], "tenant", "data", "a")))
+	checkErr(t, os.Symlink(filepath.Join(volumes[2], "secret"), filepath.Join(volumes[2], "tenant", "data", "a")))
+	if errs := f.checkOpened(); len(errs) != 2 || !errors.Is(errs[0], fs.ErrPermission) || !errors.Is(errs[1], fs.ErrPermission) {
+		t.Fatal(errs)
+	}
+	if f.multi[0] == nil || f.multi[1] != nil || f.multi[2] != nil {
+		t.Fatal(f.multi)
+	}
+	checkClose(t, f)
+	checkErr(t, os.Rename(a+".old", a))
+
+	// jails nest
+	nested, err := tenant.Jail("data")
+	checkErr(t, err)
+	f, err = nested.New("a", WithReadOnly())
+	checkErr(t, err)
+	checkRead(t, f, []byte("hello"))
+	checkClose(t, f)
+	if _, err := nested.Open("../data/a"); err == nil {
+		t.Fatal("expected an error")
+	}
+}
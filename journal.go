@@ -0,0 +1,180 @@
+package haraqafs
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+)
+
+// journalSuffix names the undo record kept next to a replica while a journaled write is in flight,
+// laid out as the write's offset, the file's size before it and a crc of the record, followed by the bytes it overwrites
+const journalSuffix = ".haraqafs-journal"
+
+const journalHeader = 20
+
+func journalPath(path string) string {
+	return path + journalSuffix
+}
+
+// WithWriteJournal makes writes all or nothing. before a write reaches a replica the bytes it overwrites are saved next
+// to it, when the write fails every replica is put back the way it was, and a write cut short by a crash is undone the
+// next time the file is opened WithExclusive
+func WithWriteJournal() FileOption {
+	return func(f *File) error {
+		f.journal = true
+		return nil
+	}
+}
+
+// writeJournaled is writeAt with an undo record in place on every replica written to
+func (f *File) writeJournaled(b []byte, offset int64) (int, error) {
+	undo, err := f.undoRecord(offset, len(b))
+	if err != nil {
+		return 0, err
+	}
+	var targets []int
+	for i := range f.multi {
+		if !f.usable(i) {
+			continue
+		}
+		if err = writeJournal(f.paths[i], undo); err == nil {
+			// the journal is no use after a power loss if its entry didn't survive it
+			err = f.syncParents(journalPath(f.paths[i]))
+		}
+		if err != nil {
+			f.dropJournals(targets)
+			_ = os.Remove(journalPath(f.paths[i]))
+			return 0, err
+		}
+		targets = append(targets, i)
+	}
+
+	n, err := f.fanWrite(b, offset)
+	if err != nil {
+		var errs []error
+		for _, i := range targets {
+			if rErr := f.undo(i, undo); rErr != nil {
+				errs = append(errs, rErr)
+				// the journal stays behind so the next open finishes the job
+				f.markDirty(i, fmt.Errorf("write to %s couldn't be rolled back: %v", f.paths[i], rErr))
+			}
+		}
+		f.digestsChanged(offset, offset+int64(len(b)))
+		return 0, aggErrors(append([]error{err}, errs...))
+	}
+	f.dropJournals(targets)
+	return n, nil
+}
+
+// undoRecord saves what a write of n bytes at offset overwrites, read from the first usable replica
+func (f *File) undoRecord(offset int64, n int) ([]byte, error) {
+	old := int64(n)
+	if offset >= f.size {
+		old = 0
+	} else if offset+old > f.size {
+		old = f.size - offset
+	}
+	rec := make([]byte, journalHeader+old)
+	binary.LittleEndian.PutUint64(rec, uint64(offset))
+	binary.LittleEndian.PutUint64(rec[8:], uint64(f.size))
+	if old > 0 {
+		src := f.healthySource(-1)
+		if src < 0 {
+			return nil, fmt.Errorf("no healthy replica to journal the write from: %w", ErrNoMajority)
+		}
+		if _, err := f.multi[src].ReadAt(rec[journalHeader:], offset); err != nil && !errors.Is(err, io.EOF) {
+			return nil, pathErr("read", f.paths[src], err)
+		}
+	}
+	binary.LittleEndian.PutUint32(rec[16:], crc32.Checksum(rec[journalHeader:], crcTable)^crc32.Checksum(rec[:16], crcTable))
+	return rec, nil
+}
+
+// writeJournal puts the undo record next to the replica at path, it's synced so it's on disk before the write is
+func writeJournal(path string, rec []byte) error {
+	j, err := os.OpenFile(journalPath(path), os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0666)
+	if err != nil {
+		return pathErr("journal", path, err)
+	}
+	if _, err = j.Write(rec); err == nil {
+		err = j.Sync()
+	}
+	if closeErr := j.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return pathErr("journal", path, err)
+	}
+	return nil
+}
+
+// undo puts replica i back the way the undo record found it and drops its journal
+func (f *File) undo(i int, rec []byte) error {
+	offset := int64(binary.LittleEndian.Uint64(rec))
+	size := int64(binary.LittleEndian.Uint64(rec[8:]))
+	if _, err := f.multi[i].WriteAt(rec[journalHeader:], offset); err != nil {
+		return pathErr("rollback", f.paths[i], err)
+	}
+	if err := f.multi[i].Truncate(size); err != nil {
+		return pathErr("rollback", f.paths[i], err)
+	}
+	if err := f.syncReplica(i); err != nil {
+		return pathErr("rollback", f.paths[i], err)
+	}
+	if err := os.Remove(journalPath(f.paths[i])); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return pathErr("rollback", f.paths[i], err)
+	}
+	return nil
+}
+
+func (f *File) dropJournals(replicas []int) {
+	for _, i := range replicas {
+		_ = os.Remove(journalPath(f.paths[i]))
+	}
+}
+
+// replayJournals undoes the writes a crash cut short, before the replicas are compared. a journal can belong to a write
+// another process still has in flight, so they're only replayed while the file is held WithExclusive
+func (f *File) replayJournals() error {
+	if f.exclusiveLock == nil {
+		return nil
+	}
+	for i := range f.multi {
+		if f.multi[i] == nil {
+			continue
+		}
+		rec, err := os.ReadFile(journalPath(f.paths[i]))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		// read only files can't be put back, consensus outvotes the replica instead
+		if f.readOnly {
+			continue
+		}
+		if err != nil {
+			return pathErr("journal", f.paths[i], err)
+		}
+		// a torn journal was never acted on, and a truncated file has nothing left to put back
+		if !validJournal(rec) || f.flags&os.O_TRUNC != 0 {
+			if err = os.Remove(journalPath(f.paths[i])); err != nil {
+				return pathErr("journal", f.paths[i], err)
+			}
+			continue
+		}
+		if err = f.undo(i, rec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validJournal(rec []byte) bool {
+	if len(rec) < journalHeader {
+		return false
+	}
+	sum := crc32.Checksum(rec[journalHeader:], crcTable) ^ crc32.Checksum(rec[:16], crcTable)
+	return binary.LittleEndian.Uint32(rec[16:]) == sum
+}
@@ -0,0 +1,85 @@
+package haraqafs
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWithWriteJournal(t *testing.T) {
+	volumes := newTmpVolumes(t, 3)
+	defer removeVolumes(volumes)
+	read := func(i int) string {
+		b, err := os.ReadFile(filepath.Join(volumes[i], "my_file"))
+		checkErr(t, err)
+		return string(b)
+	}
+	f, err := New("my_file", WithVolumes(volumes...), WithCreate(), WithWriteJournal())
+	checkErr(t, err)
+	checkWrite(t, f, []byte("hello world"))
+
+	// replica 1 can't be written, the write is taken back from replica 0
+	readOnly, err := os.Open(f.paths[1])
+	checkErr(t, err)
+	checkErr(t, f.multi[1].Close())
+	f.multi[1] = readOnly
+	if _, err = f.WriteAt([]byte("jello"), 0); err == nil {
+		t.Fatal("expected an error")
+	}
+	if s := read(0); s != "hello world" {
+		t.Fatal(s)
+	}
+	if _, err := os.Stat(journalPath(f.paths[0])); !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	if f.usable(1) {
+		t.Fatal("replica which couldn't be rolled back is usable")
+	}
+	checkClose(t, f)
+
+	// the journal left behind is replayed on open
+	checkErr(t, os.WriteFile(filepath.Join(volumes[1], "my_file"), []byte("jello world!"), 0666))
+	f, err = New("my_file", WithVolumes(volumes...), WithWriteJournal(), WithExclusive())
+	checkErr(t, err)
+	if s := read(1); s != "hello world" {
+		t.Fatal(s)
+	}
+	if _, err := os.Stat(journalPath(f.paths[1])); !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+
+	// so is one left by a crash part way through a write
+	rec, err := f.undoRecord(6, 6)
+	checkErr(t, err)
+	checkErr(t, writeJournal(f.paths[2], rec))
+	checkErr(t, os.WriteFile(filepath.Join(volumes[2], "my_file"), []byte("hello there!"), 0666))
+	checkClose(t, f)
+
+	// journals are left alone unless the file's held exclusively, they could belong to a write in flight
+	f, err = New("my_file", WithVolumes(volumes...), WithQuorum(3))
+	if !errors.Is(err, ErrDiverged) {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(journalPath(filepath.Join(volumes[2], "my_file"))); err != nil {
+		t.Fatal(err)
+	}
+	f, err = New("my_file", WithVolumes(volumes...), WithExclusive())
+	checkErr(t, err)
+	checkClose(t, f)
+	if s := read(2); s != "hello world" {
+		t.Fatal(s)
+	}
+
+	// a torn journal is dropped
+	checkErr(t, os.WriteFile(journalPath(filepath.Join(volumes[0], "my_file")), []byte("torn"), 0666))
+	f, err = New("my_file", WithVolumes(volumes...), WithExclusive())
+	checkErr(t, err)
+	checkClose(t, f)
+	if _, err := os.Stat(journalPath(filepath.Join(volumes[0], "my_file"))); !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	if s := read(0); s != "hello world" {
+		t.Fatal(s)
+	}
+}
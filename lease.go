@@ -0,0 +1,167 @@
+package haraqafs
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// leaseSuffix is appended to a replica path to name the directory recording who holds its append lease
+const leaseSuffix = ".haraqafs-lease"
+
+type LeaseMode int
+
+const (
+	// LeaseWait waits for the holder to release the lease or let it expire, bounded by WithLockTimeout and WithContext
+	LeaseWait LeaseMode = iota
+	// LeaseFailFast fails the append with ErrLeaseHeld while another process holds the lease
+	LeaseFailFast
+)
+
+// appendLease is a set of lease directories on a quorum of volumes, each naming its holder by token in an owner file
+// whose mod time is when the lease expires. it's only renewed by appends, a holder which stops appending for longer
+// than d loses it to the next process
+type appendLease struct {
+	d       time.Duration
+	mode    LeaseMode
+	token   []byte
+	dirs    []string
+	renewed time.Time
+}
+
+func newAppendLease(d time.Duration, mode LeaseMode) *appendLease {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	return &appendLease{d: d, mode: mode, token: []byte(hex.EncodeToString(b[:]))}
+}
+
+// holdLease makes sure this file holds the append lease before appending, catching up with whatever
+// the previous holder appended when the lease is newly taken. it must be called with the file lock held exclusively
+func (f *File) holdLease() error {
+	l := f.lease
+	now := time.Now()
+	switch {
+	case l.dirs != nil && now.Sub(l.renewed) < l.d/2:
+		return nil
+	case l.dirs != nil && now.Sub(l.renewed) < l.d && l.renew(now, f.writeQuorum()):
+		return nil
+	}
+	l.release()
+
+	var timeout <-chan time.Time
+	if f.lockTimeout > 0 {
+		timer := time.NewTimer(f.lockTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	var done <-chan struct{}
+	if f.ctx != nil {
+		done = f.ctx.Done()
+	}
+	for {
+		err := l.acquire(f.paths, f.writeQuorum())
+		if err == nil {
+			break
+		}
+		if l.mode == LeaseFailFast {
+			return err
+		}
+		select {
+		case <-time.After(l.d / 10):
+		case <-timeout:
+			return fmt.Errorf("%v: %w", err, ErrLockTimeout)
+		case <-done:
+			return fmt.Errorf("%v: %w", err, f.ctx.Err())
+		}
+	}
+	if err := f.reconcile(); err != nil {
+		l.release()
+		return err
+	}
+	f.recordStamps()
+	return nil
+}
+
+func (l *appendLease) acquire(paths []string, quorum int) error {
+	now := time.Now()
+	var errs []error
+	for _, p := range paths {
+		dir := p + leaseSuffix
+		err := os.Mkdir(dir, 0777)
+		if errors.Is(err, os.ErrExist) && breakStale(dir, l.d) {
+			err = os.Mkdir(dir, 0777)
+		}
+		if err == nil {
+			err = os.WriteFile(filepath.Join(dir, "owner"), l.token, 0666)
+			if err == nil {
+				err = l.expires(dir, now)
+			}
+			if err != nil {
+				_ = os.RemoveAll(dir)
+			}
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("lease %s: %w", dir, err))
+			continue
+		}
+		l.dirs = append(l.dirs, dir)
+	}
+	if len(l.dirs) < quorum {
+		l.release()
+		return fmt.Errorf("leased %d of %d replicas, %d needed: %w", len(paths)-len(errs), len(paths), quorum, aggErrors(append(errs, ErrLeaseHeld)))
+	}
+	l.renewed = now
+	return nil
+}
+
+// renew refreshes the lease directories which still name this holder, reporting whether a quorum of them did
+func (l *appendLease) renew(now time.Time, quorum int) bool {
+	var held []string
+	for _, dir := range l.dirs {
+		if l.owns(dir) && os.Chtimes(dir, now, now) == nil && l.expires(dir, now) == nil {
+			held = append(held, dir)
+		}
+	}
+	l.dirs = held
+	if len(held) < quorum {
+		return false
+	}
+	l.renewed = now
+	return true
+}
+
+// expires records that the lease in dir lapses d after now, so GC can tell a live lease from an abandoned one
+func (l *appendLease) expires(dir string, now time.Time) error {
+	return os.Chtimes(filepath.Join(dir, "owner"), now, now.Add(l.d))
+}
+
+// leaseExpired reports whether the lease in dir has lapsed by now, a lease without an owner file was abandoned
+// before it was taken and counts as lapsed once it's been stale for lockStale
+func leaseExpired(dir string, now time.Time) bool {
+	info, err := os.Stat(filepath.Join(dir, "owner"))
+	if err == nil {
+		return info.ModTime().Before(now)
+	}
+	info, err = os.Stat(dir)
+	return err == nil && info.ModTime().Before(now.Add(-lockStale))
+}
+
+func (l *appendLease) owns(dir string) bool {
+	b, err := os.ReadFile(filepath.Join(dir, "owner"))
+	return err == nil && bytes.Equal(b, l.token)
+}
+
+// release removes the lease directories which still name this holder
+func (l *appendLease) release() {
+	for _, dir := range l.dirs {
+		if l.owns(dir) {
+			_ = os.RemoveAll(dir)
+		}
+	}
+	l.dirs = nil
+}
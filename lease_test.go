@@ -0,0 +1,84 @@
+package haraqafs
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWithAppendLease(t *testing.T) {
+	volumes := newTmpVolumes(t, 3)
+	defer removeVolumes(volumes)
+	open := func(mode LeaseMode, opts ...FileOption) *File {
+		opts = append(opts, WithVolumes(append([]string(nil), volumes...)...), WithFlags(os.O_CREATE|os.O_APPEND), WithAppendLease(time.Hour, mode))
+		f, err := New("my_file", opts...)
+		checkErr(t, err)
+		return f
+	}
+
+	// two handles stand in for two processes, they don't share a lock
+	a := open(LeaseWait)
+	b := open(LeaseFailFast)
+	checkWrite(t, a, []byte("hello"))
+	if _, err := b.Write([]byte("jello")); !errors.Is(err, ErrLeaseHeld) || !errors.Is(err, ErrLocked) {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	c := open(LeaseWait, WithContext(ctx))
+	if _, err := c.Write([]byte("jello")); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatal(err)
+	}
+	checkClose(t, c)
+
+	// once the holder is done the next writer catches up and appends after it
+	checkClose(t, a)
+	checkWrite(t, b, []byte(" world"))
+	checkClose(t, b)
+	for _, v := range volumes {
+		got, err := os.ReadFile(filepath.Join(v, "my_file"))
+		checkErr(t, err)
+		if string(got) != "hello world" {
+			t.Fatal(string(got))
+		}
+		if _, err = os.Stat(filepath.Join(v, "my_file"+leaseSuffix)); !os.IsNotExist(err) {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := New("my_file", WithVolumes(append([]string(nil), volumes...)...), WithAppendLease(time.Hour, LeaseWait)); !errors.Is(err, os.ErrInvalid) {
+		t.Fatal(err)
+	}
+}
+
+func TestAppendLeaseLapses(t *testing.T) {
+	volumes := newTmpVolumes(t, 3)
+	defer removeVolumes(volumes)
+	opts := func(mode LeaseMode) []FileOption {
+		return []FileOption{WithVolumes(append([]string(nil), volumes...)...), WithFlags(os.O_CREATE | os.O_APPEND), WithAppendLease(100*time.Millisecond, mode)}
+	}
+	a, err := New("my_file", opts(LeaseFailFast)...)
+	checkErr(t, err)
+	b, err := New("my_file", opts(LeaseFailFast)...)
+	checkErr(t, err)
+
+	checkWrite(t, a, []byte("hello"))
+	time.Sleep(150 * time.Millisecond)
+	checkWrite(t, b, []byte(" world"))
+	// the lapsed holder has to take the lease back, and then appends after the other writer
+	if _, err = a.Write([]byte("!")); !errors.Is(err, ErrLeaseHeld) {
+		t.Fatal(err)
+	}
+	time.Sleep(150 * time.Millisecond)
+	checkWrite(t, a, []byte("!"))
+	checkClose(t, a)
+	checkClose(t, b)
+	got, err := os.ReadFile(filepath.Join(volumes[0], "my_file"))
+	checkErr(t, err)
+	if string(got) != "hello world!" {
+		t.Fatal(string(got))
+	}
+}
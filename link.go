@@ -0,0 +1,66 @@
+package haraqafs
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+type HardlinkPolicy int
+
+const (
+	// HardlinkIgnore repairs hardlinked replicas in place, changing every linked file
+	HardlinkIgnore HardlinkPolicy = iota
+	// HardlinkBreak copies a hardlinked replica to a new inode and renames it into place before repairing it
+	HardlinkBreak
+	// HardlinkError refuses to repair a hardlinked replica
+	HardlinkError
+)
+
+// tmpMarker is part of the name of every temporary file haraqafs creates next to a replica
+const tmpMarker = ".haraqafs-tmp-"
+
+// checkLinks is called before replica i is modified by a repair
+func (f *File) checkLinks(i int) error {
+	if f.hardlinks == HardlinkIgnore || f.multi[i] == nil {
+		return nil
+	}
+	info, err := f.multi[i].Stat()
+	if err != nil {
+		return fmt.Errorf("stat failed for %s: %w", f.paths[i], err)
+	}
+	if linkCount(info) <= 1 {
+		return nil
+	}
+	if f.hardlinks == HardlinkError {
+		return fmt.Errorf("refusing to repair %s with %d links: %w", f.paths[i], linkCount(info), ErrHardlinked)
+	}
+	return f.breakLink(i, info)
+}
+
+// breakLink moves replica i onto its own inode, leaving the other links untouched
+func (f *File) breakLink(i int, info os.FileInfo) error {
+	dir, base := filepath.Split(f.paths[i])
+	tmp, err := os.CreateTemp(dir, "."+base+tmpMarker+"*")
+	if err != nil {
+		return fmt.Errorf("break link failed for %s: %w", f.paths[i], err)
+	}
+	fail := func(err error) error {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("break link failed for %s: %w", f.paths[i], err)
+	}
+	if _, err = io.Copy(tmp, io.NewSectionReader(f.multi[i], 0, info.Size())); err != nil {
+		return fail(err)
+	}
+	if err = tmp.Chmod(info.Mode().Perm()); err != nil {
+		return fail(err)
+	}
+	if err = os.Rename(tmp.Name(), f.paths[i]); err != nil {
+		return fail(err)
+	}
+	_ = f.multi[i].Close()
+	f.multi[i] = tmp
+	return f.syncParents(f.paths[i])
+}
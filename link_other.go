@@ -0,0 +1,19 @@
+//go:build !aix && !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !solaris
+// +build !aix,!darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris
+
+package haraqafs
+
+import "os"
+
+func linkCount(info os.FileInfo) uint64 {
+	return 1
+}
+
+func sameDevice(a, b os.FileInfo) bool {
+	return false
+}
+
+// syncDir is a no-op where directories can't be opened for syncing, those filesystems journal their entries themselves
+func syncDir(dir string) error {
+	return nil
+}
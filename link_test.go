@@ -0,0 +1,45 @@
+package haraqafs
+
+import (
+	"crypto/sha256"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestHardlinkPolicy(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("link counts are not reported on windows")
+	}
+	const fileName = "my_file"
+	volumes := newTmpVolumes(t, 3)
+	defer removeVolumes(volumes)
+
+	for i, v := range volumes {
+		msg := "hello"
+		if i == 2 {
+			msg = "jello"
+		}
+		checkErr(t, os.WriteFile(filepath.Join(v, fileName), []byte(msg), 0666))
+	}
+	linked := filepath.Join(volumes[2], "linked")
+	checkErr(t, os.Link(filepath.Join(volumes[2], fileName), linked))
+
+	hashing := WithHashing(sha256.New())
+	if _, err := New(fileName, WithVolumes(volumes...), hashing, WithHardlinkPolicy(HardlinkError)); !errors.Is(err, ErrHardlinked) {
+		t.Fatal(err)
+	}
+
+	f, err := New(fileName, WithVolumes(volumes...), hashing, WithHardlinkPolicy(HardlinkBreak))
+	checkErr(t, err)
+	checkClose(t, f)
+	for path, want := range map[string]string{linked: "jello", filepath.Join(volumes[2], fileName): "hello"} {
+		b, err := os.ReadFile(path)
+		checkErr(t, err)
+		if string(b) != want {
+			t.Fatal(path, string(b))
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package haraqafs
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// lockSuffix is appended to a replica path to name the lock directory guarding it
+const lockSuffix = ".haraqafs-lock"
+
+// lockStale is how long a lock directory can go without a heartbeat before another process may break it
+var lockStale = 30 * time.Second
+
+// exclusiveLock is a set of lock directories held on a quorum of volumes, kept fresh by a heartbeat
+type exclusiveLock struct {
+	dirs []string
+	stop chan struct{}
+	done chan struct{}
+}
+
+// acquireLock creates a lock directory next to each replica, failing with ErrLocked unless a quorum of them were created.
+// mkdir is atomic on every filesystem we care about, so two processes can never both hold the same lock directory
+func acquireLock(paths []string, quorum int) (*exclusiveLock, error) {
+	l := &exclusiveLock{stop: make(chan struct{}), done: make(chan struct{})}
+	var errs []error
+	contended := false
+	for _, p := range paths {
+		dir := p + lockSuffix
+		if err := tryLock(dir); err != nil {
+			errs = append(errs, err)
+			contended = contended || errors.Is(err, os.ErrExist)
+			continue
+		}
+		l.dirs = append(l.dirs, dir)
+	}
+	if quorum < 1 {
+		quorum = 1
+	}
+	if len(l.dirs) < quorum {
+		l.remove()
+		// only a lock directory which already exists is held by another owner, a missing parent is just an error
+		if contended {
+			errs = append(errs, ErrLocked)
+		}
+		return nil, fmt.Errorf("locked %d of %d replicas, %d needed: %w", len(l.dirs), len(paths), quorum, aggErrors(errs))
+	}
+	go l.heartbeat()
+	return l, nil
+}
+
+func tryLock(dir string) error {
+	err := os.Mkdir(dir, 0777)
+	if errors.Is(err, os.ErrExist) && breakStale(dir, lockStale) {
+		err = os.Mkdir(dir, 0777)
+	}
+	if err != nil {
+		return fmt.Errorf("lock %s: %w", dir, err)
+	}
+
+	// record the owner to make stuck locks easier to track down
+	host, _ := os.Hostname()
+	_ = os.WriteFile(filepath.Join(dir, "owner"), []byte(fmt.Sprintf("%s %d\n", host, os.Getpid())), 0666)
+	return nil
+}
+
+// breakStale removes a lock directory whose owner stopped refreshing it for longer than stale.
+// the directory is renamed away first so only one process can break a given lock, and put back when its owner
+// refreshed it between the stat and the rename
+func breakStale(dir string, stale time.Duration) bool {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return os.IsNotExist(err)
+	}
+	if time.Since(info.ModTime()) < stale {
+		return false
+	}
+	var b [8]byte
+	_, _ = rand.Read(b[:])
+	broken := dir + tmpMarker + hex.EncodeToString(b[:])
+	if err := os.Rename(dir, broken); err != nil {
+		return false
+	}
+	if info, err = os.Stat(broken); err != nil || time.Since(info.ModTime()) < stale {
+		_ = os.Rename(broken, dir)
+		return false
+	}
+	_ = os.RemoveAll(broken)
+	return true
+}
+
+func (l *exclusiveLock) heartbeat() {
+	defer close(l.done)
+	ticker := time.NewTicker(lockStale / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+			now := time.Now()
+			for _, dir := range l.dirs {
+				_ = os.Chtimes(dir, now, now)
+			}
+		}
+	}
+}
+
+func (l *exclusiveLock) release() {
+	close(l.stop)
+	<-l.done
+	l.remove()
+}
+
+func (l *exclusiveLock) remove() {
+	for _, dir := range l.dirs {
+		_ = os.RemoveAll(dir)
+	}
+}
+
+// internalName reports whether name is one of the files haraqafs keeps next to a replica
+func internalName(name string) bool {
+	return strings.HasSuffix(name, lockSuffix) || strings.HasSuffix(name, leaseSuffix) || strings.HasSuffix(name, digestSuffix) || strings.HasSuffix(name, hashSuffix) ||
+		strings.HasSuffix(name, pinSuffix) || strings.HasSuffix(name, ledgerName) ||
+		strings.HasSuffix(name, journalSuffix) || strings.HasSuffix(name, stageSuffix) || strings.HasSuffix(name, commitSuffix)
+}
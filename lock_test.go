@@ -0,0 +1,57 @@
+package haraqafs
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestWithExclusive(t *testing.T) {
+	volumes := newTmpVolumes(t, 3)
+	defer removeVolumes(volumes)
+
+	f, err := New("my_file", WithVolumes(volumes...), WithCreate(), WithExclusive())
+	checkErr(t, err)
+
+	_, err = New("my_file", WithVolumes(append([]string(nil), volumes...)...), WithExclusive())
+	if !errors.Is(err, ErrLocked) {
+		t.Fatal(err)
+	}
+
+	// lock directories are hidden from listings
+	d, err := OpenDir("", WithVolumes(append([]string(nil), volumes...)...))
+	checkErr(t, err)
+	entries, err := d.ReadDir(-1)
+	checkErr(t, err)
+	if len(entries) != 1 || entries[0].Name() != "my_file" {
+		t.Fatal(entries)
+	}
+
+	checkClose(t, f)
+	f, err = New("my_file", WithVolumes(append([]string(nil), volumes...)...), WithExclusive())
+	checkErr(t, err)
+	checkClose(t, f)
+}
+
+func TestWithExclusiveStale(t *testing.T) {
+	volumes := newTmpVolumes(t, 3)
+	defer removeVolumes(volumes)
+
+	// simulate a lock left behind by a crashed process
+	old := time.Now().Add(-2 * lockStale)
+	for _, v := range volumes {
+		dir := v + "/my_file" + lockSuffix
+		checkErr(t, os.Mkdir(dir, 0777))
+		checkErr(t, os.Chtimes(dir, old, old))
+	}
+
+	f, err := New("my_file", WithVolumes(volumes...), WithCreate(), WithExclusive())
+	checkErr(t, err)
+	checkClose(t, f)
+	for _, v := range volumes {
+		if _, err := os.Stat(v + "/my_file" + lockSuffix); !os.IsNotExist(err) {
+			t.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package haraqafs
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"path/filepath"
+)
+
+// WriteChecksumManifest writes a sha256sum compatible listing of every file under root, hashing the content a quorum of replicas agree on.
+// paths are relative to root, so `sha256sum -c` can check it from root on any single volume or a restored copy
+func (fsys *FS) WriteChecksumManifest(w io.Writer, root string) error {
+	return fsys.walk(root, "", func(name string, isDir bool) error {
+		if isDir {
+			return nil
+		}
+		f, err := fsys.New(filepath.Join(root, filepath.FromSlash(name)), WithReadOnly())
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		h := sha256.New()
+		if err = f.copyQuorum(h); err != nil {
+			return fmt.Errorf("checksum %s: %w", name, err)
+		}
+		_, err = fmt.Fprintf(w, "%s  %s\n", hex.EncodeToString(h.Sum(nil)), name)
+		return err
+	})
+}
@@ -0,0 +1,32 @@
+package haraqafs
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteChecksumManifest(t *testing.T) {
+	volumes := newTmpVolumes(t, 3)
+	defer removeVolumes(volumes)
+	for _, v := range volumes {
+		checkErr(t, os.MkdirAll(filepath.Join(v, "root", "sub"), 0755))
+		checkErr(t, os.WriteFile(filepath.Join(v, "root", "a"), []byte("hello"), 0644))
+		checkErr(t, os.WriteFile(filepath.Join(v, "root", "sub", "b"), []byte("world"), 0644))
+	}
+	checkErr(t, os.WriteFile(filepath.Join(volumes[2], "root", "sub", "b"), []byte("wörld"), 0644))
+
+	var buf bytes.Buffer
+	checkErr(t, NewFS(WithVolumes(volumes...)).WriteChecksumManifest(&buf, "root"))
+	sum := func(s string) string {
+		h := sha256.Sum256([]byte(s))
+		return hex.EncodeToString(h[:])
+	}
+	want := sum("hello") + "  a\n" + sum("world") + "  sub/b\n"
+	if buf.String() != want {
+		t.Fatal(buf.String())
+	}
+}
@@ -0,0 +1,67 @@
+package haraqafs
+
+import "fmt"
+
+// openManyWorkers bounds how many files OpenMany opens at once unless WithOpenManyWorkers says otherwise
+const openManyWorkers = 16
+
+// OpenMany opens every name with the same options, several at a time. if any fail the others are closed again
+func OpenMany(names []string, opts ...FileOption) ([]*File, error) {
+	scratch := &File{}
+	if err := applyScratch(scratch, opts); err != nil {
+		return nil, err
+	}
+	workers := openManyWorkers
+	if scratch.openWorkers > 0 {
+		workers = scratch.openWorkers
+	}
+	if scratch.hashing != nil {
+		// the hash from WithHashing is shared by every file, so they have to be opened one at a time, FS.OpenMany doesn't have this problem
+		workers = 1
+	}
+	return openMany(names, workers, func(name string) (*File, error) {
+		return New(name, opts...)
+	})
+}
+
+// OpenMany opens every name through the FS, several at a time. if any fail the others are closed again
+func (fsys *FS) OpenMany(names []string, opts ...FileOption) ([]*File, error) {
+	scratch := &File{}
+	if err := applyScratch(scratch, append(fsys.opts[:len(fsys.opts):len(fsys.opts)], opts...)); err != nil {
+		return nil, err
+	}
+	workers := openManyWorkers
+	if scratch.openWorkers > 0 {
+		workers = scratch.openWorkers
+	}
+	return openMany(names, workers, func(name string) (*File, error) {
+		return fsys.New(name, opts...)
+	})
+}
+
+func openMany(names []string, workers int, open func(name string) (*File, error)) ([]*File, error) {
+	files := make([]*File, len(names))
+	indexes := make([]int, len(names))
+	for i := range indexes {
+		indexes[i] = i
+	}
+	var failed []error
+	for i, err := range boundedEach(workers, len(names), indexes, func(i int) error {
+		var err error
+		files[i], err = open(names[i])
+		return err
+	}) {
+		if err != nil {
+			failed = append(failed, fmt.Errorf("open %s: %w", names[i], err))
+		}
+	}
+	if len(failed) == 0 {
+		return files, nil
+	}
+	for _, f := range files {
+		if f != nil {
+			_ = f.Close()
+		}
+	}
+	return nil, aggErrors(failed)
+}
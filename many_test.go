@@ -0,0 +1,40 @@
+package haraqafs
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+)
+
+func TestOpenMany(t *testing.T) {
+	volumes := newTmpVolumes(t, 3)
+	defer removeVolumes(volumes)
+	names := make([]string, 50)
+	for i := range names {
+		names[i] = fmt.Sprintf("file_%d", i)
+	}
+
+	if _, err := OpenMany(names, WithVolumes(volumes...), WithOpenManyWorkers(0)); !errors.Is(err, os.ErrInvalid) {
+		t.Fatal(err)
+	}
+	files, err := OpenMany(names, WithVolumes(volumes...), WithCreate(), WithConcurrency(1), WithOpenManyWorkers(4))
+	checkErr(t, err)
+	for i, f := range files {
+		checkWrite(t, f, []byte(names[i]))
+		checkClose(t, f)
+	}
+
+	fsys := NewFS(WithVolumes(append([]string(nil), volumes...)...))
+	files, err = fsys.OpenMany(names, WithOpenManyWorkers(2))
+	checkErr(t, err)
+	for i, f := range files {
+		checkRead(t, f, []byte(names[i]))
+		checkClose(t, f)
+	}
+
+	// a missing file fails the whole batch
+	if _, err = fsys.OpenMany(append(names, "missing")); !errors.Is(err, os.ErrNotExist) {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,45 @@
+package haraqafs
+
+// Op is the kind of file operation a middleware is wrapping
+type Op int
+
+const (
+	OpRead Op = iota
+	OpWrite
+	// OpSync is a Sync or Barrier, its Call has no offset or buffer
+	OpSync
+)
+
+func (op Op) String() string {
+	switch op {
+	case OpRead:
+		return "read"
+	case OpWrite:
+		return "write"
+	case OpSync:
+		return "sync"
+	}
+	return "unknown"
+}
+
+// Call is one operation on the file, as passed through the middleware
+type Call struct {
+	Op     Op
+	Offset int64
+	Buf    []byte
+}
+
+// Middleware wraps an operation on the file, next carries on with the call, possibly changed, through the rest of the middleware to the replicas.
+// it usually runs with the file lock held, so it must not call back into the file
+type Middleware func(c Call, next func(Call) (int, error)) (int, error)
+
+// through runs op wrapped in the middleware, the first middleware registered is the outermost
+func (f *File) through(c Call, op func(Call) (int, error)) (int, error) {
+	for i := len(f.middleware) - 1; i >= 0; i-- {
+		m, next := f.middleware[i], op
+		op = func(c Call) (int, error) {
+			return m(c, next)
+		}
+	}
+	return op(c)
+}
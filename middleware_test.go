@@ -0,0 +1,80 @@
+package haraqafs
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWithMiddleware(t *testing.T) {
+	volumes := newTmpVolumes(t, 3)
+	defer removeVolumes(volumes)
+
+	var calls []string
+	trace := func(c Call, next func(Call) (int, error)) (int, error) {
+		calls = append(calls, c.Op.String())
+		return next(c)
+	}
+	errTooBig := errors.New("too big")
+	limit := func(c Call, next func(Call) (int, error)) (int, error) {
+		if c.Op == OpWrite && len(c.Buf) > 5 {
+			return 0, errTooBig
+		}
+		return next(c)
+	}
+	f, err := New("my_file", WithVolumes(volumes...), WithCreate(), WithMiddleware(trace, limit))
+	checkErr(t, err)
+
+	checkWrite(t, f, []byte("hello"))
+	if _, err = f.Write([]byte("hello world")); !errors.Is(err, errTooBig) {
+		t.Fatal(err)
+	}
+	checkSeek(t, f, 0, io.SeekStart)
+	checkRead(t, f, []byte("hello"))
+	checkErr(t, f.Barrier())
+	checkClose(t, f)
+
+	// the rejected write was traced by the outer middleware but never reached a replica
+	if len(calls) != 4 || calls[0] != "write" || calls[1] != "write" || calls[2] != "read" || calls[3] != "sync" {
+		t.Fatal(calls)
+	}
+	for _, v := range volumes {
+		b, err := os.ReadFile(filepath.Join(v, "my_file"))
+		checkErr(t, err)
+		if string(b) != "hello" {
+			t.Fatal(string(b))
+		}
+	}
+}
+
+func TestWithWriteValidator(t *testing.T) {
+	volumes := newTmpVolumes(t, 3)
+	defer removeVolumes(volumes)
+
+	errUnaligned := errors.New("unaligned record")
+	f, err := New("my_file", WithVolumes(volumes...), WithCreate(), WithWriteValidator(func(b []byte, off int64) error {
+		if off%4 != 0 || len(b)%4 != 0 {
+			return errUnaligned
+		}
+		return nil
+	}))
+	checkErr(t, err)
+	checkWrite(t, f, []byte("abcd"))
+	if n, err := f.Write([]byte("efg")); n != 0 || !errors.Is(err, errUnaligned) {
+		t.Fatal(n, err)
+	}
+	if _, err = f.WriteAt([]byte("efgh"), 2); !errors.Is(err, errUnaligned) {
+		t.Fatal(err)
+	}
+	checkWrite(t, f, []byte("efgh"))
+	checkClose(t, f)
+	for _, v := range volumes {
+		b, err := os.ReadFile(filepath.Join(v, "my_file"))
+		checkErr(t, err)
+		if string(b) != "abcdefgh" {
+			t.Fatal(string(b))
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package haraqafs
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// dirPerm returns the permissions directories are created with
+func (f *File) dirPerm() os.FileMode {
+	if f.dirPerms == 0 {
+		return os.ModePerm
+	}
+	return f.dirPerms
+}
+
+// mkdirParents creates the missing parent directories of every replica with WithMkdirAll,
+// best effort as opening the replicas reports any failure
+func (f *File) mkdirParents() {
+	for i := range f.paths {
+		f.mkdirParent(i)
+	}
+}
+
+func (f *File) mkdirParent(i int) {
+	if !f.mkdirAll {
+		return
+	}
+	var missing []string
+	if f.dirSync {
+		missing = missingDirs(filepath.Dir(f.paths[i]))
+	}
+	if os.MkdirAll(filepath.Dir(f.paths[i]), f.dirPerm()) == nil {
+		_ = f.syncParents(missing...)
+	}
+}
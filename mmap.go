@@ -0,0 +1,179 @@
+package haraqafs
+
+import (
+	"fmt"
+	"os"
+	"sort"
+)
+
+// maxDirtySpans bounds the dirty ranges tracked per replica, past it they're collapsed into one
+const maxDirtySpans = 1024
+
+type mapping struct {
+	data  []byte
+	dirty []span
+}
+
+// covers reports whether the whole range is inside the mapping
+func (m *mapping) covers(offset int64, n int) bool {
+	return m != nil && offset >= 0 && offset+int64(n) <= int64(len(m.data))
+}
+
+type span struct {
+	start, end int64
+}
+
+func (m *mapping) markDirty(start, end int64) {
+	m.dirty = append(m.dirty, span{start, end})
+	if len(m.dirty) > maxDirtySpans {
+		m.dirty = m.merged()
+	}
+	if len(m.dirty) > maxDirtySpans {
+		m.dirty = []span{{m.dirty[0].start, m.dirty[len(m.dirty)-1].end}}
+	}
+}
+
+// merged returns the dirty ranges sorted with overlapping and adjacent ranges joined
+func (m *mapping) merged() []span {
+	sort.Slice(m.dirty, func(a, b int) bool { return m.dirty[a].start < m.dirty[b].start })
+	var out []span
+	for _, s := range m.dirty {
+		if n := len(out); n > 0 && s.start <= out[n-1].end {
+			if s.end > out[n-1].end {
+				out[n-1].end = s.end
+			}
+			continue
+		}
+		out = append(out, s)
+	}
+	return out
+}
+
+// mapReplicas maps every open replica at the current size, writes inside the mapping are copied into memory instead of issuing a pwrite per replica.
+// a replica shorter than the file, one a failed truncate or another process left behind, is only mapped as far as it goes
+// so touching the mapping never faults past its end
+func (f *File) mapReplicas() error {
+	if !f.mmap || f.size == 0 {
+		return nil
+	}
+	f.maps = make([]*mapping, len(f.multi))
+	f.mapSize = f.size
+	for i := range f.multi {
+		if f.multi[i] == nil {
+			continue
+		}
+		info, err := f.multi[i].Stat()
+		if err != nil {
+			f.unmapReplicas()
+			return fmt.Errorf("mmap failed for %s: %w", f.paths[i], err)
+		}
+		size := info.Size()
+		if size > f.size {
+			size = f.size
+		}
+		if size == 0 {
+			continue
+		}
+		data, err := mmapFile(f.multi[i], size)
+		if err != nil {
+			f.unmapReplicas()
+			return fmt.Errorf("mmap failed for %s: %w", f.paths[i], err)
+		}
+		f.maps[i] = &mapping{data: data}
+	}
+	return nil
+}
+
+// unmapReplicas releases the mappings, anything not yet synced is still written back by the kernel
+func (f *File) unmapReplicas() {
+	for _, m := range f.maps {
+		if m != nil {
+			_ = munmap(m.data)
+		}
+	}
+	f.maps = nil
+	f.mapSize = 0
+}
+
+// remap maps the replicas again at the file's current size and their own, it follows every change to either.
+// the ranges not yet flushed by Msync carry over to the new mappings
+func (f *File) remap() error {
+	if !f.mmap {
+		return nil
+	}
+	dirty := make([][]span, len(f.maps))
+	for i, m := range f.maps {
+		if m != nil {
+			dirty[i] = m.dirty
+		}
+	}
+	f.unmapReplicas()
+	if err := f.mapReplicas(); err != nil {
+		return err
+	}
+	for i, m := range f.maps {
+		if m == nil || i >= len(dirty) {
+			continue
+		}
+		for _, s := range dirty[i] {
+			if s.end > int64(len(m.data)) {
+				s.end = int64(len(m.data))
+			}
+			if s.start < s.end {
+				m.markDirty(s.start, s.end)
+			}
+		}
+	}
+	return nil
+}
+
+func (f *File) mapped(offset int64, n int) bool {
+	return f.maps != nil && offset >= 0 && offset+int64(n) <= f.mapSize
+}
+
+// writeMapping copies b into the mapping of replica i when the mapping covers it, reporting whether it did
+func (f *File) writeMapping(i int, b []byte, offset int64) bool {
+	if f.maps == nil || !f.maps[i].covers(offset, len(b)) {
+		return false
+	}
+	m := f.maps[i]
+	copy(m.data[offset:], b)
+	m.markDirty(offset, offset+int64(len(b)))
+	return true
+}
+
+// msyncRange flushes a range just written through the mapping of replica i
+func (f *File) msyncRange(i int, start, end int64) error {
+	page := int64(os.Getpagesize())
+	return msync(f.maps[i].data[start/page*page : end])
+}
+
+// Msync flushes the ranges written through the mappings since the last Msync to disk
+func (f *File) Msync() error {
+	if f == nil || len(f.multi) == 0 || f.lock == nil {
+		return os.ErrInvalid
+	}
+	if err := f.acquire(); err != nil {
+		return err
+	}
+	defer f.lock.unlock()
+
+	page := int64(os.Getpagesize())
+	var errs []error
+	for i, m := range f.maps {
+		if m == nil {
+			continue
+		}
+		for _, s := range m.merged() {
+			start := s.start / page * page
+			if s.end > int64(len(m.data)) {
+				s.end = int64(len(m.data))
+			}
+			if err := msync(m.data[start:s.end]); err != nil {
+				errs = append(errs, fmt.Errorf("msync failed for %s: %w", f.paths[i], err))
+			}
+		}
+		m.dirty = nil
+	}
+	return aggErrors(errs)
+}
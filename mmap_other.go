@@ -0,0 +1,23 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux
+// +build !darwin,!dragonfly,!freebsd,!linux
+
+package haraqafs
+
+import (
+	"fmt"
+	"os"
+)
+
+var errNoMmap = fmt.Errorf("mmap isn't supported on this platform: %w", os.ErrInvalid)
+
+func mmapFile(f *os.File, size int64) ([]byte, error) {
+	return nil, errNoMmap
+}
+
+func munmap(b []byte) error {
+	return errNoMmap
+}
+
+func msync(b []byte) error {
+	return errNoMmap
+}
@@ -0,0 +1,67 @@
+//go:build darwin || dragonfly || freebsd || linux
+// +build darwin dragonfly freebsd linux
+
+package haraqafs
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWithMmap(t *testing.T) {
+	volumes := newTmpVolumes(t, 3)
+	defer removeVolumes(volumes)
+	f, err := New("my_file", WithVolumes(volumes...), WithCreate(), WithMmap())
+	checkErr(t, err)
+
+	// the file starts empty, so the first write goes through the replicas and the mapping comes with the truncate
+	checkErr(t, f.Truncate(8192))
+	if f.maps == nil {
+		t.Fatal("replicas weren't mapped")
+	}
+	for i := 0; i < 100; i++ {
+		_, err = f.WriteAt([]byte{byte(i)}, int64(i*64))
+		checkErr(t, err)
+	}
+	if len(f.maps[0].merged()) != 100 {
+		t.Fatal(len(f.maps[0].merged()))
+	}
+	checkErr(t, f.Msync())
+	if f.maps[0].dirty != nil {
+		t.Fatal(f.maps[0].dirty)
+	}
+
+	// writes past the mapping fall back to the replicas
+	_, err = f.WriteAt([]byte("tail"), 8192)
+	checkErr(t, err)
+	_, err = f.WriteAt([]byte("TAIL"), 8192)
+	checkErr(t, err)
+	checkClose(t, f)
+
+	for _, v := range volumes {
+		b, err := os.ReadFile(filepath.Join(v, "my_file"))
+		checkErr(t, err)
+		if len(b) != 8196 || b[64*99] != 99 || !bytes.Equal(b[8192:], []byte("TAIL")) {
+			t.Fatal(len(b), b[64*99])
+		}
+	}
+
+	// a replica shorter than the file is only mapped as far as it goes, writes past that go through the replica
+	f, err = New("my_file", WithVolumes(volumes...), WithMmap())
+	checkErr(t, err)
+	checkErr(t, os.Truncate(filepath.Join(volumes[1], "my_file"), 100))
+	checkErr(t, f.remap())
+	if len(f.maps[0].data) != 8196 || len(f.maps[1].data) != 100 {
+		t.Fatal(len(f.maps[0].data), len(f.maps[1].data))
+	}
+	_, err = f.WriteAt([]byte("mapped"), 4096)
+	checkErr(t, err)
+	checkClose(t, f)
+	b, err := os.ReadFile(filepath.Join(volumes[1], "my_file"))
+	checkErr(t, err)
+	if !bytes.Equal(b[4096:4102], []byte("mapped")) {
+		t.Fatal(string(b[4096:4102]))
+	}
+}
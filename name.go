@@ -0,0 +1,18 @@
+package haraqafs
+
+import (
+	"io/fs"
+	"path/filepath"
+	"strings"
+)
+
+// logicalName cleans a name which is resolved against the volume roots, rejecting absolute names and ones which
+// climb out of the volumes with .. so names taken from users can't reach files outside them
+func logicalName(op, name string) (string, error) {
+	clean := filepath.Clean(name)
+	if filepath.IsAbs(clean) || filepath.VolumeName(clean) != "" || strings.HasPrefix(clean, string(filepath.Separator)) ||
+		clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	return clean, nil
+}
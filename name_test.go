@@ -0,0 +1,45 @@
+package haraqafs
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLogicalNames(t *testing.T) {
+	volumes := newTmpVolumes(t, 3)
+	defer removeVolumes(volumes)
+	outside := filepath.Join(filepath.Dir(volumes[0]), "outside")
+	opts := []FileOption{WithVolumes(volumes...), WithCreate()}
+
+	for _, name := range []string{"..", "../outside", "a/../../outside", "/etc/passwd", outside} {
+		if _, err := New(name, opts...); !errors.Is(err, fs.ErrInvalid) {
+			t.Fatal(name, err)
+		}
+		if _, err := OpenDir(name, opts...); !errors.Is(err, fs.ErrInvalid) {
+			t.Fatal(name, err)
+		}
+		if err := Remove(name, opts...); !errors.Is(err, fs.ErrInvalid) {
+			t.Fatal(name, err)
+		}
+		if err := Rename("a", name, opts...); !errors.Is(err, fs.ErrInvalid) {
+			t.Fatal(name, err)
+		}
+		if ok, err := NewFS(opts...).Exists(name); ok || !errors.Is(err, fs.ErrInvalid) {
+			t.Fatal(name, err)
+		}
+	}
+	if _, err := os.Stat(outside); !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+
+	// names which stay inside the volumes are cleaned
+	f, err := New("a/../b", opts...)
+	checkErr(t, err)
+	checkClose(t, f)
+	if _, err := os.Stat(filepath.Join(volumes[0], "b")); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -15,9 +15,8 @@ func New(name string, opts ...FileOption) (*File, error) {
 	// new with defaults
 	f := &File{
 		flags: os.O_RDWR,
-		lock:  make(chan struct{}, 1),
+		lock:  newRWLock(),
 	}
-	f.lock <- struct{}{}
 
 	// apply options
 	for _, opt := range opts {
@@ -26,50 +25,327 @@ func New(name string, opts ...FileOption) (*File, error) {
 		}
 	}
 
+	logical := name
+	if len(f.volumes) > 0 || f.ring != nil {
+		var err error
+		if logical, err = logicalName("open", name); err != nil {
+			return nil, err
+		}
+		name = f.jailName(logical)
+	}
+	if err := f.translateAppend(); err != nil {
+		return nil, err
+	}
+	if f.framing && !f.appendOnly {
+		return nil, fmt.Errorf("framing requires append only: %w", os.ErrInvalid)
+	}
+	if f.lease != nil && !f.appendWrites {
+		return nil, fmt.Errorf("append lease requires O_APPEND: %w", os.ErrInvalid)
+	}
+	if f.mmap && f.readOnly {
+		return nil, fmt.Errorf("mmap writes need a writable file: %w", os.ErrInvalid)
+	}
+
+	// place the file on a subset of the ring
+	if f.ring != nil {
+		f.volumes = f.ring.Locate(name, f.ringReplicas)
+		f.alignSpecs()
+		if f.paths == nil {
+			f.paths = pathPool.Get().([]string)[:0]
+			f.multi = filePool.Get().([]*os.File)[:0]
+		}
+	}
+
+	// move replicas off volumes which were rebound
+	if f.placement != nil {
+		volumes, err := f.placement.resolve(name, f.volumes)
+		if err != nil {
+			return nil, err
+		}
+		f.volumes = volumes
+		f.alignSpecs()
+	}
+
+	// check the quorum can be reached at all
+	volumes := len(f.volumes)
+	if volumes == 0 {
+		volumes = 1
+	}
+	for _, q := range []int{f.quorum, f.writeQ, f.readQ} {
+		if q > volumes {
+			return nil, &QuorumError{Quorum: q, Volumes: volumes}
+		}
+	}
+	if err := f.checkErasure(); err != nil {
+		return nil, err
+	}
+
 	// check if no volumes spec'd: open single file
 	if len(f.volumes) == 0 {
 		name = filepath.Clean(name)
 		f.volumes = []string{name}
 		f.paths = []string{name}
+		if err := f.register(); err != nil {
+			return nil, err
+		}
+		if f.flags&os.O_CREATE != 0 {
+			f.mkdirParents()
+		}
+		start := time.Now()
 		tmp, err := os.OpenFile(f.paths[0], f.flags, f.perms)
+		f.observe(0, opOpen, start)
 		if err != nil {
+			f.unregister()
 			return nil, err
 		}
 		f.multi = []*os.File{tmp}
+		f.health = make([]replicaHealth, 1)
+		if f.flags&os.O_CREATE != 0 {
+			err = f.syncParents(f.paths...)
+		}
+		if err == nil {
+			err = f.replayJournals()
+		}
+		if err == nil {
+			err = f.replayCommits()
+		}
+		if err == nil {
+			err = f.recoverTails()
+		}
+		if err != nil {
+			_ = f.Close()
+			f.unregister()
+			return nil, err
+		}
+		f.sortReadOrder()
+		f.size = f.statSize()
+		if f.appendOnly {
+			f.offset = f.size
+		}
+		if err = f.loadDigests(); err == nil {
+			err = f.mapReplicas()
+		}
+		if err != nil {
+			_ = f.Close()
+			f.unregister()
+			return nil, err
+		}
+		f.recordStamps()
+		f.advance()
+		f.trackTrust()
 		return f, nil
 	}
 	if f.quorum == 0 {
 		f.quorum = 1 + len(f.volumes)/2
 	}
 
-	// open files
-	var errs []error
+	f.paths = append(f.paths, f.replicaPaths(f.volumes, name)...)
+	if err := f.checkJail(f.volumes, f.paths); err != nil {
+		return nil, err
+	}
+	// parents come first, the lock directories of WithExclusive live next to the replicas
+	if f.flags&os.O_CREATE != 0 {
+		f.mkdirParents()
+	}
+	if err := f.register(); err != nil {
+		return nil, err
+	}
 
-	for i := range f.volumes {
-		f.paths = append(f.paths, filepath.Join(f.volumes[i], name))
+	// open files, truncating them is held back until we know a quorum opened
+	f.statMissing()
+	f.notePinned()
+	if err := f.checkAccount(logical); err != nil {
+		f.unregister()
+		return nil, err
+	}
+	var errs []error
+	if f.openAsDir() {
+		f.viewDir(logical, opts)
+		errs = f.openDirReplicas()
+	}
+	for i := len(f.multi); i < len(f.volumes); i++ {
 		var err error
-		tmp, err := os.OpenFile(f.paths[i], f.flags, f.perms)
+		start := time.Now()
+		tmp, err := os.OpenFile(f.paths[i], (f.flags&^os.O_TRUNC)|f.spec(i).Flags, f.perms)
+		f.observe(i, opOpen, start)
 		if err != nil {
 			errs = append(errs, err)
 		}
 		f.multi = append(f.multi, tmp)
 	}
-	if len(f.volumes)-len(errs) < f.quorum {
+	errs = append(errs, f.checkOpened()...)
+	if opened := len(f.volumes) - len(errs); opened < f.quorum {
 		// best effort close any open files
 		_ = f.Close()
-		return nil, aggErrors(errs)
+		f.unregister()
+		return nil, aggErrors(append(errs, fmt.Errorf("%d of %d replicas opened, %d needed: %w", opened, len(f.volumes), f.quorum, ErrNoQuorum)))
+	}
+	if f.flags&os.O_CREATE != 0 {
+		if err := f.syncParents(f.paths...); err != nil {
+			_ = f.Close()
+			f.unregister()
+			return nil, err
+		}
 	}
 
-	err := f.consensus()
+	// allocated up front, replicas can be marked dirty while the file lock is shared
+	f.health = make([]replicaHealth, len(f.multi))
+	if err := f.truncateReplicas(); err != nil {
+		_ = f.Close()
+		f.unregister()
+		return nil, err
+	}
+	if f.consensusDeadline > 0 {
+		f.consensusBy = time.Now().Add(f.consensusDeadline)
+	}
+	err := f.replayJournals()
+	if err == nil {
+		err = f.replayCommits()
+	}
+	if err == nil {
+		err = f.recoverTails()
+	}
+	if err == nil {
+		err = f.consensus()
+	}
+	f.consensusBy = time.Time{}
+	f.missing = nil
 	if err != nil {
 		// best effort close any open files
 		_ = f.Close()
+		f.unregister()
+		return nil, err
+	}
+	f.sortReadOrder()
+	f.size = f.statSize()
+	if err = f.loadDigests(); err == nil {
+		err = f.mapReplicas()
+	}
+	if err != nil {
+		_ = f.Close()
+		f.unregister()
+		return nil, err
+	}
+	f.recordStamps()
+	f.advance()
+	f.trackTrust()
+	if err = f.settleOpen(); err != nil {
+		f.unregister()
 		return nil, err
 	}
+	f.startRepair()
 	return f, nil
 }
 
+// statSize returns the size of the first usable replica in read order
+func (f *File) statSize() int64 {
+	if f.erasure != nil {
+		return f.erasure.size
+	}
+	for _, i := range f.readOrder {
+		if !f.usable(i) {
+			continue
+		}
+		if info, err := f.multi[i].Stat(); err == nil {
+			return info.Size()
+		}
+	}
+	return 0
+}
+
+// alignSpecs lines the volume specs up with the volumes the file was placed on, volumes without a spec get the defaults
+func (f *File) alignSpecs() {
+	if f.specs == nil {
+		return
+	}
+	specs := make([]Volume, len(f.volumes))
+	for i, v := range f.volumes {
+		specs[i] = Volume{Path: v}
+		for _, spec := range f.specs {
+			if spec.Path == v {
+				specs[i] = spec
+				break
+			}
+		}
+	}
+	f.specs = specs
+}
+
+// translateAppend swaps O_APPEND for our own append mode, replicas opened with O_APPEND would reject the WriteAt calls writes fan out with
+func (f *File) translateAppend() error {
+	for _, spec := range f.specs {
+		if spec.Flags&os.O_APPEND != 0 {
+			return fmt.Errorf("O_APPEND applies to the whole file, not volume %s: %w", spec.Path, os.ErrInvalid)
+		}
+	}
+	if f.flags&os.O_APPEND == 0 {
+		return nil
+	}
+	f.flags &^= os.O_APPEND
+	f.appendWrites = true
+	return nil
+}
+
+// truncateReplicas applies O_TRUNC to the opened replicas, so a New which fails to open a quorum leaves every replica as it was.
+// replicas which fail to truncate are marked dirty. replicas which couldn't be opened keep their old content,
+// a later open only outvotes them with WithEmptyPolicy(EmptyVotes) and otherwise fails with ErrNoQuorum rather than repair from them
+func (f *File) truncateReplicas() error {
+	if f.flags&os.O_TRUNC == 0 {
+		return nil
+	}
+	if f.pinned {
+		return pathErr("truncate", f.paths[0], ErrPinned)
+	}
+	var errs []error
+	var truncated int
+	for i := range f.multi {
+		if f.multi[i] == nil {
+			continue
+		}
+		if err := f.multi[i].Truncate(0); err != nil {
+			err = pathErr("truncate", f.paths[i], err)
+			errs = append(errs, err)
+			f.markDirty(i, err)
+			continue
+		}
+		truncated++
+	}
+	if truncated < f.quorum {
+		return aggErrors(append(errs, fmt.Errorf("%d of %d replicas truncated, %d needed: %w", truncated, len(f.multi), f.quorum, ErrNoQuorum)))
+	}
+	return nil
+}
+
+// register claims the replica paths in the registry and, with WithExclusive, in the lock directories on disk
+func (f *File) register() error {
+	if f.registry != nil {
+		var timeout <-chan time.Time
+		if f.lockTimeout > 0 {
+			timer := time.NewTimer(f.lockTimeout)
+			defer timer.Stop()
+			timeout = timer.C
+		}
+		registered, err := f.registry.acquire(f.paths, f.registryMode, f.waitRegistry(timeout))
+		if err != nil {
+			return err
+		}
+		f.registered = registered
+	}
+	if f.exclusive {
+		l, err := acquireLock(f.paths, f.quorum)
+		if err != nil {
+			f.unregister()
+			return err
+		}
+		f.exclusiveLock = l
+	}
+	return nil
+}
+
 func (f *File) consensus() error {
+	if f.erasure != nil {
+		return f.settleShards()
+	}
 	// quick 1 file check
 	if len(f.multi) == 1 && f.multi[0] != nil {
 		return nil
@@ -80,15 +356,26 @@ func (f *File) consensus() error {
 		sourceIndex               = -1
 		sourceSize          int64 = -1
 		sourceMod           time.Time
+		modTimes            = make([]time.Time, len(f.multi))
 	)
 	hashes := hashPool.Get().([][]byte)
 	if cap(hashes) < len(f.multi) {
 		hashes = append(hashes, make([][]byte, len(f.multi))...)
 	}
 	hashes = hashes[:len(f.multi)]
-	defer func() { hashPool.Put(hashes) }()
-	sizes := sizePool.Get().([]int64)[:0]
-	defer func() { sizePool.Put(sizes) }()
+	for i := range hashes {
+		hashes[i] = nil
+	}
+	defer func() { hashPool.Put(hashes[:0]) }()
+	sizes := sizePool.Get().([]int64)
+	if cap(sizes) < len(f.multi) {
+		sizes = append(sizes, make([]int64, len(f.multi))...)
+	}
+	sizes = sizes[:len(f.multi)]
+	for i := range sizes {
+		sizes[i] = 0
+	}
+	defer func() { sizePool.Put(sizes[:0]) }()
 	for i := len(f.multi) - 1; i >= 0; i-- {
 		var err error
 		if f.multi[i] == nil {
@@ -106,33 +393,49 @@ func (f *File) consensus() error {
 			foundFile = true
 		}
 		if foundDir && foundFile {
-			return fmt.Errorf("mismatched file types: %w", os.ErrInvalid)
+			return ErrMismatchedTypes
 		}
 
-		if isSourceOfTruth(info, f.quorumFail, i, sourceIndex, sourceSize, sourceMod) {
+		modTime := f.modTime(info.ModTime())
+		modTimes[i] = modTime
+		if isSourceOfTruth(info.Size(), modTime, f.quorumFail, i, sourceIndex, sourceSize, sourceMod) {
 			sourceSize = info.Size()
-			sourceMod = info.ModTime()
+			sourceMod = modTime
 			sourceIndex = i
 		}
-		sizes = append(sizes, info.Size())
+		sizes[i] = info.Size()
 		if info.Size() == 0 {
+			hashes[i] = f.emptyVote(i)
 			continue
 		}
-		if f.hashing == nil {
-			var b [8]byte
-			binary.LittleEndian.PutUint64(b[:], uint64(info.Size()))
-			hashes[i] = b[:]
-		} else {
-			f.hashing.Reset()
-			_, e := io.Copy(f.hashing, f.multi[i])
-			if e == nil {
-				hashes[i] = f.hashing.Sum(nil)
+		if f.hashing != nil {
+			continue
+		}
+		var b [8]byte
+		binary.LittleEndian.PutUint64(b[:], uint64(info.Size()))
+		hashes[i] = b[:]
+	}
+	if f.dir != nil {
+		if foundFile {
+			return ErrMismatchedTypes
+		}
+		return f.dirConsensus()
+	}
+	var diverged [][]int64
+	if f.hashing != nil && !foundDir {
+		cached, err := f.cachedHashes(sizes, hashes)
+		if !cached && err == nil {
+			if diverged, err = f.chunkHashes(sizes, hashes); err == nil {
+				f.storeHashes(sizes, hashes)
 			}
 		}
+		if errors.Is(err, errConsensusDeadline) {
+			return f.lateConsensus(nil, -1)
+		} else if err != nil {
+			return err
+		}
 	}
 
-	// TODO: handle directories
-
 	allEqual := true
 	for i := range hashes[:len(hashes)-1] {
 		if !bytes.Equal(hashes[i], hashes[i+1]) {
@@ -144,7 +447,11 @@ func (f *File) consensus() error {
 	// cool, we're already at consensus, moving on
 	if allEqual {
 		if f.appendOnly {
-			f.offset = sizes[0]
+			for i := range sizes {
+				if sizes[i] > f.offset {
+					f.offset = sizes[i]
+				}
+			}
 		}
 		return nil
 	}
@@ -158,117 +465,233 @@ func (f *File) consensus() error {
 		hashMatches[string(hashes[i])]++
 		if hashMatches[string(hashes[i])] >= f.quorum {
 			// we've reached a quorum, using the first file in the quorum list as the source of truth
-			return f.source(foundDir, i, hashes, sizes)
+			return f.source(foundDir, i, hashes, sizes, diverged)
 		}
 	}
 
-	// unable to reach quorum
-	if sourceSize == -1 {
-		return fmt.Errorf("unable to reach quorum in source")
+	// unable to reach quorum, optionally settle ties deterministically
+	if f.hashTieBreak {
+		sourceIndex = tieBreak(f.quorumFail, sourceIndex, hashes, sizes, modTimes)
+	}
+	if sourceIndex == -1 {
+		var voters int
+		for i := range hashes {
+			if hashes[i] != nil {
+				voters++
+			}
+		}
+		if voters < f.quorum {
+			return fmt.Errorf("only %d replicas could vote, %d needed: %w", voters, f.quorum, ErrNoQuorum)
+		}
+		return fmt.Errorf("%d replicas voted, no %d agreed: %w", voters, f.quorum, ErrDiverged)
 	}
-	return f.source(foundDir, sourceIndex, hashes, sizes)
+	return f.source(foundDir, sourceIndex, hashes, sizes, diverged)
 }
 
-func (f *File) source(isDir bool, index int, hashes [][]byte, sizes []int64) error {
+func (f *File) source(isDir bool, index int, hashes [][]byte, sizes []int64, diverged [][]int64) error {
 	if f.appendOnly {
 		f.offset = sizes[index]
 	}
-	var buf []byte
-	if !isDir {
-		buf = make([]byte, 1e6)
+
+	// read only and pinned files can't be repaired, stop reading from the replicas which disagree with the source instead
+	if f.readOnly || f.pinned {
+		for i := range f.multi {
+			if f.multi[i] != nil && i != index && !bytes.Equal(hashes[i], hashes[index]) {
+				f.markDirty(i, fmt.Errorf("replica %s differs from %s", f.paths[i], f.paths[index]))
+			}
+		}
+		return nil
 	}
 
+	var lagging []int
 	for i := range f.multi {
 		// check if already equal
 		if i == index || bytes.Equal(hashes[i], hashes[index]) {
 			continue
 		}
-		if isDir {
-			if err := os.MkdirAll(f.paths[i], f.perms); err != nil {
-				return fmt.Errorf("mkdir failed for %s: %w", f.paths[i], err)
-			}
-			continue
+		lagging = append(lagging, i)
+	}
+	index, lagging = f.planRepair(index, hashes, sizes, lagging)
+	if f.asyncRepair && len(lagging) > 0 {
+		return f.deferRepair(lagging, index)
+	}
+	errs := boundedEach(f.repairConcurrency, len(f.multi), lagging, func(i int) error {
+		if f.pastConsensusDeadline() {
+			return errConsensusDeadline
 		}
-		if f.multi[i] == nil {
-			var err error
-			f.multi[i], err = os.Create(f.paths[i])
-			if err != nil {
-				return fmt.Errorf("create failed for %s: %w", f.paths[i], err)
-			}
-			var n int64
-			n, err = io.Copy(f.multi[i], f.multi[index])
-			if err != nil && !errors.Is(err, io.EOF) {
-				return fmt.Errorf("copy failed for new file %s: %w", f.paths[i], err)
-			}
-			if n != sizes[index] {
-				return fmt.Errorf("copy failed for new file %s: %w", f.paths[i], io.ErrShortWrite)
-			}
-			continue
+		if err := f.aborted(); err != nil {
+			return err
 		}
-		if !f.appendOnly {
-			sizes[i] = 0
-			if err := f.multi[i].Truncate(0); err != nil {
-				return fmt.Errorf("trunc failed for existing file %s: %w", f.paths[i], err)
-			}
+		f.scheduler.acquire()
+		defer f.scheduler.release()
+		// replicas are only rewritten from the first chunk where they differ from the source
+		var from int64
+		if diverged != nil && diverged[i][index] > 0 {
+			from = diverged[i][index]
 		}
-		if sizes[i] > sizes[index] {
-			if err := f.multi[i].Truncate(sizes[index]); err != nil {
-				return fmt.Errorf("trunc failed for existing file %s: %w", f.paths[i], err)
-			}
+		return f.repair(isDir, i, index, sizes, from)
+	})
+	var late []int
+	for i, err := range errs {
+		if errors.Is(err, errConsensusDeadline) {
+			late = append(late, i)
 			continue
 		}
-		for sizes[i] < sizes[index] {
-			n, err := f.multi[index].ReadAt(buf, sizes[i])
-			if err != nil && !errors.Is(err, io.EOF) {
-				return fmt.Errorf("read failed for existing file %s: %w", f.paths[index], err)
-			}
+		if err != nil {
+			return err
+		}
+	}
+	if len(late) > 0 {
+		return f.lateConsensus(late, index)
+	}
+	return nil
+}
 
-			// TODO: this could be more efficient if we read once and write to many
-			p, err := f.multi[i].Write(buf[:n])
-			if err != nil {
-				return fmt.Errorf("write failed for existing file %s: %w", f.paths[i], err)
-			}
-			if p != n {
-				return fmt.Errorf("write failed for existing file %s: %w", f.paths[i], io.ErrShortWrite)
-			}
-			sizes[i] += int64(n)
+// repair brings replica i in line with the source replica at index, keeping anything before from
+func (f *File) repair(isDir bool, i, index int, sizes []int64, from int64) error {
+	if isDir {
+		if err := os.MkdirAll(f.paths[i], f.perms); err != nil {
+			return pathErr("mkdir", f.paths[i], err)
+		}
+		return nil
+	}
+	if f.canClone() && !f.appendOnly && f.blockSize == 0 && (f.multi[i] == nil || from == 0) {
+		if _, err := f.cloneReplica(i, index); err != nil {
+			return err
+		}
+		sizes[i] = sizes[index]
+		return nil
+	}
+	if f.multi[i] == nil {
+		var err error
+		f.mkdirParent(i)
+		f.multi[i], err = os.Create(f.paths[i])
+		if err != nil {
+			return pathErr("open", f.paths[i], err)
+		}
+		if err = f.syncParents(f.paths[i]); err != nil {
+			return err
+		}
+		sizes[i] = 0
+	} else if err := f.checkLinks(i); err != nil {
+		return err
+	}
+	if f.blockSize > 0 && !f.appendOnly {
+		return f.repairBlocks(i, index, sizes, from)
+	}
+	if !f.appendOnly {
+		if from > sizes[i] {
+			from = sizes[i]
+		}
+		if err := f.multi[i].Truncate(from); err != nil {
+			return pathErr("truncate", f.paths[i], err)
+		}
+		sizes[i] = from
+	}
+	if sizes[i] > sizes[index] {
+		if err := f.multi[i].Truncate(sizes[index]); err != nil {
+			return pathErr("truncate", f.paths[i], err)
 		}
+		return nil
+	}
+	var buf []byte
+	for sizes[i] < sizes[index] {
+		if f.pastConsensusDeadline() {
+			return errConsensusDeadline
+		}
+		if err := f.aborted(); err != nil {
+			return err
+		}
+		buf = f.chunkFor(buf, i, 1e6)
+		n, err := f.multi[index].ReadAt(buf, sizes[i])
+		if err != nil && !errors.Is(err, io.EOF) {
+			return pathErr("read", f.paths[index], err)
+		}
+		if n == 0 {
+			return pathErr("read", f.paths[index], io.ErrUnexpectedEOF)
+		}
+		f.scheduler.wait(n)
+
+		// TODO: this could be more efficient if we read once and write to many
+		start := time.Now()
+		p, err := f.multi[i].WriteAt(buf[:n], sizes[i])
+		f.copied(i, p, time.Since(start))
+		if err != nil {
+			return pathErr("write", f.paths[i], err)
+		}
+		if p != n {
+			return pathErr("write", f.paths[i], io.ErrShortWrite)
+		}
+		sizes[i] += int64(n)
 	}
 	return nil
 }
 
+// tieBreak picks the replica with the lexicographically smallest non-empty hash among those ranked equally by the quorum fail policy
+func tieBreak(qf QuorumFail, index int, hashes [][]byte, sizes []int64, modTimes []time.Time) int {
+	best := -1
+	for i := range hashes {
+		if modTimes[i].IsZero() {
+			continue
+		}
+		if index >= 0 && !sameRank(qf, i, index, sizes, modTimes) {
+			continue
+		}
+		switch {
+		case best == -1,
+			hashes[best] == nil && hashes[i] != nil,
+			hashes[i] != nil && bytes.Compare(hashes[i], hashes[best]) < 0:
+			best = i
+		}
+	}
+	if best == -1 {
+		return index
+	}
+	return best
+}
+
+func sameRank(qf QuorumFail, i, j int, sizes []int64, modTimes []time.Time) bool {
+	switch qf {
+	case QFWriteFirst, QFWriteLast:
+		return modTimes[i].Equal(modTimes[j])
+	case QFLongest, QFShortest, QFShortestNonZero:
+		return sizes[i] == sizes[j]
+	}
+	return i == j
+}
+
 type fileAgg struct {
-	qf    quorumFailEnum
+	qf    QuorumFail
 	index int
 	size  int64
 	time  time.Time
 }
 
-func isSourceOfTruth(info os.FileInfo, qf quorumFailEnum, i, index int, size int64, t time.Time) bool {
+func isSourceOfTruth(infoSize int64, modTime time.Time, qf QuorumFail, i, index int, size int64, t time.Time) bool {
 	switch qf {
 	case QFError:
 	case QFWriteFirst:
-		return info.ModTime().Before(t) || t.IsZero()
+		return modTime.Before(t) || t.IsZero()
 	case QFWriteLast:
-		return info.ModTime().After(t)
+		return modTime.After(t)
 	case QFOrderFirst:
 		return index < 0 || i < index
 	case QFOrderLast:
 		return i > index
 	case QFLongest:
-		return info.Size() > size
+		return infoSize > size
 	case QFShortest:
-		return size < 0 || info.Size() < size
+		return size < 0 || infoSize < size
 	case QFShortestNonZero:
-		return info.Size() > 0 && info.Size() < size
+		return infoSize > 0 && (size <= 0 || infoSize < size)
 	}
 	return false
 }
 
-type quorumFailEnum int
+type QuorumFail int
 
 const (
-	QFError = iota
+	QFError QuorumFail = iota
 	QFWriteFirst
 	QFWriteLast
 	QFOrderFirst
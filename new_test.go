@@ -2,6 +2,7 @@ package haraqafs
 
 import (
 	"bytes"
+	"crypto/sha256"
 	"errors"
 	"io"
 	"os"
@@ -139,3 +140,311 @@ func checkClose(t testing.TB, f io.Closer) {
 		t.Fatal(err)
 	}
 }
+
+func TestWithHashTieBreak(t *testing.T) {
+	const fileName = "my_file"
+	var volumes []string
+	var want []byte
+	for i, msg := range []string{"aaa", "bbb", "ccc"} {
+		v := newTmpVolume(t, "tie_break*")
+		defer os.RemoveAll(v)
+		checkErr(t, os.WriteFile(filepath.Join(v, fileName), []byte(msg), 0666))
+		volumes = append(volumes, v)
+		if sum := sha256.Sum256([]byte(msg)); i == 0 || bytes.Compare(sum[:], want) < 0 {
+			want = sum[:]
+		}
+	}
+
+	if _, err := New(fileName, WithVolumes(volumes...), WithHashing(sha256.New())); err == nil {
+		t.Fatal("expected error")
+	}
+
+	// regardless of volume order the same replica should win
+	var first []byte
+	for _, order := range [][]int{{0, 1, 2}, {2, 1, 0}, {1, 2, 0}} {
+		vols := []string{volumes[order[0]], volumes[order[1]], volumes[order[2]]}
+		f, err := New(fileName, WithVolumes(vols...), WithHashing(sha256.New()), WithHashTieBreak())
+		checkErr(t, err)
+		b := make([]byte, 3)
+		_, err = f.ReadAt(b, 0)
+		checkErr(t, err)
+		checkClose(t, f)
+		if sum := sha256.Sum256(b); !bytes.Equal(sum[:], want) {
+			t.Fatal(string(b))
+		}
+		if first == nil {
+			first = b
+		}
+		if !bytes.Equal(first, b) {
+			t.Fatal(string(first), string(b))
+		}
+	}
+}
+
+func TestQuorumSanity(t *testing.T) {
+	volumes := newTmpVolumes(t, 3)
+	defer removeVolumes(volumes)
+
+	_, err := New("my_file", WithQuorum(5), WithVolumes(volumes...), WithCreate())
+	var qErr *QuorumError
+	if !errors.As(err, &qErr) || qErr.Quorum != 5 || qErr.Volumes != 3 || !errors.Is(err, os.ErrInvalid) {
+		t.Fatal(err)
+	}
+	if _, err = New(filepath.Join(volumes[0], "my_file"), WithQuorum(2), WithCreate()); !errors.As(err, &qErr) {
+		t.Fatal(err)
+	}
+}
+
+func TestWithRepairConcurrency(t *testing.T) {
+	const fileName = "my_file"
+	volumes := newTmpVolumes(t, 4)
+	defer removeVolumes(volumes)
+
+	want := bytes.Repeat([]byte("hello"), 1e6)
+	checkErr(t, os.WriteFile(filepath.Join(volumes[0], fileName), want, 0666))
+	checkErr(t, os.WriteFile(filepath.Join(volumes[1], fileName), []byte("stale"), 0666))
+
+	f, err := New(fileName, WithVolumes(volumes...), WithCreateIfNotExist(), WithQuorum(4), WithQuorumFail(QFLongest), WithRepairConcurrency(3))
+	checkErr(t, err)
+	checkClose(t, f)
+	for _, v := range volumes {
+		b, err := os.ReadFile(filepath.Join(v, fileName))
+		checkErr(t, err)
+		if !bytes.Equal(b, want) {
+			t.Fatal(v, len(b))
+		}
+	}
+}
+
+func TestWithReadOnly(t *testing.T) {
+	const fileName = "my_file"
+	volumes := newTmpVolumes(t, 3)
+	defer removeVolumes(volumes)
+
+	for i, v := range volumes {
+		msg := "hello"
+		if i == 0 {
+			msg = "jello"
+		}
+		checkErr(t, os.WriteFile(filepath.Join(v, fileName), []byte(msg), 0444))
+	}
+
+	f, err := New(fileName, WithVolumes(volumes...), WithHashing(sha256.New()), WithReadOnly())
+	checkErr(t, err)
+	if f.health[0].state != replicaDirty {
+		t.Fatal(f.health[0].state)
+	}
+	for i := 0; i < 3; i++ {
+		checkSeek(t, f, 0, io.SeekStart)
+		checkRead(t, f, []byte("hello"))
+	}
+	if _, err = f.Write([]byte("hello")); !errors.Is(err, os.ErrPermission) {
+		t.Fatal(err)
+	}
+	if err = f.Truncate(0); !errors.Is(err, os.ErrPermission) {
+		t.Fatal(err)
+	}
+	checkClose(t, f)
+
+	// the diverged replica was left alone
+	b, err := os.ReadFile(filepath.Join(volumes[0], fileName))
+	checkErr(t, err)
+	if string(b) != "jello" {
+		t.Fatal(string(b))
+	}
+}
+
+func TestWithEmptyPolicy(t *testing.T) {
+	const fileName = "my_file"
+	volumes := newTmpVolumes(t, 3)
+	defer removeVolumes(volumes)
+	checkErr(t, os.WriteFile(filepath.Join(volumes[0], fileName), []byte("hello"), 0666))
+	checkErr(t, os.WriteFile(filepath.Join(volumes[1], fileName), nil, 0666))
+
+	// a missing replica doesn't vote for an empty file even though opening it creates one
+	for _, p := range []EmptyPolicy{EmptyAbstains, EmptyVotes} {
+		if _, err := New(fileName, WithVolumes(append([]string(nil), volumes...)...), WithCreateIfNotExist(), WithEmptyPolicy(p)); err == nil {
+			t.Fatal("expected error", p)
+		}
+		checkErr(t, os.Remove(filepath.Join(volumes[2], fileName)))
+	}
+
+	// two empty replicas outvote the one with content
+	checkErr(t, os.WriteFile(filepath.Join(volumes[2], fileName), nil, 0666))
+	if _, err := New(fileName, WithVolumes(append([]string(nil), volumes...)...), WithCreateIfNotExist()); err == nil {
+		t.Fatal("expected error")
+	}
+	f, err := New(fileName, WithVolumes(append([]string(nil), volumes...)...), WithCreateIfNotExist(), WithEmptyPolicy(EmptyVotes))
+	checkErr(t, err)
+	checkClose(t, f)
+	for _, v := range volumes {
+		info, err := os.Stat(filepath.Join(v, fileName))
+		checkErr(t, err)
+		if info.Size() != 0 {
+			t.Fatal(v, info.Size())
+		}
+	}
+}
+
+func TestConsensusErrors(t *testing.T) {
+	const fileName = "my_file"
+	volumes := newTmpVolumes(t, 3)
+	defer removeVolumes(volumes)
+	open := func(opts ...FileOption) error {
+		opts = append(opts, WithVolumes(append([]string(nil), volumes...)...), WithHashing(sha256.New()))
+		f, err := New(fileName, opts...)
+		if err == nil {
+			checkClose(t, f)
+		}
+		return err
+	}
+
+	checkErr(t, os.WriteFile(filepath.Join(volumes[0], fileName), []byte("hello"), 0666))
+	if err := open(); !errors.Is(err, ErrNoQuorum) || !errors.Is(err, os.ErrNotExist) {
+		t.Fatal(err)
+	}
+	checkErr(t, os.WriteFile(filepath.Join(volumes[1], fileName), nil, 0666))
+	checkErr(t, os.WriteFile(filepath.Join(volumes[2], fileName), nil, 0666))
+	if err := open(); !errors.Is(err, ErrNoQuorum) {
+		t.Fatal(err)
+	}
+	checkErr(t, os.WriteFile(filepath.Join(volumes[1], fileName), []byte("jello"), 0666))
+	checkErr(t, os.WriteFile(filepath.Join(volumes[2], fileName), []byte("cello"), 0666))
+	if err := open(); !errors.Is(err, ErrDiverged) {
+		t.Fatal(err)
+	}
+	checkErr(t, os.Remove(filepath.Join(volumes[2], fileName)))
+	checkErr(t, os.Mkdir(filepath.Join(volumes[2], fileName), 0777))
+	if err := open(WithReadOnly()); !errors.Is(err, ErrMismatchedTypes) || !errors.Is(err, os.ErrInvalid) {
+		t.Fatal(err)
+	}
+}
+
+func TestCreateTruncatesAtQuorum(t *testing.T) {
+	const fileName = "my_file"
+	volumes := newTmpVolumes(t, 3)
+	defer removeVolumes(volumes)
+	for _, v := range volumes[:2] {
+		checkErr(t, os.WriteFile(filepath.Join(v, fileName), []byte("hello"), 0666))
+	}
+	// a directory can't be opened for writing
+	checkErr(t, os.Mkdir(filepath.Join(volumes[2], fileName), 0777))
+
+	// without a quorum nothing is truncated
+	if _, err := New(fileName, WithVolumes(append([]string(nil), volumes...)...), WithCreate(), WithQuorum(3)); !errors.Is(err, ErrNoQuorum) {
+		t.Fatal(err)
+	}
+	for _, v := range volumes[:2] {
+		b, err := os.ReadFile(filepath.Join(v, fileName))
+		checkErr(t, err)
+		if string(b) != "hello" {
+			t.Fatal(v, string(b))
+		}
+	}
+
+	f, err := New(fileName, WithVolumes(append([]string(nil), volumes...)...), WithCreate(), WithQuorum(2))
+	checkErr(t, err)
+	checkClose(t, f)
+	for _, v := range volumes[:2] {
+		info, err := os.Stat(filepath.Join(v, fileName))
+		checkErr(t, err)
+		if info.Size() != 0 {
+			t.Fatal(v, info.Size())
+		}
+	}
+}
+
+func TestNewDirectory(t *testing.T) {
+	volumes := newTmpVolumes(t, 3)
+	defer removeVolumes(volumes)
+	for _, v := range volumes[:2] {
+		checkErr(t, os.MkdirAll(filepath.Join(v, "dir", "sub"), 0777))
+		checkErr(t, os.WriteFile(filepath.Join(v, "dir", "a"), []byte("hello"), 0666))
+	}
+	checkErr(t, os.WriteFile(filepath.Join(volumes[0], "dir", "stray"), []byte("junk"), 0666))
+
+	// read only directories are listed without being repaired
+	f, err := New("dir", WithVolumes(volumes...), WithReadOnly())
+	checkErr(t, err)
+	entries, err := f.ReadDir(-1)
+	checkErr(t, err)
+	if len(entries) != 2 || entries[0].Name() != "a" || entries[1].Name() != "sub" {
+		t.Fatal(entries)
+	}
+	checkClose(t, f)
+	if _, err := os.Stat(filepath.Join(volumes[2], "dir")); !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+
+	f, err = New("dir", WithVolumes(volumes...), WithCreateIfNotExist())
+	checkErr(t, err)
+	if entries, err = f.ReadDir(1); err != nil || len(entries) != 1 || entries[0].Name() != "a" {
+		t.Fatal(entries, err)
+	}
+	if entries, err = f.ReadDir(1); err != nil || len(entries) != 1 || entries[0].Name() != "sub" {
+		t.Fatal(entries, err)
+	}
+	if _, err = f.ReadDir(1); err != io.EOF {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(filepath.Join(volumes[2], "dir", "a"))
+	checkErr(t, err)
+	if string(b) != "hello" {
+		t.Fatal(string(b))
+	}
+	if info, err := os.Stat(filepath.Join(volumes[2], "dir", "sub")); err != nil || !info.IsDir() {
+		t.Fatal(info, err)
+	}
+
+	wd, err := os.Getwd()
+	checkErr(t, err)
+	defer func() { checkErr(t, os.Chdir(wd)) }()
+	checkErr(t, f.Chdir())
+	if _, err := os.Stat("a"); err != nil {
+		t.Fatal(err)
+	}
+	checkClose(t, f)
+}
+
+func TestWithMkdirAll(t *testing.T) {
+	volumes := newTmpVolumes(t, 3)
+	defer removeVolumes(volumes)
+
+	if _, err := New("a/b/c", WithVolumes(volumes...), WithCreate()); !errors.Is(err, os.ErrNotExist) {
+		t.Fatal(err)
+	}
+	f, err := New("a/b/c", WithVolumes(volumes...), WithCreate(), WithMkdirAll(), WithDirPerms(0750))
+	checkErr(t, err)
+	checkWrite(t, f, []byte("hello"))
+	checkClose(t, f)
+	for _, v := range volumes {
+		info, err := os.Stat(filepath.Join(v, "a", "b"))
+		checkErr(t, err)
+		if info.Mode().Perm() != 0750 {
+			t.Fatal(info.Mode())
+		}
+	}
+
+	// replicas repaired onto a volume which lost the tree get their parents back too
+	checkErr(t, os.RemoveAll(filepath.Join(volumes[2], "a")))
+	f, err = New("a/b/c", WithVolumes(volumes...), WithMkdirAll())
+	checkErr(t, err)
+	checkClose(t, f)
+	b, err := os.ReadFile(filepath.Join(volumes[2], "a", "b", "c"))
+	checkErr(t, err)
+	if string(b) != "hello" {
+		t.Fatal(string(b))
+	}
+	if err := WithDirPerms(os.ModeDir | 0777)(&File{}); !errors.Is(err, os.ErrInvalid) {
+		t.Fatal(err)
+	}
+
+	// the lock directories of WithExclusive need the parents first, and missing ones aren't a held lock
+	f, err = New("x/y/z", WithVolumes(volumes...), WithCreate(), WithMkdirAll(), WithExclusive())
+	checkErr(t, err)
+	checkWrite(t, f, []byte("hello"))
+	checkClose(t, f)
+	if _, err = New("p/q", WithVolumes(volumes...), WithCreate(), WithExclusive()); errors.Is(err, ErrLocked) || !errors.Is(err, os.ErrNotExist) {
+		t.Fatal(err)
+	}
+}
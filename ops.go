@@ -0,0 +1,332 @@
+package haraqafs
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// Remove removes the replicas of a file or empty directory along with their sidecars, replicas which are already missing count as removed
+// as long as a quorum held it, otherwise it fails with fs.ErrNotExist.
+// the replicas are moved aside first, so when too few can be moved the ones already moved are put back. replicas the
+// remove itself fails on are put back too, and when that leaves fewer than a quorum removed a *RemoveError lists them
+func Remove(name string, opts ...FileOption) error {
+	return removeReplicas("remove", name, opts, os.Remove, true)
+}
+
+// RemoveAll removes the replicas of a file or directory and everything under them, with the same quorum and rollback as Remove.
+// like os.RemoveAll, a name which doesn't exist isn't an error
+func RemoveAll(name string, opts ...FileOption) error {
+	return removeReplicas("remove", name, opts, os.RemoveAll, false)
+}
+
+// Rename moves the replicas of a file or directory to newname, taking the sidecars of a file with them. both names have to be
+// placed on the same volumes, each replica moves within its own. replicas which are already missing count as renamed as long as
+// a quorum held oldname, otherwise it fails with fs.ErrNotExist. when too few can be renamed the ones already moved are moved
+// back, along with whatever they replaced
+func Rename(oldname, newname string, opts ...FileOption) error {
+	f, err := placement(opts)
+	if err != nil {
+		return err
+	}
+	volumes, from, err := f.placeReplicas(oldname)
+	if err != nil {
+		return err
+	}
+	toVolumes, placed, err := f.placeReplicas(newname)
+	if err != nil {
+		return err
+	}
+	to := make([]string, len(from))
+	for i, v := range volumes {
+		for j := range toVolumes {
+			if toVolumes[j] == v {
+				to[i] = placed[j]
+			}
+		}
+		if to[i] == "" || len(toVolumes) != len(volumes) {
+			return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: errCrossPlacement}
+		}
+	}
+	for _, p := range append(append([]string(nil), from...), to...) {
+		if pinnedUnder(p) {
+			return &fs.PathError{Op: "rename", Path: p, Err: ErrPinned}
+		}
+	}
+
+	var errs []error
+	var moves []*replicaMove
+	var missing int
+	for i := range from {
+		if _, err := os.Lstat(from[i]); errors.Is(err, os.ErrNotExist) {
+			missing++
+			continue
+		}
+		// the shard directories of a new name are only made by opening it
+		if f.shardLevels > 0 {
+			_ = os.MkdirAll(filepath.Dir(to[i]), f.dirPerm())
+		}
+		m, err := moveReplica(from[i], to[i])
+		if err != nil {
+			errs = append(errs, fmt.Errorf("rename failed for %s: %w", from[i], err))
+			continue
+		}
+		moves = append(moves, m)
+		// a rename which might not survive a power loss doesn't count towards the quorum
+		if err := f.syncParents(from[i], to[i]); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	switch {
+	case len(from)-missing < f.quorum:
+		errs = []error{&os.LinkError{Op: "rename", Old: oldname, New: newname, Err: fs.ErrNotExist}}
+	case len(from)-len(errs) >= f.quorum:
+		for _, m := range moves {
+			m.settle()
+		}
+		return nil
+	}
+	for _, m := range moves {
+		if err := m.undo(); err != nil {
+			errs = append(errs, fmt.Errorf("rollback failed for %s: %w", m.to, err))
+		}
+	}
+	return aggErrors(errs)
+}
+
+// Mkdir creates a directory on every volume, failing with os.ErrExist when a quorum already hold it.
+// when too few can be created the ones which were are removed again
+func Mkdir(name string, perm os.FileMode, opts ...FileOption) error {
+	f, err := placement(opts)
+	if err != nil {
+		return err
+	}
+	paths, err := f.placePaths(name)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	var created []string
+	var existed int
+	for _, p := range paths {
+		err := os.Mkdir(p, perm)
+		switch {
+		case err == nil:
+			created = append(created, p)
+			if err := f.syncParents(p); err != nil {
+				errs = append(errs, err)
+			}
+		case errors.Is(err, os.ErrExist) && isDir(p):
+			existed++
+		default:
+			errs = append(errs, fmt.Errorf("mkdir failed for %s: %w", p, err))
+		}
+	}
+	if existed >= f.quorum {
+		errs = []error{&fs.PathError{Op: "mkdir", Path: name, Err: os.ErrExist}}
+	} else if len(paths)-len(errs) >= f.quorum {
+		return nil
+	}
+	for _, p := range created {
+		if err := os.Remove(p); err != nil {
+			errs = append(errs, fmt.Errorf("rollback failed for %s: %w", p, err))
+		}
+	}
+	return aggErrors(errs)
+}
+
+// MkdirAll creates a directory and any missing parents on every volume.
+// when too few can be created the directories it created are removed again
+func MkdirAll(name string, perm os.FileMode, opts ...FileOption) error {
+	f, err := placement(opts)
+	if err != nil {
+		return err
+	}
+	paths, err := f.placePaths(name)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	var created [][]string
+	for _, p := range paths {
+		missing := missingDirs(p)
+		if err := os.MkdirAll(p, perm); err != nil {
+			errs = append(errs, fmt.Errorf("mkdir failed for %s: %w", p, err))
+		} else if err := f.syncParents(missing...); err != nil {
+			errs = append(errs, err)
+		}
+		// a failed MkdirAll may still have created some parents
+		created = append(created, missing)
+	}
+	if len(paths)-len(errs) >= f.quorum {
+		return nil
+	}
+	for _, missing := range created {
+		for _, p := range missing {
+			if err := os.Remove(p); err != nil && !errors.Is(err, os.ErrNotExist) {
+				errs = append(errs, fmt.Errorf("rollback failed for %s: %w", p, err))
+			}
+		}
+	}
+	return aggErrors(errs)
+}
+
+// placement reads the volumes and quorum out of opts, shard directories are never created
+func placement(opts []FileOption) (*File, error) {
+	f, err := settings(opts)
+	if err != nil {
+		return nil, err
+	}
+	f.flags = os.O_RDONLY
+	return f, nil
+}
+
+// placeVolumes returns the volumes name is placed on before any rebinds
+func (f *File) placeVolumes(name string) []string {
+	if f.ring != nil {
+		return f.ring.Locate(name, f.ringReplicas)
+	}
+	return f.volumes
+}
+
+// placePaths returns the replica paths of name
+func (f *File) placePaths(name string) ([]string, error) {
+	_, paths, err := f.placeReplicas(name)
+	return paths, err
+}
+
+// placeReplicas returns the volumes name is placed on and its replica path on each
+func (f *File) placeReplicas(name string) ([]string, []string, error) {
+	name, err := logicalName("resolve", name)
+	if err != nil {
+		return nil, nil, err
+	}
+	if f.account != nil && internalName(filepath.Base(name)) {
+		return nil, nil, &fs.PathError{Op: "resolve", Path: name, Err: fs.ErrPermission}
+	}
+	volumes, err := f.placement.resolve(name, f.placeVolumes(name))
+	if err != nil {
+		return nil, nil, err
+	}
+	paths := f.replicaPaths(volumes, f.jailName(name))
+	return volumes, paths, f.checkJail(volumes, paths)
+}
+
+// removeReplicas moves every replica of name aside, then removes them with rm once a quorum are out of the way.
+// with mustExist a name fewer than a quorum hold fails with fs.ErrNotExist. the namespace account is credited for
+// what was removed, and a *RemoveError reports which replicas were removed when rm took fewer than a quorum
+func removeReplicas(op, name string, opts []FileOption, rm func(string) error, mustExist bool) error {
+	f, err := placement(opts)
+	if err != nil {
+		return err
+	}
+	paths, err := f.placePaths(name)
+	if err != nil {
+		return err
+	}
+	for _, p := range paths {
+		if pinnedUnder(p) {
+			return &fs.PathError{Op: op, Path: p, Err: ErrPinned}
+		}
+	}
+
+	var held Usage
+	if f.account != nil {
+		held = measure(paths)
+	}
+
+	var errs []error
+	var missing int
+	var kept []string
+	aside := make([]string, len(paths))
+	for i, p := range paths {
+		tmp := asidePath(p)
+		if err := os.Rename(p, tmp); err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				missing++
+			} else {
+				kept = append(kept, p)
+				errs = append(errs, fmt.Errorf("%s failed for %s: %w", op, p, err))
+			}
+			continue
+		}
+		aside[i] = tmp
+	}
+	failed := len(errs)
+	if mustExist && len(paths)-missing < f.quorum {
+		errs = []error{&fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}}
+		failed = len(paths)
+	}
+	if len(paths)-failed < f.quorum {
+		for i, tmp := range aside {
+			if tmp == "" {
+				continue
+			}
+			if err := os.Rename(tmp, paths[i]); err != nil {
+				errs = append(errs, fmt.Errorf("rollback failed for %s: %w", paths[i], err))
+			}
+		}
+		return aggErrors(errs)
+	}
+
+	// replicas rm refuses, like directories which aren't empty, go back where they were.
+	// the ones rm took can't come back, so falling short of a quorum here is reported as a partial removal
+	var removed []string
+	var syncErrs []error
+	for i, tmp := range aside {
+		if tmp == "" {
+			continue
+		}
+		if err := rm(tmp); err != nil {
+			kept = append(kept, paths[i])
+			errs = append(errs, fmt.Errorf("%s failed for %s: %w", op, paths[i], err))
+			if err := os.Rename(tmp, paths[i]); err != nil {
+				errs = append(errs, fmt.Errorf("rollback failed for %s: %w", paths[i], err))
+			}
+			continue
+		}
+		removed = append(removed, paths[i])
+		if err := removeSidecars(paths[i]); err != nil {
+			errs = append(errs, fmt.Errorf("%s failed for %s: %w", op, paths[i], err))
+		}
+		// the replica is gone even when its parent couldn't be synced
+		if err := f.syncParents(paths[i]); err != nil {
+			syncErrs = append(syncErrs, err)
+		}
+	}
+	if f.account != nil && len(removed) > 0 {
+		// a quorum removed the name, short of one the ledger keeps whatever the replicas left in place still hold
+		var left Usage
+		if len(removed)+missing < f.quorum {
+			left = measure(kept)
+		}
+		if err := f.account.charge(left.Bytes-held.Bytes, left.Files-held.Files); err != nil {
+			syncErrs = append(syncErrs, err)
+		}
+	}
+	if len(removed)+missing < f.quorum {
+		return &RemoveError{Op: op, Name: name, Removed: removed, Kept: kept, Err: aggErrors(append(errs, syncErrs...))}
+	}
+	return aggErrors(syncErrs)
+}
+
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+// missingDirs returns path and those of its parents which don't exist yet, deepest first
+func missingDirs(path string) []string {
+	var missing []string
+	for p := filepath.Clean(path); ; p = filepath.Dir(p) {
+		if _, err := os.Lstat(p); !errors.Is(err, os.ErrNotExist) {
+			return missing
+		}
+		missing = append(missing, p)
+		if filepath.Dir(p) == p {
+			return missing
+		}
+	}
+}
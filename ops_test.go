@@ -0,0 +1,140 @@
+package haraqafs
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPathOps(t *testing.T) {
+	volumes := newTmpVolumes(t, 3)
+	defer removeVolumes(volumes)
+	exists := func(name string, want ...bool) {
+		t.Helper()
+		for i, v := range volumes {
+			if _, err := os.Lstat(filepath.Join(v, name)); (err == nil) != want[i] {
+				t.Fatal(name, v, err)
+			}
+		}
+	}
+
+	checkErr(t, MkdirAll("a/b", 0777, WithVolumes(volumes...)))
+	exists("a/b", true, true, true)
+	if err := Mkdir("a", 0777, WithVolumes(volumes...)); !errors.Is(err, os.ErrExist) {
+		t.Fatal(err)
+	}
+
+	// a file in the way on one volume fails a mkdir needing every replica, the others are rolled back
+	checkErr(t, os.WriteFile(filepath.Join(volumes[2], "c"), nil, 0666))
+	if err := Mkdir("c", 0777, WithVolumes(volumes...), WithQuorum(3)); err == nil {
+		t.Fatal("mkdir succeeded")
+	}
+	exists("c", false, false, true)
+	checkErr(t, os.Remove(filepath.Join(volumes[2], "c")))
+	if err := MkdirAll("a/d/e", 0777, WithVolumes(volumes...), WithQuorum(3)); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := New("a/file", WithVolumes(volumes...), WithCreate(), WithVerifiedReads())
+	checkErr(t, err)
+	checkWrite(t, f, []byte("hello"))
+	checkClose(t, f)
+
+	// renaming over a directory which isn't empty fails on one volume and is moved back
+	checkErr(t, os.MkdirAll(filepath.Join(volumes[1], "a", "moved", "x"), 0777))
+	if err := Rename("a/file", "a/moved", WithVolumes(volumes...), WithQuorum(3)); err == nil {
+		t.Fatal("rename succeeded")
+	}
+	exists("a/file", true, true, true)
+	exists("a/file"+digestSuffix, true, true, true)
+	checkErr(t, os.RemoveAll(filepath.Join(volumes[1], "a", "moved")))
+	checkErr(t, Rename("a/file", "a/moved", WithVolumes(volumes...)))
+	exists("a/file", false, false, false)
+	exists("a/moved"+digestSuffix, true, true, true)
+
+	if err := Remove("a", WithVolumes(volumes...)); err == nil {
+		t.Fatal("removed a directory which isn't empty")
+	}
+	exists("a/moved", true, true, true)
+	checkErr(t, Remove("a/moved", WithVolumes(volumes...)))
+	exists("a/moved", false, false, false)
+	exists("a/moved"+digestSuffix, false, false, false)
+	checkErr(t, RemoveAll("a", WithVolumes(volumes...)))
+	exists("a", false, false, false)
+
+	// a directory removed from fewer than a quorum reports what it took
+	checkErr(t, MkdirAll("p", 0777, WithVolumes(volumes...)))
+	for _, v := range volumes[1:] {
+		checkErr(t, os.WriteFile(filepath.Join(v, "p", "x"), nil, 0666))
+	}
+	var rErr *RemoveError
+	if err := Remove("p", WithVolumes(volumes...)); !errors.As(err, &rErr) || len(rErr.Removed) != 1 || len(rErr.Kept) != 2 {
+		t.Fatal(err)
+	}
+	exists("p", false, true, true)
+	checkErr(t, RemoveAll("p", WithVolumes(volumes...)))
+
+	// names a quorum don't hold don't exist
+	if err := Remove("a", WithVolumes(volumes...)); !errors.Is(err, os.ErrNotExist) {
+		t.Fatal(err)
+	}
+	if err := Rename("a", "b", WithVolumes(volumes...)); !errors.Is(err, os.ErrNotExist) {
+		t.Fatal(err)
+	}
+	checkErr(t, RemoveAll("a", WithVolumes(volumes...)))
+	for _, v := range volumes {
+		entries, err := os.ReadDir(v)
+		checkErr(t, err)
+		if len(entries) != 0 {
+			t.Fatal(entries)
+		}
+	}
+}
+
+func TestRenameRollback(t *testing.T) {
+	volumes := newTmpVolumes(t, 3)
+	defer removeVolumes(volumes)
+	for _, name := range []string{"from", "to"} {
+		f, err := New(name, WithVolumes(volumes...), WithCreate(), WithVerifiedReads())
+		checkErr(t, err)
+		checkWrite(t, f, []byte(name))
+		checkClose(t, f)
+	}
+
+	// the files and sidecars a failed rename replaced are put back
+	checkErr(t, os.Remove(filepath.Join(volumes[2], "to")))
+	checkErr(t, os.MkdirAll(filepath.Join(volumes[2], "to", "x"), 0777))
+	if err := Rename("from", "to", WithVolumes(volumes...), WithQuorum(3)); err == nil {
+		t.Fatal("rename succeeded")
+	}
+	for _, v := range volumes[:2] {
+		for _, name := range []string{"from", "to"} {
+			b, err := os.ReadFile(filepath.Join(v, name))
+			checkErr(t, err)
+			if string(b) != name {
+				t.Fatal(v, name, string(b))
+			}
+			if _, err := os.Stat(filepath.Join(v, name+digestSuffix)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	// sharded names get their directories, names placed on different volumes can't be renamed
+	checkErr(t, Rename("from", "sharded", WithVolumes(volumes...), WithSharding(2)))
+	f, err := New("sharded", WithVolumes(volumes...), WithSharding(2))
+	checkErr(t, err)
+	checkRead(t, f, []byte("from"))
+	checkClose(t, f)
+	ring, err := NewRing(16, volumes...)
+	checkErr(t, err)
+	for _, name := range []string{"a", "b", "c", "d", "e", "f", "g", "h"} {
+		if err = Rename("to", name, WithRing(ring, 1), WithQuorum(1)); errors.Is(err, os.ErrInvalid) {
+			break
+		}
+	}
+	if !errors.Is(err, os.ErrInvalid) {
+		t.Fatal(err)
+	}
+}
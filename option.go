@@ -1,12 +1,14 @@
 package haraqafs
 
 import (
+	"context"
 	"fmt"
 	"hash"
 	"os"
 	"path/filepath"
 	"sync"
 	"sync/atomic"
+	"time"
 )
 
 type FileOption func(f *File) error
@@ -21,6 +23,30 @@ func WithQuorum(n int) FileOption {
 	}
 }
 
+// WithWriteQuorum lets writes succeed once n replicas took them, the replicas which failed are marked dirty and healed in the background.
+// the quorum used to reach consensus when opening is still set with WithQuorum
+func WithWriteQuorum(n int) FileOption {
+	return func(f *File) error {
+		if n <= 0 {
+			return fmt.Errorf("write quorum must be greater than 0: %w", os.ErrInvalid)
+		}
+		f.writeQ = n
+		return nil
+	}
+}
+
+// WithReadQuorum makes reads compare n replicas and only return content they agree on, failing with ErrNoMajority otherwise.
+// a read quorum plus a write quorum larger than the number of replicas means every read sees the latest write
+func WithReadQuorum(n int) FileOption {
+	return func(f *File) error {
+		if n <= 0 {
+			return fmt.Errorf("read quorum must be greater than 0: %w", os.ErrInvalid)
+		}
+		f.readQ = n
+		return nil
+	}
+}
+
 func WithFlags(flags int) FileOption {
 	return func(f *File) error {
 		// we need to be able to read & write files to open & sync
@@ -32,6 +58,16 @@ func WithFlags(flags int) FileOption {
 		}
 
 		f.flags = flags
+		f.readOnly = false
+		return nil
+	}
+}
+
+// WithReadOnly opens every replica read only, replicas which disagree with consensus are skipped rather than repaired
+func WithReadOnly() FileOption {
+	return func(f *File) error {
+		f.flags = os.O_RDONLY
+		f.readOnly = true
 		return nil
 	}
 }
@@ -40,6 +76,7 @@ func WithCreate() FileOption {
 	return func(f *File) error {
 		f.flags = os.O_RDWR | os.O_CREATE | os.O_TRUNC
 		f.perms = 0666
+		f.readOnly = false
 		return nil
 	}
 }
@@ -48,6 +85,7 @@ func WithCreateIfNotExist() FileOption {
 	return func(f *File) error {
 		f.flags = os.O_RDWR | os.O_CREATE
 		f.perms = 0666
+		f.readOnly = false
 		return nil
 	}
 }
@@ -70,6 +108,63 @@ func WithVolumes(volumes ...string) FileOption {
 	}
 }
 
+type Volume struct {
+	Path       string   `json:"path"`
+	Flags      int      `json:"flags,omitempty"`
+	Sync       SyncMode `json:"sync,omitempty"`
+	ReadWeight int      `json:"read_weight,omitempty"`
+	// Tier groups volumes of the same kind of storage, see FS.Tier
+	Tier string `json:"tier,omitempty"`
+}
+
+// SyncMode overrides, for a single volume, whether the file's SyncPolicy syncs each write
+type SyncMode int
+
+const (
+	// SyncDefault syncs writes when the SyncPolicy does
+	SyncDefault SyncMode = iota
+	// SyncAlways syncs every write to the volume, even under SyncBarrier or SyncNone
+	SyncAlways
+	// SyncNever never syncs writes to the volume, Sync and Barrier still sync it unless the policy is SyncNone
+	SyncNever
+)
+
+func WithVolumeSpecs(specs ...Volume) FileOption {
+	volumes := make([]string, len(specs))
+	for i := range specs {
+		volumes[i] = specs[i].Path
+	}
+	withVolumes := WithVolumes(volumes...)
+	for i := range specs {
+		specs[i].Path = volumes[i]
+	}
+	return func(f *File) error {
+		if err := withVolumes(f); err != nil {
+			return err
+		}
+		f.specs = specs
+		return nil
+	}
+}
+
+// applyScratch applies opts to f, a file which is only read back for its configuration and never opened,
+// so the slices WithVolumes took from the pools are handed straight back
+func applyScratch(f *File, opts []FileOption) error {
+	defer func() {
+		if f.paths != nil {
+			pathPool.Put(f.paths[:0])
+			filePool.Put(f.multi[:0])
+			f.paths, f.multi = nil, nil
+		}
+	}()
+	for _, opt := range opts {
+		if err := opt(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 var (
 	volumeMax int64 = 1
 
@@ -101,9 +196,417 @@ func WithAppendOnly(appendOnly bool) FileOption {
 	}
 }
 
+// WithFraming wraps every write to an append only file in a checksummed record,
+// so a torn write at the end of a replica is detected and cut off when the file is next opened
+func WithFraming() FileOption {
+	return func(f *File) error {
+		f.framing = true
+		return nil
+	}
+}
+
+// WithTornPolicy picks how a framed replica with a torn tail is handled on open, the default is TruncateTorn
+func WithTornPolicy(p TornPolicy) FileOption {
+	return func(f *File) error {
+		if p < TruncateTorn || p > QuarantineTorn {
+			return fmt.Errorf("unknown torn policy %d: %w", p, os.ErrInvalid)
+		}
+		f.tornPolicy = p
+		return nil
+	}
+}
+
+// WithChangeDetection checks the replicas for changes made outside of the file before reads, at most once per every,
+// and re-runs consensus when one was modified, replaced or removed. an every of zero checks before every read,
+// read only files are never checked
+func WithChangeDetection(every time.Duration) FileOption {
+	return func(f *File) error {
+		if every < 0 {
+			return fmt.Errorf("negative change detection interval: %w", os.ErrInvalid)
+		}
+		f.detectChanges = true
+		f.checkEvery = every
+		return nil
+	}
+}
+
+// WithVerifiedReads keeps a sidecar of block checksums next to every replica and checks each read against it,
+// falling back to the next replica when the blocks covering the read don't match
+func WithVerifiedReads() FileOption {
+	return func(f *File) error {
+		f.verifiedReads = true
+		return nil
+	}
+}
+
+// WithMmap maps every replica into memory for fixed size files with lots of small random updates,
+// writes inside the file are copied into the mappings and only reach disk once Msync is called or the kernel writes them back
+func WithMmap() FileOption {
+	return func(f *File) error {
+		f.mmap = true
+		return nil
+	}
+}
+
+// WithConsensusDeadline bounds how long New spends comparing and repairing replicas, late decides what happens when it runs out
+func WithConsensusDeadline(d time.Duration, late LateConsensus) FileOption {
+	return func(f *File) error {
+		if d <= 0 {
+			return fmt.Errorf("consensus deadline must be positive: %w", os.ErrInvalid)
+		}
+		if late < LateError || late > LateHeal {
+			return fmt.Errorf("unknown late consensus policy %d: %w", late, os.ErrInvalid)
+		}
+		f.consensusDeadline = d
+		f.consensusLate = late
+		return nil
+	}
+}
+
+// WithEmptyPolicy picks whether replicas which exist but are empty vote for an empty file during consensus, the default is EmptyAbstains
+func WithEmptyPolicy(p EmptyPolicy) FileOption {
+	return func(f *File) error {
+		if p < EmptyAbstains || p > EmptyVotes {
+			return fmt.Errorf("unknown empty policy %d: %w", p, os.ErrInvalid)
+		}
+		f.emptyPolicy = p
+		return nil
+	}
+}
+
+// WithForceSync syncs every write with its metadata when sync is set, and only on Sync or Barrier otherwise.
+// Deprecated: use WithSyncPolicy with SyncWrite or SyncBarrier
 func WithForceSync(sync bool) FileOption {
 	return func(f *File) error {
-		f.forceSync = sync
+		f.syncPolicy = SyncBarrier
+		if sync {
+			f.syncPolicy = SyncWrite
+		}
+		return nil
+	}
+}
+
+func WithSharding(levels int) FileOption {
+	return func(f *File) error {
+		if levels < 0 || levels > maxShardLevels {
+			return fmt.Errorf("shard levels must be between 0 and %d: %w", maxShardLevels, os.ErrInvalid)
+		}
+		f.shardLevels = levels
+		return nil
+	}
+}
+
+func WithRing(r *Ring, replicas int) FileOption {
+	return func(f *File) error {
+		if r == nil || replicas <= 0 {
+			return fmt.Errorf("ring requires at least 1 replica: %w", os.ErrInvalid)
+		}
+		if replicas > len(r.volumes) {
+			return fmt.Errorf("ring has %d volumes, fewer than %d replicas: %w", len(r.volumes), replicas, os.ErrInvalid)
+		}
+		if int64(replicas) > atomic.LoadInt64(&volumeMax) {
+			atomic.StoreInt64(&volumeMax, int64(replicas))
+		}
+		f.ring = r
+		f.ringReplicas = replicas
+		return nil
+	}
+}
+
+func WithQuorumFail(qf QuorumFail) FileOption {
+	return func(f *File) error {
+		if qf < QFError || qf > QFShortestNonZero {
+			return fmt.Errorf("unknown quorum fail policy %d: %w", qf, os.ErrInvalid)
+		}
+		f.quorumFail = qf
+		return nil
+	}
+}
+
+func WithClock(c Clock) FileOption {
+	return func(f *File) error {
+		if c == nil {
+			return fmt.Errorf("missing clock: %w", os.ErrInvalid)
+		}
+		f.clock = c
+		return nil
+	}
+}
+
+func WithHashTieBreak() FileOption {
+	return func(f *File) error {
+		f.hashTieBreak = true
+		return nil
+	}
+}
+
+func WithStats(s *Stats) FileOption {
+	return func(f *File) error {
+		f.stats = s
+		return nil
+	}
+}
+
+// WithSlowReplicaDetection degrades replicas whose p99 latency exceeds factor times their peers while quorum allows
+func WithSlowReplicaDetection(factor float64) FileOption {
+	return func(f *File) error {
+		if factor <= 1 {
+			return fmt.Errorf("slow replica factor must be greater than 1: %w", os.ErrInvalid)
+		}
+		f.slowFactor = factor
+		return nil
+	}
+}
+
+func WithEvents(fn func(Event)) FileOption {
+	return func(f *File) error {
+		f.events = fn
+		return nil
+	}
+}
+
+// WithMiddleware wraps every read, write and Barrier on the file, for metrics, throttling, tracing or validation
+func WithMiddleware(m ...Middleware) FileOption {
+	return func(f *File) error {
+		for _, m := range m {
+			if m == nil {
+				return fmt.Errorf("nil middleware: %w", os.ErrInvalid)
+			}
+		}
+		f.middleware = append(f.middleware, m...)
+		return nil
+	}
+}
+
+// WithWriteValidator checks every write before it touches any replica, an error from fn rejects the write,
+// so invariants like record alignment or magic bytes hold on every replica alike
+func WithWriteValidator(fn func(b []byte, off int64) error) FileOption {
+	return func(f *File) error {
+		if fn == nil {
+			return fmt.Errorf("nil write validator: %w", os.ErrInvalid)
+		}
+		f.validate = fn
+		return nil
+	}
+}
+
+// WithReplicaTimeout fans writes out concurrently, replicas still writing after d once quorum is met are marked dirty
+func WithReplicaTimeout(d time.Duration) FileOption {
+	return func(f *File) error {
+		if d <= 0 {
+			return fmt.Errorf("replica timeout must be greater than 0: %w", os.ErrInvalid)
+		}
+		f.replicaTimeout = d
+		return nil
+	}
+}
+
+// WithParallelReads splits reads of at least twice size bytes across replicas and reads the pieces concurrently
+func WithParallelReads(size int) FileOption {
+	return func(f *File) error {
+		if size <= 0 {
+			return fmt.Errorf("parallel read size must be greater than 0: %w", os.ErrInvalid)
+		}
+		f.parallelReadSize = size
+		return nil
+	}
+}
+
+// WithConcurrency bounds how many replicas are operated on at once by fan-out operations like Truncate, Chmod and Close
+func WithConcurrency(n int) FileOption {
+	return func(f *File) error {
+		if n <= 0 {
+			return fmt.Errorf("concurrency must be greater than 0: %w", os.ErrInvalid)
+		}
+		f.concurrency = n
+		return nil
+	}
+}
+
+// WithOpenManyWorkers bounds how many files OpenMany opens at once, 16 by default. it's separate from WithConcurrency,
+// which bounds the replicas of each file
+func WithOpenManyWorkers(n int) FileOption {
+	return func(f *File) error {
+		if n <= 0 {
+			return fmt.Errorf("open many workers must be greater than 0: %w", os.ErrInvalid)
+		}
+		f.openWorkers = n
+		return nil
+	}
+}
+
+// WithWriteConcurrency writes to up to n replicas at once instead of one after another and waits for all of them,
+// a write succeeds once a quorum of replicas took it, the replicas which failed are marked dirty until healed
+func WithWriteConcurrency(n int) FileOption {
+	return func(f *File) error {
+		if n <= 0 {
+			return fmt.Errorf("write concurrency must be greater than 0: %w", os.ErrInvalid)
+		}
+		f.writeConcurrency = n
+		return nil
+	}
+}
+
+func WithHardlinkPolicy(p HardlinkPolicy) FileOption {
+	return func(f *File) error {
+		if p < HardlinkIgnore || p > HardlinkError {
+			return fmt.Errorf("unknown hardlink policy %d: %w", p, os.ErrInvalid)
+		}
+		f.hardlinks = p
+		return nil
+	}
+}
+
+// WithBlockRepair compares and repairs replicas in blocks of size bytes, only rewriting the blocks of a diverged replica
+// which differ from the source rather than everything after the first difference
+func WithBlockRepair(size int) FileOption {
+	return func(f *File) error {
+		if size <= 0 {
+			return fmt.Errorf("block size must be greater than 0: %w", os.ErrInvalid)
+		}
+		f.blockSize = size
+		return nil
+	}
+}
+
+// WithRepairConcurrency sets how many lagging replicas are rebuilt at once during consensus, the default is one at a time
+func WithRepairConcurrency(n int) FileOption {
+	return func(f *File) error {
+		if n <= 0 {
+			return fmt.Errorf("repair concurrency must be greater than 0: %w", os.ErrInvalid)
+		}
+		f.repairConcurrency = n
+		return nil
+	}
+}
+
+// WithSpaceAwareRepair copies from the least loaded of the replicas holding the consensus and rebuilds lagging replicas
+// on the emptiest volumes first. a replica whose volume would be left with less than reserve bytes free isn't rebuilt,
+// it's marked dirty instead so healing doesn't fill an already tight disk
+func WithSpaceAwareRepair(reserve int64) FileOption {
+	return func(f *File) error {
+		if reserve < 0 {
+			return fmt.Errorf("negative repair reserve: %w", os.ErrInvalid)
+		}
+		f.spaceAware = true
+		f.repairReserve = reserve
+		return nil
+	}
+}
+
+// WithMkdirAll creates the missing parent directories of every replica when the file is created or repaired,
+// with the permissions set by WithDirPerms
+func WithMkdirAll() FileOption {
+	return func(f *File) error {
+		f.mkdirAll = true
+		return nil
+	}
+}
+
+// WithDirPerms sets the permissions of the directories haraqafs creates, before the umask, the default is 0777
+func WithDirPerms(perm os.FileMode) FileOption {
+	return func(f *File) error {
+		if perm&^os.ModePerm != 0 {
+			return fmt.Errorf("invalid directory permissions %v: %w", perm, os.ErrInvalid)
+		}
+		f.dirPerms = perm
+		return nil
+	}
+}
+
+// WithPlacement moves replicas off dead volumes according to p's rebinds, see RebindVolume
+func WithPlacement(p *Placement) FileOption {
+	return func(f *File) error {
+		if p == nil {
+			return fmt.Errorf("missing placement: %w", os.ErrInvalid)
+		}
+		f.placement = p
+		return nil
+	}
+}
+
+// WithRepairScheduler routes repairs through a scheduler shared with other files
+func WithRepairScheduler(s *RepairScheduler) FileOption {
+	return func(f *File) error {
+		f.scheduler = s
+		return nil
+	}
+}
+
+// WithZeroFill writes explicit zeros to every replica when writing past the end of the file instead of leaving a hole,
+// so replicas are identical on disk even on filesystems without sparse file support
+func WithZeroFill() FileOption {
+	return func(f *File) error {
+		f.zeroFill = true
+		return nil
+	}
+}
+
+// WithRegistry detects other handles in this process open on the same replicas, either failing or waiting per mode
+func WithRegistry(r *Registry, mode RegistryMode) FileOption {
+	return func(f *File) error {
+		if mode < RegistryConflict || mode > RegistrySerialize {
+			return fmt.Errorf("unknown registry mode %d: %w", mode, os.ErrInvalid)
+		}
+		f.registry = r
+		f.registryMode = mode
+		return nil
+	}
+}
+
+// WithExclusive holds lock directories next to a quorum of the replicas for as long as the file is open,
+// so independent processes sharing the volumes can't own the same file at once
+func WithExclusive() FileOption {
+	return func(f *File) error {
+		f.exclusive = true
+		return nil
+	}
+}
+
+// WithFailStop rejects writes and truncates once quorum is lost instead of letting the surviving replicas run ahead,
+// they fail with ErrQuorumLost until Heal brings enough replicas back
+func WithFailStop() FileOption {
+	return func(f *File) error {
+		f.failStop = true
+		return nil
+	}
+}
+
+// WithAppendLease makes processes appending to the same O_APPEND file take turns, an append first takes a lease
+// recorded on a quorum of volumes and catches up with the previous holder's appends. the lease is renewed by appending
+// and lapses after d without one, mode decides whether an append waits for the lease or fails with ErrLeaseHeld
+func WithAppendLease(d time.Duration, mode LeaseMode) FileOption {
+	return func(f *File) error {
+		if d <= 0 {
+			return fmt.Errorf("lease duration must be positive: %w", os.ErrInvalid)
+		}
+		if mode < LeaseWait || mode > LeaseFailFast {
+			return fmt.Errorf("unknown lease mode %d: %w", mode, os.ErrInvalid)
+		}
+		f.lease = newAppendLease(d, mode)
+		return nil
+	}
+}
+
+// WithLockTimeout bounds how long any method waits for another operation on the file to finish before failing with ErrLockTimeout
+func WithLockTimeout(d time.Duration) FileOption {
+	return func(f *File) error {
+		if d <= 0 {
+			return fmt.Errorf("lock timeout must be positive: %w", os.ErrInvalid)
+		}
+		f.lockTimeout = d
+		return nil
+	}
+}
+
+// WithContext makes every method waiting for the file lock give up once ctx is done,
+// cancelling ctx lets callers walk away from a file stuck behind a hung replica
+func WithContext(ctx context.Context) FileOption {
+	return func(f *File) error {
+		if ctx == nil {
+			return fmt.Errorf("nil context: %w", os.ErrInvalid)
+		}
+		f.ctx = ctx
 		return nil
 	}
 }
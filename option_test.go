@@ -0,0 +1,39 @@
+package haraqafs
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWithVolumeSpecs(t *testing.T) {
+	const fileName = "my_file"
+	v1 := newTmpVolume(t, "spec_1*")
+	defer os.RemoveAll(v1)
+	v2 := newTmpVolume(t, "spec_2*")
+	defer os.RemoveAll(v2)
+
+	f, err := New(fileName, WithVolumeSpecs(
+		Volume{Path: v1, ReadWeight: 10},
+		Volume{Path: v2, Sync: SyncAlways},
+	), WithCreate())
+	checkErr(t, err)
+	if f.readOrder[0] != 0 {
+		t.Fatal(f.readOrder)
+	}
+	if f.shouldSync(0) || !f.shouldSync(1) {
+		t.Fatal("unexpected sync policy")
+	}
+	checkWrite(t, f, []byte("hello"))
+	checkClose(t, f)
+
+	// corrupt the lower weighted replica, reads should prefer the heavier one
+	checkErr(t, os.WriteFile(filepath.Join(v2, fileName), []byte("world"), 0666))
+	f, err = New(fileName, WithVolumeSpecs(
+		Volume{Path: v1, ReadWeight: 10},
+		Volume{Path: v2},
+	), WithQuorum(1))
+	checkErr(t, err)
+	checkRead(t, f, []byte("hello"))
+	checkClose(t, f)
+}
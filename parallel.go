@@ -0,0 +1,146 @@
+package haraqafs
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"time"
+)
+
+// readAtParallel splits a large read across the usable replicas and reads the pieces concurrently
+func (f *File) readAtParallel(b []byte, off int64) (int, error) {
+	replicas := f.readPlan(nil)
+	pieces := len(b) / f.parallelReadSize
+	if pieces > len(replicas) {
+		pieces = len(replicas)
+	}
+	if pieces < 2 {
+		return f.readAt(b, off)
+	}
+
+	type piece struct {
+		start, end int
+		n          int
+		took       time.Duration
+		err        error
+	}
+	results := make([]piece, pieces)
+	size := (len(b) + pieces - 1) / pieces
+	var wg sync.WaitGroup
+	for p := range results {
+		results[p].start = p * size
+		results[p].end = results[p].start + size
+		if results[p].end > len(b) {
+			results[p].end = len(b)
+		}
+		wg.Add(1)
+		go func(p *piece, i int) {
+			defer wg.Done()
+			start := time.Now()
+			p.n, p.err = f.multi[i].ReadAt(b[p.start:p.end], off+int64(p.start))
+			p.took = time.Since(start)
+		}(&results[p], replicas[p])
+	}
+	wg.Wait()
+
+	var total int
+	for p := range results {
+		f.observeDuration(replicas[p], opRead, results[p].took)
+		res := results[p]
+		if res.n < res.end-res.start && (p < len(results)-1 || !errors.Is(res.err, io.EOF)) {
+			// the replica failed or came up short, fall back to the others for the rest of the piece
+			var n int
+			n, res.err = f.readAt(b[res.start+res.n:res.end], off+int64(res.start+res.n))
+			res.n += n
+		}
+		total += res.n
+		if res.err != nil {
+			return total, res.err
+		}
+		if res.n < res.end-res.start {
+			return total, io.EOF
+		}
+	}
+	return total, nil
+}
+
+// writeAtParallel writes to the usable replicas concurrently and waits for all of them, it's used with WithWriteConcurrency or WithWriteQuorum. replicas which fail are marked dirty
+// as long as a quorum succeeded, otherwise every replica's error is returned
+func (f *File) writeAtParallel(b []byte, offset int64) error {
+	var replicas []int
+	for i := range f.multi {
+		if f.multi[i] == nil || f.usable(i) {
+			replicas = append(replicas, i)
+		}
+	}
+	limit := f.writeConcurrency
+	if limit <= 0 {
+		limit = len(f.multi)
+	}
+	errs := boundedEach(limit, len(f.multi), replicas, func(i int) error {
+		if f.multi[i] == nil {
+			return pathErr("write", f.paths[i], errMissingReplica)
+		}
+		return f.writeReplica(i, b, offset)
+	})
+	var failed []error
+	for _, i := range replicas {
+		if errs[i] != nil {
+			failed = append(failed, errs[i])
+		}
+	}
+	if len(replicas)-len(failed) < f.writeQuorum() {
+		return aggErrors(failed)
+	}
+	for _, i := range replicas {
+		if errs[i] != nil && f.multi[i] != nil {
+			f.markDirty(i, errs[i])
+		}
+	}
+	if len(failed) > 0 && f.writeQ > 0 {
+		f.healLater()
+	}
+	return nil
+}
+
+// fanout runs fn concurrently for every open replica, bounded by the configured concurrency, returning errors by replica index
+func (f *File) fanout(fn func(i int) error) []error {
+	replicas := make([]int, 0, len(f.multi))
+	for i := range f.multi {
+		if f.multi[i] != nil {
+			replicas = append(replicas, i)
+		}
+	}
+	limit := f.concurrency
+	if limit <= 0 {
+		limit = len(f.multi)
+	}
+	return boundedEach(limit, len(f.multi), replicas, fn)
+}
+
+// boundedEach runs fn for each index with at most limit running at once, returning errors in a slice of length n
+func boundedEach(limit, n int, indexes []int, fn func(i int) error) []error {
+	errs := make([]error, n)
+	if limit <= 1 || len(indexes) <= 1 {
+		for _, i := range indexes {
+			errs[i] = fn(i)
+		}
+		return errs
+	}
+
+	sem := make(chan struct{}, limit)
+	var wg sync.WaitGroup
+	for _, i := range indexes {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(i int) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			errs[i] = fn(i)
+		}(i)
+	}
+	wg.Wait()
+	return errs
+}
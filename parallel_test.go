@@ -0,0 +1,146 @@
+package haraqafs
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWithParallelReads(t *testing.T) {
+	const fileName = "my_file"
+	volumes := newTmpVolumes(t, 3)
+	defer removeVolumes(volumes)
+
+	fsys := NewFS(WithVolumes(volumes...), WithParallelReads(1024))
+	f, err := fsys.New(fileName, WithCreate())
+	checkErr(t, err)
+	want := bytes.Repeat([]byte("0123456789"), 1000)
+	checkWrite(t, f, want)
+
+	got := make([]byte, len(want))
+	n, err := f.ReadAt(got, 0)
+	checkErr(t, err)
+	if n != len(want) || !bytes.Equal(got, want) {
+		t.Fatal(n)
+	}
+	for _, s := range fsys.Stats() {
+		if s.Read.Count != 1 {
+			t.Fatal(s)
+		}
+	}
+
+	// a missing replica falls back to the others
+	checkErr(t, os.Truncate(filepath.Join(volumes[1], fileName), 0))
+	got = make([]byte, len(want)+100)
+	n, err = f.ReadAt(got, 0)
+	if !errors.Is(err, io.EOF) || n != len(want) || !bytes.Equal(got[:n], want) {
+		t.Fatal(n, err)
+	}
+	checkClose(t, f)
+}
+
+func TestFanout(t *testing.T) {
+	const fileName = "my_file"
+	volumes := newTmpVolumes(t, 3)
+	defer removeVolumes(volumes)
+
+	f, err := New(fileName, WithVolumes(volumes...), WithCreate(), WithConcurrency(2))
+	checkErr(t, err)
+	checkWrite(t, f, []byte("hello"))
+	checkErr(t, f.Truncate(2))
+	checkErr(t, f.Chmod(0600))
+	checkErr(t, f.Barrier())
+	for _, v := range volumes {
+		info, err := os.Stat(filepath.Join(v, fileName))
+		checkErr(t, err)
+		if info.Size() != 2 || info.Mode().Perm() != 0600 {
+			t.Fatal(info.Size(), info.Mode())
+		}
+	}
+	checkClose(t, f)
+	if err = f.Close(); !errors.Is(err, os.ErrClosed) {
+		t.Fatal(err)
+	}
+}
+
+func TestWithWriteConcurrency(t *testing.T) {
+	volumes := newTmpVolumes(t, 3)
+	defer removeVolumes(volumes)
+
+	f, err := New("my_file", WithVolumes(volumes...), WithCreate(), WithWriteConcurrency(3))
+	checkErr(t, err)
+	checkWrite(t, f, []byte("hello"))
+	for _, v := range volumes {
+		b, err := os.ReadFile(filepath.Join(v, "my_file"))
+		checkErr(t, err)
+		if string(b) != "hello" {
+			t.Fatal(string(b))
+		}
+	}
+
+	// a failed replica is marked dirty while quorum holds
+	checkErr(t, f.multi[0].Close())
+	checkWrite(t, f, []byte(" world"))
+	if f.usable(0) {
+		t.Fatal("failed replica is still usable")
+	}
+	checkErr(t, f.multi[1].Close())
+	_, err = f.Write([]byte("!"))
+	var pErr *fs.PathError
+	if !errors.As(err, &pErr) || pErr.Path != f.paths[1] || !errors.Is(err, os.ErrClosed) {
+		t.Fatal(err)
+	}
+	_ = f.Close()
+}
+
+func TestWithWriteQuorum(t *testing.T) {
+	volumes := newTmpVolumes(t, 3)
+	defer removeVolumes(volumes)
+
+	if _, err := New("my_file", WithVolumes(append([]string(nil), volumes...)...), WithCreate(), WithWriteQuorum(4)); !errors.Is(err, os.ErrInvalid) {
+		t.Fatal(err)
+	}
+	f, err := New("my_file", WithVolumes(append([]string(nil), volumes...)...), WithCreate(), WithQuorum(3), WithWriteQuorum(2))
+	checkErr(t, err)
+	checkErr(t, f.multi[0].Close())
+	checkWrite(t, f, []byte("hello"))
+	if f.usable(0) || f.QuorumLost() {
+		t.Fatal("failed replica is still usable")
+	}
+	checkErr(t, f.multi[1].Close())
+	if _, err = f.Write([]byte("hello")); !errors.Is(err, os.ErrClosed) {
+		t.Fatal(err)
+	}
+	_ = f.Close()
+}
+
+func TestWithReadQuorum(t *testing.T) {
+	volumes := newTmpVolumes(t, 3)
+	defer removeVolumes(volumes)
+	for i, v := range volumes {
+		msg := "hello"
+		if i == 0 {
+			msg = "jello"
+		}
+		checkErr(t, os.WriteFile(filepath.Join(v, "my_file"), []byte(msg), 0666))
+	}
+
+	// read only files aren't repaired, so the replicas keep disagreeing
+	f, err := New("my_file", WithVolumes(append([]string(nil), volumes...)...), WithReadOnly(), WithReadQuorum(2))
+	checkErr(t, err)
+	b := make([]byte, 5)
+	if _, err = f.ReadAt(b, 0); err != nil && !errors.Is(err, io.EOF) || string(b) != "hello" {
+		t.Fatal(err, string(b))
+	}
+	checkClose(t, f)
+	f, err = New("my_file", WithVolumes(append([]string(nil), volumes...)...), WithReadOnly(), WithReadQuorum(3))
+	checkErr(t, err)
+	if _, err = f.ReadAt(b, 0); !errors.Is(err, ErrNoMajority) {
+		t.Fatal(err)
+	}
+	checkClose(t, f)
+}
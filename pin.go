@@ -0,0 +1,108 @@
+package haraqafs
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// pinSuffix names the marker kept next to every replica of a pinned file
+const pinSuffix = ".haraqafs-pin"
+
+// ErrPinned is returned when removing, renaming, truncating or repairing a pinned file
+var ErrPinned = fmt.Errorf("file is pinned: %w", os.ErrPermission)
+
+// Pin marks a child file so GC, repair and the directory's removals leave it alone until Unpin.
+// the marker is written next to every replica, including ones which are missing, a quorum of them must succeed
+func (d *Dir) Pin(name string) error {
+	return d.each(name, "pin", func(path string) error {
+		marker, err := os.OpenFile(path+pinSuffix, os.O_CREATE|os.O_WRONLY, 0o644)
+		if err != nil {
+			return err
+		}
+		return marker.Close()
+	})
+}
+
+// Unpin removes the markers left by Pin from every replica
+func (d *Dir) Unpin(name string) error {
+	return d.each(name, "unpin", func(path string) error {
+		err := os.Remove(path + pinSuffix)
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	})
+}
+
+// Pinned reports whether a child is pinned. a marker on any replica pins the file, so a partial Unpin errs on the side of keeping it
+func (d *Dir) Pinned(name string) (bool, error) {
+	name, err := childName("pinned", name)
+	if err != nil {
+		return false, err
+	}
+	for _, p := range d.paths {
+		if pinned(filepath.Join(p, name)) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// pinned reports whether the replica at path carries a pin marker
+func pinned(path string) bool {
+	_, err := os.Lstat(path + pinSuffix)
+	return err == nil
+}
+
+// pinnedUnder reports whether the replica at path, or anything under it when it's a directory, is pinned
+func pinnedUnder(path string) bool {
+	if pinned(path) {
+		return true
+	}
+	errFound := errors.New("found")
+	err := filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() && strings.HasSuffix(d.Name(), pinSuffix) {
+			return errFound
+		}
+		return nil
+	})
+	return err == errFound
+}
+
+// checkPinned returns ErrPinned when any replica of the child name is pinned
+func (d *Dir) checkPinned(op, name string) error {
+	name, err := childName(op, name)
+	if err != nil {
+		return err
+	}
+	for _, p := range d.paths {
+		if pinnedUnder(filepath.Join(p, name)) {
+			return &fs.PathError{Op: op, Path: filepath.Join(d.name, name), Err: ErrPinned}
+		}
+	}
+	return nil
+}
+
+// notePinned notes whether any replica is pinned, pinned files are never repaired
+func (f *File) notePinned() {
+	for _, p := range f.paths {
+		if pinned(p) {
+			f.pinned = true
+			return
+		}
+	}
+}
+
+// keptByPin reports whether name is a sidecar of a pinned entry among names, which must survive with it
+func keptByPin(names map[string]bool, name string) bool {
+	for base := range names {
+		if base != name && strings.HasPrefix(name, base+".") && names[base+pinSuffix] {
+			return true
+		}
+	}
+	return false
+}
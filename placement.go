@@ -0,0 +1,232 @@
+package haraqafs
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Rebind moves the replicas a dead volume held for Prefix, a file or a whole tree, onto Substitute.
+// an empty Prefix rebinds everything the volume held
+type Rebind struct {
+	Dead       string `json:"dead"`
+	Substitute string `json:"substitute"`
+	Prefix     string `json:"prefix,omitempty"`
+}
+
+// Placement holds the rebinds applied to every file opened with WithPlacement, it's safe to share between files
+// and can be changed while they're open, files pick up the change the next time they're opened
+type Placement struct {
+	mu      sync.RWMutex
+	rebinds []Rebind
+}
+
+// NewPlacement returns a placement starting with rebinds, for instance ones saved from Rebinds
+func NewPlacement(rebinds ...Rebind) (*Placement, error) {
+	p := &Placement{}
+	for _, r := range rebinds {
+		if err := p.Add(r); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// Add records a rebind, replacing any earlier one for the same dead volume and prefix
+func (p *Placement) Add(r Rebind) error {
+	if r.Dead == "" || r.Substitute == "" {
+		return fmt.Errorf("rebind needs a dead and a substitute volume: %w", os.ErrInvalid)
+	}
+	r.Dead, r.Substitute = filepath.Clean(r.Dead), filepath.Clean(r.Substitute)
+	if r.Prefix != "" {
+		r.Prefix = filepath.Clean(r.Prefix)
+	}
+	if r.Dead == r.Substitute {
+		return fmt.Errorf("volume %s can't substitute for itself: %w", r.Dead, os.ErrInvalid)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i := range p.rebinds {
+		if p.rebinds[i].Dead == r.Dead && p.rebinds[i].Prefix == r.Prefix {
+			p.rebinds[i] = r
+			return nil
+		}
+	}
+	p.rebinds = append(p.rebinds, r)
+	return nil
+}
+
+// Rebinds returns the recorded rebinds, to be saved in a Config and restored with NewPlacement
+func (p *Placement) Rebinds() []Rebind {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return append([]Rebind(nil), p.rebinds...)
+}
+
+// resolve returns the volumes holding name once rebinds are applied, following substitutes which died in turn.
+// volumes is never modified, it's shared with every other file opened with the same options
+func (p *Placement) resolve(name string, volumes []string) ([]string, error) {
+	if p == nil {
+		return volumes, nil
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	name = filepath.Clean(name)
+	var out []string
+	for i, v := range volumes {
+		w := v
+		for hops := 0; ; hops++ {
+			next, ok := p.lookup(name, w)
+			if !ok {
+				break
+			}
+			if hops == len(p.rebinds) {
+				return nil, fmt.Errorf("rebinds of %s loop: %w", v, os.ErrInvalid)
+			}
+			w = next
+		}
+		if w == v {
+			continue
+		}
+		if out == nil {
+			out = append([]string(nil), volumes...)
+		}
+		out[i] = w
+	}
+	if out == nil {
+		return volumes, nil
+	}
+	seen := make(map[string]bool, len(out))
+	for _, v := range out {
+		if seen[v] {
+			return nil, fmt.Errorf("%s would hold two replicas of %s: %w", v, name, os.ErrInvalid)
+		}
+		seen[v] = true
+	}
+	return out, nil
+}
+
+// lookup returns the substitute of the most specific rebind of volume covering name
+func (p *Placement) lookup(name, volume string) (string, bool) {
+	best := -1
+	for i, r := range p.rebinds {
+		if r.Dead != volume || !covers(r.Prefix, name) {
+			continue
+		}
+		if best < 0 || len(r.Prefix) > len(p.rebinds[best].Prefix) {
+			best = i
+		}
+	}
+	if best < 0 {
+		return "", false
+	}
+	return p.rebinds[best].Substitute, true
+}
+
+func covers(prefix, name string) bool {
+	return prefix == "" || prefix == "." || name == prefix || strings.HasPrefix(name, prefix+string(filepath.Separator))
+}
+
+// RebindVolume records that dead's replicas under root, a file or a tree, live on substitute from now on and heals every
+// file there onto it by opening it. opts must include the WithPlacement the files are opened with, and a quorum of each
+// file's other replicas must survive. an empty root rebinds everything dead held
+func RebindVolume(root, dead, substitute string, opts ...FileOption) error {
+	f, err := placement(opts)
+	if err != nil {
+		return err
+	}
+	if f.placement == nil {
+		return fmt.Errorf("rebinding needs WithPlacement: %w", os.ErrInvalid)
+	}
+	prefix := root
+	if root == "" {
+		root = "."
+	}
+	if root, err = logicalName("rebind", root); err != nil {
+		return err
+	}
+	if prefix != "" {
+		prefix = root
+	}
+	if err = f.placement.Add(Rebind{Dead: dead, Substitute: substitute, Prefix: prefix}); err != nil {
+		return err
+	}
+	dead, substitute = filepath.Clean(dead), filepath.Clean(substitute)
+
+	// the survivors list the files, the dead volume can't and the substitute doesn't have them yet
+	names := make(map[string]bool)
+	var errs []error
+	for _, v := range f.volumes {
+		if v == dead || v == substitute {
+			continue
+		}
+		err := filepath.WalkDir(filepath.Join(v, root), func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				if os.IsNotExist(err) {
+					return nil
+				}
+				return err
+			}
+			if internalName(d.Name()) || garbage(path, d.Name(), d.IsDir()) {
+				if d.IsDir() {
+					return fs.SkipDir
+				}
+				return nil
+			}
+			if !d.Type().IsRegular() {
+				return nil
+			}
+			name, err := filepath.Rel(v, path)
+			if err == nil {
+				names[name] = true
+			}
+			return err
+		})
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	heal := append(append([]FileOption(nil), opts...), WithCreateIfNotExist())
+	for _, name := range sorted {
+		volumes, err := f.placement.resolve(name, f.placeVolumes(name))
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if !contains(volumes, substitute) {
+			continue
+		}
+		if err = os.MkdirAll(filepath.Dir(filepath.Join(substitute, name)), os.ModePerm); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		file, err := New(name, heal...)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if err = file.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return aggErrors(errs)
+}
+
+func contains(volumes []string, volume string) bool {
+	for _, v := range volumes {
+		if v == volume {
+			return true
+		}
+	}
+	return false
+}
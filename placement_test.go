@@ -0,0 +1,66 @@
+package haraqafs
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRebindVolume(t *testing.T) {
+	volumes := newTmpVolumes(t, 5)
+	defer removeVolumes(volumes)
+	spare, other := volumes[3], volumes[4]
+	p, err := NewPlacement()
+	checkErr(t, err)
+	opts := []FileOption{WithVolumes(volumes[:3]...), WithPlacement(p)}
+
+	checkErr(t, MkdirAll("a/b", 0777, opts...))
+	checkErr(t, MkdirAll("c", 0777, opts...))
+	for _, name := range []string{"a/x", "a/b/y", "c/z"} {
+		f, err := New(name, append(opts, WithCreate())...)
+		checkErr(t, err)
+		checkWrite(t, f, []byte(name))
+		checkClose(t, f)
+	}
+	// the volume is lost for good
+	checkErr(t, os.RemoveAll(volumes[2]))
+
+	checkErr(t, RebindVolume("a", volumes[2], spare, opts...))
+	for name, want := range map[string]bool{"a/x": true, "a/b/y": true, "c/z": false} {
+		b, err := os.ReadFile(filepath.Join(spare, name))
+		if want && (err != nil || string(b) != name) || !want && !os.IsNotExist(err) {
+			t.Fatal(name, string(b), err)
+		}
+	}
+	f, err := New("a/b/y", opts...)
+	checkErr(t, err)
+	if f.paths[2] != filepath.Join(spare, "a", "b", "y") {
+		t.Fatal(f.paths)
+	}
+	checkClose(t, f)
+
+	// the rest of the volume goes elsewhere, a more specific rebind wins
+	checkErr(t, RebindVolume("", volumes[2], other, opts...))
+	if b, err := os.ReadFile(filepath.Join(other, "c", "z")); err != nil || string(b) != "c/z" {
+		t.Fatal(string(b), err)
+	}
+	if _, err := os.Stat(filepath.Join(other, "a", "x")); !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+
+	// rebinds survive a round trip through a config
+	c := Config{Volumes: []Volume{{Path: volumes[0]}, {Path: volumes[1]}, {Path: volumes[2]}}, Rebinds: p.Rebinds()}
+	fsys, err := c.FS()
+	checkErr(t, err)
+	file, err := fsys.Open("a/x")
+	checkErr(t, err)
+	checkRead(t, file.(*File), []byte("a/x"))
+	checkClose(t, file.(*File))
+
+	// a substitute can't end up holding two replicas of a file
+	checkErr(t, p.Add(Rebind{Dead: volumes[1], Substitute: spare, Prefix: "a"}))
+	if _, err = New("a/x", opts...); !errors.Is(err, os.ErrInvalid) {
+		t.Fatal(err)
+	}
+}
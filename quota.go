@@ -0,0 +1,334 @@
+package haraqafs
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ledgerName is the replicated file at the root of a namespace recording its quota and usage
+const ledgerName = ".haraqafs-quota"
+
+// Quota limits how much a namespace can hold, zero leaves a limit off
+type Quota struct {
+	Bytes int64 `json:"bytes"`
+	Files int64 `json:"files"`
+}
+
+// Usage is how much a namespace holds
+type Usage struct {
+	Bytes int64 `json:"bytes"`
+	Files int64 `json:"files"`
+}
+
+type ledger struct {
+	Quota Quota `json:"quota"`
+	Usage Usage `json:"usage"`
+	// Gen counts the updates, the newest copy of the ledger wins when the volumes disagree
+	Gen uint64 `json:"gen"`
+}
+
+// account charges the changes made through a namespace to its ledger. charges made while the ledger's being updated
+// queue up and are settled together by the next update
+type account struct {
+	paths  []string
+	quorum int
+	mu     sync.Mutex
+	queue  []*pendingCharge
+	busy   bool
+}
+
+type pendingCharge struct {
+	bytes, files int64
+	done         chan error
+}
+
+// ledgerWait is how long an update waits for other processes to let go of the ledger
+var ledgerWait = 5 * time.Second
+
+// Namespace returns an FS jailed to name whose files count against q. usage is tracked in a ledger replicated
+// across the volumes at the namespace root, so every handle on the namespace shares the same limits.
+// creating a file past the file limit or growing one past the byte limit fails with ErrQuotaExceeded
+func (fsys *FS) Namespace(name string, q Quota) (*FS, error) {
+	if q.Bytes < 0 || q.Files < 0 {
+		return nil, fmt.Errorf("quota must not be negative: %w", os.ErrInvalid)
+	}
+	ns, err := fsys.Jail(name)
+	if err != nil {
+		return nil, err
+	}
+	a, err := newAccount(ns.opts)
+	if err != nil {
+		return nil, err
+	}
+	if err = a.update(func(l *ledger) {
+		l.Quota = q
+	}); err != nil {
+		return nil, err
+	}
+	ns.opts = append(ns.opts[:len(ns.opts):len(ns.opts)], withAccount(a))
+	ns.account = a
+	return ns, nil
+}
+
+// newAccount places the ledger of the namespace opts are jailed to, creating the namespace root on each volume
+func newAccount(opts []FileOption) (*account, error) {
+	f, err := placement(opts)
+	if err != nil {
+		return nil, err
+	}
+	paths, err := f.placePaths(ledgerName)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range paths {
+		_ = os.MkdirAll(filepath.Dir(p), f.dirPerm())
+	}
+	return &account{paths: paths, quorum: f.quorum}, nil
+}
+
+// Usage returns the quota and usage of the namespace, see Namespace
+func (fsys *FS) Usage() (Quota, Usage, error) {
+	if fsys.account == nil {
+		return Quota{}, Usage{}, fmt.Errorf("not a namespace: %w", os.ErrInvalid)
+	}
+	l, err := fsys.account.read()
+	return l.Quota, l.Usage, err
+}
+
+func withAccount(a *account) FileOption {
+	return func(f *File) error {
+		f.account = a
+		return nil
+	}
+}
+
+// read returns the newest copy of the ledger, every copy is replaced whole so none is ever half written
+func (a *account) read() (ledger, error) {
+	var newest ledger
+	var errs []error
+	for _, p := range a.paths {
+		b, err := os.ReadFile(p)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			errs = append(errs, pathErr("read", p, err))
+			continue
+		}
+		var l ledger
+		if json.Unmarshal(b, &l) == nil && l.Gen > newest.Gen {
+			newest = l
+		}
+	}
+	if len(a.paths)-len(errs) < a.quorum {
+		return ledger{}, aggErrors(errs)
+	}
+	return newest, nil
+}
+
+// update applies fn to the ledger while holding it exclusively across processes and writes it back to every volume
+func (a *account) update(fn func(l *ledger)) error {
+	lock, err := a.lock()
+	if err != nil {
+		return err
+	}
+	defer lock.release()
+
+	l, err := a.read()
+	if err != nil {
+		return err
+	}
+	fn(&l)
+	l.Gen++
+	b, err := json.Marshal(l)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, p := range a.paths {
+		// a copy is replaced whole, a crash part way through leaves the old ledger rather than an empty one
+		if err := replaceFile(p, b); err != nil {
+			errs = append(errs, pathErr("write", p, err))
+			continue
+		}
+		if err := syncDir(filepath.Dir(p)); err != nil {
+			errs = append(errs, pathErr("sync", filepath.Dir(p), err))
+		}
+	}
+	if len(a.paths)-len(errs) < a.quorum {
+		return fmt.Errorf("ledger written to %d of %d volumes, %d needed: %w", len(a.paths)-len(errs), len(a.paths), a.quorum, aggErrors(append(errs, ErrNoQuorum)))
+	}
+	return nil
+}
+
+// lock takes the lock directories of the ledger, other processes only hold them for an update so it waits them out.
+// a ledger which stays locked fails with ErrLockTimeout, the file being written isn't the one which is locked
+func (a *account) lock() (*exclusiveLock, error) {
+	deadline := time.Now().Add(ledgerWait)
+	for wait := time.Millisecond; ; {
+		l, err := acquireLock(a.paths, a.quorum)
+		if err == nil {
+			return l, nil
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("quota ledger %s stayed locked for %s: %w", a.paths[0], ledgerWait, ErrLockTimeout)
+		}
+		time.Sleep(wait)
+		if wait < 50*time.Millisecond {
+			wait *= 2
+		}
+	}
+}
+
+// charge adds bytes and files to the usage, failing with ErrQuotaExceeded instead when growing past a limit
+func (a *account) charge(bytes, files int64) error {
+	if bytes == 0 && files == 0 {
+		return nil
+	}
+	c := &pendingCharge{bytes: bytes, files: files, done: make(chan error, 1)}
+	a.mu.Lock()
+	a.queue = append(a.queue, c)
+	if a.busy {
+		// the update in flight picks it up once it's done
+		a.mu.Unlock()
+		return <-c.done
+	}
+	a.busy = true
+	for len(a.queue) > 0 {
+		batch := a.queue
+		a.queue = nil
+		a.mu.Unlock()
+		a.settle(batch)
+		a.mu.Lock()
+	}
+	a.busy = false
+	a.mu.Unlock()
+	return <-c.done
+}
+
+// settle applies a batch of charges to the ledger in one update, each charge is accepted or refused on its own
+func (a *account) settle(batch []*pendingCharge) {
+	refused := make([]error, len(batch))
+	err := a.update(func(l *ledger) {
+		for k, c := range batch {
+			refused[k] = l.apply(c.bytes, c.files)
+		}
+	})
+	for k, c := range batch {
+		if err != nil {
+			c.done <- err
+		} else {
+			c.done <- refused[k]
+		}
+	}
+}
+
+// apply adds bytes and files to the usage unless that grows it past a limit
+func (l *ledger) apply(bytes, files int64) error {
+	u := Usage{Bytes: l.Usage.Bytes + bytes, Files: l.Usage.Files + files}
+	if bytes > 0 && l.Quota.Bytes > 0 && u.Bytes > l.Quota.Bytes {
+		return fmt.Errorf("%d of %d bytes used, %d more requested: %w", l.Usage.Bytes, l.Quota.Bytes, bytes, ErrQuotaExceeded)
+	}
+	if files > 0 && l.Quota.Files > 0 && u.Files > l.Quota.Files {
+		return fmt.Errorf("%d of %d files used: %w", l.Usage.Files, l.Quota.Files, ErrQuotaExceeded)
+	}
+	// give backs for changes an older ledger never saw don't take usage below zero
+	if u.Bytes < 0 {
+		u.Bytes = 0
+	}
+	if u.Files < 0 {
+		u.Files = 0
+	}
+	l.Usage = u
+	return nil
+}
+
+// measure returns the largest usage held under any of paths, haraqafs' own files aren't counted
+func measure(paths []string) Usage {
+	var most Usage
+	for _, p := range paths {
+		var u Usage
+		_ = filepath.WalkDir(p, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || !d.Type().IsRegular() || internalName(d.Name()) {
+				return nil
+			}
+			if info, err := d.Info(); err == nil {
+				u.Bytes += info.Size()
+				u.Files++
+			}
+			return nil
+		})
+		if u.Bytes > most.Bytes {
+			most.Bytes = u.Bytes
+		}
+		if u.Files > most.Files {
+			most.Files = u.Files
+		}
+	}
+	return most
+}
+
+// checkAccount refuses names which would reach the ledger, and notes how much the file held before it was opened
+func (f *File) checkAccount(name string) error {
+	if f.account == nil {
+		return nil
+	}
+	if internalName(filepath.Base(name)) {
+		return &fs.PathError{Op: "open", Path: name, Err: fs.ErrPermission}
+	}
+	for _, p := range f.paths {
+		if info, err := os.Stat(p); err == nil && info.Mode().IsRegular() {
+			f.opened.Files = 1
+			if info.Size() > f.opened.Bytes {
+				f.opened.Bytes = info.Size()
+			}
+		}
+	}
+	return nil
+}
+
+// settleOpen charges a newly opened file to its namespace, removing the replicas it created when that's over quota
+func (f *File) settleOpen() error {
+	if f.account == nil || f.readOnly || f.dir != nil {
+		return nil
+	}
+	var files int64
+	if f.opened.Files == 0 {
+		files = 1
+	}
+	err := f.account.charge(f.size-f.opened.Bytes, files)
+	if err != nil {
+		_ = f.Close()
+	}
+	if err != nil && files == 1 {
+		for _, p := range f.paths {
+			_ = os.Remove(p)
+		}
+	}
+	return err
+}
+
+// chargeGrowth charges growing the file to end before it's written, returning how much was charged
+func (f *File) chargeGrowth(end int64) (int64, error) {
+	if f.account == nil || end <= f.size {
+		return 0, nil
+	}
+	return end - f.size, f.account.charge(end-f.size, 0)
+}
+
+// settleGrowth squares the charge made by chargeGrowth with how much the file actually changed from size,
+// giving back growth which failed and bytes freed by shrinking it
+func (f *File) settleGrowth(size, charged int64) {
+	if f.account == nil {
+		return
+	}
+	if d := f.size - size - charged; d != 0 {
+		_ = f.account.charge(d, 0)
+	}
+}
@@ -0,0 +1,123 @@
+package haraqafs
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestNamespace(t *testing.T) {
+	volumes := newTmpVolumes(t, 3)
+	defer removeVolumes(volumes)
+	fsys := NewFS(WithVolumes(volumes...))
+
+	if _, err := fsys.Namespace("tenant", Quota{Bytes: -1}); !errors.Is(err, os.ErrInvalid) {
+		t.Fatal(err)
+	}
+	ns, err := fsys.Namespace("tenant", Quota{Bytes: 10, Files: 2})
+	checkErr(t, err)
+
+	f, err := ns.Create("a")
+	checkErr(t, err)
+	checkWrite(t, f, []byte("hello"))
+	if _, err = f.Write([]byte("hello world")); !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatal(err)
+	}
+	checkClose(t, f)
+	if _, err := os.Stat(filepath.Join(volumes[0], "tenant", "a")); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err = ns.Create("b")
+	checkErr(t, err)
+	checkClose(t, f)
+	if _, err = ns.Create("c"); !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(volumes[0], "tenant", "c")); !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	q, u, err := ns.Usage()
+	checkErr(t, err)
+	if q != (Quota{Bytes: 10, Files: 2}) || u != (Usage{Bytes: 5, Files: 2}) {
+		t.Fatal(q, u)
+	}
+
+	// usage is shared with every handle on the namespace and freed by removes and truncates
+	other, err := fsys.Namespace("tenant", Quota{Bytes: 10, Files: 2})
+	checkErr(t, err)
+	checkErr(t, other.Remove("b"))
+	f, err = other.OpenFile("a", os.O_RDWR, 0)
+	checkErr(t, err)
+	checkErr(t, f.Truncate(2))
+	checkClose(t, f)
+	if _, u, err = ns.Usage(); err != nil || u != (Usage{Bytes: 2, Files: 1}) {
+		t.Fatal(u, err)
+	}
+
+	// the ledger is out of reach
+	if _, err = ns.Create(ledgerName); !errors.Is(err, fs.ErrPermission) {
+		t.Fatal(err)
+	}
+	if err = ns.Remove(ledgerName); !errors.Is(err, fs.ErrPermission) {
+		t.Fatal(err)
+	}
+	if _, _, err = fsys.Usage(); !errors.Is(err, os.ErrInvalid) {
+		t.Fatal(err)
+	}
+
+	// a ledger held by someone else times out rather than reporting the file as locked
+	defer func(wait time.Duration) { ledgerWait = wait }(ledgerWait)
+	ledgerWait = 10 * time.Millisecond
+	l, err := acquireLock(ns.account.paths, 2)
+	checkErr(t, err)
+	f, err = ns.OpenFile("a", os.O_RDWR, 0)
+	checkErr(t, err)
+	if _, err = f.WriteAt([]byte("hello"), 2); !errors.Is(err, ErrLockTimeout) || errors.Is(err, ErrLocked) {
+		t.Fatal(err)
+	}
+	l.release()
+	checkClose(t, f)
+}
+
+func TestNamespaceConcurrentCharges(t *testing.T) {
+	volumes := newTmpVolumes(t, 3)
+	defer removeVolumes(volumes)
+	ns, err := NewFS(WithVolumes(volumes...)).Namespace("tenant", Quota{Files: 5})
+	checkErr(t, err)
+
+	// charges made while the ledger's busy are settled together, every create past the limit is refused
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var created, refused int
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			f, err := ns.Create(fmt.Sprintf("file_%d", i))
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == nil:
+				created++
+				_ = f.Close()
+			case errors.Is(err, ErrQuotaExceeded):
+				refused++
+			default:
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	_, u, err := ns.Usage()
+	checkErr(t, err)
+	if created != 5 || refused != 3 || u.Files != 5 {
+		t.Fatal(created, refused, u)
+	}
+
+}
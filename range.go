@@ -0,0 +1,19 @@
+package haraqafs
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// Range returns a view of the n bytes of quorum content starting at off, for serving byte ranges or handing to parsers
+// which expect a bounded reader. the view reads through ReadAt, so it doesn't move the file offset and several can be read at once
+func (f *File) Range(off, n int64) (*io.SectionReader, error) {
+	if f == nil || len(f.multi) == 0 || f.lock == nil {
+		return nil, os.ErrInvalid
+	}
+	if off < 0 || n < 0 {
+		return nil, fmt.Errorf("invalid range %d+%d: %w", off, n, os.ErrInvalid)
+	}
+	return io.NewSectionReader(f, off, n), nil
+}
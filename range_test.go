@@ -0,0 +1,39 @@
+package haraqafs
+
+import (
+	"errors"
+	"io"
+	"os"
+	"testing"
+)
+
+func TestRange(t *testing.T) {
+	volumes := newTmpVolumes(t, 3)
+	defer removeVolumes(volumes)
+
+	f, err := New("my_file", WithVolumes(volumes...), WithCreate())
+	checkErr(t, err)
+	checkWrite(t, f, []byte("hello world"))
+
+	r, err := f.Range(6, 3)
+	checkErr(t, err)
+	b, err := io.ReadAll(r)
+	checkErr(t, err)
+	if string(b) != "wor" || r.Size() != 3 {
+		t.Fatal(string(b), r.Size())
+	}
+
+	// ranges past the end stop at the end of the file
+	r, err = f.Range(6, 100)
+	checkErr(t, err)
+	b, err = io.ReadAll(r)
+	checkErr(t, err)
+	if string(b) != "world" {
+		t.Fatal(string(b))
+	}
+
+	if _, err = f.Range(-1, 3); !errors.Is(err, os.ErrInvalid) {
+		t.Fatal(err)
+	}
+	checkClose(t, f)
+}
@@ -0,0 +1,111 @@
+package haraqafs
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+type RegistryMode int
+
+const (
+	// RegistryConflict fails a second open of the same replicas with a *ConflictError
+	RegistryConflict RegistryMode = iota
+	// RegistrySerialize blocks a second open of the same replicas until the first is closed
+	RegistrySerialize
+)
+
+// Registry tracks the files open in this process so two handles never fan out writes to the same replicas.
+// every replica path is held on its own, so handles sharing only some of their replicas still conflict
+type Registry struct {
+	mu   sync.Mutex
+	open map[string]chan struct{}
+}
+
+func NewRegistry() *Registry {
+	return &Registry{open: make(map[string]chan struct{})}
+}
+
+// acquire holds every one of paths, or none of them. wait is called with the release of a held path to wait on
+// in RegistrySerialize mode, and gives up waiting by returning an error
+func (r *Registry) acquire(paths []string, mode RegistryMode, wait func(released <-chan struct{}) error) ([]string, error) {
+	for {
+		r.mu.Lock()
+		var held []string
+		var released chan struct{}
+		for _, p := range paths {
+			if ch, ok := r.open[p]; ok {
+				held = append(held, p)
+				released = ch
+			}
+		}
+		if len(held) == 0 {
+			ch := make(chan struct{})
+			for _, p := range paths {
+				r.open[p] = ch
+			}
+			r.mu.Unlock()
+			return append([]string(nil), paths...), nil
+		}
+		r.mu.Unlock()
+		if mode == RegistryConflict {
+			return nil, &ConflictError{Paths: held}
+		}
+		if err := wait(released); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// release lets go of paths, which were all held by the same acquire
+func (r *Registry) release(paths []string) {
+	r.mu.Lock()
+	var released chan struct{}
+	for _, p := range paths {
+		if ch, ok := r.open[p]; ok {
+			delete(r.open, p)
+			released = ch
+		}
+	}
+	if released != nil {
+		close(released)
+	}
+	r.mu.Unlock()
+}
+
+// waitRegistry waits for released, giving up with the lock timeout or once the file's contexts are done
+func (f *File) waitRegistry(timeout <-chan time.Time) func(released <-chan struct{}) error {
+	return func(released <-chan struct{}) error {
+		var done, cancelled <-chan struct{}
+		if f.ctx != nil {
+			done = f.ctx.Done()
+		}
+		if f.openCtx != nil {
+			cancelled = f.openCtx.Done()
+		}
+		select {
+		case <-released:
+			return nil
+		case <-timeout:
+			return fmt.Errorf("waited %s for replicas open in this process: %w", f.lockTimeout, ErrLockTimeout)
+		case <-done:
+			return fmt.Errorf("waiting for replicas open in this process: %w", f.ctx.Err())
+		case <-cancelled:
+			return fmt.Errorf("waiting for replicas open in this process: %w", f.openCtx.Err())
+		}
+	}
+}
+
+func (f *File) unregister() {
+	if f.lease != nil {
+		f.lease.release()
+	}
+	if f.exclusiveLock != nil {
+		f.exclusiveLock.release()
+		f.exclusiveLock = nil
+	}
+	if f.registry != nil && f.registered != nil {
+		f.registry.release(f.registered)
+		f.registered = nil
+	}
+}
@@ -0,0 +1,70 @@
+package haraqafs
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWithRegistry(t *testing.T) {
+	volumes := newTmpVolumes(t, 2)
+	defer removeVolumes(volumes)
+	r := NewRegistry()
+
+	f, err := New("my_file", WithVolumes(volumes...), WithCreate(), WithRegistry(r, RegistryConflict))
+	checkErr(t, err)
+
+	// the volume order doesn't matter
+	_, err = New("my_file", WithVolumes(volumes[1], volumes[0]), WithRegistry(r, RegistryConflict))
+	var conflict *ConflictError
+	if !errors.As(err, &conflict) || !errors.Is(err, os.ErrExist) {
+		t.Fatal(err)
+	}
+
+	opened := make(chan *File)
+	waiting := append([]string(nil), volumes...)
+	go func() {
+		g, err := New("my_file", WithVolumes(waiting...), WithRegistry(r, RegistrySerialize))
+		if err != nil {
+			t.Error(err)
+		}
+		opened <- g
+	}()
+	select {
+	case <-opened:
+		t.Fatal("second handle opened while the first was open")
+	case <-time.After(50 * time.Millisecond):
+	}
+	checkClose(t, f)
+	g := <-opened
+	checkClose(t, g)
+
+	f, err = New("my_file", WithVolumes(volumes...), WithRegistry(r, RegistryConflict))
+	checkErr(t, err)
+
+	// sharing a single replica is enough to conflict
+	if _, err = New("my_file", WithVolumes(volumes[0]), WithRegistry(r, RegistryConflict)); !errors.As(err, &conflict) {
+		t.Fatal(err)
+	}
+	if len(conflict.Paths) != 1 || conflict.Paths[0] != filepath.Join(volumes[0], "my_file") {
+		t.Fatal(conflict.Paths)
+	}
+
+	// waiting gives up with the lock timeout and the open context
+	if _, err = New("my_file", WithVolumes(volumes[1]), WithRegistry(r, RegistrySerialize), WithLockTimeout(time.Millisecond)); !errors.Is(err, ErrLockTimeout) {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	if _, err = NewContext(ctx, "my_file", WithVolumes(volumes[1]), WithRegistry(r, RegistrySerialize)); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatal(err)
+	}
+	checkClose(t, f)
+
+	f, err = New("my_file", WithVolumes(volumes[1]), WithRegistry(r, RegistryConflict))
+	checkErr(t, err)
+	checkClose(t, f)
+}
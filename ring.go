@@ -0,0 +1,144 @@
+package haraqafs
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+)
+
+// Ring places files on a subset of a large volume pool using consistent hashing with virtual nodes
+type Ring struct {
+	vnodes  int
+	volumes []string
+	points  []ringPoint
+}
+
+type ringPoint struct {
+	hash   uint64
+	volume int
+}
+
+func NewRing(vnodes int, volumes ...string) (*Ring, error) {
+	if vnodes <= 0 {
+		return nil, fmt.Errorf("virtual nodes must be greater than 0: %w", os.ErrInvalid)
+	}
+	if len(volumes) == 0 {
+		return nil, fmt.Errorf("missing volumes: %w", os.ErrInvalid)
+	}
+	r := &Ring{
+		vnodes:  vnodes,
+		volumes: make([]string, 0, len(volumes)),
+		points:  make([]ringPoint, 0, vnodes*len(volumes)),
+	}
+	seen := make(map[string]bool, len(volumes))
+	for _, v := range volumes {
+		v = filepath.Clean(v)
+		if seen[v] {
+			return nil, fmt.Errorf("duplicate volume %s: %w", v, os.ErrInvalid)
+		}
+		seen[v] = true
+		r.volumes = append(r.volumes, v)
+		for i := 0; i < vnodes; i++ {
+			r.points = append(r.points, ringPoint{
+				hash:   ringHash(v + "#" + strconv.Itoa(i)),
+				volume: len(r.volumes) - 1,
+			})
+		}
+	}
+	sort.Slice(r.points, func(i, j int) bool {
+		if r.points[i].hash == r.points[j].hash {
+			return r.volumes[r.points[i].volume] < r.volumes[r.points[j].volume]
+		}
+		return r.points[i].hash < r.points[j].hash
+	})
+	return r, nil
+}
+
+func ringHash(s string) uint64 {
+	sum := sha256.Sum256([]byte(s))
+	return binary.BigEndian.Uint64(sum[:8])
+}
+
+func (r *Ring) Volumes() []string {
+	return append([]string(nil), r.volumes...)
+}
+
+// WithVolume returns a copy of the ring with an additional volume
+func (r *Ring) WithVolume(volume string) (*Ring, error) {
+	return NewRing(r.vnodes, append(r.Volumes(), volume)...)
+}
+
+// WithoutVolume returns a copy of the ring with a volume removed
+func (r *Ring) WithoutVolume(volume string) (*Ring, error) {
+	volume = filepath.Clean(volume)
+	volumes := make([]string, 0, len(r.volumes))
+	for _, v := range r.volumes {
+		if v != volume {
+			volumes = append(volumes, v)
+		}
+	}
+	if len(volumes) == len(r.volumes) {
+		return nil, fmt.Errorf("volume %s not in ring: %w", volume, os.ErrNotExist)
+	}
+	return NewRing(r.vnodes, volumes...)
+}
+
+// Locate returns the n distinct volumes responsible for name, walking the ring clockwise
+func (r *Ring) Locate(name string, n int) []string {
+	if n > len(r.volumes) {
+		n = len(r.volumes)
+	}
+	h := ringHash(filepath.ToSlash(filepath.Clean(name)))
+	start := sort.Search(len(r.points), func(i int) bool { return r.points[i].hash >= h })
+
+	volumes := make([]string, 0, n)
+	seen := make([]bool, len(r.volumes))
+	for i := 0; i < len(r.points) && len(volumes) < n; i++ {
+		p := r.points[(start+i)%len(r.points)]
+		if seen[p.volume] {
+			continue
+		}
+		seen[p.volume] = true
+		volumes = append(volumes, r.volumes[p.volume])
+	}
+	return volumes
+}
+
+type Move struct {
+	Name string
+	From []string
+	To   []string
+}
+
+// Moves computes which files need replicas added or removed when moving from r to next
+func (r *Ring) Moves(next *Ring, names []string, replicas int) []Move {
+	var moves []Move
+	for _, name := range names {
+		before := r.Locate(name, replicas)
+		after := next.Locate(name, replicas)
+		m := Move{Name: name, From: diffVolumes(before, after), To: diffVolumes(after, before)}
+		if len(m.From) > 0 || len(m.To) > 0 {
+			moves = append(moves, m)
+		}
+	}
+	return moves
+}
+
+// diffVolumes returns the volumes in a which aren't in b
+func diffVolumes(a, b []string) []string {
+	var diff []string
+outer:
+	for _, v := range a {
+		for _, w := range b {
+			if v == w {
+				continue outer
+			}
+		}
+		diff = append(diff, v)
+	}
+	return diff
+}
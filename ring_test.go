@@ -0,0 +1,62 @@
+package haraqafs
+
+import (
+	"os"
+	"strconv"
+	"testing"
+)
+
+func TestRing(t *testing.T) {
+	var volumes []string
+	for i := 0; i < 20; i++ {
+		volumes = append(volumes, "/vol"+strconv.Itoa(i))
+	}
+	r, err := NewRing(64, volumes...)
+	checkErr(t, err)
+
+	var names []string
+	for i := 0; i < 1000; i++ {
+		names = append(names, "file"+strconv.Itoa(i))
+	}
+	for _, name := range names[:10] {
+		located := r.Locate(name, 3)
+		if len(located) != 3 || len(diffVolumes(located, r.Locate(name, 3))) != 0 {
+			t.Fatal(located)
+		}
+	}
+
+	next, err := r.WithVolume("/vol20")
+	checkErr(t, err)
+	moves := r.Moves(next, names, 3)
+	// roughly 3/21 of the files should gain a replica on the new volume
+	if len(moves) == 0 || len(moves) > len(names)/4 {
+		t.Fatal(len(moves))
+	}
+	for _, m := range moves {
+		if len(m.To) != 1 || m.To[0] != "/vol20" || len(m.From) != 1 {
+			t.Fatal(m)
+		}
+	}
+
+	if _, err = r.WithoutVolume("/missing"); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestWithRing(t *testing.T) {
+	v1 := newTmpVolume(t, "ring_1*")
+	defer os.RemoveAll(v1)
+	v2 := newTmpVolume(t, "ring_2*")
+	defer os.RemoveAll(v2)
+	v3 := newTmpVolume(t, "ring_3*")
+	defer os.RemoveAll(v3)
+
+	r, err := NewRing(16, v1, v2, v3)
+	checkErr(t, err)
+	f, err := New("ringed", WithRing(r, 2), WithCreate())
+	checkErr(t, err)
+	if len(f.paths) != 2 {
+		t.Fatal(f.paths)
+	}
+	checkClose(t, f)
+}
@@ -0,0 +1,191 @@
+package haraqafs
+
+import (
+	"fmt"
+	"os"
+)
+
+// gfExp and gfLog are the exponent and logarithm tables of GF(2^8) over the polynomial x^8+x^4+x^3+x^2+1,
+// gfExp is doubled in length so products never need reducing mod 255
+var gfExp, gfLog = gfTables()
+
+func gfTables() (exp [510]byte, log [256]byte) {
+	x := 1
+	for i := 0; i < 255; i++ {
+		exp[i] = byte(x)
+		exp[i+255] = byte(x)
+		log[x] = byte(i)
+		x <<= 1
+		if x&0x100 != 0 {
+			x ^= 0x11d
+		}
+	}
+	return exp, log
+}
+
+func gfMul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return gfExp[int(gfLog[a])+int(gfLog[b])]
+}
+
+func gfInv(a byte) byte {
+	return gfExp[255-int(gfLog[a])]
+}
+
+// mulAdd adds c times src into dst
+func mulAdd(dst, src []byte, c byte) {
+	if c == 0 {
+		return
+	}
+	lc := int(gfLog[c])
+	for i, s := range src {
+		if s != 0 {
+			dst[i] ^= gfExp[lc+int(gfLog[s])]
+		}
+	}
+}
+
+// rsCode is a systematic Reed–Solomon code of data shards protected by parity shards,
+// any data of the data+parity shards are enough to rebuild the rest
+type rsCode struct {
+	data, parity int
+	// matrix maps the data shards to every shard, its top rows are the identity
+	matrix [][]byte
+}
+
+func newRSCode(data, parity int) (*rsCode, error) {
+	if data < 1 || parity < 1 || data+parity > 256 {
+		return nil, fmt.Errorf("erasure coding needs at least 1 data and 1 parity shard, at most 256 in all, got %d+%d: %w", data, parity, os.ErrInvalid)
+	}
+	// a vandermonde matrix made systematic, every square subset of its rows stays invertible
+	vm := make([][]byte, data+parity)
+	for r := range vm {
+		vm[r] = make([]byte, data)
+		for c := range vm[r] {
+			vm[r][c] = gfPow(byte(r), c)
+		}
+	}
+	top, err := invert(vm[:data])
+	if err != nil {
+		return nil, err
+	}
+	return &rsCode{data: data, parity: parity, matrix: mulMatrix(vm, top)}, nil
+}
+
+func gfPow(a byte, n int) byte {
+	if n == 0 {
+		return 1
+	}
+	if a == 0 {
+		return 0
+	}
+	return gfExp[(int(gfLog[a])*n)%255]
+}
+
+func mulMatrix(a, b [][]byte) [][]byte {
+	out := make([][]byte, len(a))
+	for r := range a {
+		out[r] = make([]byte, len(b[0]))
+		for c := range out[r] {
+			var v byte
+			for k := range b {
+				v ^= gfMul(a[r][k], b[k][c])
+			}
+			out[r][c] = v
+		}
+	}
+	return out
+}
+
+// invert returns the inverse of the square matrix m by gauss-jordan elimination
+func invert(m [][]byte) ([][]byte, error) {
+	n := len(m)
+	work := make([][]byte, n)
+	for r := range m {
+		work[r] = make([]byte, 2*n)
+		copy(work[r], m[r])
+		work[r][n+r] = 1
+	}
+	for c := 0; c < n; c++ {
+		pivot := c
+		for pivot < n && work[pivot][c] == 0 {
+			pivot++
+		}
+		if pivot == n {
+			return nil, fmt.Errorf("erasure coding matrix is singular: %w", ErrCorrupt)
+		}
+		work[c], work[pivot] = work[pivot], work[c]
+		scale := gfInv(work[c][c])
+		for k := range work[c] {
+			work[c][k] = gfMul(work[c][k], scale)
+		}
+		for r := range work {
+			if r != c && work[r][c] != 0 {
+				mulAdd(work[r], work[c], work[r][c])
+			}
+		}
+	}
+	inv := make([][]byte, n)
+	for r := range work {
+		inv[r] = work[r][n:]
+	}
+	return inv, nil
+}
+
+// encode fills the parity shards from the data shards, every shard is the same length
+func (c *rsCode) encode(shards [][]byte) {
+	for p := c.data; p < c.data+c.parity; p++ {
+		for k := range shards[p] {
+			shards[p][k] = 0
+		}
+		for d := 0; d < c.data; d++ {
+			mulAdd(shards[p], shards[d], c.matrix[p][d])
+		}
+	}
+}
+
+// reconstruct rebuilds the shards which are nil from the others, it fails with ErrNoMajority when fewer than data are left
+func (c *rsCode) reconstruct(shards [][]byte, size int) error {
+	var have []int
+	for i, s := range shards {
+		if s != nil {
+			have = append(have, i)
+		}
+	}
+	if len(have) < c.data {
+		return fmt.Errorf("%d of %d shards left, %d needed: %w", len(have), len(shards), c.data, ErrNoMajority)
+	}
+	if len(have) == len(shards) {
+		return nil
+	}
+	have = have[:c.data]
+	sub := make([][]byte, c.data)
+	for r, i := range have {
+		sub[r] = c.matrix[i]
+	}
+	dec, err := invert(sub)
+	if err != nil {
+		return err
+	}
+	for d := 0; d < c.data; d++ {
+		if shards[d] != nil {
+			continue
+		}
+		shards[d] = make([]byte, size)
+		for r, i := range have {
+			mulAdd(shards[d], shards[i], dec[d][r])
+		}
+	}
+	for p := c.data; p < len(shards); p++ {
+		if shards[p] != nil {
+			continue
+		}
+		shards[p] = make([]byte, size)
+		for d := 0; d < c.data; d++ {
+			mulAdd(shards[p], shards[d], c.matrix[p][d])
+		}
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package haraqafs
+
+import (
+	"os"
+	"sync"
+	"sync/atomic"
+)
+
+// rwLock is a reader/writer lock whose waits can be abandoned, and which can be closed for good
+type rwLock struct {
+	mu      sync.Mutex
+	readers int
+	writer  bool
+	waiting int
+	closed  bool
+	// done mirrors closed for lock free readers
+	done int32
+	// changed is closed and replaced whenever the lock is released, waking everyone waiting on it
+	changed chan struct{}
+}
+
+func newRWLock() *rwLock {
+	return &rwLock{changed: make(chan struct{})}
+}
+
+// lock takes the lock exclusively, or shared with other readers, until abort fires.
+// waiting writers hold off new readers so a steady stream of reads can't starve them
+func (l *rwLock) lock(exclusive bool, abort func(wait <-chan struct{}) error) error {
+	counted := false
+	for {
+		l.mu.Lock()
+		switch {
+		case l.closed:
+			l.leave(counted)
+			l.mu.Unlock()
+			return os.ErrClosed
+		case exclusive && !l.writer && l.readers == 0:
+			l.writer = true
+			if counted {
+				l.waiting--
+			}
+			l.mu.Unlock()
+			return nil
+		case !exclusive && !l.writer && l.waiting == 0:
+			l.readers++
+			l.mu.Unlock()
+			return nil
+		}
+		if exclusive && !counted {
+			l.waiting++
+			counted = true
+		}
+		wait := l.changed
+		l.mu.Unlock()
+		if err := abort(wait); err != nil {
+			l.mu.Lock()
+			l.leave(counted)
+			l.mu.Unlock()
+			return err
+		}
+	}
+}
+
+// leave gives up waiting, which might let readers through
+func (l *rwLock) leave(counted bool) {
+	if counted {
+		l.waiting--
+		l.wake()
+	}
+}
+
+// tryRLock takes a shared lock only if it's free right now
+func (l *rwLock) tryRLock() (ok bool, closed bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return false, true
+	}
+	if l.writer || l.waiting > 0 {
+		return false, false
+	}
+	l.readers++
+	return true, false
+}
+
+func (l *rwLock) unlock() {
+	l.mu.Lock()
+	l.writer = false
+	l.wake()
+	l.mu.Unlock()
+}
+
+// downgrade turns an exclusive lock into a shared one without letting a writer in between
+func (l *rwLock) downgrade() {
+	l.mu.Lock()
+	l.writer = false
+	l.readers++
+	l.wake()
+	l.mu.Unlock()
+}
+
+func (l *rwLock) runlock() {
+	l.mu.Lock()
+	l.readers--
+	l.wake()
+	l.mu.Unlock()
+}
+
+// close releases an exclusive lock and fails every later attempt to take it
+func (l *rwLock) close() {
+	l.mu.Lock()
+	l.writer = false
+	l.closed = true
+	atomic.StoreInt32(&l.done, 1)
+	l.wake()
+	l.mu.Unlock()
+}
+
+func (l *rwLock) isClosed() bool {
+	return atomic.LoadInt32(&l.done) == 1
+}
+
+func (l *rwLock) wake() {
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
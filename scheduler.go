@@ -0,0 +1,77 @@
+package haraqafs
+
+import (
+	"sync"
+	"time"
+)
+
+// RepairScheduler coordinates repairs across many files, capping how many replicas are rebuilt at once and how fast
+type RepairScheduler struct {
+	slots   chan struct{}
+	limiter *rateLimiter
+}
+
+// NewRepairScheduler returns a scheduler allowing concurrency simultaneous replica repairs, sharing bytesPerSecond of
+// bandwidth between them. A bytesPerSecond of 0 leaves bandwidth unlimited
+func NewRepairScheduler(concurrency int, bytesPerSecond int64) *RepairScheduler {
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	return &RepairScheduler{
+		slots:   make(chan struct{}, concurrency),
+		limiter: newRateLimiter(bytesPerSecond),
+	}
+}
+
+func (s *RepairScheduler) acquire() {
+	if s != nil {
+		s.slots <- struct{}{}
+	}
+}
+
+func (s *RepairScheduler) release() {
+	if s != nil {
+		<-s.slots
+	}
+}
+
+func (s *RepairScheduler) wait(n int) {
+	if s != nil {
+		s.limiter.wait(n)
+	}
+}
+
+// rateLimiter is a token bucket refilled at rate bytes per second, holding at most a second of tokens
+type rateLimiter struct {
+	mu     sync.Mutex
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(bytesPerSecond int64) *rateLimiter {
+	if bytesPerSecond <= 0 {
+		return nil
+	}
+	return &rateLimiter{rate: float64(bytesPerSecond), tokens: float64(bytesPerSecond), last: time.Now()}
+}
+
+func (l *rateLimiter) wait(n int) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.rate {
+		l.tokens = l.rate
+	}
+	l.last = now
+	l.tokens -= float64(n)
+	var delay time.Duration
+	if l.tokens < 0 {
+		delay = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	l.mu.Unlock()
+	time.Sleep(delay)
+}
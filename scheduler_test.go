@@ -0,0 +1,48 @@
+package haraqafs
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRepairScheduler(t *testing.T) {
+	volumes := newTmpVolumes(t, 2)
+	defer removeVolumes(volumes)
+
+	// two files each needing 150KB of repair, sharing 200KB/s
+	data := bytes.Repeat([]byte("x"), 150<<10)
+	for _, name := range []string{"a", "b"} {
+		checkErr(t, os.WriteFile(filepath.Join(volumes[0], name), data, 0666))
+	}
+	fsys := NewFS(WithVolumes(volumes...), WithQuorum(1), WithRepairScheduler(NewRepairScheduler(1, 200<<10)))
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	for _, name := range []string{"a", "b"} {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			f, err := fsys.New(name, WithCreateIfNotExist())
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			_ = f.Close()
+		}(name)
+	}
+	wg.Wait()
+	if took := time.Since(start); took < 300*time.Millisecond {
+		t.Fatal("repairs weren't throttled", took)
+	}
+	for _, name := range []string{"a", "b"} {
+		b, err := os.ReadFile(filepath.Join(volumes[1], name))
+		checkErr(t, err)
+		if !bytes.Equal(b, data) {
+			t.Fatal(name, len(b))
+		}
+	}
+}
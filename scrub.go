@@ -0,0 +1,142 @@
+package haraqafs
+
+import (
+	"bytes"
+	"context"
+	"os"
+)
+
+// ScrubReport is what Scrub found comparing the replicas of a file chunk by chunk
+type ScrubReport struct {
+	// Bytes counts the bytes compared on each replica
+	Bytes int64
+	// StartGeneration and EndGeneration bound the writes which landed while the scrub ran
+	StartGeneration uint64
+	EndGeneration   uint64
+	Mismatches      []ScrubMismatch
+}
+
+// ScrubMismatch is a chunk on which some replicas disagreed with the quorum, Paths are the replicas which disagreed,
+// every compared replica when no quorum agreed
+type ScrubMismatch struct {
+	Offset int64
+	Length int
+	Paths  []string
+}
+
+// Scrub compares the replicas of the file chunk by chunk without changing them. it can run while the file is being written:
+// the lock is shared for one chunk at a time so writers only ever wait on a single chunk,
+// and replicas whose watermark shows they missed writes are left out rather than reported as corrupt
+func (f *File) Scrub(ctx context.Context) (*ScrubReport, error) {
+	if f == nil || len(f.multi) == 0 || f.lock == nil {
+		return nil, os.ErrInvalid
+	}
+	// directories have no content to compare and pinned files are left alone
+	if f.dir != nil || f.pinned {
+		return &ScrubReport{}, nil
+	}
+	if f.erasure != nil {
+		return nil, errShards
+	}
+	r := &ScrubReport{StartGeneration: f.Generation()}
+	bufs := make([][]byte, len(f.multi))
+	for off := int64(0); ; {
+		if err := ctx.Err(); err != nil {
+			return r, err
+		}
+		n, err := f.scrubChunk(r, bufs, off)
+		if err != nil {
+			return r, err
+		}
+		if n == 0 {
+			break
+		}
+		off += int64(n)
+		r.Bytes += int64(n)
+	}
+	r.EndGeneration = f.Generation()
+	f.scrubbed(r)
+	return r, nil
+}
+
+// scrubChunk compares the chunk at off across the replicas which are up to date, returning its length, 0 past the end of the file
+func (f *File) scrubChunk(r *ScrubReport, bufs [][]byte, off int64) (int, error) {
+	if err := f.acquireRead(); err != nil {
+		return 0, err
+	}
+	defer f.releaseRead()
+
+	n := int64(f.chunkSize())
+	if f.size-off < n {
+		n = f.size - off
+	}
+	if n <= 0 {
+		return 0, nil
+	}
+	var compared []int
+	for i := range f.multi {
+		if !f.usable(i) || f.lagging(i) {
+			continue
+		}
+		if cap(bufs[i]) < int(n) {
+			bufs[i] = make([]byte, n)
+		}
+		bufs[i] = bufs[i][:n]
+		read, err := f.multi[i].ReadAt(bufs[i], off)
+		if int64(read) < n && err != nil {
+			// a short replica disagrees like any other
+			bufs[i] = bufs[i][:read]
+		}
+		compared = append(compared, i)
+	}
+
+	// the largest group of identical replicas is the truth if it holds a quorum
+	source, votes := -1, 0
+	for _, i := range compared {
+		var count int
+		for _, j := range compared {
+			if bytes.Equal(bufs[i], bufs[j]) {
+				count++
+			}
+		}
+		if count > votes {
+			source, votes = i, count
+		}
+	}
+	if votes == len(compared) {
+		return int(n), nil
+	}
+	m := ScrubMismatch{Offset: off, Length: int(n)}
+	for _, i := range compared {
+		if votes < f.quorum || !bytes.Equal(bufs[i], bufs[source]) {
+			m.Paths = append(m.Paths, f.paths[i])
+		}
+	}
+	r.Mismatches = append(r.Mismatches, m)
+	return int(n), nil
+}
+
+// scrubbed records which replicas a full scrub found in agreement, they're preferred by reads from then on
+func (f *File) scrubbed(r *ScrubReport) {
+	bad := make(map[string]bool)
+	for _, m := range r.Mismatches {
+		for _, p := range m.Paths {
+			bad[p] = true
+		}
+	}
+	for i := range f.multi {
+		switch {
+		case bad[f.paths[i]]:
+			f.markVerified(i, 0)
+		case f.usable(i) && !f.lagging(i):
+			f.markVerified(i, r.StartGeneration)
+		}
+	}
+}
+
+// lagging reports whether replica i's watermark shows it missed the latest write
+func (f *File) lagging(i int) bool {
+	f.markMu.Lock()
+	defer f.markMu.Unlock()
+	return f.marks != nil && f.marks[i].gen < f.gen
+}
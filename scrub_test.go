@@ -0,0 +1,57 @@
+package haraqafs
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"sync"
+	"testing"
+)
+
+func TestScrub(t *testing.T) {
+	volumes := newTmpVolumes(t, 3)
+	defer removeVolumes(volumes)
+
+	f, err := New("scrub", WithVolumes(volumes...), WithCreate(), WithBlockRepair(16))
+	checkErr(t, err)
+	defer checkClose(t, f)
+	checkWrite(t, f, bytes.Repeat([]byte("a"), 64))
+
+	// flip a byte in the second chunk behind the file's back
+	replica, err := os.OpenFile(f.paths[2], os.O_RDWR, 0)
+	checkErr(t, err)
+	_, err = replica.WriteAt([]byte("b"), 20)
+	checkErr(t, err)
+	checkErr(t, replica.Close())
+
+	// writers keep going while the scrub runs
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			if _, err := f.WriteAt([]byte("cccc"), int64(64+4*i)); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+	r, err := f.Scrub(context.Background())
+	wg.Wait()
+	checkErr(t, err)
+	if len(r.Mismatches) != 1 || r.Mismatches[0].Offset != 16 || r.Mismatches[0].Length != 16 {
+		t.Fatal(r.Mismatches)
+	}
+	if paths := r.Mismatches[0].Paths; len(paths) != 1 || paths[0] != f.paths[2] {
+		t.Fatal(paths)
+	}
+	if r.Bytes < 64 || r.EndGeneration < r.StartGeneration {
+		t.Fatal(r)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := f.Scrub(ctx); err != context.Canceled {
+		t.Fatal(err)
+	}
+}
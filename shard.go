@@ -0,0 +1,57 @@
+package haraqafs
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+)
+
+const maxShardLevels = 8
+
+// shardName maps a logical name to a hashed subdirectory layout, e.g. ab/cd/name
+func shardName(name string, levels int) string {
+	name = filepath.Clean(name)
+	sum := sha256.Sum256([]byte(filepath.ToSlash(name)))
+	h := hex.EncodeToString(sum[:])
+	parts := make([]string, 0, levels+1)
+	for i := 0; i < levels; i++ {
+		parts = append(parts, h[2*i:2*i+2])
+	}
+	return filepath.Join(append(parts, name)...)
+}
+
+// replicaPaths returns the path of name on each volume. with sharding enabled every replica shares one layout, the
+// sharded one if any volume has it, an existing flat one if any volume has that instead, and sharded for a new file
+func (f *File) replicaPaths(volumes []string, name string) []string {
+	paths := make([]string, len(volumes))
+	if f.shardLevels == 0 {
+		for i, v := range volumes {
+			paths[i] = filepath.Join(v, name)
+		}
+		return paths
+	}
+	layout := func(name string) bool {
+		for i, v := range volumes {
+			paths[i] = filepath.Join(v, name)
+		}
+		for _, p := range paths {
+			if _, err := os.Stat(p); err == nil {
+				return true
+			}
+		}
+		return false
+	}
+	sharded := shardName(name, f.shardLevels)
+	if !layout(sharded) && layout(name) {
+		return paths
+	}
+	layout(sharded)
+	if f.flags&os.O_CREATE != 0 {
+		for _, p := range paths {
+			// best effort, the open will report any failure
+			_ = os.MkdirAll(filepath.Dir(p), f.dirPerm())
+		}
+	}
+	return paths
+}
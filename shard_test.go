@@ -0,0 +1,64 @@
+package haraqafs
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWithSharding(t *testing.T) {
+	v1 := newTmpVolume(t, "shard_1*")
+	defer os.RemoveAll(v1)
+
+	f, err := New("sharded", WithVolumes(v1), WithSharding(2), WithCreate())
+	checkErr(t, err)
+	checkWrite(t, f, []byte("hello"))
+	checkClose(t, f)
+	if _, err = os.Stat(filepath.Join(v1, shardName("sharded", 2))); err != nil {
+		t.Fatal(err)
+	}
+
+	// existing flat files are still found
+	checkErr(t, os.WriteFile(filepath.Join(v1, "flat"), []byte("hello"), 0666))
+	f, err = New("flat", WithVolumes(v1), WithSharding(2), WithCreateIfNotExist())
+	checkErr(t, err)
+	checkRead(t, f, []byte("hello"))
+	checkClose(t, f)
+
+	if _, err = New("flat", WithSharding(maxShardLevels+1)); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestShardingLayout(t *testing.T) {
+	volumes := newTmpVolumes(t, 3)
+	defer removeVolumes(volumes)
+
+	// a replica left flat on one volume doesn't split the file across layouts
+	checkErr(t, os.WriteFile(filepath.Join(volumes[0], "mixed"), []byte("hello"), 0666))
+	for _, v := range volumes[1:] {
+		sharded := filepath.Join(v, shardName("mixed", 2))
+		checkErr(t, os.MkdirAll(filepath.Dir(sharded), 0777))
+		checkErr(t, os.WriteFile(sharded, []byte("hello"), 0666))
+	}
+	f, err := New("mixed", WithVolumes(volumes...), WithSharding(2), WithCreateIfNotExist())
+	checkErr(t, err)
+	for i, p := range f.paths {
+		if p != filepath.Join(volumes[i], shardName("mixed", 2)) {
+			t.Fatal(f.paths)
+		}
+	}
+	checkClose(t, f)
+
+	// a flat file missing from some volumes stays flat on all of them
+	checkErr(t, os.WriteFile(filepath.Join(volumes[1], "flat"), []byte("hello"), 0666))
+	checkErr(t, os.WriteFile(filepath.Join(volumes[2], "flat"), []byte("hello"), 0666))
+	f, err = New("flat", WithVolumes(volumes...), WithSharding(2), WithCreateIfNotExist())
+	checkErr(t, err)
+	for i, p := range f.paths {
+		if p != filepath.Join(volumes[i], "flat") {
+			t.Fatal(f.paths)
+		}
+	}
+	checkClose(t, f)
+}
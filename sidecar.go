@@ -0,0 +1,159 @@
+package haraqafs
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// sidecars returns the files kept next to the replica at path which describe its content, the digest, hash, journal and redo sidecars and any quarantined torn tails.
+// lock and lease directories belong to the handles holding them and are left for them to release
+func sidecars(path string) []string {
+	var found []string
+	for _, suffix := range []string{digestSuffix, hashSuffix, journalSuffix, stageSuffix, commitSuffix} {
+		if _, err := os.Lstat(path + suffix); err == nil {
+			found = append(found, path+suffix)
+		}
+	}
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	prefix := filepath.Base(path) + ".torn."
+	for _, e := range entries {
+		if !strings.HasPrefix(e.Name(), prefix) {
+			continue
+		}
+		if _, err := strconv.ParseInt(strings.TrimPrefix(e.Name(), prefix), 10, 64); err == nil {
+			found = append(found, filepath.Join(filepath.Dir(path), e.Name()))
+		}
+	}
+	return found
+}
+
+// removeSidecars removes the sidecars of the replica at path
+func removeSidecars(path string) error {
+	for _, s := range sidecars(path) {
+		if err := os.Remove(s); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// renameReplica moves the replica at from to to along with its sidecars, replacing the file at to
+func renameReplica(from, to string) error {
+	m, err := moveReplica(from, to)
+	if err != nil {
+		return err
+	}
+	m.settle()
+	return nil
+}
+
+// replicaMove is a replica moved by moveReplica, the file and sidecars it displaced at its destination are kept aside
+// until the move is settled or undone
+type replicaMove struct {
+	from, to string
+	aside    [][2]string
+}
+
+// moveReplica moves the replica at from to to along with its sidecars. the file and sidecars left at to by an older file
+// are moved aside first, so a crash part way through never leaves to pointing at metadata for the wrong file and undo
+// can put them back
+func moveReplica(from, to string) (*replicaMove, error) {
+	m := &replicaMove{from: from, to: to}
+	displaced := sidecars(to)
+	if info, err := os.Lstat(to); err == nil && !info.IsDir() {
+		displaced = append([]string{to}, displaced...)
+	}
+	for _, p := range displaced {
+		aside := asidePath(p)
+		if err := os.Rename(p, aside); err != nil {
+			m.restore()
+			return nil, err
+		}
+		m.aside = append(m.aside, [2]string{p, aside})
+	}
+	moving := sidecars(from)
+	if err := os.Rename(from, to); err != nil {
+		m.restore()
+		return nil, err
+	}
+	for _, s := range moving {
+		if err := os.Rename(s, to+strings.TrimPrefix(s, from)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			_ = m.undo()
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// undo moves the replica and its sidecars back and puts back what the move displaced
+func (m *replicaMove) undo() error {
+	moving := sidecars(m.to)
+	if err := os.Rename(m.to, m.from); err != nil {
+		return err
+	}
+	var errs []error
+	for _, s := range moving {
+		if err := os.Rename(s, m.from+strings.TrimPrefix(s, m.to)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			errs = append(errs, err)
+		}
+	}
+	if err := m.restore(); err != nil {
+		errs = append(errs, err)
+	}
+	return aggErrors(errs)
+}
+
+func (m *replicaMove) restore() error {
+	var errs []error
+	for k := len(m.aside) - 1; k >= 0; k-- {
+		if err := os.Rename(m.aside[k][1], m.aside[k][0]); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	m.aside = nil
+	return aggErrors(errs)
+}
+
+// settle removes what the move displaced
+func (m *replicaMove) settle() {
+	for _, a := range m.aside {
+		_ = os.RemoveAll(a[1])
+	}
+	m.aside = nil
+}
+
+// asidePath returns a name next to path to move it out of the way under, named like the other temporary files so GC
+// collects it after a crash
+func asidePath(path string) string {
+	var b [8]byte
+	_, _ = rand.Read(b[:])
+	return filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+tmpMarker+hex.EncodeToString(b[:]))
+}
+
+// replaceFile writes b to a temporary file next to path and renames it over path, so path holds either its old
+// content or b even when a crash cuts the write short
+func replaceFile(path string, b []byte) error {
+	dir, base := filepath.Split(path)
+	tmp, err := os.CreateTemp(dir, "."+base+tmpMarker+"*")
+	if err != nil {
+		return err
+	}
+	if _, err = tmp.Write(b); err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+	}
+	return err
+}
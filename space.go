@@ -0,0 +1,62 @@
+package haraqafs
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// planRepair picks the least loaded of the replicas agreeing with the source at index to copy from, orders the lagging
+// replicas emptiest volume first, and marks dirty the ones whose volume would be left with less than the reserve.
+// volumes whose free space can't be read are repaired last, and volumes with no reads recorded are never picked as least loaded
+func (f *File) planRepair(index int, hashes [][]byte, sizes []int64, lagging []int) (int, []int) {
+	if !f.spaceAware {
+		return index, lagging
+	}
+	if f.stats != nil {
+		best, sampled := f.readLatency(index)
+		for i := range f.multi {
+			if f.multi[i] != nil && i != index && bytes.Equal(hashes[i], hashes[index]) {
+				if l, ok := f.readLatency(i); ok && (!sampled || l < best) {
+					index, best, sampled = i, l, true
+				}
+			}
+		}
+	}
+
+	free := make(map[int]int64, len(lagging))
+	known := make(map[int]bool, len(lagging))
+	planned := lagging[:0]
+	for _, i := range lagging {
+		free[i], known[i] = f.volumeFree(filepath.Dir(f.paths[i]))
+		if known[i] && free[i]-(sizes[index]-sizes[i]) < f.repairReserve {
+			f.markDirty(i, fmt.Errorf("repairing %s would leave %d bytes free on %s, %d reserved: %w",
+				f.paths[i], free[i]-(sizes[index]-sizes[i]), f.volumes[i], f.repairReserve, ErrNoSpace))
+			continue
+		}
+		planned = append(planned, i)
+	}
+	sort.SliceStable(planned, func(a, b int) bool {
+		if known[planned[a]] != known[planned[b]] {
+			return known[planned[a]]
+		}
+		return free[planned[a]] > free[planned[b]]
+	})
+	return index, planned
+}
+
+// readLatency is the mean read latency seen on replica i's volume, false if no read has been seen there yet
+func (f *File) readLatency(i int) (time.Duration, bool) {
+	read := f.stats.Volumes(f.volumes[i])[0].Read
+	return read.Mean, read.Count > 0
+}
+
+// volumeFree is the free space of the volume holding path, false if it can't be read
+func (f *File) volumeFree(path string) (int64, bool) {
+	if f.freeSpace != nil {
+		return f.freeSpace(path)
+	}
+	return freeSpace(path)
+}
@@ -0,0 +1,8 @@
+//go:build !darwin && !freebsd && !linux
+// +build !darwin,!freebsd,!linux
+
+package haraqafs
+
+func freeSpace(path string) (int64, bool) {
+	return 0, false
+}
@@ -0,0 +1,72 @@
+package haraqafs
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWithSpaceAwareRepair(t *testing.T) {
+	volumes := newTmpVolumes(t, 4)
+	defer removeVolumes(volumes)
+	free := map[string]int64{volumes[0]: 1 << 30, volumes[1]: 1 << 30, volumes[2]: 1 << 20, volumes[3]: 1 << 10}
+	withFree := withFreeSpace(func(path string) (int64, bool) {
+		n, ok := free[path]
+		return n, ok
+	})
+
+	f, err := New("file", WithVolumes(volumes...), WithCreate())
+	checkErr(t, err)
+	checkWrite(t, f, make([]byte, 4<<10))
+	checkClose(t, f)
+	for _, v := range volumes[2:] {
+		checkErr(t, os.Remove(filepath.Join(v, "file")))
+	}
+
+	// the tight volume is left dirty rather than filled
+	var events []Event
+	f, err = New("file", WithVolumes(volumes...), WithCreateIfNotExist(), WithQuorum(2), WithSpaceAwareRepair(1<<10), withFree, WithEvents(func(e Event) { events = append(events, e) }))
+	checkErr(t, err)
+	info, err := os.Stat(filepath.Join(volumes[2], "file"))
+	checkErr(t, err)
+	if info.Size() != 4<<10 {
+		t.Fatal(info.Size())
+	}
+	if info, err = os.Stat(filepath.Join(volumes[3], "file")); err != nil || info.Size() != 0 {
+		t.Fatal(info, err)
+	}
+	if len(events) != 1 || events[0].Kind != EventDirty || events[0].Volume != volumes[3] || !strings.Contains(events[0].Err.Error(), ErrNoSpace.Error()) {
+		t.Fatal(events)
+	}
+	checkClose(t, f)
+
+	// copies come from the least loaded agreeing replica, onto the emptiest volume first
+	stats := NewStats()
+	stats.record(volumes[0], opRead, time.Second)
+	stats.record(volumes[1], opRead, time.Millisecond)
+	f, err = New("file", WithVolumes(volumes...), WithSpaceAwareRepair(0), WithStats(stats), withFree)
+	checkErr(t, err)
+	defer checkClose(t, f)
+	free[volumes[3]] = 1 << 40
+	hashes := [][]byte{{1}, {1}, {2}, {2}}
+	index, lagging := f.planRepair(0, hashes, []int64{5, 5, 0, 0}, []int{2, 3})
+	if index != 1 || len(lagging) != 2 || lagging[0] != 3 || lagging[1] != 2 {
+		t.Fatal(index, lagging)
+	}
+
+	// a volume nothing has been read from isn't taken for the least loaded
+	hashes = [][]byte{{1}, {2}, {1}, {2}}
+	if index, _ = f.planRepair(0, hashes, []int64{5, 0, 5, 0}, nil); index != 0 {
+		t.Fatal(index)
+	}
+}
+
+// withFreeSpace fakes the free space of the volumes with free
+func withFreeSpace(free func(path string) (int64, bool)) FileOption {
+	return func(f *File) error {
+		f.freeSpace = free
+		return nil
+	}
+}
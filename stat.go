@@ -0,0 +1,57 @@
+package haraqafs
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// fileInfo is the consensus view of a file, a replica's info with the size the replicas agreed on
+type fileInfo struct {
+	os.FileInfo
+	name string
+	size int64
+}
+
+func (fi *fileInfo) Name() string { return fi.name }
+func (fi *fileInfo) Size() int64  { return fi.size }
+
+// Stat returns the info of the first usable replica in read order, reporting the consensus size,
+// so a File can stand in where an os.File is expected. ReplicaStats returns the info of every replica
+func (f *File) Stat() (os.FileInfo, error) {
+	if f == nil || len(f.multi) == 0 || f.lock == nil {
+		return nil, os.ErrInvalid
+	}
+	if err := f.acquireRead(); err != nil {
+		return nil, err
+	}
+	defer f.releaseRead()
+
+	info, err := f.stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return info, nil
+	}
+	return &fileInfo{FileInfo: info, name: filepath.Base(f.paths[0]), size: f.size}, nil
+}
+
+// ReplicaStats returns the info of each replica in volume order, nil where a replica is missing or couldn't be stat'd
+func (f *File) ReplicaStats() ([]os.FileInfo, error) {
+	if f == nil || len(f.multi) == 0 || f.lock == nil {
+		return nil, os.ErrInvalid
+	}
+	if err := f.acquireRead(); err != nil {
+		return nil, err
+	}
+	defer f.releaseRead()
+
+	infos := make([]os.FileInfo, len(f.multi))
+	for i := range f.multi {
+		if f.multi[i] == nil {
+			continue
+		}
+		infos[i], _ = f.multi[i].Stat()
+	}
+	return infos, nil
+}
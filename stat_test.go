@@ -0,0 +1,34 @@
+package haraqafs
+
+import "testing"
+
+func TestStat(t *testing.T) {
+	volumes := newTmpVolumes(t, 3)
+	defer removeVolumes(volumes)
+
+	f, err := New("my_file", WithVolumes(volumes...), WithCreate())
+	checkErr(t, err)
+	checkWrite(t, f, []byte("hello"))
+	checkErr(t, f.Truncate(3))
+
+	info, err := f.Stat()
+	checkErr(t, err)
+	if info.Name() != "my_file" || info.Size() != 3 || info.IsDir() || !info.Mode().IsRegular() {
+		t.Fatal(info.Name(), info.Size(), info.Mode())
+	}
+
+	infos, err := f.ReplicaStats()
+	checkErr(t, err)
+	if len(infos) != 3 {
+		t.Fatal(infos)
+	}
+	for _, info := range infos {
+		if info == nil || info.Size() != 3 {
+			t.Fatal(info)
+		}
+	}
+	checkClose(t, f)
+	if _, err = f.Stat(); err == nil {
+		t.Fatal("expected error")
+	}
+}
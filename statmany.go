@@ -0,0 +1,119 @@
+package haraqafs
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// NameStat is what StatMany found out about a name without opening it
+type NameStat struct {
+	Name string
+	// Exists is true when a quorum of replicas hold the name
+	Exists bool
+	// Size is the size a quorum of replicas agree on, -1 when they don't
+	Size int64
+	// Replicas counts the replicas holding the name
+	Replicas int
+	Err      error
+}
+
+// StatMany reports the existence and consensus size of every name by stat'ing the replicas, several names at a time.
+// nothing is opened, created or repaired
+func (fsys *FS) StatMany(names []string) ([]NameStat, error) {
+	scratch := &File{}
+	if err := applyScratch(scratch, fsys.opts); err != nil {
+		return nil, err
+	}
+	if len(scratch.volumes) == 0 && scratch.ring == nil {
+		return nil, fmt.Errorf("missing volumes: %w", os.ErrInvalid)
+	}
+	// replicaPaths mustn't create shard directories
+	scratch.flags = os.O_RDONLY
+
+	stats := make([]NameStat, len(names))
+	indexes := make([]int, len(names))
+	for i := range indexes {
+		indexes[i] = i
+	}
+	boundedEach(openManyWorkers, len(names), indexes, func(i int) error {
+		stats[i] = scratch.statName(names[i])
+		return nil
+	})
+	return stats, nil
+}
+
+// Exists reports whether a quorum of replicas hold name
+func (fsys *FS) Exists(name string) (bool, error) {
+	stats, err := fsys.StatMany([]string{name})
+	if err != nil {
+		return false, err
+	}
+	return stats[0].Exists, stats[0].Err
+}
+
+func (f *File) statName(name string) NameStat {
+	s := NameStat{Name: name, Size: -1}
+	name, err := logicalName("stat", name)
+	if err != nil {
+		s.Err = err
+		return s
+	}
+	volumes, err := f.placement.resolve(name, f.placeVolumes(name))
+	if err != nil {
+		s.Err = err
+		return s
+	}
+	quorum := f.quorum
+	if quorum == 0 {
+		quorum = 1 + len(volumes)/2
+	}
+	if f.erasure != nil && f.quorum == 0 {
+		quorum = f.erasure.code.data
+	}
+
+	sizes := make(map[int64]int)
+	// shards hold a part of the file each, their size is the one in the header of the newest generation
+	var newest uint64
+	shards := make(map[uint64]int)
+	shardSizes := make(map[uint64]int64)
+	var errs []error
+	for _, path := range f.replicaPaths(volumes, f.jailName(name)) {
+		info, err := os.Stat(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		s.Replicas++
+		switch {
+		case info.IsDir():
+		case f.erasure == nil:
+			sizes[info.Size()]++
+		default:
+			if size, gen, ok := readShardHeader(path); ok {
+				shards[gen]++
+				shardSizes[gen] = size
+				if gen > newest {
+					newest = gen
+				}
+			}
+		}
+	}
+	s.Exists = s.Replicas >= quorum
+	for size, n := range sizes {
+		if n >= quorum {
+			s.Size = size
+		}
+	}
+	if shards[newest] >= quorum {
+		s.Size = shardSizes[newest]
+	}
+	// errors only matter when they could have changed the answer
+	if !s.Exists && s.Replicas+len(errs) >= quorum {
+		s.Err = aggErrors(errs)
+	}
+	return s
+}
@@ -0,0 +1,40 @@
+package haraqafs
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStatMany(t *testing.T) {
+	volumes := newTmpVolumes(t, 3)
+	defer removeVolumes(volumes)
+	fsys := NewFS(WithVolumes(volumes...))
+
+	f, err := fsys.New("everywhere", WithCreate())
+	checkErr(t, err)
+	checkWrite(t, f, []byte("hello"))
+	checkClose(t, f)
+	checkErr(t, os.WriteFile(filepath.Join(volumes[0], "minority"), []byte("hi"), 0666))
+	checkErr(t, os.WriteFile(filepath.Join(volumes[0], "split"), []byte("a"), 0666))
+	checkErr(t, os.WriteFile(filepath.Join(volumes[1], "split"), []byte("bb"), 0666))
+
+	stats, err := fsys.StatMany([]string{"everywhere", "minority", "split", "missing"})
+	checkErr(t, err)
+	want := []NameStat{
+		{Name: "everywhere", Exists: true, Size: 5, Replicas: 3},
+		{Name: "minority", Size: -1, Replicas: 1},
+		{Name: "split", Exists: true, Size: -1, Replicas: 2},
+		{Name: "missing", Size: -1},
+	}
+	for i := range want {
+		if stats[i] != want[i] {
+			t.Fatal(stats[i], want[i])
+		}
+	}
+
+	ok, err := fsys.Exists("everywhere")
+	if err != nil || !ok {
+		t.Fatal(ok, err)
+	}
+}
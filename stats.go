@@ -0,0 +1,194 @@
+package haraqafs
+
+import (
+	"math/bits"
+	"sort"
+	"sync"
+	"time"
+)
+
+type opKind int
+
+const (
+	opOpen opKind = iota
+	opRead
+	opWrite
+	opSync
+	opCount
+)
+
+// Stats tracks per volume latency histograms, it's safe to share between files
+type Stats struct {
+	mu      sync.Mutex
+	volumes map[string]*[opCount]histogram
+}
+
+type VolumeStats struct {
+	Volume string
+	Open   Latency
+	Read   Latency
+	Write  Latency
+	Sync   Latency
+}
+
+type Latency struct {
+	Count uint64
+	Min   time.Duration
+	Max   time.Duration
+	Mean  time.Duration
+	P50   time.Duration
+	P90   time.Duration
+	P99   time.Duration
+}
+
+func NewStats() *Stats {
+	return &Stats{volumes: make(map[string]*[opCount]histogram)}
+}
+
+func (s *Stats) record(volume string, op opKind, d time.Duration) {
+	s.mu.Lock()
+	h, ok := s.volumes[volume]
+	if !ok {
+		h = new([opCount]histogram)
+		s.volumes[volume] = h
+	}
+	h[op].record(d)
+	s.mu.Unlock()
+}
+
+// Volumes returns a snapshot of the latencies of every volume seen so far, sorted by volume
+func (s *Stats) Volumes(volumes ...string) []VolumeStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(volumes) == 0 {
+		for v := range s.volumes {
+			volumes = append(volumes, v)
+		}
+		sort.Strings(volumes)
+	}
+	out := make([]VolumeStats, 0, len(volumes))
+	for _, v := range volumes {
+		h, ok := s.volumes[v]
+		if !ok {
+			h = new([opCount]histogram)
+		}
+		out = append(out, VolumeStats{
+			Volume: v,
+			Open:   h[opOpen].snapshot(),
+			Read:   h[opRead].snapshot(),
+			Write:  h[opWrite].snapshot(),
+			Sync:   h[opSync].snapshot(),
+		})
+	}
+	return out
+}
+
+// histogram is a log-linear histogram, every power of two is split into histSub buckets giving roughly 12% precision
+const (
+	histSubBits = 3
+	histSub     = 1 << histSubBits
+)
+
+type histogram struct {
+	counts [64 * histSub]uint64
+	count  uint64
+	sum    time.Duration
+	min    time.Duration
+	max    time.Duration
+}
+
+func histBucket(d time.Duration) int {
+	v := uint64(d)
+	if v < histSub {
+		return int(v)
+	}
+	exp := bits.Len64(v) - 1
+	sub := (v >> uint(exp-histSubBits)) & (histSub - 1)
+	return (exp-histSubBits+1)*histSub + int(sub)
+}
+
+// histValue returns the upper bound of a bucket
+func histValue(b int) time.Duration {
+	if b < histSub {
+		return time.Duration(b)
+	}
+	exp := b/histSub + histSubBits - 1
+	sub := uint64(b % histSub)
+	return time.Duration((histSub+sub+1)<<uint(exp-histSubBits) - 1)
+}
+
+func (h *histogram) record(d time.Duration) {
+	if d < 0 {
+		d = 0
+	}
+	h.counts[histBucket(d)]++
+	if h.count == 0 || d < h.min {
+		h.min = d
+	}
+	if d > h.max {
+		h.max = d
+	}
+	h.count++
+	h.sum += d
+}
+
+func (h *histogram) percentile(p float64) time.Duration {
+	if h.count == 0 {
+		return 0
+	}
+	target := uint64(p*float64(h.count) + 0.5)
+	if target == 0 {
+		target = 1
+	}
+	var seen uint64
+	for b, c := range h.counts {
+		seen += c
+		if seen >= target {
+			if v := histValue(b); v < h.max {
+				return v
+			}
+			return h.max
+		}
+	}
+	return h.max
+}
+
+func (h *histogram) snapshot() Latency {
+	if h.count == 0 {
+		return Latency{}
+	}
+	return Latency{
+		Count: h.count,
+		Min:   h.min,
+		Max:   h.max,
+		Mean:  h.sum / time.Duration(h.count),
+		P50:   h.percentile(0.50),
+		P90:   h.percentile(0.90),
+		P99:   h.percentile(0.99),
+	}
+}
+
+func (f *File) observe(i int, op opKind, start time.Time) {
+	if f.stats == nil && !f.trackHealth() && f.trust.latency == nil {
+		return
+	}
+	f.observeDuration(i, op, time.Since(start))
+}
+
+func (f *File) observeDuration(i int, op opKind, d time.Duration) {
+	f.sample(i, op, d)
+	if op == opRead {
+		f.timeRead(i, d)
+	}
+	if f.stats != nil {
+		f.stats.record(f.volumes[i], op, d)
+	}
+}
+
+// Stats returns the latencies of the file's volumes, if stats were enabled with WithStats
+func (f *File) Stats() []VolumeStats {
+	if f == nil || f.stats == nil {
+		return nil
+	}
+	return f.stats.Volumes(f.volumes...)
+}
@@ -0,0 +1,45 @@
+package haraqafs
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHistogram(t *testing.T) {
+	var h histogram
+	for i := 1; i <= 1000; i++ {
+		h.record(time.Duration(i) * time.Microsecond)
+	}
+	l := h.snapshot()
+	if l.Count != 1000 || l.Min != time.Microsecond || l.Max != time.Millisecond {
+		t.Fatal(l)
+	}
+	for _, c := range []struct {
+		got, want time.Duration
+	}{{l.P50, 500 * time.Microsecond}, {l.P90, 900 * time.Microsecond}, {l.P99, 990 * time.Microsecond}} {
+		if c.got < c.want*87/100 || c.got > c.want*113/100 {
+			t.Fatal(c.got, c.want)
+		}
+	}
+}
+
+func TestFSStats(t *testing.T) {
+	volumes := newTmpVolumes(t, 2)
+	defer removeVolumes(volumes)
+
+	fsys := NewFS(WithVolumes(volumes...))
+	f, err := fsys.New("my_file", WithCreate(), WithForceSync(true))
+	checkErr(t, err)
+	checkWrite(t, f, []byte("hello"))
+	checkClose(t, f)
+
+	stats := fsys.Stats()
+	if len(stats) != 2 {
+		t.Fatal(stats)
+	}
+	for _, s := range stats {
+		if s.Open.Count != 1 || s.Write.Count != 1 || s.Sync.Count != 1 {
+			t.Fatal(s)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package haraqafs
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+type Status struct {
+	Quorum     int        `json:"quorum"`
+	QuorumFail string     `json:"quorum_fail"`
+	Offset     int64      `json:"offset"`
+	AppendOnly bool       `json:"append_only"`
+	Sync       SyncPolicy `json:"sync"`
+	// Deprecated: ForceSync is set when every write is synced with its metadata, use Sync
+	ForceSync      bool            `json:"force_sync"`
+	Closed         bool            `json:"closed"`
+	Busy           bool            `json:"busy"`
+	Replicas       []ReplicaStatus `json:"replicas"`
+	PendingRepairs []string        `json:"pending_repairs,omitempty"`
+	QuorumLost     bool            `json:"quorum_lost,omitempty"`
+}
+
+type ReplicaStatus struct {
+	Volume string `json:"volume"`
+	Path   string `json:"path"`
+	State  string `json:"state"`
+	// Verified is the generation the replica was last checked against the others at, 0 when it wasn't or failed the check
+	Verified uint64 `json:"verified_generation,omitempty"`
+}
+
+func (s replicaState) String() string {
+	switch s {
+	case replicaHealthy:
+		return "healthy"
+	case replicaDegraded:
+		return "degraded"
+	case replicaDirty:
+		return "dirty"
+	}
+	return fmt.Sprintf("replicaState(%d)", int(s))
+}
+
+func (qf QuorumFail) String() string {
+	switch qf {
+	case QFError:
+		return "error"
+	case QFWriteFirst:
+		return "write-first"
+	case QFWriteLast:
+		return "write-last"
+	case QFOrderFirst:
+		return "order-first"
+	case QFOrderLast:
+		return "order-last"
+	case QFLongest:
+		return "longest"
+	case QFShortest:
+		return "shortest"
+	case QFShortestNonZero:
+		return "shortest-non-zero"
+	}
+	return fmt.Sprintf("QuorumFail(%d)", int(qf))
+}
+
+// Status returns a snapshot of the replica state, if another operation holds the file only the static configuration is reported
+func (f *File) Status() Status {
+	if f == nil || f.lock == nil {
+		return Status{Closed: true}
+	}
+	s := Status{
+		Quorum:     f.writeQuorum(),
+		QuorumFail: f.quorumFail.String(),
+		AppendOnly: f.appendOnly,
+		QuorumLost: f.QuorumLost(),
+		Sync:       f.syncPolicy,
+		ForceSync:  f.syncPolicy == SyncWrite || f.syncPolicy == SyncDataDir,
+	}
+	switch ok, closed := f.lock.tryRLock(); {
+	case closed:
+		s.Closed = true
+		return s
+	case ok:
+		defer f.lock.runlock()
+	default:
+		s.Busy = true
+	}
+
+	s.Replicas = make([]ReplicaStatus, len(f.paths))
+	for i := range f.paths {
+		s.Replicas[i] = ReplicaStatus{Volume: f.volumes[i], Path: f.paths[i], Verified: f.verifiedAt(i)}
+		switch {
+		case s.Busy:
+			s.Replicas[i].State = "unknown"
+		case f.multi[i] == nil:
+			s.Replicas[i].State = "missing"
+		case f.health != nil:
+			s.Replicas[i].State = f.health[i].getState().String()
+		default:
+			s.Replicas[i].State = replicaHealthy.String()
+		}
+	}
+	if !s.Busy {
+		s.Offset = f.offset
+	}
+
+	// list the replicas which need repair before they can be trusted
+	for _, r := range s.Replicas {
+		switch r.State {
+		case "missing", replicaDegraded.String(), replicaDirty.String():
+			s.PendingRepairs = append(s.PendingRepairs, r.Path)
+		}
+	}
+	return s
+}
+
+func (f *File) StatusJSON() ([]byte, error) {
+	return json.Marshal(f.Status())
+}
+
+func (s Status) String() string {
+	var b strings.Builder
+	switch {
+	case s.Closed:
+		b.WriteString("closed ")
+	case s.Busy:
+		b.WriteString("busy ")
+	}
+	fmt.Fprintf(&b, "quorum=%d/%d quorum-fail=%s offset=%d", s.Quorum, len(s.Replicas), s.QuorumFail, s.Offset)
+	if s.AppendOnly {
+		b.WriteString(" append-only")
+	}
+	if s.Sync != SyncBarrier {
+		fmt.Fprintf(&b, " sync=%s", s.Sync)
+	}
+	for _, r := range s.Replicas {
+		fmt.Fprintf(&b, "\n  %s %s (volume %s)", r.State, r.Path, r.Volume)
+	}
+	if len(s.PendingRepairs) > 0 {
+		fmt.Fprintf(&b, "\n  pending repairs: %s", strings.Join(s.PendingRepairs, ", "))
+	}
+	return b.String()
+}
+
+func (f *File) DebugState() string {
+	return f.Status().String()
+}
+
+func (f *File) String() string {
+	if f == nil {
+		return "<nil>"
+	}
+	return fmt.Sprintf("haraqafs.File{%s}", strings.Replace(f.DebugState(), "\n ", ";", -1))
+}
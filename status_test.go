@@ -0,0 +1,43 @@
+package haraqafs
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStatus(t *testing.T) {
+	volumes := newTmpVolumes(t, 2)
+	defer removeVolumes(volumes)
+
+	f, err := New("my_file", WithVolumes(volumes...), WithCreate(), WithReplicaTimeout(time.Second))
+	checkErr(t, err)
+	checkWrite(t, f, []byte("hello"))
+	f.markDirty(1, nil)
+
+	s := f.Status()
+	if s.Offset != 5 || s.Quorum != 2 || len(s.Replicas) != 2 || s.Replicas[1].State != "dirty" {
+		t.Fatal(s)
+	}
+	if len(s.PendingRepairs) != 1 || s.PendingRepairs[0] != f.paths[1] {
+		t.Fatal(s.PendingRepairs)
+	}
+	if str := f.String(); !strings.Contains(str, "dirty "+f.paths[1]) || !strings.Contains(str, "offset=5") {
+		t.Fatal(str)
+	}
+	t.Log(f.DebugState())
+
+	b, err := f.StatusJSON()
+	checkErr(t, err)
+	var decoded Status
+	checkErr(t, json.Unmarshal(b, &decoded))
+	if !reflect.DeepEqual(decoded, s) {
+		t.Fatal(string(b))
+	}
+	checkClose(t, f)
+	if !f.Status().Closed {
+		t.Fatal(f.Status())
+	}
+}
@@ -0,0 +1,91 @@
+package haraqafs
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+type ReadStrategy int
+
+const (
+	// ReadOrdered tries replicas by read weight and verification, see readPlan
+	ReadOrdered ReadStrategy = iota
+	// ReadPrimary only reads from the first usable replica in read order, its errors aren't retried on the others
+	ReadPrimary
+	// ReadRoundRobin starts each read on the next replica in turn
+	ReadRoundRobin
+	// ReadFastest starts each read on the replica with the lowest recent read latency
+	ReadFastest
+	// ReadRandom starts each read on a random replica
+	ReadRandom
+)
+
+// WithReadStrategy picks which replica reads start on, so read load can be spread across volumes on different disks.
+// whatever the strategy, replicas which failed a read recently are only tried after the others
+func WithReadStrategy(s ReadStrategy) FileOption {
+	return func(f *File) error {
+		if s < ReadOrdered || s > ReadRandom {
+			return fmt.Errorf("unknown read strategy %d: %w", s, os.ErrInvalid)
+		}
+		f.strategy = s
+		return nil
+	}
+}
+
+// spread reorders the replicas in plan which haven't failed recently according to the read strategy
+func (f *File) spread(plan []int) []int {
+	ok := len(plan)
+	for ok > 0 && f.failedRecently(plan[ok-1]) {
+		ok--
+	}
+	if ok < 2 {
+		return plan
+	}
+	switch f.strategy {
+	case ReadRoundRobin:
+		rotate(plan[:ok], int(atomic.AddUint64(&f.trust.turn, 1)%uint64(ok)))
+	case ReadRandom:
+		rotate(plan[:ok], rand.Intn(ok))
+	case ReadFastest:
+		// replicas which haven't been timed yet sort first, so each gets measured
+		for j := 1; j < ok; j++ {
+			for k := j; k > 0 && f.latency(plan[k]) < f.latency(plan[k-1]); k-- {
+				plan[k], plan[k-1] = plan[k-1], plan[k]
+			}
+		}
+	}
+	return plan
+}
+
+// rotate moves the first n elements of s to its end
+func rotate(s []int, n int) {
+	if n == 0 {
+		return
+	}
+	tmp := append([]int(nil), s[:n]...)
+	copy(s, s[n:])
+	copy(s[len(s)-n:], tmp)
+}
+
+// timeRead folds a read of replica i into its moving average latency
+func (f *File) timeRead(i int, d time.Duration) {
+	if i >= len(f.trust.latency) {
+		return
+	}
+	old := atomic.LoadInt64(&f.trust.latency[i])
+	if old == 0 {
+		atomic.StoreInt64(&f.trust.latency[i], int64(d))
+		return
+	}
+	atomic.StoreInt64(&f.trust.latency[i], old+(int64(d)-old)/8)
+}
+
+func (f *File) latency(i int) int64 {
+	if i >= len(f.trust.latency) {
+		return 0
+	}
+	return atomic.LoadInt64(&f.trust.latency[i])
+}
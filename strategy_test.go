@@ -0,0 +1,67 @@
+package haraqafs
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestWithReadStrategy(t *testing.T) {
+	volumes := newTmpVolumes(t, 3)
+	defer removeVolumes(volumes)
+	if _, err := New("my_file", WithVolumes(volumes...), WithCreate(), WithReadStrategy(ReadRandom+1)); !errors.Is(err, os.ErrInvalid) {
+		t.Fatal(err)
+	}
+	open := func(s ReadStrategy) *File {
+		f, err := New("my_file", WithVolumes(volumes...), WithCreate(), WithReadStrategy(s))
+		checkErr(t, err)
+		checkWrite(t, f, []byte("hello"))
+		return f
+	}
+
+	f := open(ReadPrimary)
+	for n := 0; n < 3; n++ {
+		if plan := f.readPlan(nil); len(plan) != 1 || plan[0] != 2 {
+			t.Fatal(plan)
+		}
+	}
+	checkClose(t, f)
+
+	f = open(ReadRoundRobin)
+	starts := make(map[int]bool)
+	for n := 0; n < 3; n++ {
+		plan := f.readPlan(nil)
+		if len(plan) != 3 {
+			t.Fatal(plan)
+		}
+		starts[plan[0]] = true
+	}
+	if len(starts) != 3 {
+		t.Fatal(starts)
+	}
+	checkClose(t, f)
+
+	f = open(ReadFastest)
+	f.trust.latency = []int64{30, 10, 20}
+	if plan := f.readPlan(nil); plan[0] != 1 || plan[1] != 2 || plan[2] != 0 {
+		t.Fatal(plan)
+	}
+	checkSeek(t, f, 0, 0)
+	checkRead(t, f, []byte("hello"))
+	if f.latency(1) == 10 {
+		t.Fatal("read wasn't timed")
+	}
+	checkClose(t, f)
+
+	f = open(ReadRandom)
+	for n := 0; n < 10; n++ {
+		seen := make(map[int]bool)
+		for _, i := range f.readPlan(nil) {
+			seen[i] = true
+		}
+		if len(seen) != 3 {
+			t.Fatal(seen)
+		}
+	}
+	checkClose(t, f)
+}
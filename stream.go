@@ -0,0 +1,83 @@
+package haraqafs
+
+import (
+	"errors"
+	"io"
+	"os"
+	"time"
+)
+
+const (
+	// streamChunk is how much ReadFrom reads from its source at a time
+	streamChunk = 1 << 20
+	// streamDepth is how many chunks ReadFrom has in flight, one being written while the next is read
+	streamDepth = 2
+)
+
+// ReadFrom writes everything read from r to the file at its offset, so io.Copy streams into it.
+// the next chunk is read from r while the last one is written to the replicas, rather than one after the other
+func (f *File) ReadFrom(r io.Reader) (int64, error) {
+	if f == nil || len(f.multi) == 0 || f.lock == nil {
+		return 0, os.ErrInvalid
+	}
+	type chunk struct {
+		buf []byte
+		err error
+	}
+	free := make(chan []byte, streamDepth)
+	for i := 0; i < streamDepth; i++ {
+		free <- nil
+	}
+	full := make(chan chunk, streamDepth)
+	stop := make(chan struct{})
+	go func() {
+		defer close(full)
+		for {
+			var buf []byte
+			select {
+			case buf = <-free:
+			case <-stop:
+				return
+			}
+			// a free buffer and stop can both be ready, stop wins
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			buf = f.chunkFor(buf, -1, streamChunk)
+			n, err := r.Read(buf)
+			full <- chunk{buf: buf[:n], err: err}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	// r isn't read once ReadFrom returns, even when a write failed part way through
+	defer func() {
+		close(stop)
+		for range full {
+		}
+	}()
+
+	var total int64
+	for c := range full {
+		if len(c.buf) > 0 {
+			start := time.Now()
+			n, err := f.Write(c.buf)
+			f.copied(-1, n, time.Since(start))
+			total += int64(n)
+			if err != nil {
+				return total, err
+			}
+		}
+		if errors.Is(c.err, io.EOF) {
+			return total, nil
+		}
+		if c.err != nil {
+			return total, c.err
+		}
+		free <- c.buf[:cap(c.buf)]
+	}
+	return total, nil
+}
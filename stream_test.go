@@ -0,0 +1,40 @@
+package haraqafs
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/iotest"
+)
+
+func TestReadFrom(t *testing.T) {
+	volumes := newTmpVolumes(t, 3)
+	defer removeVolumes(volumes)
+	f, err := New("my_file", WithVolumes(volumes...), WithCreate())
+	checkErr(t, err)
+
+	data := bytes.Repeat([]byte("0123456789"), 3*streamChunk/10+7)
+	n, err := io.Copy(f, iotest.HalfReader(bytes.NewReader(data)))
+	checkErr(t, err)
+	if n != int64(len(data)) {
+		t.Fatal(n)
+	}
+
+	// errors from the source stop the copy after what was read so far is written
+	bad := errors.New("bad source")
+	n, err = f.ReadFrom(io.MultiReader(bytes.NewReader([]byte("tail")), iotest.ErrReader(bad)))
+	if !errors.Is(err, bad) || n != 4 {
+		t.Fatal(n, err)
+	}
+	checkClose(t, f)
+	for _, v := range volumes {
+		b, err := os.ReadFile(filepath.Join(v, "my_file"))
+		checkErr(t, err)
+		if !bytes.Equal(b, append(data, "tail"...)) {
+			t.Fatal(len(b))
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package haraqafs
+
+import (
+	"fmt"
+	"os"
+)
+
+// SyncPolicy picks how durable a write is by the time it returns, trading throughput for what survives a power loss.
+// a volume's SyncMode wins over the policy for whether each write to that volume is synced, but the policy alone decides
+// how a replica is synced, whether Sync and Barrier do anything, and whether parent directories are synced
+type SyncPolicy int
+
+const (
+	// SyncBarrier leaves writes to the OS and syncs every replica when Sync or Barrier is called
+	SyncBarrier SyncPolicy = iota
+	// SyncNone never syncs, Sync and Barrier return straight away
+	SyncNone
+	// SyncData syncs each write's data with fdatasync where the platform has it, as do Sync and Barrier. metadata like
+	// the modification time reaches disk whenever the OS gets to it unless the file relies on it
+	SyncData
+	// SyncDataDir syncs each write along with its metadata, and the parent directory of each replica after it's created,
+	// renamed or removed as WithDirSync does
+	SyncDataDir
+	// SyncWrite syncs each write along with its metadata but leaves the parent directories to the OS, as WithForceSync did
+	SyncWrite
+)
+
+var syncPolicyNames = []string{
+	SyncBarrier: "barrier",
+	SyncNone:    "none",
+	SyncData:    "data",
+	SyncDataDir: "data+dir",
+	SyncWrite:   "write",
+}
+
+func (p SyncPolicy) String() string {
+	if p < SyncBarrier || p > SyncWrite {
+		return fmt.Sprintf("SyncPolicy(%d)", int(p))
+	}
+	return syncPolicyNames[p]
+}
+
+// WithSyncPolicy sets how durable writes are when they return, the default is SyncBarrier
+func WithSyncPolicy(p SyncPolicy) FileOption {
+	return func(f *File) error {
+		if p < SyncBarrier || p > SyncWrite {
+			return fmt.Errorf("unknown sync policy %d: %w", p, os.ErrInvalid)
+		}
+		f.syncPolicy = p
+		return nil
+	}
+}
+
+// syncReplica syncs replica i, leaving out the metadata which isn't needed to read it back unless the file relies on it
+func (f *File) syncReplica(i int) error {
+	if f.needsMetadata() {
+		return f.multi[i].Sync()
+	}
+	return datasync(f.multi[i])
+}
+
+// needsMetadata reports whether replica mod times have to survive a power loss. only SyncData settles for the data alone,
+// and even then the digest and hash sidecars, which are matched to a replica by its size and mod time, and the
+// quorum fail policies which pick a replica by when it was written depend on them
+func (f *File) needsMetadata() bool {
+	return f.syncPolicy != SyncData || f.verifiedReads || f.hashCache || f.quorumFail == QFWriteFirst || f.quorumFail == QFWriteLast
+}
@@ -0,0 +1,24 @@
+package haraqafs
+
+import (
+	"os"
+	"syscall"
+)
+
+// datasync flushes the data of file and only the metadata needed to read it back
+func datasync(file *os.File) error {
+	conn, err := file.SyscallConn()
+	if err == nil {
+		cErr := conn.Control(func(fd uintptr) {
+			err = syscall.Fdatasync(int(fd))
+		})
+		if cErr != nil {
+			// a closed file reports it the way Sync does
+			return file.Sync()
+		}
+	}
+	if err != nil {
+		return &os.PathError{Op: "fdatasync", Path: file.Name(), Err: err}
+	}
+	return nil
+}
@@ -0,0 +1,11 @@
+//go:build !linux && !netbsd
+// +build !linux,!netbsd
+
+package haraqafs
+
+import "os"
+
+// datasync falls back to a full sync where there's no fdatasync
+func datasync(file *os.File) error {
+	return file.Sync()
+}
@@ -0,0 +1,108 @@
+package haraqafs
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWithSyncPolicy(t *testing.T) {
+	volumes := newTmpVolumes(t, 2)
+	defer removeVolumes(volumes)
+
+	for _, p := range []SyncPolicy{SyncBarrier, SyncNone, SyncData, SyncDataDir, SyncWrite} {
+		for _, opts := range [][]FileOption{nil, {WithReplicaTimeout(time.Second)}} {
+			f, err := New("my_file", append(opts, WithVolumes(volumes...), WithCreate(), WithSyncPolicy(p))...)
+			checkErr(t, err)
+			if f.shouldSync(0) != (p == SyncData || p == SyncDataDir || p == SyncWrite) {
+				t.Fatal(p, "syncs writes", f.shouldSync(0))
+			}
+			if f.Status().ForceSync != (p == SyncDataDir || p == SyncWrite) {
+				t.Fatal(p, "reported as force sync")
+			}
+			checkWrite(t, f, []byte("hello world"))
+			checkErr(t, f.Barrier())
+			if s := f.String(); p == SyncBarrier && strings.Contains(s, "sync=") || p != SyncBarrier && !strings.Contains(s, "sync="+p.String()) {
+				t.Fatal(s)
+			}
+			checkClose(t, f)
+		}
+	}
+	// a volume's sync mode wins over the policy for its writes
+	for _, p := range []SyncPolicy{SyncBarrier, SyncNone, SyncData, SyncDataDir, SyncWrite} {
+		f, err := New("my_file", WithVolumeSpecs(Volume{Path: volumes[0], Sync: SyncAlways}, Volume{Path: volumes[1], Sync: SyncNever}), WithSyncPolicy(p))
+		checkErr(t, err)
+		if !f.shouldSync(0) || f.shouldSync(1) {
+			t.Fatal(p, f.shouldSync(0), f.shouldSync(1))
+		}
+		checkClose(t, f)
+	}
+	if _, err := New("my_file", WithVolumes(volumes...), WithSyncPolicy(SyncWrite+1)); !errors.Is(err, os.ErrInvalid) {
+		t.Fatal(err)
+	}
+
+	// the old switch maps onto the policies
+	f := &File{}
+	checkErr(t, WithForceSync(true)(f))
+	if f.syncPolicy != SyncWrite {
+		t.Fatal(f.syncPolicy)
+	}
+	checkErr(t, WithForceSync(false)(f))
+	if f.syncPolicy != SyncBarrier {
+		t.Fatal(f.syncPolicy)
+	}
+
+	fsys, err := ParseConfig(strings.NewReader(`{"volumes": [{"path": "` + volumes[0] + `"}], "sync_policy": "data+dir"}`))
+	checkErr(t, err)
+	f, err = fsys.New("my_file", WithCreate())
+	checkErr(t, err)
+	if f.syncPolicy != SyncDataDir {
+		t.Fatal(f.syncPolicy)
+	}
+	checkClose(t, f)
+	if _, err = ParseConfig(strings.NewReader(`{"volumes": [{"path": "/tmp"}], "sync_policy": "sometimes"}`)); !errors.Is(err, os.ErrInvalid) {
+		t.Fatal(err)
+	}
+	if _, err = ParseConfig(strings.NewReader(`{"volumes": [{"path": "/tmp"}], "force_sync": true, "sync_policy": "none"}`)); !errors.Is(err, os.ErrInvalid) {
+		t.Fatal(err)
+	}
+	_, err = ParseConfig(strings.NewReader(`{"volumes": [{"path": "/tmp"}], "force_sync": true, "sync_policy": "write"}`))
+	checkErr(t, err)
+}
+
+func TestDatasync(t *testing.T) {
+	volumes := newTmpVolumes(t, 1)
+	defer removeVolumes(volumes)
+
+	f, err := New("my_file", WithVolumes(volumes...), WithCreate())
+	checkErr(t, err)
+	checkWrite(t, f, []byte("hello world"))
+	checkErr(t, datasync(f.multi[0]))
+	checkClose(t, f)
+	if err = datasync(f.multi[0]); !errors.Is(err, os.ErrClosed) {
+		t.Fatal(err)
+	}
+
+	// mod times can only be left behind with SyncData, and only when nothing relies on them
+	for _, c := range []struct {
+		opts []FileOption
+		want bool
+	}{
+		{nil, true},
+		{[]FileOption{WithSyncPolicy(SyncData)}, false},
+		{[]FileOption{WithSyncPolicy(SyncDataDir)}, true},
+		{[]FileOption{WithSyncPolicy(SyncData), WithQuorumFail(QFWriteLast)}, true},
+		{[]FileOption{WithSyncPolicy(SyncData), WithHashCache()}, true},
+		{[]FileOption{WithSyncPolicy(SyncData), WithVerifiedReads()}, true},
+	} {
+		f := &File{}
+		for _, opt := range c.opts {
+			checkErr(t, opt(f))
+		}
+		if f.needsMetadata() != c.want {
+			t.Fatal(c.opts, f.needsMetadata())
+		}
+	}
+}
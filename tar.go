@@ -0,0 +1,195 @@
+package haraqafs
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ExportTar streams the subtree at root into a tar archive. every block of every file is read from all of its replicas
+// and only written once a quorum of them agree, so the archive never holds data a minority of replicas made up
+func (fsys *FS) ExportTar(w io.Writer, root string) error {
+	tw := tar.NewWriter(w)
+	if err := fsys.exportDir(tw, root, ""); err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+// walk calls fn for every directory and regular file under root agreed on by a quorum, with slash separated names relative to root
+func (fsys *FS) walk(root, rel string, fn func(name string, isDir bool) error) error {
+	d, err := OpenDir(filepath.Join(root, filepath.FromSlash(rel)), fsys.opts...)
+	if err != nil {
+		return err
+	}
+	entries, err := d.ReadDir(-1)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		name := path.Join(rel, e.Name())
+		switch {
+		case e.IsDir():
+			if err = fn(name, true); err != nil {
+				return err
+			}
+			if err = fsys.walk(root, name, fn); err != nil {
+				return err
+			}
+		case e.Type().IsRegular():
+			if err = fn(name, false); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (fsys *FS) exportDir(tw *tar.Writer, root, rel string) error {
+	return fsys.walk(root, rel, func(name string, isDir bool) error {
+		if isDir {
+			return tw.WriteHeader(&tar.Header{Typeflag: tar.TypeDir, Name: name + "/", Mode: 0755})
+		}
+		return fsys.exportFile(tw, root, name)
+	})
+}
+
+func (fsys *FS) exportFile(tw *tar.Writer, root, name string) error {
+	f, err := fsys.New(filepath.Join(root, filepath.FromSlash(name)), WithReadOnly())
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.stat()
+	if err != nil {
+		return err
+	}
+	err = tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Mode:     int64(info.Mode().Perm()),
+		Size:     f.size,
+		ModTime:  info.ModTime(),
+	})
+	if err != nil {
+		return err
+	}
+	if err = f.copyQuorum(tw); err != nil {
+		return fmt.Errorf("export %s: %w", name, err)
+	}
+	return nil
+}
+
+// copyQuorum writes the whole file to w, reading each block from every replica and only using it once a quorum agree
+func (f *File) copyQuorum(w io.Writer) error {
+	buf := make([]byte, 1e6)
+	for off := int64(0); off < f.size; {
+		n := int64(len(buf))
+		if f.size-off < n {
+			n = f.size - off
+		}
+		m, err := f.ReadAtWithQuorum(buf[:n], off, f.writeQuorum())
+		if int64(m) < n {
+			if err == nil || errors.Is(err, io.EOF) {
+				err = io.ErrUnexpectedEOF
+			}
+			return err
+		}
+		if _, err = w.Write(buf[:m]); err != nil {
+			return err
+		}
+		off += int64(m)
+	}
+	return nil
+}
+
+// stat returns the info of the first usable replica in read order
+func (f *File) stat() (os.FileInfo, error) {
+	err := errMissingReplica
+	for _, i := range f.readOrder {
+		if !f.usable(i) {
+			continue
+		}
+		var info os.FileInfo
+		if info, err = f.multi[i].Stat(); err == nil {
+			return info, nil
+		}
+	}
+	return nil, err
+}
+
+// ImportTar writes every directory and regular file in the archive under root, replacing files which already exist
+func (fsys *FS) ImportTar(r io.Reader, root string) error {
+	tr := tar.NewReader(r)
+	made := make(map[string]bool)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		name := path.Clean(hdr.Name)
+		if path.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") {
+			return fmt.Errorf("tar entry %s escapes the root: %w", hdr.Name, os.ErrInvalid)
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			err = fsys.mkdirAll(root, name, made)
+		case tar.TypeReg:
+			if err = fsys.mkdirAll(root, path.Dir(name), made); err == nil {
+				err = fsys.importFile(tr, filepath.Join(root, filepath.FromSlash(name)), os.FileMode(hdr.Mode).Perm())
+			}
+		default:
+			err = fmt.Errorf("unsupported tar entry %s: %w", hdr.Name, os.ErrInvalid)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// mkdirAll creates dir and its parents on every volume, remembering what it made so each directory is only opened once
+func (fsys *FS) mkdirAll(root, dir string, made map[string]bool) error {
+	if made[dir] {
+		return nil
+	}
+	if dir != "." {
+		if err := fsys.mkdirAll(root, path.Dir(dir), made); err != nil {
+			return err
+		}
+	}
+	opts := append(append([]FileOption(nil), fsys.opts...), WithCreate())
+	if _, err := OpenDir(filepath.Join(root, filepath.FromSlash(dir)), opts...); err != nil {
+		return err
+	}
+	made[dir] = true
+	return nil
+}
+
+func (fsys *FS) importFile(r io.Reader, name string, perm os.FileMode) error {
+	f, err := fsys.New(name, WithCreate())
+	if err != nil {
+		return err
+	}
+	if err = f.Truncate(0); err == nil {
+		_, err = io.Copy(f, r)
+	}
+	if err == nil {
+		err = f.Chmod(perm)
+	}
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		return fmt.Errorf("import %s: %w", name, err)
+	}
+	return nil
+}
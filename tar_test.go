@@ -0,0 +1,41 @@
+package haraqafs
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestExportImportTar(t *testing.T) {
+	volumes := newTmpVolumes(t, 3)
+	defer removeVolumes(volumes)
+	for _, v := range volumes {
+		checkErr(t, os.MkdirAll(filepath.Join(v, "root", "sub"), 0755))
+		checkErr(t, os.WriteFile(filepath.Join(v, "root", "a"), []byte("hello"), 0644))
+		checkErr(t, os.WriteFile(filepath.Join(v, "root", "sub", "b"), []byte("world"), 0600))
+	}
+	// a minority replica with different content doesn't make it into the archive
+	checkErr(t, os.WriteFile(filepath.Join(volumes[0], "root", "a"), []byte("jello"), 0644))
+
+	var buf bytes.Buffer
+	checkErr(t, NewFS(WithVolumes(volumes...)).ExportTar(&buf, "root"))
+
+	into := newTmpVolumes(t, 2)
+	defer removeVolumes(into)
+	checkErr(t, NewFS(WithVolumes(into...)).ImportTar(&buf, "copy"))
+	for _, v := range into {
+		for name, want := range map[string]string{"a": "hello", "sub/b": "world"} {
+			b, err := os.ReadFile(filepath.Join(v, "copy", filepath.FromSlash(name)))
+			checkErr(t, err)
+			if string(b) != want {
+				t.Fatal(name, string(b))
+			}
+		}
+		info, err := os.Stat(filepath.Join(v, "copy", "sub", "b"))
+		checkErr(t, err)
+		if info.Mode().Perm() != 0600 {
+			t.Fatal(info.Mode())
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package haraqafs
+
+import (
+	"fmt"
+	"os"
+)
+
+// Tier returns an FS which only places files on the volumes of tier, picked by their Volume.Tier. a ring is narrowed
+// to the tier's volumes, placing each file on as many of them as before
+func (fsys *FS) Tier(tier string) (*FS, error) {
+	f := &File{}
+	if err := applyScratch(f, fsys.opts); err != nil {
+		return nil, err
+	}
+	var specs []Volume
+	var volumes []string
+	for _, spec := range f.specs {
+		if spec.Tier == tier {
+			specs = append(specs, spec)
+			volumes = append(volumes, spec.Path)
+		}
+	}
+	if len(specs) == 0 {
+		return nil, fmt.Errorf("no volumes in tier %q: %w", tier, os.ErrInvalid)
+	}
+	opts := append(fsys.opts[:len(fsys.opts):len(fsys.opts)], WithVolumeSpecs(specs...))
+	if f.ring != nil {
+		r, err := NewRing(f.ring.vnodes, volumes...)
+		if err != nil {
+			return nil, err
+		}
+		if f.ringReplicas > len(volumes) {
+			return nil, fmt.Errorf("tier %q has %d volumes, fewer than %d replicas: %w", tier, len(volumes), f.ringReplicas, os.ErrInvalid)
+		}
+		opts = append(opts, WithRing(r, f.ringReplicas))
+	}
+	return &FS{opts: opts, newHash: fsys.newHash, stats: fsys.stats, jail: fsys.jail, account: fsys.account}, nil
+}
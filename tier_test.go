@@ -0,0 +1,57 @@
+package haraqafs
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestTier(t *testing.T) {
+	volumes := newTmpVolumes(t, 4)
+	defer removeVolumes(volumes)
+
+	c := Config{Quorum: 1}
+	for i, v := range volumes {
+		tier := "ssd"
+		if i%2 == 1 {
+			tier = "hdd"
+		}
+		c.Volumes = append(c.Volumes, Volume{Path: v, Tier: tier})
+	}
+	fsys, err := c.FS()
+	checkErr(t, err)
+	hdd, err := fsys.Tier("hdd")
+	checkErr(t, err)
+	f, err := hdd.New("my_file", WithCreate())
+	checkErr(t, err)
+	if len(f.volumes) != 2 || f.volumes[0] != volumes[1] || f.volumes[1] != volumes[3] || f.spec(1).Tier != "hdd" {
+		t.Fatal(f.volumes)
+	}
+	checkClose(t, f)
+	if _, err = fsys.Tier("tape"); !errors.Is(err, os.ErrInvalid) {
+		t.Fatal(err)
+	}
+
+	// rings are narrowed to the tier
+	c.Ring = &RingConfig{VirtualNodes: 8, Replicas: 2}
+	fsys, err = c.FS()
+	checkErr(t, err)
+	ssd, err := fsys.Tier("ssd")
+	checkErr(t, err)
+	for _, name := range []string{"a", "b", "c", "d"} {
+		f, err = ssd.New(name, WithCreate())
+		checkErr(t, err)
+		for i := range f.volumes {
+			if f.volumes[i] != volumes[0] && f.volumes[i] != volumes[2] {
+				t.Fatal(f.volumes)
+			}
+		}
+		checkClose(t, f)
+	}
+	c.Ring.Replicas = 3
+	fsys, err = c.FS()
+	checkErr(t, err)
+	if _, err = fsys.Tier("ssd"); !errors.Is(err, os.ErrInvalid) {
+		t.Fatal(err)
+	}
+}
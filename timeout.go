@@ -0,0 +1,121 @@
+package haraqafs
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+type replicaResult struct {
+	i     int
+	write time.Duration
+	sync  time.Duration
+	err   error
+}
+
+// writeAtTimeout writes to every usable replica concurrently, once quorum is met replicas slower than the timeout are marked dirty and abandoned.
+// replicas which fail are marked dirty as long as a quorum can still succeed, otherwise every replica's error is returned
+func (f *File) writeAtTimeout(b []byte, offset int64) error {
+	// abandoned writes can outlive the call and the file, so they mustn't touch the caller's buffer or the file's pooled slices
+	buf := append([]byte(nil), b...)
+	results := make(chan replicaResult, len(f.multi))
+	pending := make(map[int]bool, len(f.multi))
+	for i := range f.multi {
+		if !f.usable(i) {
+			if f.multi[i] == nil {
+				return fmt.Errorf("write failed on volume %s: %w", f.volumes[i], errMissingReplica)
+			}
+			continue
+		}
+		pending[i] = true
+		sync := f.shouldSync(i)
+		data := !f.needsMetadata()
+		var file writeSyncer = f.multi[i]
+		if f.wrapReplica != nil {
+			file = f.wrapReplica(i, file)
+		}
+		path := f.paths[i]
+		go func(i int, file writeSyncer) {
+			res := replicaResult{i: i}
+			start := time.Now()
+			n, err := file.WriteAt(buf, offset)
+			res.write = time.Since(start)
+			switch {
+			case err != nil:
+				res.err = pathErr("write", path, err)
+			case n != len(buf):
+				res.err = pathErr("write", path, io.ErrShortWrite)
+			case sync:
+				start = time.Now()
+				if replica, ok := file.(*os.File); ok && data {
+					err = datasync(replica)
+				} else {
+					err = file.Sync()
+				}
+				if err != nil {
+					res.err = pathErr("sync", path, err)
+				}
+				res.sync = time.Since(start)
+			}
+			results <- res
+		}(i, file)
+	}
+
+	timer := time.NewTimer(f.replicaTimeout)
+	defer timer.Stop()
+	var done int
+	var failed []error
+	failedAt := make(map[int]error)
+	var timedOut bool
+	for len(pending) > 0 {
+		if timedOut && done >= f.writeQuorum() {
+			break
+		}
+		if done+len(pending) < f.writeQuorum() {
+			return aggErrors(failed)
+		}
+		select {
+		case res := <-results:
+			delete(pending, res.i)
+			f.record(res)
+			if res.err == nil {
+				if err := f.stamp(res.i); err != nil {
+					res.err = pathErr("chtimes", f.paths[res.i], err)
+				}
+			}
+			if res.err != nil {
+				failed = append(failed, res.err)
+				failedAt[res.i] = res.err
+				continue
+			}
+			done++
+		case <-timer.C:
+			timedOut = true
+		}
+	}
+	if done < f.writeQuorum() {
+		return aggErrors(failed)
+	}
+
+	for i, err := range failedAt {
+		f.markDirty(i, err)
+	}
+	// abandon the stragglers, they'll need repair before they can be trusted again
+	for i := range pending {
+		f.markDirty(i, fmt.Errorf("write to %s exceeded %s: %w", f.paths[i], f.replicaTimeout, errReplicaTimeout))
+	}
+	return nil
+}
+
+func (f *File) record(res replicaResult) {
+	f.observeDuration(res.i, opWrite, res.write)
+	if res.sync > 0 {
+		f.observeDuration(res.i, opSync, res.sync)
+	}
+}
+
+type writeSyncer interface {
+	io.WriterAt
+	Sync() error
+}
@@ -0,0 +1,96 @@
+package haraqafs
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+type slowWriter struct {
+	writeSyncer
+	delay time.Duration
+}
+
+func (w slowWriter) WriteAt(b []byte, off int64) (int, error) {
+	time.Sleep(w.delay)
+	return w.writeSyncer.WriteAt(b, off)
+}
+
+// withWrapReplica intercepts the writes to every replica with wrap
+func withWrapReplica(wrap func(i int, w writeSyncer) writeSyncer) FileOption {
+	return func(f *File) error {
+		f.wrapReplica = wrap
+		return nil
+	}
+}
+
+func TestWithReplicaTimeout(t *testing.T) {
+	volumes := newTmpVolumes(t, 3)
+	defer removeVolumes(volumes)
+
+	var events []Event
+	f, err := New("my_file", WithVolumes(volumes...), WithCreate(), WithReplicaTimeout(10*time.Millisecond), withWrapReplica(func(i int, w writeSyncer) writeSyncer {
+		if i == 1 {
+			return slowWriter{writeSyncer: w, delay: time.Second}
+		}
+		return w
+	}), WithEvents(func(e Event) {
+		events = append(events, e)
+	}))
+	checkErr(t, err)
+
+	start := time.Now()
+	checkWrite(t, f, []byte("hello"))
+	if time.Since(start) > 500*time.Millisecond {
+		t.Fatal("write waited on the slow replica")
+	}
+	if f.health[1].state != replicaDirty || len(events) != 1 || events[0].Kind != EventDirty {
+		t.Fatal(f.health[1].state, events)
+	}
+
+	// further writes skip the dirty replica
+	start = time.Now()
+	checkWrite(t, f, []byte("hello"))
+	if time.Since(start) > 500*time.Millisecond {
+		t.Fatal("write waited on the dirty replica")
+	}
+	checkSeek(t, f, 0, 0)
+	checkRead(t, f, []byte("hellohello"))
+	checkClose(t, f)
+}
+
+type failingWriter struct {
+	writeSyncer
+}
+
+func (w failingWriter) WriteAt(b []byte, off int64) (int, error) {
+	return 0, errors.New("disk failed")
+}
+
+func TestWithReplicaTimeoutFailure(t *testing.T) {
+	volumes := newTmpVolumes(t, 3)
+	defer removeVolumes(volumes)
+
+	var failing int
+	f, err := New("my_file", WithVolumes(volumes...), WithCreate(), WithReplicaTimeout(time.Second), WithWriteQuorum(2), withWrapReplica(func(i int, w writeSyncer) writeSyncer {
+		if i < failing {
+			return failingWriter{writeSyncer: w}
+		}
+		return w
+	}))
+	checkErr(t, err)
+
+	// a failed replica is left behind while the quorum still succeeds
+	failing = 1
+	checkWrite(t, f, []byte("hello"))
+	if f.health[0].state != replicaDirty || f.health[1].state != replicaHealthy {
+		t.Fatal(f.health[0].state, f.health[1].state)
+	}
+
+	// the write fails once the quorum can't be reached
+	failing = 2
+	if _, err := f.Write([]byte("hello")); err == nil {
+		t.Fatal("expected the write to fail")
+	}
+	checkClose(t, f)
+}
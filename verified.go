@@ -0,0 +1,123 @@
+package haraqafs
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// readFailCooldown is how long a replica whose read failed is only tried after the others
+const readFailCooldown = 30 * time.Second
+
+// replicaTrust is what reads know about each replica beyond its health
+type replicaTrust struct {
+	verified []uint64 // generation the replica was last checked against the others at, 0 when it wasn't or failed the check
+	failed   []int64  // unix nanoseconds of the replica's last failed read
+	latency  []int64  // moving average read latency in nanoseconds, only kept for ReadFastest
+	turn     uint64   // the last replica a round robin read started on
+}
+
+// trackTrust starts tracking the replicas, every replica left usable after consensus agrees with the source
+func (f *File) trackTrust() {
+	f.trust = replicaTrust{verified: make([]uint64, len(f.multi)), failed: make([]int64, len(f.multi))}
+	if f.strategy == ReadFastest {
+		f.trust.latency = make([]int64, len(f.multi))
+	}
+	gen := f.Generation()
+	for i := range f.multi {
+		if f.usable(i) {
+			f.markVerified(i, gen)
+		}
+	}
+}
+
+// markVerified records replica i as agreeing with the others at generation gen, 0 marks it unverified
+func (f *File) markVerified(i int, gen uint64) {
+	if i < len(f.trust.verified) {
+		atomic.StoreUint64(&f.trust.verified[i], gen)
+	}
+}
+
+func (f *File) verifiedAt(i int) uint64 {
+	if i >= len(f.trust.verified) {
+		return 0
+	}
+	return atomic.LoadUint64(&f.trust.verified[i])
+}
+
+// readFailed records a failed read so replica i is tried last for a while
+func (f *File) readFailed(i int) {
+	if i < len(f.trust.failed) {
+		atomic.StoreInt64(&f.trust.failed[i], time.Now().UnixNano())
+	}
+}
+
+func (f *File) failedRecently(i int) bool {
+	if i >= len(f.trust.failed) {
+		return false
+	}
+	last := atomic.LoadInt64(&f.trust.failed[i])
+	return last != 0 && time.Since(time.Unix(0, last)) < readFailCooldown
+}
+
+// readPlan appends the usable replicas to plan in the order reads should try them: replicas which failed a read recently
+// go last, then higher read weights and more recently verified replicas go first, ties keep the read order.
+// the read strategy then picks which of the replicas that didn't fail goes first
+func (f *File) readPlan(plan []int) []int {
+	if f.strategy == ReadPrimary {
+		for _, i := range f.readOrder {
+			if f.usable(i) && f.trusted(i) {
+				return append(plan, i)
+			}
+		}
+		return plan
+	}
+	for _, i := range f.readOrder {
+		if !f.usable(i) || !f.trusted(i) {
+			continue
+		}
+		plan = append(plan, i)
+		// insertion sort, there are only ever a handful of replicas
+		for k := len(plan) - 1; k > 0 && f.readsBefore(plan[k], plan[k-1]); k-- {
+			plan[k], plan[k-1] = plan[k-1], plan[k]
+		}
+	}
+	return f.spread(plan)
+}
+
+func (f *File) readsBefore(a, b int) bool {
+	if fa, fb := f.failedRecently(a), f.failedRecently(b); fa != fb {
+		return fb
+	}
+	if wa, wb := f.spec(a).ReadWeight, f.spec(b).ReadWeight; wa != wb {
+		return wa > wb
+	}
+	return f.verifiedAt(a) > f.verifiedAt(b)
+}
+
+// WithStrictReads refuses reads with a *StaleReadError when the only replicas left to serve them are dirty,
+// failed verification or missed the latest write, instead of falling back to them
+func WithStrictReads() FileOption {
+	return func(f *File) error {
+		f.strictReads = true
+		return nil
+	}
+}
+
+// trusted reports whether strict reads may use replica i
+func (f *File) trusted(i int) bool {
+	return !f.strictReads || (f.verifiedAt(i) != 0 && !f.lagging(i))
+}
+
+// unservable is the error for a read no replica in the plan could serve
+func (f *File) unservable(off int64, n int) error {
+	if !f.strictReads {
+		return errMissingReplica
+	}
+	e := &StaleReadError{Offset: off, Length: n}
+	for i := range f.multi {
+		if f.multi[i] != nil {
+			e.Replicas = append(e.Replicas, f.paths[i])
+		}
+	}
+	return e
+}
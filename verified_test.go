@@ -0,0 +1,78 @@
+package haraqafs
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadPlan(t *testing.T) {
+	volumes := newTmpVolumes(t, 3)
+	defer removeVolumes(volumes)
+	f, err := New("my_file", WithVolumes(volumes...), WithCreate())
+	checkErr(t, err)
+	defer checkClose(t, f)
+	checkWrite(t, f, []byte("hello"))
+	for _, r := range f.Status().Replicas {
+		if r.Verified == 0 {
+			t.Fatal(r)
+		}
+	}
+	if plan := f.readPlan(nil); len(plan) != 3 || plan[0] != 2 {
+		t.Fatal(plan)
+	}
+
+	// replicas verified more recently are preferred
+	gen := f.Generation()
+	f.markVerified(0, gen+1)
+	if plan := f.readPlan(nil); plan[0] != 0 || plan[1] != 2 {
+		t.Fatal(plan)
+	}
+
+	// a replica whose read failed goes last
+	checkErr(t, f.multi[0].Close())
+	checkSeek(t, f, 0, 0)
+	checkRead(t, f, []byte("hello"))
+	if plan := f.readPlan(nil); plan[0] != 2 || plan[2] != 0 {
+		t.Fatal(plan)
+	}
+	reopened, err := os.OpenFile(f.paths[0], os.O_RDWR, 0)
+	checkErr(t, err)
+	f.multi[0] = reopened
+
+	// a scrub which finds a replica disagreeing takes back its verification
+	checkErr(t, os.WriteFile(filepath.Join(volumes[1], "my_file"), []byte("jello"), 0666))
+	_, err = f.Scrub(context.Background())
+	checkErr(t, err)
+	if f.verifiedAt(1) != 0 || f.verifiedAt(2) == 0 {
+		t.Fatal(f.Status().Replicas)
+	}
+}
+
+func TestWithStrictReads(t *testing.T) {
+	volumes := newTmpVolumes(t, 3)
+	defer removeVolumes(volumes)
+	f, err := New("my_file", WithVolumes(volumes...), WithCreate(), WithStrictReads())
+	checkErr(t, err)
+	defer checkClose(t, f)
+	checkWrite(t, f, []byte("hello"))
+
+	// unverified replicas are skipped while a verified one is left
+	f.markVerified(2, 0)
+	f.markVerified(1, 0)
+	checkSeek(t, f, 0, 0)
+	checkRead(t, f, []byte("hello"))
+
+	f.markDirty(0, errors.New("test"))
+	var sErr *StaleReadError
+	if _, err = f.ReadAt(make([]byte, 5), 0); !errors.As(err, &sErr) || !errors.Is(err, ErrStaleRead) || len(sErr.Replicas) != 3 {
+		t.Fatal(err)
+	}
+
+	// once healed the replicas are verified again
+	checkErr(t, f.Heal())
+	checkSeek(t, f, 0, 0)
+	checkRead(t, f, []byte("hello"))
+}
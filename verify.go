@@ -0,0 +1,195 @@
+package haraqafs
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// VerifyState is the verdict VerifyVolume reaches on one file
+type VerifyState string
+
+const (
+	// VerifyClean files are held with the same content by the volume and every peer
+	VerifyClean VerifyState = "clean"
+	// VerifyMissing files are absent from some peers but agree everywhere they're held
+	VerifyMissing VerifyState = "missing"
+	// VerifyDiverged files have replicas whose content disagrees with the majority
+	VerifyDiverged VerifyState = "diverged"
+	// VerifyCorrupt files have replicas which no longer match their own block checksums
+	VerifyCorrupt VerifyState = "corrupt"
+	// VerifySkipped files are erasure coded, their shards differ by design so they aren't compared
+	VerifySkipped VerifyState = "skipped"
+)
+
+// VerifyReport is what VerifyVolume found, it marshals to JSON for review before a bulk heal
+type VerifyReport struct {
+	Volume string             `json:"volume"`
+	Peers  []string           `json:"peers"`
+	Bytes  int64              `json:"bytes"`
+	Files  []FileVerification `json:"files"`
+}
+
+// FileVerification is the verdict on one file, State is the worst of the problems found.
+// each list names the volumes with that problem
+type FileVerification struct {
+	Name     string      `json:"name"`
+	State    VerifyState `json:"state"`
+	Missing  []string    `json:"missing,omitempty"`
+	Diverged []string    `json:"diverged,omitempty"`
+	Corrupt  []string    `json:"corrupt,omitempty"`
+	Err      string      `json:"error,omitempty"`
+}
+
+// VerifyVolume compares every file on volume with its replicas on peers without repairing anything, reading at most
+// bytesPerSecond across all replicas, 0 leaves it unlimited. sidecars, temporary files and pinned files are skipped
+func VerifyVolume(ctx context.Context, volume string, peers []string, bytesPerSecond int64) (*VerifyReport, error) {
+	volume = filepath.Clean(volume)
+	r := &VerifyReport{Volume: volume, Peers: peers, Files: []FileVerification{}}
+	limiter := newRateLimiter(bytesPerSecond)
+	err := filepath.WalkDir(volume, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		if internalName(d.Name()) || garbage(path, d.Name(), d.IsDir()) {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() || !d.Type().IsRegular() || pinned(path) {
+			return nil
+		}
+		name, err := filepath.Rel(volume, path)
+		if err != nil {
+			return err
+		}
+		if _, _, ok := readShardHeader(path); ok {
+			r.Files = append(r.Files, FileVerification{Name: name, State: VerifySkipped})
+			return nil
+		}
+		volumes := append([]string{volume}, peers...)
+		paths := make([]string, len(volumes))
+		for i := range volumes {
+			paths[i] = filepath.Join(volumes[i], name)
+		}
+		v, n, err := verifyPaths(ctx, name, volumes, paths, limiter)
+		if err != nil {
+			return err
+		}
+		r.Bytes += n
+		r.Files = append(r.Files, v)
+		return nil
+	})
+	return r, err
+}
+
+// verifyPaths reads every replica of name once, hashing its content and checking it against its block checksums
+func verifyPaths(ctx context.Context, name string, volumes, paths []string, limiter *rateLimiter) (FileVerification, int64, error) {
+	v := FileVerification{Name: name, State: VerifyClean}
+	var read int64
+	var errs []error
+	held := make(map[string][]string)
+	for i, vol := range volumes {
+		sum, corrupt, n, err := verifyReplica(ctx, paths[i], limiter)
+		read += n
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+			v.Missing = append(v.Missing, vol)
+			continue
+		case ctx.Err() != nil:
+			return v, read, ctx.Err()
+		case err != nil:
+			errs = append(errs, err)
+			continue
+		}
+		if corrupt {
+			v.Corrupt = append(v.Corrupt, vol)
+		}
+		held[string(sum)] = append(held[string(sum)], vol)
+	}
+
+	// the largest group of identical replicas is taken as the content, ties go to the one holding the volume being verified
+	sums := make([]string, 0, len(held))
+	for sum := range held {
+		sums = append(sums, sum)
+	}
+	sort.Strings(sums)
+	var majority string
+	for _, sum := range sums {
+		vols := held[sum]
+		if len(vols) > len(held[majority]) || (len(vols) == len(held[majority]) && vols[0] == volumes[0]) {
+			majority = sum
+		}
+	}
+	for sum, vols := range held {
+		if sum != majority {
+			v.Diverged = append(v.Diverged, vols...)
+		}
+	}
+	sort.Strings(v.Diverged)
+
+	switch {
+	case len(v.Corrupt) > 0:
+		v.State = VerifyCorrupt
+	case len(v.Diverged) > 0:
+		v.State = VerifyDiverged
+	case len(v.Missing) > 0:
+		v.State = VerifyMissing
+	}
+	if err := aggErrors(errs); err != nil {
+		v.Err = err.Error()
+	}
+	return v, read, nil
+}
+
+// verifyReplica hashes the replica at path, reporting it corrupt when it has an up to date digest sidecar it doesn't match
+func verifyReplica(ctx context.Context, path string, limiter *rateLimiter) (sum []byte, corrupt bool, read int64, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, false, 0, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, false, 0, err
+	}
+	if !info.Mode().IsRegular() {
+		return nil, false, 0, fmt.Errorf("%s is not a regular file: %w", path, os.ErrInvalid)
+	}
+	sums, verified := readDigests(path, info)
+
+	h := sha256.New()
+	buf := make([]byte, digestBlock)
+	for k := 0; ; k++ {
+		if err = ctx.Err(); err != nil {
+			return nil, false, read, err
+		}
+		limiter.wait(len(buf))
+		n, err := io.ReadFull(file, buf)
+		read += int64(n)
+		if n > 0 {
+			h.Write(buf[:n])
+			if verified && k < len(sums) && crc32.Checksum(buf[:n], crcTable) != sums[k] {
+				corrupt = true
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return nil, false, read, err
+		}
+	}
+	return h.Sum(nil), corrupt, read, nil
+}
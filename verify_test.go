@@ -0,0 +1,62 @@
+package haraqafs
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestVerifyVolume(t *testing.T) {
+	volumes := newTmpVolumes(t, 3)
+	defer removeVolumes(volumes)
+
+	checkErr(t, MkdirAll("dir", 0777, WithVolumes(volumes...)))
+	for _, name := range []string{"clean", "missing", "diverged", "corrupt"} {
+		f, err := New(filepath.Join("dir", name), WithVolumes(volumes...), WithCreate(), WithVerifiedReads())
+		checkErr(t, err)
+		checkWrite(t, f, []byte("hello"))
+		checkClose(t, f)
+	}
+	checkErr(t, os.Remove(filepath.Join(volumes[2], "dir", "missing")))
+	checkErr(t, os.WriteFile(filepath.Join(volumes[1], "dir", "diverged"), []byte("other"), 0666))
+	// flip the content without touching the size or mod time the sidecar was written for
+	path := filepath.Join(volumes[0], "dir", "corrupt")
+	info, err := os.Stat(path)
+	checkErr(t, err)
+	checkErr(t, os.WriteFile(path, []byte("jello"), 0666))
+	checkErr(t, os.Chtimes(path, info.ModTime(), info.ModTime()))
+
+	r, err := VerifyVolume(context.Background(), volumes[0], volumes[1:], 1<<20)
+	checkErr(t, err)
+	if len(r.Files) != 4 || r.Bytes != 55 {
+		t.Fatal(r)
+	}
+	want := map[string]VerifyState{"clean": VerifyClean, "missing": VerifyMissing, "diverged": VerifyDiverged, "corrupt": VerifyCorrupt}
+	for _, v := range r.Files {
+		if v.State != want[filepath.Base(v.Name)] {
+			t.Fatal(v)
+		}
+	}
+	b, err := json.Marshal(r)
+	checkErr(t, err)
+	var back VerifyReport
+	checkErr(t, json.Unmarshal(b, &back))
+	if len(back.Files) != 4 || back.Files[0].Name != filepath.Join("dir", "clean") || back.Files[0].State != VerifyClean {
+		t.Fatal(string(b))
+	}
+
+	// nothing was repaired
+	b, err = os.ReadFile(filepath.Join(volumes[1], "dir", "diverged"))
+	checkErr(t, err)
+	if string(b) != "other" {
+		t.Fatal(string(b))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := VerifyVolume(ctx, volumes[0], volumes[1:], 0); err != context.Canceled {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,69 @@
+package haraqafs
+
+import "os"
+
+// SizeWatcher receives the new size of the file whenever a write or truncate through the same handle changes it.
+// a reader which falls behind only sees the latest size, C is closed when the watcher is stopped or the file closed
+type SizeWatcher struct {
+	C <-chan int64
+	c chan int64
+	f *File
+}
+
+// WatchSize registers a watcher for size changes, so consumers can react to the file growing or shrinking without polling Stat
+func (f *File) WatchSize() (*SizeWatcher, error) {
+	if f == nil || len(f.multi) == 0 || f.lock == nil {
+		return nil, os.ErrInvalid
+	}
+	f.watchMu.Lock()
+	defer f.watchMu.Unlock()
+	if f.lock.isClosed() {
+		return nil, os.ErrClosed
+	}
+	c := make(chan int64, 1)
+	w := &SizeWatcher{C: c, c: c, f: f}
+	f.watchers = append(f.watchers, w)
+	return w, nil
+}
+
+// Stop unregisters the watcher and closes C
+func (w *SizeWatcher) Stop() {
+	f := w.f
+	f.watchMu.Lock()
+	defer f.watchMu.Unlock()
+	for i := range f.watchers {
+		if f.watchers[i] == w {
+			f.watchers = append(f.watchers[:i], f.watchers[i+1:]...)
+			close(w.c)
+			return
+		}
+	}
+}
+
+// notifySize tells the watchers about the current size if it changed since they were last told
+func (f *File) notifySize() {
+	f.watchMu.Lock()
+	defer f.watchMu.Unlock()
+	if f.size == f.watchedSize {
+		return
+	}
+	f.watchedSize = f.size
+	for _, w := range f.watchers {
+		// replace a size the reader hasn't picked up yet rather than block the writer
+		select {
+		case <-w.c:
+		default:
+		}
+		w.c <- f.size
+	}
+}
+
+// stopWatchers closes every watcher once the file is closed
+func (f *File) stopWatchers() {
+	f.watchMu.Lock()
+	defer f.watchMu.Unlock()
+	for _, w := range f.watchers {
+		close(w.c)
+	}
+	f.watchers = nil
+}
@@ -0,0 +1,51 @@
+package haraqafs
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestWatchSize(t *testing.T) {
+	volumes := newTmpVolumes(t, 3)
+	defer removeVolumes(volumes)
+
+	f, err := New("my_file", WithVolumes(volumes...), WithCreate())
+	checkErr(t, err)
+	w, err := f.WatchSize()
+	checkErr(t, err)
+	stopped, err := f.WatchSize()
+	checkErr(t, err)
+	stopped.Stop()
+	if _, ok := <-stopped.C; ok {
+		t.Fatal("stopped watcher is open")
+	}
+
+	checkWrite(t, f, []byte("hello"))
+	if size := <-w.C; size != 5 {
+		t.Fatal(size)
+	}
+	// a rewrite in place doesn't change the size
+	_, err = f.WriteAt([]byte("j"), 0)
+	checkErr(t, err)
+	select {
+	case size := <-w.C:
+		t.Fatal(size)
+	default:
+	}
+
+	// sizes the reader missed are coalesced into the latest
+	checkWrite(t, f, []byte(" world"))
+	checkErr(t, f.Truncate(2))
+	if size := <-w.C; size != 2 {
+		t.Fatal(size)
+	}
+
+	checkClose(t, f)
+	if _, ok := <-w.C; ok {
+		t.Fatal("watcher open after close")
+	}
+	if _, err = f.WatchSize(); !errors.Is(err, os.ErrClosed) {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,184 @@
+package haraqafs
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Watermark is how far a replica is known to have kept up with the file, every write and truncate starts a new generation.
+// replicas which dropped off the synchronous path stay at the last generation they saw until they're healed,
+// a zero Generation means the replica never matched consensus since the file was opened
+type Watermark struct {
+	Volume     string `json:"volume"`
+	Path       string `json:"path"`
+	Offset     int64  `json:"offset"`
+	Generation uint64 `json:"generation"`
+}
+
+// Watermarks returns how far each replica has kept up, in volume order, for bounded staleness reads and wait for replication logic
+func (f *File) Watermarks() ([]Watermark, error) {
+	if f == nil || len(f.multi) == 0 || f.lock == nil {
+		return nil, os.ErrInvalid
+	}
+	if err := f.acquireRead(); err != nil {
+		return nil, err
+	}
+	defer f.releaseRead()
+
+	f.markMu.Lock()
+	defer f.markMu.Unlock()
+	marks := make([]Watermark, len(f.paths))
+	for i := range f.paths {
+		marks[i] = Watermark{Volume: f.volumes[i], Path: f.paths[i]}
+		if f.marks != nil {
+			marks[i].Offset = f.marks[i].offset
+			marks[i].Generation = f.marks[i].gen
+		}
+	}
+	return marks, nil
+}
+
+// Generation returns the generation of the latest write or truncate
+func (f *File) Generation() uint64 {
+	if f == nil {
+		return 0
+	}
+	f.markMu.Lock()
+	defer f.markMu.Unlock()
+	return f.gen
+}
+
+type watermark struct {
+	offset int64
+	gen    uint64
+}
+
+// advance starts a new generation, seen by every replica still on the synchronous path.
+// it must be called with the file lock held exclusively
+func (f *File) advance() {
+	f.markMu.Lock()
+	defer f.markMu.Unlock()
+	if f.marks == nil {
+		f.marks = make([]watermark, len(f.multi))
+	}
+	f.gen++
+	for i := range f.multi {
+		if f.usable(i) {
+			f.marks[i] = watermark{offset: f.size, gen: f.gen}
+		}
+	}
+	f.wakeMarks()
+	f.notifySize()
+}
+
+// caughtUp moves replica i to the current generation once it's been repaired
+func (f *File) caughtUp(i int) {
+	f.markMu.Lock()
+	defer f.markMu.Unlock()
+	if f.marks == nil {
+		f.marks = make([]watermark, len(f.multi))
+	}
+	f.marks[i] = watermark{offset: f.size, gen: f.gen}
+	f.markVerified(i, f.gen)
+	f.wakeMarks()
+}
+
+// wakeMarks wakes anyone waiting on the watermarks, it must be called with the mark mutex held
+func (f *File) wakeMarks() {
+	if f.marked != nil {
+		close(f.marked)
+		f.marked = nil
+	}
+}
+
+// WaitForReplication blocks until the file up to offset is on at least n replicas and synced to disk on them,
+// so files written without WithForceSync or with WithReplicaTimeout can still checkpoint with strong guarantees.
+// an n of zero waits for the write quorum, replicas which fell behind only count again once they're healed
+func (f *File) WaitForReplication(ctx context.Context, offset int64, n int) error {
+	if f == nil || len(f.multi) == 0 || f.lock == nil {
+		return os.ErrInvalid
+	}
+	if n == 0 {
+		n = f.writeQuorum()
+	}
+	if n < 0 || n > len(f.multi) {
+		return fmt.Errorf("can't wait for %d of %d replicas: %w", n, len(f.multi), os.ErrInvalid)
+	}
+	for {
+		if f.lock.isClosed() {
+			return os.ErrClosed
+		}
+		f.markMu.Lock()
+		if f.marked == nil {
+			f.marked = make(chan struct{})
+		}
+		wait := f.marked
+		caughtUp := f.replicatedTo(offset)
+		f.markMu.Unlock()
+
+		if len(caughtUp) >= n {
+			ok, err := f.syncReplicated(offset, n)
+			if ok || err != nil {
+				return err
+			}
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-wait:
+		}
+	}
+}
+
+// replicatedTo returns the replicas which have kept up to offset, it must be called with the mark mutex held
+func (f *File) replicatedTo(offset int64) []int {
+	var caughtUp []int
+	for i, m := range f.marks {
+		if m.gen > 0 && m.offset >= offset {
+			caughtUp = append(caughtUp, i)
+		}
+	}
+	return caughtUp
+}
+
+// syncReplicated syncs the replicas which have kept up to offset, reporting false if fewer than n still have
+func (f *File) syncReplicated(offset int64, n int) (bool, error) {
+	if f.mmap {
+		if err := f.Msync(); err != nil {
+			return false, err
+		}
+	}
+	if err := f.acquireRead(); err != nil {
+		return false, err
+	}
+	defer f.releaseRead()
+
+	f.markMu.Lock()
+	caughtUp := f.replicatedTo(offset)
+	f.markMu.Unlock()
+	if len(caughtUp) < n {
+		return false, nil
+	}
+	var errs []error
+	var synced int
+	for _, i := range caughtUp {
+		if f.multi[i] == nil {
+			continue
+		}
+		start := time.Now()
+		err := f.syncReplica(i)
+		f.observe(i, opSync, start)
+		if err != nil {
+			errs = append(errs, pathErr("sync", f.paths[i], err))
+			continue
+		}
+		synced++
+	}
+	if synced < n {
+		return false, aggErrors(append(errs, &SyncQuorumError{Quorum: n, Synced: synced}))
+	}
+	return true, nil
+}
@@ -0,0 +1,100 @@
+package haraqafs
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestWatermarks(t *testing.T) {
+	volumes := newTmpVolumes(t, 3)
+	defer removeVolumes(volumes)
+
+	f, err := New("my_file", WithVolumes(volumes...), WithCreate(), WithQuorum(2))
+	checkErr(t, err)
+	checkWrite(t, f, []byte("hello"))
+
+	checkErr(t, f.acquire())
+	f.markDirty(2, errors.New("gone"))
+	f.lock.unlock()
+	checkWrite(t, f, []byte(" world"))
+
+	marks, err := f.Watermarks()
+	checkErr(t, err)
+	if f.Generation() != 3 || len(marks) != 3 {
+		t.Fatal(f.Generation(), marks)
+	}
+	for i, m := range marks {
+		want := Watermark{Volume: volumes[i], Path: f.paths[i], Offset: 11, Generation: 3}
+		if i == 2 {
+			want.Offset, want.Generation = 5, 2
+		}
+		if m != want {
+			t.Fatal(i, m)
+		}
+	}
+
+	checkErr(t, f.Heal())
+	marks, err = f.Watermarks()
+	checkErr(t, err)
+	if marks[2].Offset != 11 || marks[2].Generation != 3 {
+		t.Fatal(marks[2])
+	}
+	checkClose(t, f)
+	if _, err = f.Watermarks(); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestWaitForReplication(t *testing.T) {
+	volumes := newTmpVolumes(t, 3)
+	defer removeVolumes(volumes)
+
+	f, err := New("my_file", WithVolumes(volumes...), WithCreate(), WithQuorum(2))
+	checkErr(t, err)
+	checkWrite(t, f, []byte("hello"))
+	checkErr(t, f.WaitForReplication(context.Background(), 5, 3))
+
+	checkErr(t, f.acquire())
+	f.markDirty(2, errors.New("gone"))
+	f.lock.unlock()
+	checkWrite(t, f, []byte(" world"))
+	checkErr(t, f.WaitForReplication(context.Background(), 11, 0))
+
+	// the dirty replica only counts once it's healed
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err = f.WaitForReplication(ctx, 11, 3); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatal(err)
+	}
+	done := make(chan error)
+	go func() {
+		done <- f.WaitForReplication(context.Background(), 11, 3)
+	}()
+	checkErr(t, f.Heal())
+	checkErr(t, <-done)
+
+	if err = f.WaitForReplication(context.Background(), 0, 4); !errors.Is(err, os.ErrInvalid) {
+		t.Fatal(err)
+	}
+	go func() {
+		done <- f.WaitForReplication(context.Background(), 100, 1)
+	}()
+	checkClose(t, f)
+	if err = <-done; !errors.Is(err, os.ErrClosed) {
+		t.Fatal(err)
+	}
+
+	// replicas which caught up but can't be synced don't count either
+	f, err = New("my_file", WithVolumes(volumes...), WithQuorum(2))
+	checkErr(t, err)
+	checkWrite(t, f, []byte("hello"))
+	checkErr(t, f.multi[0].Close())
+	var qErr *SyncQuorumError
+	if err = f.WaitForReplication(context.Background(), 5, 3); !errors.As(err, &qErr) || qErr.Synced != 2 {
+		t.Fatal(err)
+	}
+	_ = f.Close()
+}